@@ -0,0 +1,61 @@
+package data
+
+import (
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/spf13/cobra"
+	"github.com/wminshew/emrysclient/pkg/dataset"
+	"github.com/wminshew/emrysclient/pkg/token"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+func init() {
+	Cmd.AddCommand(pushCmd)
+	Cmd.AddCommand(lsCmd)
+	Cmd.AddCommand(rmCmd)
+	Cmd.AddCommand(tagCmd)
+	Cmd.AddCommand(statusCmd)
+	Cmd.AddCommand(pruneCmd)
+}
+
+// Cmd exports data subcommand to root
+var Cmd = &cobra.Command{
+	Use:   "data",
+	Short: "Manage datasets & project data",
+	Long: "Push, list, remove & tag named datasets, which any job can use " +
+		"with --dataset name[@version]. Versions share unchanged files, so " +
+		"pushing a new version only uploads what changed. Status & prune " +
+		"manage the data synced for a project by emrys run" +
+		"\n\nReport bugs to support@emrys.io or with the feedback subcommand",
+}
+
+// newClient returns a dataset client authorized with the user's saved token
+func newClient() (*dataset.Client, url.URL, error) {
+	authToken, err := token.Get()
+	if err != nil {
+		return nil, url.URL{}, fmt.Errorf("retrieving authToken: %v", err)
+	}
+	claims := &jwt.StandardClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(authToken, claims); err != nil {
+		return nil, url.URL{}, fmt.Errorf("parsing authToken: %v", err)
+	}
+	if err := claims.Valid(); err != nil {
+		return nil, url.URL{}, fmt.Errorf("invalid authToken: %v: please login again", err)
+	}
+	refreshAt := time.Unix(claims.ExpiresAt, 0).Add(token.RefreshBuffer)
+	if refreshAt.Before(time.Now()) {
+		return nil, url.URL{}, fmt.Errorf("token too close to expiration, please login again")
+	}
+
+	c := &dataset.Client{
+		AuthToken: authToken,
+		Client:    &http.Client{},
+	}
+	u := url.URL{
+		Scheme: "https",
+		Host:   "api.emrys.io",
+	}
+	return c, u, nil
+}
@@ -0,0 +1,75 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+	"github.com/wminshew/emrysclient/pkg/dataset"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+var lsCmd = &cobra.Command{
+	Use:   "ls [name]",
+	Short: "List datasets, or the versions of one",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c, u, err := newClient()
+		if err != nil {
+			log.Printf("Data: %v", err)
+			return
+		}
+		ctx := context.Background()
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		if len(args) == 0 {
+			datasets, err := c.List(ctx, u)
+			if err != nil {
+				log.Printf("Data: error listing datasets: %v", err)
+				return
+			}
+			fmt.Fprintln(tw, "NAME\tVERSIONS\tLATEST\tTAGS")
+			for _, d := range datasets {
+				latest := ""
+				if len(d.Versions) > 0 {
+					latest = d.Versions[len(d.Versions)-1].Version
+				}
+				fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", d.Name, len(d.Versions), latest, strings.Join(sortedTags(d.Tags), ","))
+			}
+		} else {
+			if err := dataset.ValidateName(args[0]); err != nil {
+				log.Printf("Data: %v", err)
+				return
+			}
+			d, err := c.Get(ctx, u, args[0])
+			if err != nil {
+				log.Printf("Data: error getting %s: %v", args[0], err)
+				return
+			}
+			tagsByVersion := make(map[string][]string)
+			for _, tag := range sortedTags(d.Tags) {
+				tagsByVersion[d.Tags[tag]] = append(tagsByVersion[d.Tags[tag]], tag)
+			}
+			fmt.Fprintln(tw, "VERSION\tFILES\tSIZE\tCREATED\tTAGS")
+			for _, v := range d.Versions {
+				fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", v.Version, v.Files, humanize.Bytes(uint64(v.Size)),
+					humanize.Time(v.Created), strings.Join(tagsByVersion[v.Version], ","))
+			}
+		}
+		if err := tw.Flush(); err != nil {
+			log.Printf("Data: error writing list: %v", err)
+		}
+	},
+}
+
+func sortedTags(tags map[string]string) []string {
+	sorted := []string{}
+	for tag := range tags {
+		sorted = append(sorted, tag)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
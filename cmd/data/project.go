@@ -0,0 +1,80 @@
+package data
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/wminshew/emrys/pkg/validate"
+	"github.com/wminshew/emrysclient/pkg/job"
+	"log"
+	"net/url"
+	"os"
+)
+
+// addProjectFlags adds the flags selecting a project & its data directory, as in emrys run
+func addProjectFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("config", "c", ".emrys", "Path to config file (don't include extension). Defaults to .emrys")
+	cmd.Flags().StringP("project", "p", "", "User project (required)")
+	cmd.Flags().StringP("data", "d", "", "Path to the data directory (required)")
+	cmd.PreRun = func(cmd *cobra.Command, args []string) {
+		if err := func() error {
+			if err := viper.BindPFlag("config", cmd.Flags().Lookup("config")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("user.project", cmd.Flags().Lookup("project")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("user.data", cmd.Flags().Lookup("data")); err != nil {
+				return err
+			}
+			return nil
+		}(); err != nil {
+			log.Printf("Data: error binding pflag: %v", err)
+			panic(err)
+		}
+	}
+}
+
+// projectJob returns a job for the configured project & data directory, which the project's
+// data sync is managed through
+func projectJob() (*job.Job, url.URL, error) {
+	viper.SetConfigName(viper.GetString("config"))
+	viper.AddConfigPath(".")
+	viper.AddConfigPath("$HOME/.config/emrys")
+	viper.AddConfigPath("$HOME")
+	if err := viper.ReadInConfig(); err != nil {
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+			return nil, url.URL{}, fmt.Errorf("reading config file: %v", err)
+		}
+	}
+
+	j := &job.Job{
+		Project: viper.GetString("user.project"),
+		Data:    viper.GetString("user.data"),
+	}
+	if j.Project == "" {
+		return nil, url.URL{}, fmt.Errorf("must specify a project in config or with flag")
+	}
+	projectRegexp := validate.ProjectRegexp()
+	if !projectRegexp.MatchString(j.Project) {
+		return nil, url.URL{}, fmt.Errorf("project (%s) must satisfy regex constraints: %s", j.Project, projectRegexp)
+	}
+	if j.Data == "" {
+		return nil, url.URL{}, fmt.Errorf("must specify a data directory in config or with flag")
+	} else if job.IsDataURL(j.Data) {
+		return nil, url.URL{}, fmt.Errorf("data (%s) is a remote data set, which isn't synced: its lockfile pins it", j.Data)
+	}
+	if info, err := os.Stat(j.Data); err != nil {
+		return nil, url.URL{}, err
+	} else if !info.IsDir() {
+		return nil, url.URL{}, fmt.Errorf("data (%s) isn't a directory", j.Data)
+	}
+
+	c, u, err := newClient()
+	if err != nil {
+		return nil, url.URL{}, err
+	}
+	j.AuthToken = c.AuthToken
+	j.Client = c.Client
+	return j, u, nil
+}
@@ -0,0 +1,85 @@
+package data
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+	"log"
+	"os"
+	"strings"
+)
+
+func init() {
+	addProjectFlags(pruneCmd)
+	pruneCmd.Flags().BoolP("dry-run", "n", false, "List the files that would be removed, without asking to remove them")
+	pruneCmd.Flags().BoolP("yes", "y", false, "Remove the files without asking for confirmation")
+	pruneCmd.Flags().SortFlags = false
+}
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove a project's remote data files that no longer exist locally",
+	Long: "List the data files the server holds for a project that are no " +
+		"longer in its data directory, then remove them once confirmed. Without " +
+		"--yes, prune only lists them unless run from a terminal",
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			log.Printf("Data: error reading dry-run: %v", err)
+			return
+		}
+		yes, err := cmd.Flags().GetBool("yes")
+		if err != nil {
+			log.Printf("Data: error reading yes: %v", err)
+			return
+		}
+		j, u, err := projectJob()
+		if err != nil {
+			log.Printf("Data: %v", err)
+			return
+		}
+
+		ctx := context.Background()
+		stale, err := j.StaleData(ctx, u)
+		if err != nil {
+			log.Printf("Data: error listing stale files: %v", err)
+			return
+		}
+		for _, p := range stale {
+			fmt.Printf("would remove: %s\n", p)
+		}
+		log.Printf("Data: would remove %d file(s) from project %s\n", len(stale), j.Project)
+		if dryRun || len(stale) == 0 {
+			return
+		}
+		if !yes {
+			if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+				log.Printf("Data: rerun with --yes to remove them\n")
+				return
+			} else if !confirm(fmt.Sprintf("Remove %d file(s) from project %s?", len(stale), j.Project)) {
+				log.Printf("Data: nothing removed\n")
+				return
+			}
+		}
+
+		if err := j.PruneData(ctx, u, stale); err != nil {
+			log.Printf("Data: error pruning: %v", err)
+			return
+		}
+		log.Printf("Data: removed %d file(s) from project %s\n", len(stale), j.Project)
+	},
+}
+
+// confirm asks the user question on the terminal, returning true if they answer yes
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
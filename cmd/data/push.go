@@ -0,0 +1,66 @@
+package data
+
+import (
+	"context"
+	"github.com/spf13/cobra"
+	"github.com/wminshew/emrysclient/pkg/dataset"
+	"log"
+	"os"
+)
+
+func init() {
+	pushCmd.Flags().StringP("tag", "t", "", "Tag the pushed version, e.g. stable")
+}
+
+var pushCmd = &cobra.Command{
+	Use:   "push <name> <dir>",
+	Short: "Push a directory as a new version of a dataset",
+	Long: "Push a directory as a new version of a dataset, creating the " +
+		"dataset if needed. Only files the server doesn't already hold are uploaded",
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		name, dir := args[0], args[1]
+		if err := dataset.ValidateName(name); err != nil {
+			log.Printf("Data: %v", err)
+			return
+		}
+		tag, err := cmd.Flags().GetString("tag")
+		if err != nil {
+			log.Printf("Data: error reading tag: %v", err)
+			return
+		}
+		if tag != "" {
+			if err := dataset.ValidateName(tag); err != nil {
+				log.Printf("Data: invalid tag: %v", err)
+				return
+			}
+		}
+		if info, err := os.Stat(dir); err != nil {
+			log.Printf("Data: %v", err)
+			return
+		} else if !info.IsDir() {
+			log.Printf("Data: %s isn't a directory", dir)
+			return
+		}
+
+		c, u, err := newClient()
+		if err != nil {
+			log.Printf("Data: %v", err)
+			return
+		}
+		ctx := context.Background()
+		version, err := c.Push(ctx, u, name, dir)
+		if err != nil {
+			log.Printf("Data: error pushing %s: %v", name, err)
+			return
+		}
+		ref := dataset.Ref{Name: name, Version: version}
+		if tag != "" {
+			if err := c.Tag(ctx, u, ref, tag); err != nil {
+				log.Printf("Data: error tagging %s as %s: %v", ref, tag, err)
+				return
+			}
+		}
+		log.Printf("Data: pushed %s\n", ref)
+	},
+}
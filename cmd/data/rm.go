@@ -0,0 +1,50 @@
+package data
+
+import (
+	"context"
+	"github.com/spf13/cobra"
+	"github.com/wminshew/emrysclient/pkg/dataset"
+	"log"
+)
+
+func init() {
+	rmCmd.Flags().Bool("all", false, "Remove every version of the dataset")
+}
+
+var rmCmd = &cobra.Command{
+	Use:   "rm <name@version | name --all>",
+	Short: "Remove a version of a dataset, or the whole dataset",
+	Long: "Remove a version of a dataset, or with --all the whole dataset. " +
+		"Files still used by other versions are kept",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ref, err := dataset.ParseRef(args[0])
+		if err != nil {
+			log.Printf("Data: %v", err)
+			return
+		}
+		all, err := cmd.Flags().GetBool("all")
+		if err != nil {
+			log.Printf("Data: error reading all: %v", err)
+			return
+		}
+		if ref.Version == "" && !all {
+			log.Printf("Data: specify a version (%s@v1) or --all to remove every version", ref.Name)
+			return
+		} else if ref.Version != "" && all {
+			log.Printf("Data: can't remove a single version with --all")
+			return
+		}
+
+		c, u, err := newClient()
+		if err != nil {
+			log.Printf("Data: %v", err)
+			return
+		}
+		if err := c.Remove(context.Background(), u, ref); err != nil {
+			log.Printf("Data: error removing %s: %v", ref, err)
+			return
+		}
+		log.Printf("Data: removed %s\n", ref)
+	},
+}
@@ -0,0 +1,62 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"log"
+)
+
+func init() {
+	addProjectFlags(statusCmd)
+	statusCmd.Flags().Bool("remote", false, "Compare to the files the server holds for the project, instead of the last sync")
+	statusCmd.Flags().BoolP("verbose", "v", false, "List unchanged files too")
+	statusCmd.Flags().SortFlags = false
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show how a project's data directory changed since its last sync",
+	Long: "Show the files of a project's data directory added, modified, deleted " +
+		"or unchanged since its last sync, without uploading anything",
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		remote, err := cmd.Flags().GetBool("remote")
+		if err != nil {
+			log.Printf("Data: error reading remote: %v", err)
+			return
+		}
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			log.Printf("Data: error reading verbose: %v", err)
+			return
+		}
+		j, u, err := projectJob()
+		if err != nil {
+			log.Printf("Data: %v", err)
+			return
+		}
+
+		s, err := j.DataStatus(context.Background(), u, remote)
+		if err != nil {
+			log.Printf("Data: error: %v", err)
+			return
+		}
+		for _, p := range s.Added {
+			fmt.Printf("added:     %s\n", p)
+		}
+		for _, p := range s.Modified {
+			fmt.Printf("modified:  %s\n", p)
+		}
+		for _, p := range s.Deleted {
+			fmt.Printf("deleted:   %s\n", p)
+		}
+		if verbose {
+			for _, p := range s.Unchanged {
+				fmt.Printf("unchanged: %s\n", p)
+			}
+		}
+		fmt.Printf("%d added, %d modified, %d deleted, %d unchanged\n",
+			len(s.Added), len(s.Modified), len(s.Deleted), len(s.Unchanged))
+	},
+}
@@ -0,0 +1,57 @@
+package data
+
+import (
+	"context"
+	"github.com/spf13/cobra"
+	"github.com/wminshew/emrysclient/pkg/dataset"
+	"log"
+)
+
+func init() {
+	tagCmd.Flags().BoolP("delete", "d", false, "Delete the tag instead")
+}
+
+var tagCmd = &cobra.Command{
+	Use:   "tag <name[@version]> <tag>",
+	Short: "Tag a version of a dataset",
+	Long: "Tag a version of a dataset (the latest if none is given), so jobs can " +
+		"use it with --dataset name@tag. Tagging moves a tag already in use",
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		ref, err := dataset.ParseRef(args[0])
+		if err != nil {
+			log.Printf("Data: %v", err)
+			return
+		}
+		tag := args[1]
+		if err := dataset.ValidateName(tag); err != nil {
+			log.Printf("Data: invalid tag: %v", err)
+			return
+		}
+		del, err := cmd.Flags().GetBool("delete")
+		if err != nil {
+			log.Printf("Data: error reading delete: %v", err)
+			return
+		}
+
+		c, u, err := newClient()
+		if err != nil {
+			log.Printf("Data: %v", err)
+			return
+		}
+		ctx := context.Background()
+		if del {
+			if err := c.Untag(ctx, u, ref.Name, tag); err != nil {
+				log.Printf("Data: error deleting tag %s: %v", tag, err)
+				return
+			}
+			log.Printf("Data: deleted tag %s of %s\n", tag, ref.Name)
+			return
+		}
+		if err := c.Tag(ctx, u, ref, tag); err != nil {
+			log.Printf("Data: error tagging %s as %s: %v", ref, tag, err)
+			return
+		}
+		log.Printf("Data: tagged %s as %s\n", ref, tag)
+	},
+}
@@ -6,7 +6,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/cenkalti/backoff"
-	docker "github.com/docker/docker/client"
 	"github.com/pkg/errors"
 	"github.com/satori/go.uuid"
 	"github.com/shirou/gopsutil/cpu"
@@ -26,7 +25,7 @@ import (
 )
 
 // MonitorMiner monitors the miner's system and all its workers
-func MonitorMiner(ctx context.Context, client *http.Client, dClient *docker.Client, authToken *string, workers []*worker.Worker, cancelFunc func(), u url.URL) {
+func MonitorMiner(ctx context.Context, client *http.Client, authToken *string, pool *workerPool, images *worker.ImageCache, cancelFunc func(), u url.URL) {
 	defer func() {
 		select {
 		case <-ctx.Done():
@@ -68,10 +67,10 @@ func MonitorMiner(ctx context.Context, client *http.Client, dClient *docker.Clie
 			}
 			stats.Disk = diskUsage
 
-			for _, w := range workers {
+			for _, w := range pool.list() {
 				wStats := &job.WorkerStats{}
-				if w.JobID != "" {
-					if wStats.JobID, err = uuid.FromString(w.JobID); err != nil {
+				if jID := w.JobID(); jID != "" {
+					if wStats.JobID, err = uuid.FromString(jID); err != nil {
 						return errors.Wrapf(err, "device %d: getting uuid from job ID", w.Device)
 					}
 				}
@@ -82,54 +81,58 @@ func MonitorMiner(ctx context.Context, client *http.Client, dClient *docker.Clie
 				}
 
 				// get docker container stats [cpu, mem, disk]
-				if w.ContainerID != "" {
-					containerStats, err := w.Docker.ContainerStats(ctx, w.ContainerID, false)
+				if cID := w.ContainerID(); cID != "" {
+					containerStats, err := w.Runtime.ContainerStats(ctx, cID)
 					if err != nil {
 						return errors.Wrapf(err, "device %d: getting container stats", w.Device)
 					}
-					defer check.Err(containerStats.Body.Close)
+					defer check.Err(containerStats.Close)
 
-					if err := json.NewDecoder(containerStats.Body).Decode(&wStats.DockerStats); err != nil && err != io.EOF {
+					if err := json.NewDecoder(containerStats).Decode(&wStats.DockerStats); err != nil && err != io.EOF {
 						return errors.Wrapf(err, "device %d: decoding container stats", w.Device)
 					}
 
 					// size of image & container
 					wStats.DockerDisk = &job.DockerDisk{}
-					dockerDisk, err := w.Docker.DiskUsage(ctx)
+					containerDisk, err := w.Runtime.ContainerDiskUsage(ctx, cID)
 					if err != nil {
 						return errors.Wrapf(err, "device %d: getting docker disk usage", w.Device)
 					}
-					for _, container := range dockerDisk.Containers {
-						if container.ID == w.ContainerID {
-							wStats.DockerDisk.SizeRw = container.SizeRw
-							wStats.DockerDisk.SizeRootFs = container.SizeRootFs // should be image size
-						}
-					}
+					wStats.DockerDisk.SizeRw = containerDisk.SizeRw
+					wStats.DockerDisk.SizeRootFs = containerDisk.SizeRootFs // should be image size
 
 					// size of data folder
-					wStats.DockerDisk.SizeDataDir, err = worker.GetDirSize(w.DataDir)
+					dataDir, outputDir := w.JobDirs()
+					wStats.DockerDisk.SizeDataDir, err = worker.GetDirSize(dataDir)
 					if err != nil {
 						return errors.Wrap(err, "getting directory size: data folder")
 					}
 
 					// size of output folder
-					wStats.DockerDisk.SizeOutputDir, err = worker.GetDirSize(w.OutputDir)
+					wStats.DockerDisk.SizeOutputDir, err = worker.GetDirSize(outputDir)
 					if err != nil {
 						return errors.Wrap(err, "getting directory size: output folder")
 					}
-
-					// TODO: should be uint64, but keeping check consistent with server
-					if int64(w.Disk) < (wStats.DockerDisk.SizeRw + wStats.DockerDisk.SizeRootFs +
-						wStats.DockerDisk.SizeDataDir + wStats.DockerDisk.SizeOutputDir) {
-						w.DiskQuotaExceeded = true
-					}
 				}
 
 				stats.WorkerStats = append(stats.WorkerStats, wStats)
 			}
 
+			imageCacheStats, err := images.Stats(ctx)
+			if err != nil {
+				return errors.Wrap(err, "getting image cache stats")
+			}
+
+			// image cache stats extend job.MinerStats so the server can prefer miners holding a job's layers
+			minerStats := struct {
+				job.MinerStats
+				ImageCache *worker.ImageCacheStats `json:"image_cache"`
+			}{
+				MinerStats: stats,
+				ImageCache: imageCacheStats,
+			}
 			body := &bytes.Buffer{}
-			if err := json.NewEncoder(body).Encode(&stats); err != nil {
+			if err := json.NewEncoder(body).Encode(&minerStats); err != nil {
 				return err
 			}
 
@@ -0,0 +1,117 @@
+package mine
+
+import (
+	"context"
+	"fmt"
+	"github.com/blang/semver"
+	docker "github.com/docker/docker/client"
+	"github.com/wminshew/emrysclient/pkg/worker"
+	"strings"
+)
+
+const (
+	runtimeDocker       = "docker"
+	runtimePodman       = "podman"
+	runtimeContainerd   = "containerd"
+	defaultPodmanHost   = "unix:///run/podman/podman.sock"
+	installInstructions = "detailed instructions may be found at https://docs.emrys.io/docs/suppliers/installation"
+)
+
+var (
+	minPodmanSemver = semver.Version{
+		Major: 3,
+		Minor: 0,
+		Patch: 0,
+	}
+	minContainerdSemver = semver.Version{
+		Major: 1,
+		Minor: 4,
+		Patch: 0,
+	}
+)
+
+// initRuntime connects to the named container runtime at host (blank for the runtime's default)
+// & verifies it's configured for mining. The returned func releases the runtime's resources
+func initRuntime(ctx context.Context, name, host string) (worker.ContainerRuntime, func() error, error) {
+	switch name {
+	case runtimeDocker, "":
+		dClient, err := initDockerAPI(ctx, host, "dockerd", minDockerServerSemver, "userns")
+		if err != nil {
+			return nil, nil, err
+		}
+		return worker.NewDockerRuntime(dClient), dClient.Close, nil
+	case runtimePodman:
+		if host == "" {
+			host = defaultPodmanHost
+		}
+		// rootless podman maps container users into the invoking user's namespace
+		dClient, err := initDockerAPI(ctx, host, "podman", minPodmanSemver, "rootless", "userns")
+		if err != nil {
+			return nil, nil, err
+		}
+		return worker.NewPodmanRuntime(dClient), dClient.Close, nil
+	case runtimeContainerd:
+		r := worker.NewContainerdRuntime(host)
+		info, err := r.Info(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("getting containerd info: %v", err)
+		}
+		if err := checkRuntimeInfo("containerd", info.ServerVersion, minContainerdSemver, info.SecurityOptions, "rootless", "userns"); err != nil {
+			return nil, nil, err
+		}
+		return r, func() error { return nil }, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown container runtime %s (must be one of %s, %s, or %s)", name, runtimeDocker, runtimePodman, runtimeContainerd)
+	}
+}
+
+// initDockerAPI connects to a docker-compatible api at host & checks its version & user isolation
+func initDockerAPI(ctx context.Context, host, name string, minSemver semver.Version, isolationOpts ...string) (*docker.Client, error) {
+	var dClient *docker.Client
+	var err error
+	if host == "" {
+		dClient, err = docker.NewEnvClient()
+	} else {
+		dClient, err = docker.NewClientWithOpts(docker.FromEnv, docker.WithHost(host), docker.WithAPIVersionNegotiation())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creating %s client: %v", name, err)
+	}
+
+	info, err := dClient.Info(ctx)
+	if err != nil {
+		_ = dClient.Close()
+		return nil, fmt.Errorf("getting %s info: %v", name, err)
+	}
+
+	if err := checkRuntimeInfo(name, info.ServerVersion, minSemver, info.SecurityOptions, isolationOpts...); err != nil {
+		_ = dClient.Close()
+		return nil, err
+	}
+
+	return dClient, nil
+}
+
+// checkRuntimeInfo verifies the runtime is at least minSemver & runs containers with one of isolationOpts
+func checkRuntimeInfo(name, serverVersion string, minSemver semver.Version, securityOptions []string, isolationOpts ...string) error {
+	if serverSemver, err := semver.ParseTolerant(serverVersion); err != nil {
+		return fmt.Errorf("converting %s server version (%s) to semver: %v", name, serverVersion, err)
+	} else if serverSemver.LT(minSemver) {
+		return fmt.Errorf("please upgrade %s before connecting (current: %s, must use at least %s; %s)", name, serverSemver.String(), minSemver.String(), installInstructions)
+	}
+
+	if hasIsolation := func() bool {
+		for _, opt := range securityOptions {
+			for _, isolationOpt := range isolationOpts {
+				if strings.Contains(opt, isolationOpt) {
+					return true
+				}
+			}
+		}
+		return false
+	}(); !hasIsolation {
+		return fmt.Errorf("please run %s with %s before connecting (%s)", name, strings.Join(isolationOpts, " or "), installInstructions)
+	}
+
+	return nil
+}
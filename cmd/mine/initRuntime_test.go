@@ -0,0 +1,42 @@
+package mine
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCheckRuntimeInfo(t *testing.T) {
+	tests := []struct {
+		name            string
+		serverVersion   string
+		securityOptions []string
+		isolationOpts   []string
+		wantErr         string
+	}{
+		{"podman rootless", "4.3.1", []string{"name=seccomp,profile=default", "name=rootless"}, []string{"rootless", "userns"}, ""},
+		{"userns, v-prefixed version", "v4.1.0", []string{"name=userns"}, []string{"rootless", "userns"}, ""},
+		{"minimum version", "3.0.0", []string{"name=rootless"}, []string{"rootless"}, ""},
+		{"too old", "2.2.1", []string{"name=rootless"}, []string{"rootless"}, "please upgrade"},
+		{"unparseable version", "dev", []string{"name=rootless"}, []string{"rootless"}, "converting"},
+		{"no isolation", "4.3.1", []string{"name=seccomp,profile=default"}, []string{"rootless", "userns"}, "rootless or userns"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkRuntimeInfo("runtime", tt.serverVersion, minPodmanSemver, tt.securityOptions, tt.isolationOpts...)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkRuntimeInfo() = %v, want nil", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkRuntimeInfo() = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInitRuntimeUnknown(t *testing.T) {
+	if _, _, err := initRuntime(context.Background(), "lxc", ""); err == nil || !strings.Contains(err.Error(), "unknown container runtime") {
+		t.Errorf("initRuntime(lxc) = %v, want unknown container runtime", err)
+	}
+}
@@ -2,44 +2,28 @@ package mine
 
 import (
 	"context"
-	"encoding/base64"
-	"encoding/json"
-	"fmt"
 	"github.com/blang/semver"
-	"github.com/cenkalti/backoff"
 	"github.com/dgrijalva/jwt-go"
-	"github.com/docker/docker/api/types"
-	docker "github.com/docker/docker/client"
-	"github.com/dustin/go-humanize"
-	"github.com/fsnotify/fsnotify"
-	"github.com/shirou/gopsutil/disk"
-	"github.com/shirou/gopsutil/mem"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/wminshew/emrys/pkg/check"
-	"github.com/wminshew/emrys/pkg/job"
 	"github.com/wminshew/emrysclient/cmd/version"
-	"github.com/wminshew/emrysclient/pkg/poll"
+	"github.com/wminshew/emrysclient/pkg/fakeserver"
+	"github.com/wminshew/emrysclient/pkg/sim"
 	"github.com/wminshew/emrysclient/pkg/token"
 	"github.com/wminshew/emrysclient/pkg/worker"
 	"github.com/wminshew/gonvml"
-	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
-	"path"
-	"strconv"
-	"strings"
 	"time"
 )
 
 var (
-	terminate             = false
-	jobsInProcess         = 0
-	bidsOut               = 0
+	terminate             = make(chan struct{})
 	minDockerServerSemver = semver.Version{
 		Major: 19,
 		Minor: 3,
@@ -64,9 +48,30 @@ func init() {
 	Cmd.Flags().StringP("config", "c", ".emrys", "Path to config file (don't include extension)")
 	Cmd.Flags().StringSliceP("devices", "d", []string{}, "Cuda devices to mine with on emrys. If blank, program will mine with all detected devices.")
 	Cmd.Flags().StringSliceP("bid-rates", "b", []string{}, "Per device bid rates ($/hr) for mining jobs (required; may set 1 value for all devices, or 1 value per device)")
+	Cmd.Flags().StringSlice("bid-strategies", []string{}, "Per device bid strategies (fixed [default], schedule:HH:MM-HH:MM=RATE;..., utilization:MIN-MAX, or script:COMMAND; may set 1 value for all devices, or 1 value per device)")
 	Cmd.Flags().StringSlice("ram", []string{"8gb"}, "Per device RAM allocation for mining jobs (defaults to 8gb; may set 1 value for all devices, or 1 value per device)")
 	Cmd.Flags().StringSlice("disk", []string{"25gb"}, "Per device disk allocation for mining jobs (defaults to 25gb; may set 1 value for all devices, or 1 value per device)")
+	Cmd.Flags().StringSlice("workdir", []string{}, "Per device directory job data & output are kept in while jobs run; disk allocations are checked against its filesystem (defaults to ~/.emrys; may set 1 value for all devices, or 1 value per device)")
 	Cmd.Flags().StringP("mining-command", "m", "", "Mining command to execute between emrys jobs. Must use $DEVICE flag so emrys can toggle mining-per-device correctly between jobs.")
+	Cmd.Flags().StringSlice("bid-schedule", []string{}, "Per device weekly windows (local time) when emrys jobs may be bid on, e.g. 'mon-fri 18:00-08:00; sat-sun 00:00-24:00'. If blank, always bid. (may set 1 value for all devices, or 1 value per device; day lists with commas must be set in the config file)")
+	Cmd.Flags().StringSlice("mining-schedule", []string{}, "Per device weekly windows (local time) when mining-command may run, in the same format as bid-schedule. If blank, always mine between jobs.")
+	Cmd.Flags().Float64("electricity-price", 0, "Cost of electricity ($/kWh); used with mining-revenue to never bid below break-even")
+	Cmd.Flags().StringSlice("mining-revenue", []string{}, "Per device expected revenue ($/hr) of mining-command (may set 1 value for all devices, or 1 value per device)")
+	Cmd.Flags().String("below-break-even", worker.BreakEvenRaise, "What to do with bids below a device's break-even rate: raise them to break-even, or skip the job")
+	Cmd.Flags().StringSlice("pids-limit", []string{}, "Per device limit on processes & threads in job containers (defaults to 4096; 0 is unlimited)")
+	Cmd.Flags().StringSlice("read-only-rootfs", []string{}, "Per device toggle to mount job containers' root filesystem read-only with tmpfs scratch space at /tmp, /var/tmp & /run (defaults to true)")
+	Cmd.Flags().StringSlice("tmpfs-size", []string{}, "Per device size of each tmpfs scratch mount in read-only job containers (defaults to 1gb; 0 uses the runtime's default)")
+	Cmd.Flags().StringSlice("ipc", []string{}, "Per device ipc mode of job containers (private [default], shareable, or none)")
+	Cmd.Flags().StringSlice("seccomp", []string{}, "Per device seccomp profile of job containers (bundled [default], runtime-default, unconfined, or the path to a json profile)")
+	Cmd.Flags().StringSlice("apparmor", []string{}, "Per device apparmor profile of job containers; must be loaded on the host (defaults to the runtime's default profile)")
+	Cmd.Flags().StringSlice("network-policy", []string{}, "Per device network access of job containers: internet-only [default] (blocks the host & private networks), none, or allow:HOST[:PORT];... (may set 1 value for all devices, or 1 value per device; only jobs whose declared network needs fit the policy are bid on)")
+	Cmd.Flags().Duration("output-sync-interval", 5*time.Minute, "Upload new & changed job output this often while jobs run, so users keep their checkpoints if a job fails (0 uploads output only when jobs finish)")
+	Cmd.Flags().String("output-sync-threshold", "1gb", "Upload new job output early once this much is waiting to be uploaded")
+	Cmd.Flags().String("image-cache", "50gb", "Disk budget for keeping job images between jobs so later jobs can reuse their layers (0 removes each job's image when it finishes)")
+	Cmd.Flags().Duration("image-max-age", 7*24*time.Hour, "Remove cached images that haven't been used for this long (0 keeps them until the cache is over budget)")
+	Cmd.Flags().String("runtime", runtimeDocker, "Container runtime to execute jobs with (docker, podman, or containerd)")
+	Cmd.Flags().String("runtime-host", "", "Address of the container runtime's socket (defaults to the runtime's standard location)")
+	Cmd.Flags().Int("simulate", 0, "Simulate mining with this many fake devices against an in-process fake emrys server (no gpu, docker, or account required)")
 	Cmd.Flags().SortFlags = false
 }
 
@@ -91,15 +96,78 @@ var Cmd = &cobra.Command{
 			if err := viper.BindPFlag("miner.bid-rates", cmd.Flags().Lookup("bid-rates")); err != nil {
 				return err
 			}
+			if err := viper.BindPFlag("miner.bid-strategies", cmd.Flags().Lookup("bid-strategies")); err != nil {
+				return err
+			}
 			if err := viper.BindPFlag("miner.ram", cmd.Flags().Lookup("ram")); err != nil {
 				return err
 			}
 			if err := viper.BindPFlag("miner.disk", cmd.Flags().Lookup("disk")); err != nil {
 				return err
 			}
+			if err := viper.BindPFlag("miner.workdir", cmd.Flags().Lookup("workdir")); err != nil {
+				return err
+			}
 			if err := viper.BindPFlag("miner.mining-command", cmd.Flags().Lookup("mining-command")); err != nil {
 				return err
 			}
+			if err := viper.BindPFlag("miner.bid-schedule", cmd.Flags().Lookup("bid-schedule")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("miner.mining-schedule", cmd.Flags().Lookup("mining-schedule")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("miner.electricity-price", cmd.Flags().Lookup("electricity-price")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("miner.mining-revenue", cmd.Flags().Lookup("mining-revenue")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("miner.below-break-even", cmd.Flags().Lookup("below-break-even")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("miner.pids-limit", cmd.Flags().Lookup("pids-limit")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("miner.read-only-rootfs", cmd.Flags().Lookup("read-only-rootfs")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("miner.tmpfs-size", cmd.Flags().Lookup("tmpfs-size")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("miner.ipc", cmd.Flags().Lookup("ipc")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("miner.seccomp", cmd.Flags().Lookup("seccomp")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("miner.apparmor", cmd.Flags().Lookup("apparmor")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("miner.network-policy", cmd.Flags().Lookup("network-policy")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("miner.output-sync-interval", cmd.Flags().Lookup("output-sync-interval")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("miner.output-sync-threshold", cmd.Flags().Lookup("output-sync-threshold")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("miner.image-cache", cmd.Flags().Lookup("image-cache")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("miner.image-max-age", cmd.Flags().Lookup("image-max-age")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("miner.runtime", cmd.Flags().Lookup("runtime")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("miner.runtime-host", cmd.Flags().Lookup("runtime-host")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("miner.simulate", cmd.Flags().Lookup("simulate")); err != nil {
+				return err
+			}
 			return nil
 		}(); err != nil {
 			log.Printf("Mine: error binding pflag: %v", err)
@@ -107,106 +175,114 @@ var Cmd = &cobra.Command{
 		}
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		if os.Geteuid() != 0 {
+		numSimulated := viper.GetInt("miner.simulate")
+		simulate := numSimulated > 0
+		if !simulate && os.Geteuid() != 0 {
 			log.Printf("Insufficient privileges. Are you root?\n")
 			return
 		}
 
-		dClient, err := docker.NewEnvClient()
-		if err != nil {
-			log.Printf("Mine: error creating docker client: %v", err)
-			return
-		}
-		defer check.Err(dClient.Close)
-
-		info, err := dClient.Info(context.Background())
-		if err != nil {
-			log.Printf("Mine: error getting docker info: %v", err)
-			return
-		}
-
-		if dockerServerSemver, err := semver.ParseTolerant(info.ServerVersion); err != nil {
-			log.Printf("Mine: error converting docker server version (%s) to semver: %v", info.ServerVersion, err)
-			return
-		} else if dockerServerSemver.LT(minDockerServerSemver) {
-			log.Printf("Mine: please upgrade dockerd before connecting (current: %s, must use at least %s; detailed instructions may be found at https://docs.emrys.io/docs/suppliers/installation)\n", dockerServerSemver.String(), minDockerServerSemver.String())
-			return
-		}
-
-		if hasUserNS := func() bool {
-			for _, opt := range info.SecurityOptions {
-				if strings.Contains(opt, "userns") {
-					return true
-				}
+		var runtime worker.ContainerRuntime
+		var simGPUs []*sim.GPU
+		if simulate {
+			log.Printf("Mine: simulating %d device(s); no real jobs will be mined\n", numSimulated)
+			for i := 0; i < numSimulated; i++ {
+				simGPUs = append(simGPUs, sim.NewGPU(uint(i)))
 			}
-			return false
-		}(); !hasUserNS {
-			log.Printf("Mine: please add userns-remap to dockerd before connecting (detailed instructions may be found at https://docs.emrys.io/docs/suppliers/installation)\n")
-			return
+			runtime = sim.NewRuntime(simGPUs)
+		} else {
+			var closeRuntime func() error
+			var err error
+			runtime, closeRuntime, err = initRuntime(context.Background(), viper.GetString("miner.runtime"), viper.GetString("miner.runtime-host"))
+			if err != nil {
+				log.Printf("Mine: %v", err)
+				return
+			}
+			defer check.Err(closeRuntime)
 		}
 
 		stop := make(chan os.Signal, 1)
 		signal.Notify(stop, os.Interrupt)
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
-		go monitorInterrupts(ctx, stop, cancel)
 
-		authToken, err := token.Get()
-		if err != nil {
-			log.Printf("Mine: error getting authToken: %v", err)
-			return
-		}
-		claims := &jwt.StandardClaims{}
-		if _, _, err := new(jwt.Parser).ParseUnverified(authToken, claims); err != nil {
-			log.Printf("Mine: error parsing authToken %v: %v\n", authToken, err)
-			return
-		}
-		if err := claims.Valid(); err != nil {
-			log.Printf("Mine: invalid authToken: %v", err)
-			log.Printf("Please login again.\n")
-			return
-		}
-		mID := claims.Subject
-		exp := claims.ExpiresAt
-		refreshAt := time.Unix(exp, 0).Add(token.RefreshBuffer)
-		if refreshAt.Before(time.Now()) {
-			log.Printf("Mine: token too close to expiration, please login again.")
-			return
-		}
+		var authToken, mID string
+		var client *http.Client
+		var u url.URL
+		if simulate {
+			srv := fakeserver.New(&fakeserver.Scenario{
+				PollTimeout:  simPollTimeout,
+				UserVersion:  version.UserVer.String(),
+				MinerVersion: version.MinerVer.String(),
+				Token:        simToken,
+				SSHKey:       []byte(simToken),
+				BaseImages:   simBaseImages,
+			})
+			defer srv.Close()
+			go postSimulatedJobs(ctx, srv)
+			authToken = simToken
+			mID = simMinerID
+			client = srv.Client()
+			u = srv.URL()
+		} else {
+			var err error
+			authToken, err = token.Get()
+			if err != nil {
+				log.Printf("Mine: error getting authToken: %v", err)
+				return
+			}
+			claims := &jwt.StandardClaims{}
+			if _, _, err := new(jwt.Parser).ParseUnverified(authToken, claims); err != nil {
+				log.Printf("Mine: error parsing authToken %v: %v\n", authToken, err)
+				return
+			}
+			if err := claims.Valid(); err != nil {
+				log.Printf("Mine: invalid authToken: %v", err)
+				log.Printf("Please login again.\n")
+				return
+			}
+			mID = claims.Subject
+			exp := claims.ExpiresAt
+			refreshAt := time.Unix(exp, 0).Add(token.RefreshBuffer)
+			if refreshAt.Before(time.Now()) {
+				log.Printf("Mine: token too close to expiration, please login again.")
+				return
+			}
 
-		tr := &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				Timeout:   60 * time.Second,
-				KeepAlive: 60 * time.Second,
-				DualStack: true,
-			}).DialContext,
-			MaxIdleConns:          50,
-			IdleConnTimeout:       60 * time.Second,
-			TLSHandshakeTimeout:   5 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-			DisableCompression:    true,
-		}
-		client := &http.Client{Transport: tr}
-		s := "https"
-		h := "api.emrys.io"
-		u := url.URL{
-			Scheme: s,
-			Host:   h,
-		}
+			tr := &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				DialContext: (&net.Dialer{
+					Timeout:   60 * time.Second,
+					KeepAlive: 60 * time.Second,
+					DualStack: true,
+				}).DialContext,
+				MaxIdleConns:          50,
+				IdleConnTimeout:       60 * time.Second,
+				TLSHandshakeTimeout:   5 * time.Second,
+				ExpectContinueTimeout: 1 * time.Second,
+				DisableCompression:    true,
+			}
+			client = &http.Client{Transport: tr}
+			s := "https"
+			h := "api.emrys.io"
+			u = url.URL{
+				Scheme: s,
+				Host:   h,
+			}
 
-		go func() {
-			for {
-				if err := token.Monitor(ctx, client, u, &authToken, refreshAt); err != nil {
-					log.Printf("Token: refresh error: %v", err)
-				}
-				select {
-				case <-ctx.Done():
-					return
-				default:
+			go func() {
+				for {
+					if err := token.Monitor(ctx, client, u, &authToken, refreshAt); err != nil {
+						log.Printf("Token: refresh error: %v", err)
+					}
+					select {
+					case <-ctx.Done():
+						return
+					default:
+					}
 				}
-			}
-		}()
+			}()
+		}
 
 		if err := version.CheckMine(ctx, client, u); err != nil {
 			log.Printf("Version error: %v", err)
@@ -219,304 +295,74 @@ var Cmd = &cobra.Command{
 		viper.AddConfigPath("$HOME/.config/emrys")
 		viper.AddConfigPath("$HOME")
 		if err := viper.ReadInConfig(); err != nil {
-			log.Printf("Mine: error reading config file: %v", err)
-			return
-		}
-
-		miningCmdStr := viper.GetString("miner.mining-command")
-		if miningCmdStr != "" && !strings.Contains(miningCmdStr, "$DEVICE") {
-			log.Printf("Mine: error: if mining-command is set, it must include $DEVICE")
-			return
-		}
-
-		if err := gonvml.Initialize(); err != nil {
-			log.Printf("Mine: error initializing gonvml: %v. Please make sure NVML is in the shared library search path.", err)
-			return
-		}
-		defer check.Err(gonvml.Shutdown)
-
-		driverVersion, err := gonvml.SystemDriverVersion()
-		if err != nil {
-			log.Printf("Mine: error finding nvidia driver: %v", err)
-			return
-		}
-		if nvidiaDriverSemver, err := semver.ParseTolerant(driverVersion); err != nil {
-			log.Printf("Mine: error converting nvidia driver version (%s) to semver: %v", driverVersion, err)
-			return
-		} else if nvidiaDriverSemver.LT(minNvidiaDriverSemver) {
-			log.Printf("Mine: please upgrade your nvidia driver before connecting (current: %d, must use at least %d; detailed instructions may be found at https://docs.emrys.io/docs/suppliers/installation)\n", nvidiaDriverSemver.Major, minNvidiaDriverSemver.Major)
-			return
-		}
-		log.Printf("Nvidia driver: %v\n", driverVersion)
-
-		devices := []uint{}
-		devicesStr := viper.GetStringSlice("miner.devices")
-		if len(devicesStr) == 0 {
-			// no flag provided, grab all detected devices
-			numDevices, err := gonvml.DeviceCount()
-			if err != nil {
-				log.Printf("Mine: error counting nvidia devices: %v", err)
+			if _, ok := err.(viper.ConfigFileNotFoundError); !ok || !simulate {
+				log.Printf("Mine: error reading config file: %v", err)
 				return
 			}
-			for i := 0; i < int(numDevices); i++ {
-				devices = append(devices, uint(i))
-			}
-		} else {
-			// flag provided, convert to uints
-			for _, s := range devicesStr {
-				u, err := strconv.ParseUint(s, 10, 64)
-				if err != nil {
-					log.Printf("Invalid devices entry %s: %v", s, err)
-					return
-				}
-				devices = append(devices, uint(u))
-			}
 		}
 
-		bidRatesStr := viper.GetStringSlice("miner.bid-rates")
-		if len(bidRatesStr) != 1 && len(bidRatesStr) != len(devices) {
-			log.Printf("Mismatch between number of devices (%d) and bid-rates (%d). Either set a single bid rate for all devices, or one for each device.\n",
-				len(devices), len(bidRatesStr))
-			return
-		}
-
-		ramStrs := viper.GetStringSlice("miner.ram")
-		if len(ramStrs) != 1 && len(ramStrs) != len(devices) {
-			log.Printf("Mismatch between number of devices (%d) and ram allocations (%d). Either set a single ram allocation for each device, or one for each device.\n",
-				len(devices), len(ramStrs))
-			return
-		}
-
-		diskStrs := viper.GetStringSlice("miner.disk")
-		if len(diskStrs) != 1 && len(diskStrs) != len(devices) {
-			log.Printf("Mismatch between number of devices (%d) and disk allocations (%d). Either set a single disk allocation for each device, or one for each device.\n",
-				len(devices), len(diskStrs))
-			return
-		}
-
-		workers := []*worker.Worker{}
-		nextOpenPort := 8889
-		var totalRAM, totalDisk uint64
-		for i, d := range devices {
-			var brStr string
-			if len(bidRatesStr) == 1 {
-				brStr = bidRatesStr[0]
-			} else {
-				brStr = bidRatesStr[i]
-			}
-			br, err := strconv.ParseFloat(brStr, 64)
-			if err != nil {
-				log.Printf("Invalid bid-rate entry %s: %v", brStr, err)
+		if !simulate {
+			if err := gonvml.Initialize(); err != nil {
+				log.Printf("Mine: error initializing gonvml: %v. Please make sure NVML is in the shared library search path.", err)
 				return
 			}
+			defer check.Err(gonvml.Shutdown)
 
-			var ramStr string
-			if len(ramStrs) == 1 {
-				ramStr = ramStrs[0]
-			} else {
-				ramStr = ramStrs[i]
-			}
-			ram, err := humanize.ParseBytes(ramStr)
+			driverVersion, err := gonvml.SystemDriverVersion()
 			if err != nil {
-				log.Printf("Invaid ram entry %s: %v", ramStr, err)
+				log.Printf("Mine: error finding nvidia driver: %v", err)
 				return
 			}
-
-			var diskStr string
-			if len(diskStrs) == 1 {
-				diskStr = diskStrs[0]
-			} else {
-				diskStr = diskStrs[i]
-			}
-			disk, err := humanize.ParseBytes(diskStr)
-			if err != nil {
-				log.Printf("Invaid disk entry %s: %v", diskStr, err)
+			if nvidiaDriverSemver, err := semver.ParseTolerant(driverVersion); err != nil {
+				log.Printf("Mine: error converting nvidia driver version (%s) to semver: %v", driverVersion, err)
+				return
+			} else if nvidiaDriverSemver.LT(minNvidiaDriverSemver) {
+				log.Printf("Mine: please upgrade your nvidia driver before connecting (current: %d, must use at least %d; detailed instructions may be found at https://docs.emrys.io/docs/suppliers/installation)\n", nvidiaDriverSemver.Major, minNvidiaDriverSemver.Major)
 				return
 			}
+			log.Printf("Nvidia driver: %v\n", driverVersion)
+		}
 
-			cm := &worker.CryptoMiner{
-				Command: miningCmdStr,
-				Device:  d,
-			}
-			w := &worker.Worker{
-				MinerID:       mID,
-				Client:        client,
-				Docker:        dClient,
-				AuthToken:     &authToken,
-				BidsOut:       &bidsOut,
-				JobsInProcess: &jobsInProcess,
-				Device:        d,
-				Snapshot:      &job.DeviceSnapshot{},
-				Busy:          false,
-				JobID:         "",
-				BidRate:       br,
-				RAM:           ram,
-				Disk:          disk,
-				Miner:         cm,
-				Port:          fmt.Sprintf("%d", nextOpenPort),
-			}
-			nextOpenPort++
-			totalRAM += ram
-			totalDisk += disk
-
-			w.Miner.Init(ctx)
-			defer w.Miner.Stop()
-
-			if err := w.InitGPUMonitoring(); err != nil {
-				log.Printf("Mine: error initializing gpu monitoring: %v", err)
+		numDevices := uint(numSimulated)
+		if !simulate {
+			var err error
+			numDevices, err = gonvml.DeviceCount()
+			if err != nil {
+				log.Printf("Mine: error counting nvidia devices: %v", err)
 				return
 			}
-
-			go w.UserGPULog(ctx, gpuPeriod)
-
-			workers = append(workers, w)
 		}
 
-		memStats, err := mem.VirtualMemoryWithContext(ctx)
+		cfgs, err := parseMinerConfig(numDevices)
 		if err != nil {
-			log.Printf("Mine: error getting memory stats: %v", err)
-			return
-		} else if totalRAM > memStats.Available {
-			log.Printf("Mine: insufficient available memory (requested for bidding: %s "+
-				"> system memory available %s)", humanize.Bytes(totalRAM), humanize.Bytes(memStats.Available))
+			log.Printf("Mine: %v", err)
 			return
 		}
 
-		diskUsage, err := disk.UsageWithContext(ctx, "/")
+		var firewall worker.Firewall
+		if !simulate {
+			firewall = worker.NewIptablesFirewall()
+		}
+		r, err := newRig(ctx, client, &authToken, mID, "", runtime, firewall, func(d uint) (worker.GPU, worker.FanController) {
+			if simulate {
+				return simGPUs[d], &sim.Fans{GPU: simGPUs[d]}
+			}
+			return worker.NewNVMLGPU(d), &worker.NvidiaSettingsFans{Index: d}
+		}, cfgs)
+		if r != nil {
+			defer r.pool.stopMiners()
+		}
 		if err != nil {
-			log.Printf("Mine: error getting disk usage: %v", err)
-			return
-		} else if totalDisk > diskUsage.Free {
-			log.Printf("Mine: insufficient available disk space (requested for bidding: %s "+
-				"> system disk space available %s)", humanize.Bytes(totalDisk), humanize.Bytes(diskUsage.Free))
+			log.Printf("Mine: error %v", err)
 			return
 		}
-
-		go MonitorMiner(ctx, client, dClient, &authToken, workers, cancel, u)
-
-		viper.WatchConfig()
-		viper.OnConfigChange(func(e fsnotify.Event) {
-			log.Printf("Config file changed: %v %v\n", e.Op, e.Name)
-			// TODO: update cryptominer command
-			// TODO: update worker bid-rate
-			// TODO: check if system has sufficient ram / disk for new totalRAM/totalDisk? will be tricky
-		})
-
-		p := path.Join("miner", "connect")
-		u.Path = p
-		q := u.Query()
-		q.Set("timeout", "600")
-		buffer := int64(3) // auctions last 3 seconds
-		sinceTime := (time.Now().Unix() - buffer) * 1000
-		q.Set("since_time", fmt.Sprintf("%d", sinceTime))
-		u.RawQuery = q.Encode()
-
-		log.Printf("Connecting to emrys for jobs...\n")
-		for {
-			pr := poll.Response{}
-			if terminate {
-				log.Printf("Mining job search canceled.\n")
-				return
-			}
-
-			if err := version.CheckMine(ctx, client, u); err != nil {
-				log.Printf("Version error: %v", err)
-				return
-			}
-
-			dockerAuthConfig := types.AuthConfig{
-				RegistryToken: authToken,
-			}
-			dockerAuthJSON, err := json.Marshal(dockerAuthConfig)
-			if err != nil {
-				log.Printf("Mine: error marshaling docker auth config: %v", err)
-				return
-			}
-			dockerAuthStr := base64.URLEncoding.EncodeToString(dockerAuthJSON)
-			if err := seedDockerdCache(ctx, dClient, dockerAuthStr); err != nil {
-				log.Printf("Mine: error seeding docker cache: %v", err)
-				return
-			}
-
-			operation := func() error {
-				req, err := http.NewRequest(http.MethodGet, u.String(), nil)
-				if err != nil {
-					return fmt.Errorf("creating request %v %v: %v", http.MethodGet, u.Path, err)
-				}
-				req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", authToken))
-				req = req.WithContext(ctx)
-
-				resp, err := client.Do(req)
-				if err != nil {
-					return err
-				}
-				defer check.Err(resp.Body.Close)
-
-				if resp.StatusCode == http.StatusBadGateway {
-					return fmt.Errorf("server: temporary error")
-				} else if resp.StatusCode == http.StatusInternalServerError {
-					return fmt.Errorf("server: internal error")
-				} else if resp.StatusCode >= 300 {
-					b, _ := ioutil.ReadAll(resp.Body)
-					return backoff.Permanent(fmt.Errorf("server: %v", string(b)))
-				}
-
-				if err := json.NewDecoder(resp.Body).Decode(&pr); err != nil {
-					return fmt.Errorf("decoding response: %v", err)
-				}
-
-				return nil
-			}
-			expBackOff := backoff.NewExponentialBackOff()
-			expBackOff.MaxElapsedTime = maxBackOffElapsedTime
-			if err := backoff.RetryNotify(operation,
-				backoff.WithContext(expBackOff, ctx),
-				func(err error, t time.Duration) {
-					log.Printf("Connect error: %v", err)
-					log.Printf("Retrying in %s seconds\n", t.Round(time.Second).String())
-				}); err != nil {
-				log.Printf("Connect error: %v", err)
-				return
-			}
-
-			if err := checkContextCanceled(ctx); err != nil {
-				log.Printf("Miner canceled job search: %v", err)
-				return
-			}
-
-			if len(pr.Events) > 0 {
-				log.Println(len(pr.Events), "job(s) up for auction")
-				for _, event := range pr.Events {
-					sinceTime = event.Timestamp
-					msg := &job.Message{}
-					if err := json.Unmarshal(event.Data, msg); err != nil {
-						log.Printf("Mine: error unmarshaling json message: %v", err)
-						continue
-					}
-					if msg.Job == nil {
-						continue
-					}
-					for _, worker := range workers {
-						w := worker
-						if !w.Busy {
-							go func() {
-								if err := w.Bid(ctx, u, msg); err != nil {
-									log.Printf("Mine: bid: %v", err)
-								}
-							}()
-						}
-					}
-				}
-			} else {
-				if pr.Timestamp > sinceTime {
-					sinceTime = pr.Timestamp
-				}
-			}
-
-			q = u.Query()
-			q.Set("since_time", fmt.Sprintf("%d", sinceTime))
-			u.RawQuery = q.Encode()
+		go monitorInterrupts(ctx, stop, cancel, r.pool)
+		if err := r.start(ctx, cancel, u); err != nil {
+			log.Printf("Mine: error %v", err)
+			return
 		}
+		r.watchConfig(ctx, numDevices)
+		r.connect(ctx, u)
 	},
 }
 
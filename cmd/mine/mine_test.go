@@ -0,0 +1,206 @@
+package mine
+
+import (
+	"bytes"
+	"context"
+	"github.com/spf13/viper"
+	"github.com/wminshew/emrysclient/pkg/fakeserver"
+	"github.com/wminshew/emrysclient/pkg/sim"
+	"github.com/wminshew/emrysclient/pkg/worker"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+const testTimeout = 30 * time.Second
+
+// startTestRig mines with a single simulated device against a fake server running s, until
+// the returned func is called
+func startTestRig(t *testing.T, s *fakeserver.Scenario) (*fakeserver.Server, *rig, func()) {
+	workdir, err := ioutil.TempDir("", "emrys-mine-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	configDir, err := ioutil.TempDir("", "emrys-mine-test-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	viper.Reset()
+	viper.Set("miner.bid-rates", []string{"1"})
+	viper.Set("miner.ram", []string{"1mb"})
+	viper.Set("miner.disk", []string{"1mb"})
+	viper.Set("miner.workdir", []string{workdir})
+	viper.Set("miner.below-break-even", worker.BreakEvenRaise)
+	viper.Set("miner.output-sync-threshold", "1gb")
+	viper.Set("miner.image-cache", "0")
+	cfgs, err := parseMinerConfig(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gpus := []*sim.GPU{sim.NewGPU(0)}
+	runtime := sim.NewRuntime(gpus)
+	// long enough for the log to be shipped in more than one chunk
+	runtime.JobDuration = 3 * time.Second
+	runtime.LogPeriod = 100 * time.Millisecond
+
+	srv := fakeserver.New(s)
+	ctx, cancel := context.WithCancel(context.Background())
+	authToken := s.Token
+	r, err := newRig(ctx, srv.Client(), &authToken, "test-miner", configDir, runtime, nil, func(d uint) (worker.GPU, worker.FanController) {
+		return gpus[d], &sim.Fans{GPU: gpus[d]}
+	}, cfgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.start(ctx, cancel, srv.URL()); err != nil {
+		t.Fatal(err)
+	}
+	connected := make(chan struct{})
+	go func() {
+		defer close(connected)
+		r.connect(ctx, srv.URL())
+	}()
+	return srv, r, func() {
+		cancel()
+		<-connected
+		r.pool.stopMiners()
+		srv.Close()
+		_ = os.RemoveAll(workdir)
+		_ = os.RemoveAll(configDir)
+	}
+}
+
+// waitFor polls cond until it holds, failing t if it doesn't within testTimeout
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(testTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func jobState(t *testing.T, srv *fakeserver.Server, jID string) fakeserver.JobState {
+	j, err := srv.Job(jID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return j
+}
+
+func TestMineLifecycle(t *testing.T) {
+	tests := []struct {
+		name     string
+		scenario func(s *fakeserver.Scenario)
+		check    func(t *testing.T, srv *fakeserver.Server, r *rig, jID string)
+	}{
+		{
+			name: "bad gateway storm",
+			scenario: func(s *fakeserver.Scenario) {
+				s.BadGatewayStorm = 2
+			},
+			check: func(t *testing.T, srv *fakeserver.Server, r *rig, jID string) {
+				waitFor(t, "job output", func() bool {
+					j := jobState(t, srv, jID)
+					return j.LogDone && j.Output != nil
+				})
+				j := jobState(t, srv, jID)
+				if j.Winner == "" {
+					t.Errorf("job has no winner")
+				}
+				if j.Canceled {
+					t.Errorf("job canceled")
+				}
+				if hits := srv.Hits("GET api.emrys.io /miner/connect"); hits <= 2 {
+					t.Errorf("connect hits = %d, want retries past the storm", hits)
+				}
+			},
+		},
+		{
+			name: "bid payment required",
+			scenario: func(s *fakeserver.Scenario) {
+				s.AuctionPaymentRequired = true
+			},
+			check: func(t *testing.T, srv *fakeserver.Server, r *rig, jID string) {
+				route := "POST api.emrys.io /miner/job/" + jID + "/bid"
+				waitFor(t, "bid", func() bool { return srv.Hits(route) > 0 })
+				waitFor(t, "worker to return to idle", func() bool {
+					return r.pool.list()[0].State() == worker.StateIdle
+				})
+				if j := jobState(t, srv, jID); j.Winner != "" {
+					t.Errorf("winner = %s, want none", j.Winner)
+				}
+			},
+		},
+		{
+			name: "canceled after logs",
+			scenario: func(s *fakeserver.Scenario) {
+				s.CancelAfterLogs = 1
+			},
+			check: func(t *testing.T, srv *fakeserver.Server, r *rig, jID string) {
+				waitFor(t, "job output", func() bool {
+					j := jobState(t, srv, jID)
+					return j.LogDone && j.Output != nil
+				})
+				j := jobState(t, srv, jID)
+				if !j.Canceled {
+					t.Errorf("job not canceled")
+				}
+				if !bytes.Contains(j.Log, []byte("JOB CANCELED")) {
+					t.Errorf("log doesn't record the cancellation:\n%s", j.Log)
+				}
+				waitFor(t, "worker to return to idle", func() bool {
+					return r.pool.list()[0].State() == worker.StateIdle
+				})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := fakeserver.DefaultScenario()
+			tt.scenario(s)
+			srv, r, stop := startTestRig(t, s)
+			defer stop()
+			jID, err := srv.PostJob("test", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, srv, r, jID)
+		})
+	}
+}
+
+func TestReaddRetiringDevice(t *testing.T) {
+	srv, r, stop := startTestRig(t, fakeserver.DefaultScenario())
+	defer stop()
+	cfgs := r.cfgs
+	w := r.pool.list()[0]
+	if _, err := srv.PostJob("test", false); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "job to run", func() bool { return w.State() == worker.StateRunning })
+
+	ctx := context.Background()
+	r.pool.reconfigure(ctx, []deviceConfig{})
+	if n := len(r.pool.list()); n != 0 {
+		t.Fatalf("%d active workers after removing the device, want 0", n)
+	}
+	r.pool.reconfigure(ctx, cfgs)
+	workers := r.pool.list()
+	if len(workers) != 1 || workers[0] != w {
+		t.Fatalf("re-added device has workers %v, want the retiring worker %p", workers, w)
+	}
+
+	waitFor(t, "job to finish", func() bool { return w.State() == worker.StateIdle })
+	time.Sleep(100 * time.Millisecond)
+	if workers := r.pool.list(); len(workers) != 1 || workers[0] != w {
+		t.Fatalf("workers %v after the job finished, want the kept worker %p", workers, w)
+	}
+	if bidsOut, jobsInProcess := r.pool.counts(); bidsOut != 0 || jobsInProcess != 0 {
+		t.Errorf("counts = %d bids, %d jobs, want none", bidsOut, jobsInProcess)
+	}
+}
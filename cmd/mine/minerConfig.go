@@ -0,0 +1,383 @@
+package mine
+
+import (
+	"context"
+	"fmt"
+	"github.com/dustin/go-humanize"
+	"github.com/shirou/gopsutil/disk"
+	"github.com/shirou/gopsutil/mem"
+	"github.com/spf13/viper"
+	"github.com/wminshew/emrysclient/pkg/worker"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// deviceConfig is the configured settings for a single device
+type deviceConfig struct {
+	Device   uint
+	Settings worker.Settings
+}
+
+// parseMinerConfig reads the per-device miner settings from viper. numDevices is
+// the number of devices detected on the rig
+func parseMinerConfig(numDevices uint) ([]deviceConfig, error) {
+	miningCmdStr := viper.GetString("miner.mining-command")
+	if miningCmdStr != "" && !strings.Contains(miningCmdStr, "$DEVICE") {
+		return nil, fmt.Errorf("if mining-command is set, it must include $DEVICE")
+	}
+
+	devices := []uint{}
+	devicesStr := viper.GetStringSlice("miner.devices")
+	if len(devicesStr) == 0 {
+		// no flag provided, grab all detected devices
+		for i := 0; i < int(numDevices); i++ {
+			devices = append(devices, uint(i))
+		}
+	} else {
+		// flag provided, convert to uints
+		for _, s := range devicesStr {
+			u, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid devices entry %s: %v", s, err)
+			}
+			if u >= uint64(numDevices) {
+				return nil, fmt.Errorf("invalid devices entry %s: only %d device(s) detected", s, numDevices)
+			}
+			devices = append(devices, uint(u))
+		}
+	}
+
+	bidRatesStr := viper.GetStringSlice("miner.bid-rates")
+	if len(bidRatesStr) != 1 && len(bidRatesStr) != len(devices) {
+		return nil, fmt.Errorf("mismatch between number of devices (%d) and bid-rates (%d). Either set a single bid rate for all devices, or one for each device",
+			len(devices), len(bidRatesStr))
+	}
+
+	ramStrs := viper.GetStringSlice("miner.ram")
+	if len(ramStrs) != 1 && len(ramStrs) != len(devices) {
+		return nil, fmt.Errorf("mismatch between number of devices (%d) and ram allocations (%d). Either set a single ram allocation for each device, or one for each device",
+			len(devices), len(ramStrs))
+	}
+
+	diskStrs := viper.GetStringSlice("miner.disk")
+	if len(diskStrs) != 1 && len(diskStrs) != len(devices) {
+		return nil, fmt.Errorf("mismatch between number of devices (%d) and disk allocations (%d). Either set a single disk allocation for each device, or one for each device",
+			len(devices), len(diskStrs))
+	}
+
+	strategyStrs := viper.GetStringSlice("miner.bid-strategies")
+	if len(strategyStrs) > 1 && len(strategyStrs) != len(devices) {
+		return nil, fmt.Errorf("mismatch between number of devices (%d) and bid-strategies (%d). Either set a single bid strategy for all devices, or one for each device",
+			len(devices), len(strategyStrs))
+	}
+
+	revenueStrs := viper.GetStringSlice("miner.mining-revenue")
+	if len(revenueStrs) > 1 && len(revenueStrs) != len(devices) {
+		return nil, fmt.Errorf("mismatch between number of devices (%d) and mining-revenue (%d). Either set a single mining revenue for all devices, or one for each device",
+			len(devices), len(revenueStrs))
+	}
+
+	electricityPrice := viper.GetFloat64("miner.electricity-price")
+	if electricityPrice < 0 {
+		return nil, fmt.Errorf("invalid electricity-price %v: must be non-negative", electricityPrice)
+	}
+
+	breakEvenPolicy := viper.GetString("miner.below-break-even")
+	if breakEvenPolicy != worker.BreakEvenRaise && breakEvenPolicy != worker.BreakEvenSkip {
+		return nil, fmt.Errorf("invalid below-break-even %s: must be %s or %s", breakEvenPolicy, worker.BreakEvenRaise, worker.BreakEvenSkip)
+	}
+
+	outputSyncInterval := viper.GetDuration("miner.output-sync-interval")
+	if outputSyncInterval < 0 {
+		return nil, fmt.Errorf("invalid output-sync-interval %v: must be non-negative", outputSyncInterval)
+	}
+	outputSyncThresholdStr := viper.GetString("miner.output-sync-threshold")
+	outputSyncThreshold, err := humanize.ParseBytes(outputSyncThresholdStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output-sync-threshold %s: %v", outputSyncThresholdStr, err)
+	}
+
+	bidScheduleStrs := viper.GetStringSlice("miner.bid-schedule")
+	if len(bidScheduleStrs) > 1 && len(bidScheduleStrs) != len(devices) {
+		return nil, fmt.Errorf("mismatch between number of devices (%d) and bid-schedule (%d). Either set a single bid schedule for all devices, or one for each device",
+			len(devices), len(bidScheduleStrs))
+	}
+
+	miningScheduleStrs := viper.GetStringSlice("miner.mining-schedule")
+	if len(miningScheduleStrs) > 1 && len(miningScheduleStrs) != len(devices) {
+		return nil, fmt.Errorf("mismatch between number of devices (%d) and mining-schedule (%d). Either set a single mining schedule for all devices, or one for each device",
+			len(devices), len(miningScheduleStrs))
+	}
+
+	workdirs := viper.GetStringSlice("miner.workdir")
+	if len(workdirs) > 1 && len(workdirs) != len(devices) {
+		return nil, fmt.Errorf("mismatch between number of devices (%d) and workdir (%d). Either set a single workdir for all devices, or one for each device",
+			len(devices), len(workdirs))
+	}
+	defaultWorkdir, err := worker.DefaultWorkdir()
+	if err != nil {
+		return nil, err
+	}
+
+	networkPolicyStrs := viper.GetStringSlice("miner.network-policy")
+	if len(networkPolicyStrs) > 1 && len(networkPolicyStrs) != len(devices) {
+		return nil, fmt.Errorf("mismatch between number of devices (%d) and network-policy (%d). Either set a single network policy for all devices, or one for each device",
+			len(devices), len(networkPolicyStrs))
+	}
+
+	securityProfiles, err := parseSecurityProfiles(len(devices))
+	if err != nil {
+		return nil, err
+	}
+
+	cfgs := []deviceConfig{}
+	for i, d := range devices {
+		var brStr string
+		if len(bidRatesStr) == 1 {
+			brStr = bidRatesStr[0]
+		} else {
+			brStr = bidRatesStr[i]
+		}
+		br, err := strconv.ParseFloat(brStr, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bid-rate entry %s: %v", brStr, err)
+		}
+
+		var ramStr string
+		if len(ramStrs) == 1 {
+			ramStr = ramStrs[0]
+		} else {
+			ramStr = ramStrs[i]
+		}
+		ram, err := humanize.ParseBytes(ramStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ram entry %s: %v", ramStr, err)
+		}
+
+		var diskStr string
+		if len(diskStrs) == 1 {
+			diskStr = diskStrs[0]
+		} else {
+			diskStr = diskStrs[i]
+		}
+		disk, err := humanize.ParseBytes(diskStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid disk entry %s: %v", diskStr, err)
+		}
+
+		var strategyStr string
+		if len(strategyStrs) == 1 {
+			strategyStr = strategyStrs[0]
+		} else if len(strategyStrs) > 1 {
+			strategyStr = strategyStrs[i]
+		}
+		strategy, err := worker.ParseBidStrategy(strategyStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bid-strategy entry %s: %v", strategyStr, err)
+		}
+
+		var revenue float64
+		if len(revenueStrs) > 0 {
+			revenueStr := revenueStrs[0]
+			if len(revenueStrs) > 1 {
+				revenueStr = revenueStrs[i]
+			}
+			if revenue, err = strconv.ParseFloat(revenueStr, 64); err != nil {
+				return nil, fmt.Errorf("invalid mining-revenue entry %s: %v", revenueStr, err)
+			}
+		}
+
+		var bidScheduleStr string
+		if len(bidScheduleStrs) == 1 {
+			bidScheduleStr = bidScheduleStrs[0]
+		} else if len(bidScheduleStrs) > 1 {
+			bidScheduleStr = bidScheduleStrs[i]
+		}
+		bidSchedule, err := worker.ParseSchedule(bidScheduleStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bid-schedule entry %s: %v", bidScheduleStr, err)
+		}
+
+		var miningScheduleStr string
+		if len(miningScheduleStrs) == 1 {
+			miningScheduleStr = miningScheduleStrs[0]
+		} else if len(miningScheduleStrs) > 1 {
+			miningScheduleStr = miningScheduleStrs[i]
+		}
+		miningSchedule, err := worker.ParseSchedule(miningScheduleStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mining-schedule entry %s: %v", miningScheduleStr, err)
+		}
+
+		workdir := defaultWorkdir
+		if len(workdirs) == 1 {
+			workdir = workdirs[0]
+		} else if len(workdirs) > 1 {
+			workdir = workdirs[i]
+		}
+		if workdir, err = filepath.Abs(workdir); err != nil {
+			return nil, fmt.Errorf("invalid workdir entry %s: %v", workdir, err)
+		}
+
+		var networkPolicyStr string
+		if len(networkPolicyStrs) == 1 {
+			networkPolicyStr = networkPolicyStrs[0]
+		} else if len(networkPolicyStrs) > 1 {
+			networkPolicyStr = networkPolicyStrs[i]
+		}
+		networkPolicy, err := worker.ParseNetworkPolicy(networkPolicyStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network-policy entry %s: %v", networkPolicyStr, err)
+		}
+
+		cfgs = append(cfgs, deviceConfig{
+			Device: d,
+			Settings: worker.Settings{
+				BidRate:             br,
+				RAM:                 ram,
+				Disk:                disk,
+				Workdir:             workdir,
+				MiningCommand:       miningCmdStr,
+				MiningSchedule:      miningSchedule,
+				BidSchedule:         bidSchedule,
+				BidStrategy:         strategy,
+				ElectricityPrice:    electricityPrice,
+				MiningRevenue:       revenue,
+				BreakEvenPolicy:     breakEvenPolicy,
+				Security:            securityProfiles[i],
+				NetworkPolicy:       networkPolicy,
+				OutputSyncInterval:  outputSyncInterval,
+				OutputSyncThreshold: outputSyncThreshold,
+			},
+		})
+	}
+
+	return cfgs, nil
+}
+
+// parseSecurityProfiles reads the per-device job container security settings from viper,
+// starting from worker.DefaultSecurityProfile for any that aren't set
+func parseSecurityProfiles(numDevices int) ([]worker.SecurityProfile, error) {
+	settings := make(map[string][]string)
+	for _, key := range []string{"pids-limit", "read-only-rootfs", "tmpfs-size", "ipc", "seccomp", "apparmor"} {
+		strs := viper.GetStringSlice(fmt.Sprintf("miner.%s", key))
+		if len(strs) > 1 && len(strs) != numDevices {
+			return nil, fmt.Errorf("mismatch between number of devices (%d) and %s (%d). Either set a single %s for all devices, or one for each device",
+				numDevices, key, len(strs), key)
+		}
+		settings[key] = strs
+	}
+	deviceSetting := func(key string, i int) (string, bool) {
+		strs := settings[key]
+		if len(strs) == 0 {
+			return "", false
+		} else if len(strs) == 1 {
+			return strs[0], true
+		}
+		return strs[i], true
+	}
+
+	profiles := []worker.SecurityProfile{}
+	for i := 0; i < numDevices; i++ {
+		p := worker.DefaultSecurityProfile()
+		if s, ok := deviceSetting("pids-limit", i); ok {
+			pidsLimit, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pids-limit entry %s: %v", s, err)
+			}
+			p.PidsLimit = pidsLimit
+		}
+		if s, ok := deviceSetting("read-only-rootfs", i); ok {
+			readOnly, err := strconv.ParseBool(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid read-only-rootfs entry %s: %v", s, err)
+			}
+			p.ReadOnlyRootfs = readOnly
+		}
+		if s, ok := deviceSetting("tmpfs-size", i); ok {
+			tmpfsSize, err := humanize.ParseBytes(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid tmpfs-size entry %s: %v", s, err)
+			}
+			p.TmpfsSize = tmpfsSize
+		}
+		if s, ok := deviceSetting("ipc", i); ok {
+			p.IpcMode = s
+		}
+		if s, ok := deviceSetting("seccomp", i); ok {
+			p.Seccomp = s
+		}
+		if s, ok := deviceSetting("apparmor", i); ok {
+			p.AppArmor = s
+		}
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid security profile for device entry %d: %v", i, err)
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+// parseImageCacheConfig returns the image cache's disk budget & max age
+func parseImageCacheConfig() (uint64, time.Duration, error) {
+	budgetStr := viper.GetString("miner.image-cache")
+	budget, err := humanize.ParseBytes(budgetStr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("parsing image-cache %s: %v", budgetStr, err)
+	}
+	maxAge := viper.GetDuration("miner.image-max-age")
+	if maxAge < 0 {
+		return 0, 0, fmt.Errorf("invalid image-max-age %v: must be non-negative", maxAge)
+	}
+	return budget, maxAge, nil
+}
+
+// checkCapacity verifies the system can support the ram & disk allocations in cfgs,
+// returning the rig's capacity for emrys jobs. Disk is checked on the filesystem of
+// each device's workdir, keyed by mount point. allocatedRAM & allocatedDisk are held
+// by bids & running jobs, which are no longer reflected in the system's available
+// memory & free disk
+func checkCapacity(ctx context.Context, cfgs []deviceConfig, allocatedRAM uint64, allocatedDisk map[string]uint64) (uint64, map[string]uint64, error) {
+	var totalRAM uint64
+	totalDisk := make(map[string]uint64)
+	for _, cfg := range cfgs {
+		totalRAM += cfg.Settings.RAM
+		// workdirs must exist to find their filesystem
+		if err := os.MkdirAll(cfg.Settings.Workdir, 0755); err != nil {
+			return 0, nil, fmt.Errorf("making workdir %s: %v", cfg.Settings.Workdir, err)
+		}
+		fs, err := worker.MountPoint(cfg.Settings.Workdir)
+		if err != nil {
+			return 0, nil, fmt.Errorf("finding workdir filesystem: %v", err)
+		}
+		totalDisk[fs] += cfg.Settings.Disk
+	}
+
+	memStats, err := mem.VirtualMemoryWithContext(ctx)
+	if err != nil {
+		return 0, nil, fmt.Errorf("getting memory stats: %v", err)
+	}
+	ramCapacity := memStats.Available + allocatedRAM
+	if totalRAM > ramCapacity {
+		return 0, nil, fmt.Errorf("insufficient available memory (requested for bidding: %s "+
+			"> system memory available %s)", humanize.Bytes(totalRAM), humanize.Bytes(ramCapacity))
+	}
+
+	diskCapacity := make(map[string]uint64)
+	for fs, total := range totalDisk {
+		diskUsage, err := disk.UsageWithContext(ctx, fs)
+		if err != nil {
+			return 0, nil, fmt.Errorf("getting disk usage of %s: %v", fs, err)
+		}
+		diskCapacity[fs] = diskUsage.Free + allocatedDisk[fs]
+		if total > diskCapacity[fs] {
+			return 0, nil, fmt.Errorf("insufficient available disk space on %s (requested for bidding: %s "+
+				"> disk space available %s)", fs, humanize.Bytes(total), humanize.Bytes(diskCapacity[fs]))
+		}
+	}
+
+	return ramCapacity, diskCapacity, nil
+}
@@ -7,7 +7,7 @@ import (
 	"time"
 )
 
-func monitorInterrupts(ctx context.Context, stop <-chan os.Signal, cancelFunc func()) {
+func monitorInterrupts(ctx context.Context, stop <-chan os.Signal, cancelFunc func(), pool *workerPool) {
 	select {
 	case <-ctx.Done():
 		return
@@ -16,7 +16,8 @@ func monitorInterrupts(ctx context.Context, stop <-chan os.Signal, cancelFunc fu
 			log.Printf("Canceling...\n")
 			cancelFunc()
 		}()
-		terminate = true
+		close(terminate)
+		bidsOut, jobsInProcess := pool.counts()
 		if jobsInProcess > 0 {
 			log.Printf("Cancellation request received: please press ctrl-c again to force quit.\n")
 			if jobsInProcess == 1 {
@@ -30,6 +31,7 @@ func monitorInterrupts(ctx context.Context, stop <-chan os.Signal, cancelFunc fu
 					return
 				case <-time.After(1 * time.Second):
 				}
+				bidsOut, jobsInProcess = pool.counts()
 			}
 		} else if bidsOut > 0 {
 			log.Printf("Cancellation request received: please press ctrl-c again to quit.\n")
@@ -44,6 +46,7 @@ func monitorInterrupts(ctx context.Context, stop <-chan os.Signal, cancelFunc fu
 					return
 				case <-time.After(1 * time.Second):
 				}
+				bidsOut, _ = pool.counts()
 			}
 		}
 	}
@@ -0,0 +1,270 @@
+package mine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cenkalti/backoff"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+	"github.com/wminshew/emrys/pkg/check"
+	"github.com/wminshew/emrys/pkg/job"
+	"github.com/wminshew/emrysclient/cmd/version"
+	"github.com/wminshew/emrysclient/pkg/poll"
+	"github.com/wminshew/emrysclient/pkg/worker"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"sync"
+	"time"
+)
+
+// rig is the miner's workers & the resources they share
+type rig struct {
+	minerID   string
+	client    *http.Client
+	authToken *string
+	runtime   worker.ContainerRuntime
+	ledger    *worker.Ledger
+	images    *worker.ImageCache
+	pool      *workerPool
+	cfgs      []deviceConfig
+}
+
+// newRig starts a worker for each of cfgs, executing jobs on runtime for miner mID. hardware
+// returns the gpu & fans of device d; firewall may be nil. Workers keep their job records in
+// configDir, or ~/.config/emrys if it's blank
+func newRig(ctx context.Context, client *http.Client, authToken *string, mID, configDir string, runtime worker.ContainerRuntime,
+	firewall worker.Firewall, hardware func(d uint) (worker.GPU, worker.FanController), cfgs []deviceConfig) (*rig, error) {
+	imageCacheBudget, imageMaxAge, err := parseImageCacheConfig()
+	if err != nil {
+		return nil, err
+	}
+	r := &rig{
+		minerID:   mID,
+		client:    client,
+		authToken: authToken,
+		runtime:   runtime,
+		ledger:    worker.NewLedger(),
+		images:    worker.NewImageCache(runtime, imageCacheBudget, imageMaxAge),
+		cfgs:      cfgs,
+	}
+	r.pool = newWorkerPool(func(d uint, s worker.Settings, port string) *worker.Worker {
+		w := &worker.Worker{
+			MinerID:             mID,
+			Client:              client,
+			Runtime:             runtime,
+			AuthToken:           authToken,
+			Ledger:              r.ledger,
+			Images:              r.images,
+			Device:              d,
+			BidRate:             s.BidRate,
+			RAM:                 s.RAM,
+			Disk:                s.Disk,
+			Workdir:             s.Workdir,
+			ConfigDir:           configDir,
+			BidStrategy:         s.BidStrategy,
+			BidSchedule:         s.BidSchedule,
+			ElectricityPrice:    s.ElectricityPrice,
+			MiningRevenue:       s.MiningRevenue,
+			BreakEvenPolicy:     s.BreakEvenPolicy,
+			Security:            s.Security,
+			NetworkPolicy:       s.NetworkPolicy,
+			OutputSyncInterval:  s.OutputSyncInterval,
+			OutputSyncThreshold: s.OutputSyncThreshold,
+			Firewall:            firewall,
+			Miner: &worker.CryptoMiner{
+				Command:  s.MiningCommand,
+				Device:   d,
+				Schedule: s.MiningSchedule,
+			},
+			Port: port,
+		}
+		w.GPU, w.Fans = hardware(d)
+		return w
+	})
+	for _, cfg := range cfgs {
+		if err := r.pool.add(ctx, cfg.Device, cfg.Settings); err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+// start recovers any jobs left by a previous run, cleans up after it & sizes the ledger, then
+// monitors the rig & seeds its base images. cancel is called if monitoring fails
+func (r *rig) start(ctx context.Context, cancel context.CancelFunc, u url.URL) error {
+	recovered := []string{}
+	for _, w := range r.pool.list() {
+		jID, err := w.Recover(ctx, u)
+		if err != nil {
+			return fmt.Errorf("device %d: recovering jobs from previous run: %v", w.Device, err)
+		}
+		if jID != "" {
+			recovered = append(recovered, jID)
+		}
+	}
+	workdirs := []string{}
+	for _, cfg := range r.cfgs {
+		workdirs = append(workdirs, cfg.Settings.Workdir)
+	}
+	if err := worker.CleanOrphans(ctx, r.runtime, r.minerID, workdirs, recovered); err != nil {
+		return fmt.Errorf("cleaning up after previous runs: %v", err)
+	}
+	if err := r.images.Evict(ctx); err != nil {
+		log.Printf("Mine: error evicting cached images: %v", err)
+	}
+
+	allocatedRAM, allocatedDisk := r.ledger.Allocated()
+	ramCapacity, diskCapacity, err := checkCapacity(ctx, r.cfgs, allocatedRAM, allocatedDisk)
+	if err != nil {
+		return err
+	}
+	r.ledger.SetCapacity(ramCapacity, diskCapacity)
+
+	go MonitorMiner(ctx, r.client, r.authToken, r.pool, r.images, cancel, u)
+	go seedBaseImages(ctx, r.client, r.authToken, r.runtime, r.images, r.pool, u)
+	return nil
+}
+
+// watchConfig reconfigures the rig whenever its config file changes. numDevices is the number
+// of devices detected on the rig
+func (r *rig) watchConfig(ctx context.Context, numDevices uint) {
+	var reloadMu sync.Mutex
+	viper.WatchConfig()
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		reloadMu.Lock()
+		defer reloadMu.Unlock()
+		log.Printf("Config file changed: %v %v\n", e.Op, e.Name)
+		cfgs, err := parseMinerConfig(numDevices)
+		if err != nil {
+			log.Printf("Mine: error reloading config: %v; keeping previous settings", err)
+			return
+		}
+		allocatedRAM, allocatedDisk := r.ledger.Allocated()
+		ramCapacity, diskCapacity, err := checkCapacity(ctx, cfgs, allocatedRAM, allocatedDisk)
+		if err != nil {
+			log.Printf("Mine: error reloading config: %v; keeping previous settings", err)
+			return
+		}
+		imageCacheBudget, imageMaxAge, err := parseImageCacheConfig()
+		if err != nil {
+			log.Printf("Mine: error reloading config: %v; keeping previous settings", err)
+			return
+		}
+		r.ledger.SetCapacity(ramCapacity, diskCapacity)
+		r.images.SetLimits(imageCacheBudget, imageMaxAge)
+		r.pool.reconfigure(ctx, cfgs)
+	})
+}
+
+// connect long-polls u for jobs up for auction & bids on them with the rig's idle workers,
+// until the miner is terminated or ctx is canceled
+func (r *rig) connect(ctx context.Context, u url.URL) {
+	p := path.Join("miner", "connect")
+	u.Path = p
+	q := u.Query()
+	q.Set("timeout", "600")
+	buffer := int64(3) // auctions last 3 seconds
+	sinceTime := (time.Now().Unix() - buffer) * 1000
+	q.Set("since_time", fmt.Sprintf("%d", sinceTime))
+	u.RawQuery = q.Encode()
+
+	log.Printf("Connecting to emrys for jobs...\n")
+	for {
+		pr := poll.Response{}
+		select {
+		case <-terminate:
+			log.Printf("Mining job search canceled.\n")
+			return
+		default:
+		}
+
+		if err := version.CheckMine(ctx, r.client, u); err != nil {
+			log.Printf("Version error: %v", err)
+			return
+		}
+
+		operation := func() error {
+			req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+			if err != nil {
+				return fmt.Errorf("creating request %v %v: %v", http.MethodGet, u.Path, err)
+			}
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", *r.authToken))
+			req = req.WithContext(ctx)
+
+			resp, err := r.client.Do(req)
+			if err != nil {
+				return err
+			}
+			defer check.Err(resp.Body.Close)
+
+			if resp.StatusCode == http.StatusBadGateway {
+				return fmt.Errorf("server: temporary error")
+			} else if resp.StatusCode == http.StatusInternalServerError {
+				return fmt.Errorf("server: internal error")
+			} else if resp.StatusCode >= 300 {
+				b, _ := ioutil.ReadAll(resp.Body)
+				return backoff.Permanent(fmt.Errorf("server: %v", string(b)))
+			}
+
+			if err := json.NewDecoder(resp.Body).Decode(&pr); err != nil {
+				return fmt.Errorf("decoding response: %v", err)
+			}
+
+			return nil
+		}
+		expBackOff := backoff.NewExponentialBackOff()
+		expBackOff.MaxElapsedTime = maxBackOffElapsedTime
+		if err := backoff.RetryNotify(operation,
+			backoff.WithContext(expBackOff, ctx),
+			func(err error, t time.Duration) {
+				log.Printf("Connect error: %v", err)
+				log.Printf("Retrying in %s seconds\n", t.Round(time.Second).String())
+			}); err != nil {
+			log.Printf("Connect error: %v", err)
+			return
+		}
+
+		if err := checkContextCanceled(ctx); err != nil {
+			log.Printf("Miner canceled job search: %v", err)
+			return
+		}
+
+		if len(pr.Events) > 0 {
+			log.Println(len(pr.Events), "job(s) up for auction")
+			for _, event := range pr.Events {
+				sinceTime = event.Timestamp
+				msg := &job.Message{}
+				if err := json.Unmarshal(event.Data, msg); err != nil {
+					log.Printf("Mine: error unmarshaling json message: %v", err)
+					continue
+				}
+				if msg.Job == nil {
+					continue
+				}
+				limits := worker.ParseJobLimits(event.Data)
+				for _, w := range r.pool.list() {
+					w := w
+					if w.State() == worker.StateIdle {
+						go func(u url.URL) {
+							if err := w.Bid(ctx, u, msg, limits); err != nil {
+								log.Printf("Mine: bid: %v", err)
+							}
+						}(u)
+					}
+				}
+			}
+		} else {
+			if pr.Timestamp > sinceTime {
+				sinceTime = pr.Timestamp
+			}
+		}
+
+		q = u.Query()
+		q.Set("since_time", fmt.Sprintf("%d", sinceTime))
+		u.RawQuery = q.Encode()
+	}
+}
@@ -0,0 +1,199 @@
+package mine
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/cenkalti/backoff"
+	"github.com/docker/docker/api/types"
+	"github.com/dustin/go-humanize"
+	"github.com/wminshew/emrys/pkg/check"
+	"github.com/wminshew/emrys/pkg/jsonmessage"
+	"github.com/wminshew/emrysclient/pkg/worker"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"time"
+)
+
+const (
+	// seedPeriod is how often the base image manifest is refreshed
+	seedPeriod = 1 * time.Hour
+	// seedPausePeriod is how often a paused seed checks whether jobs are done transferring
+	seedPausePeriod = 10 * time.Second
+)
+
+// defaultBaseImages is seeded until the server's manifest has been fetched
+var defaultBaseImages = []worker.BaseImage{
+	{
+		Ref:    "registry.emrys.io/emrys/base:18.04-10.1",
+		CUDA:   "10.1",
+		Ubuntu: "18.04",
+	},
+}
+
+// seedBaseImages keeps the server's recommended base images pulled & pinned in the image cache,
+// refreshing the manifest every seedPeriod. Pulls yield to jobs' downloads & uploads, pausing
+// while any worker is transferring data
+func seedBaseImages(ctx context.Context, client *http.Client, authToken *string, runtime worker.ContainerRuntime,
+	images *worker.ImageCache, pool *workerPool, u url.URL) {
+	manifest := defaultBaseImages
+	for {
+		if m, err := getBaseImages(ctx, client, authToken, u); err != nil {
+			log.Printf("Mine: error getting base image manifest: %v; seeding previous manifest", err)
+		} else {
+			manifest = m
+		}
+
+		refs := []string{}
+		for _, img := range manifest {
+			refs = append(refs, img.Ref)
+		}
+		images.SetPinned(refs)
+
+		if stats, err := images.Stats(ctx); err != nil {
+			log.Printf("Mine: error checking cached base images: %v", err)
+		} else {
+			cached := make(map[string]bool)
+			for _, ref := range stats.BaseImages {
+				cached[ref] = true
+			}
+			for _, img := range manifest {
+				if cached[img.Ref] {
+					continue
+				}
+				if err := pullBaseImage(ctx, runtime, pool, *authToken, img); err != nil {
+					log.Printf("Mine: error pulling base image %s: %v", img.Ref, err)
+				}
+				if ctx.Err() != nil {
+					return
+				}
+			}
+		}
+
+		if err := images.Evict(ctx); err != nil {
+			log.Printf("Mine: error evicting cached images: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(seedPeriod):
+		}
+	}
+}
+
+// getBaseImages fetches the server's manifest of recommended base images
+func getBaseImages(ctx context.Context, client *http.Client, authToken *string, u url.URL) ([]worker.BaseImage, error) {
+	u.Path = path.Join("miner", "images", "base")
+	manifest := []worker.BaseImage{}
+	operation := func() error {
+		req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+		if err != nil {
+			return backoff.Permanent(fmt.Errorf("creating request %v %v: %v", http.MethodGet, u.Path, err))
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", *authToken))
+		req = req.WithContext(ctx)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer check.Err(resp.Body.Close)
+
+		if resp.StatusCode == http.StatusBadGateway {
+			return fmt.Errorf("server: temporary error")
+		} else if resp.StatusCode >= 300 {
+			b, _ := ioutil.ReadAll(resp.Body)
+			return backoff.Permanent(fmt.Errorf("server: %v", string(b)))
+		}
+
+		return json.NewDecoder(resp.Body).Decode(&manifest)
+	}
+	if err := backoff.RetryNotify(operation,
+		backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxRetries), ctx),
+		func(err error, t time.Duration) {
+			log.Printf("Mine: error getting base image manifest: %v", err)
+			log.Printf("Mine: retrying in %s seconds\n", t.Round(time.Second).String())
+		}); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// pullBaseImage pulls img once no job is transferring data, canceling & restarting the pull
+// if a job starts transferring before it finishes. Layers pulled before a pause are kept
+func pullBaseImage(ctx context.Context, runtime worker.ContainerRuntime, pool *workerPool, authToken string, img worker.BaseImage) error {
+	dockerAuthConfig := types.AuthConfig{
+		RegistryToken: authToken,
+	}
+	dockerAuthJSON, err := json.Marshal(dockerAuthConfig)
+	if err != nil {
+		return fmt.Errorf("marshaling docker auth config: %v", err)
+	}
+	dockerAuthStr := base64.URLEncoding.EncodeToString(dockerAuthJSON)
+
+	for {
+		for pool.transferring() {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(seedPausePeriod):
+			}
+		}
+
+		size := "unknown size"
+		if img.Size > 0 {
+			size = humanize.Bytes(img.Size)
+		}
+		log.Printf("Pulling base image %s (cuda %s, ubuntu %s; %s)...\n", img.Ref, img.CUDA, img.Ubuntu, size)
+		pullCtx, cancelPull := context.WithCancel(ctx)
+		paused := make(chan struct{})
+		go func() {
+			for {
+				select {
+				case <-pullCtx.Done():
+					return
+				case <-time.After(seedPausePeriod):
+				}
+				if pool.transferring() {
+					close(paused)
+					cancelPull()
+					return
+				}
+			}
+		}()
+
+		operation := func() error {
+			pullResp, err := runtime.ImagePull(pullCtx, img.Ref, dockerAuthStr)
+			if err != nil {
+				return err
+			}
+			defer check.Err(pullResp.Close)
+
+			return jsonmessage.DisplayJSONMessagesStream(pullResp, os.Stdout, os.Stdout.Fd(), nil)
+		}
+		err := backoff.RetryNotify(operation,
+			backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 3), pullCtx),
+			func(err error, t time.Duration) {
+				log.Printf("Error pulling base image %s: %v", img.Ref, err)
+				log.Printf("Retrying in %s seconds\n", t.Round(time.Second).String())
+			})
+		cancelPull()
+		select {
+		case <-paused:
+			log.Printf("Pausing base image pull while jobs transfer data...\n")
+			continue
+		default:
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("Base image %s pulled\n", img.Ref)
+		return nil
+	}
+}
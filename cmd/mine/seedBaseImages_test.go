@@ -0,0 +1,96 @@
+package mine
+
+import (
+	"context"
+	"github.com/wminshew/emrysclient/pkg/fakeserver"
+	"github.com/wminshew/emrysclient/pkg/sim"
+	"github.com/wminshew/emrysclient/pkg/worker"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// unavailableTransport answers every request with a 503
+type unavailableTransport struct{}
+
+func (unavailableTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusServiceUnavailable,
+		Body:       ioutil.NopCloser(strings.NewReader("unavailable")),
+		Request:    req,
+	}, nil
+}
+
+func TestSeedBaseImages(t *testing.T) {
+	serverImages := []worker.BaseImage{
+		{Ref: "registry.emrys.io/emrys/base:16.04-9.0", CUDA: "9.0", Ubuntu: "16.04"},
+		{Ref: "registry.emrys.io/emrys/base:18.04-10.0", CUDA: "10.0", Ubuntu: "18.04"},
+	}
+	tests := []struct {
+		name        string
+		unavailable bool
+		want        []worker.BaseImage
+	}{
+		{"server manifest", false, serverImages},
+		{"server unavailable", true, defaultBaseImages},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := fakeserver.DefaultScenario()
+			s.BaseImages = serverImages
+			srv := fakeserver.New(s)
+			defer srv.Close()
+			client := srv.Client()
+			if tt.unavailable {
+				client.Transport = unavailableTransport{}
+			}
+			runtime := sim.NewRuntime([]*sim.GPU{sim.NewGPU(0)})
+			images := worker.NewImageCache(runtime, 0, 0)
+			// an image the manifest doesn't mention isn't pinned, so it's evicted
+			out, err := runtime.ImagePull(context.Background(), "registry.emrys.io/miner/old-job", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = out.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			seeded := make(chan struct{})
+			go func() {
+				defer close(seeded)
+				seedBaseImages(ctx, client, &s.Token, runtime, images, newWorkerPool(nil), srv.URL())
+			}()
+			want := []string{}
+			for _, img := range tt.want {
+				want = append(want, img.Ref)
+			}
+			sort.Strings(want)
+			// with no budget, only the pinned base images survive eviction
+			waitFor(t, "base images to be pinned & the rest evicted", func() bool {
+				stats, err := images.Stats(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				pinned := append([]string{}, stats.BaseImages...)
+				sort.Strings(pinned)
+				left := []string{}
+				for _, img := range stats.Images {
+					left = append(left, img.Refs...)
+				}
+				sort.Strings(left)
+				return reflect.DeepEqual(pinned, want) && reflect.DeepEqual(left, want)
+			})
+			cancel()
+			<-seeded
+
+			hits := srv.Hits("GET api.emrys.io /miner/images/base")
+			if tt.unavailable && hits != 0 {
+				t.Errorf("manifest fetched %d times from an unavailable server", hits)
+			} else if !tt.unavailable && hits != 1 {
+				t.Errorf("manifest fetched %d times, want 1", hits)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package mine
+
+import (
+	"context"
+	"github.com/wminshew/emrysclient/pkg/fakeserver"
+	"github.com/wminshew/emrysclient/pkg/worker"
+	"log"
+	"math/rand"
+	"time"
+)
+
+const (
+	simProject       = "simulation"
+	simToken         = "simulated-token"
+	simMinerID       = "simulated-miner"
+	simPollTimeout   = 10 * time.Second
+	simMeanJobPeriod = 45 * time.Second
+)
+
+// simBaseImages is the fake server's base image manifest
+var simBaseImages = []worker.BaseImage{
+	{
+		Ref:    "registry.emrys.io/emrys/base:18.04-10.1",
+		CUDA:   "10.1",
+		Ubuntu: "18.04",
+		Size:   2500 * 1000 * 1000,
+	},
+	{
+		Ref:    "registry.emrys.io/emrys/base:18.04-10.0",
+		CUDA:   "10.0",
+		Ubuntu: "18.04",
+		Size:   2400 * 1000 * 1000,
+	},
+}
+
+// postSimulatedJobs regularly puts synthetic jobs up for auction on the fake server
+func postSimulatedJobs(ctx context.Context, srv *fakeserver.Server) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(rand.ExpFloat64() * float64(simMeanJobPeriod))):
+		}
+
+		jID, err := srv.PostJob(simProject, false)
+		if err != nil {
+			log.Printf("Mine: simulate: error posting job: %v", err)
+			continue
+		}
+		log.Printf("Mine: simulate: posted job %s\n", jID)
+	}
+}
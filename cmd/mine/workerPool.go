@@ -0,0 +1,193 @@
+package mine
+
+import (
+	"context"
+	"fmt"
+	"github.com/wminshew/emrysclient/pkg/worker"
+	"log"
+	"sync"
+)
+
+const firstNotebookPort = 8889
+
+// workerPool tracks the rig's active workers as devices are added & removed
+type workerPool struct {
+	// newWorker constructs the Worker for device d
+	newWorker func(d uint, s worker.Settings, port string) *worker.Worker
+	mu        sync.Mutex
+	workers   []*worker.Worker
+	cancels   map[*worker.Worker]context.CancelFunc
+	retiring  map[*worker.Worker]chan struct{}
+	nextPort  int
+}
+
+func newWorkerPool(newWorker func(d uint, s worker.Settings, port string) *worker.Worker) *workerPool {
+	return &workerPool{
+		newWorker: newWorker,
+		cancels:   make(map[*worker.Worker]context.CancelFunc),
+		retiring:  make(map[*worker.Worker]chan struct{}),
+		nextPort:  firstNotebookPort,
+	}
+}
+
+// list returns the active workers
+func (p *workerPool) list() []*worker.Worker {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*worker.Worker{}, p.workers...)
+}
+
+// counts returns the number of outstanding bids & jobs in process across the pool's
+// workers, including those being retired
+func (p *workerPool) counts() (bidsOut, jobsInProcess int) {
+	p.mu.Lock()
+	workers := append([]*worker.Worker{}, p.workers...)
+	for w := range p.retiring {
+		workers = append(workers, w)
+	}
+	p.mu.Unlock()
+
+	for _, w := range workers {
+		switch w.State() {
+		case worker.StateIdle:
+		case worker.StateBidding:
+			bidsOut++
+		default:
+			jobsInProcess++
+		}
+	}
+	return bidsOut, jobsInProcess
+}
+
+// transferring reports whether any of the pool's workers, including those being retired, is
+// downloading or uploading a job's image & data
+func (p *workerPool) transferring() bool {
+	p.mu.Lock()
+	workers := append([]*worker.Worker{}, p.workers...)
+	for w := range p.retiring {
+		workers = append(workers, w)
+	}
+	p.mu.Unlock()
+
+	for _, w := range workers {
+		switch w.State() {
+		case worker.StateWon, worker.StatePreparing, worker.StateUploading:
+			return true
+		}
+	}
+	return false
+}
+
+// add starts a worker for device d
+func (p *workerPool) add(ctx context.Context, d uint, s worker.Settings) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.addLocked(ctx, d, s)
+}
+
+func (p *workerPool) addLocked(ctx context.Context, d uint, s worker.Settings) error {
+	w := p.newWorker(d, s, fmt.Sprintf("%d", p.nextPort))
+	if err := w.InitGPUMonitoring(); err != nil {
+		return fmt.Errorf("device %d: initializing gpu monitoring: %v", d, err)
+	}
+	p.nextPort++
+
+	wCtx, cancel := context.WithCancel(ctx)
+	w.Miner.Init(wCtx)
+	go w.UserGPULog(wCtx, gpuPeriod)
+
+	p.workers = append(p.workers, w)
+	p.cancels[w] = cancel
+	return nil
+}
+
+// reconfigure applies cfgs to the pool: existing workers are reconfigured, new
+// devices are added & devices no longer configured are retired
+func (p *workerPool) reconfigure(ctx context.Context, cfgs []deviceConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	existing := make(map[uint]*worker.Worker)
+	for _, w := range p.workers {
+		existing[w.Device] = w
+	}
+	retiring := make(map[uint]*worker.Worker)
+	for w := range p.retiring {
+		retiring[w.Device] = w
+	}
+
+	configured := make(map[uint]struct{})
+	for _, cfg := range cfgs {
+		configured[cfg.Device] = struct{}{}
+		if w, ok := existing[cfg.Device]; ok {
+			w.Reconfigure(cfg.Settings)
+			continue
+		}
+		if w, ok := retiring[cfg.Device]; ok {
+			// the device's worker may still be finishing a job; keep it rather than start
+			// a second worker on the same gpu
+			log.Printf("Mine: keeping device %d\n", cfg.Device)
+			close(p.retiring[w])
+			delete(p.retiring, w)
+			w.Reconfigure(cfg.Settings)
+			p.workers = append(p.workers, w)
+			continue
+		}
+		log.Printf("Mine: adding device %d\n", cfg.Device)
+		if err := p.addLocked(ctx, cfg.Device, cfg.Settings); err != nil {
+			log.Printf("Mine: error adding device: %v", err)
+		}
+	}
+
+	workers := []*worker.Worker{}
+	for _, w := range p.workers {
+		if _, ok := configured[w.Device]; ok {
+			workers = append(workers, w)
+			continue
+		}
+		log.Printf("Mine: removing device %d\n", w.Device)
+		keep := make(chan struct{})
+		p.retiring[w] = keep
+		go p.retire(ctx, w, keep)
+	}
+	p.workers = workers
+}
+
+// retire stops w once it finishes any outstanding bid or in-process job, unless keep is
+// closed first. w must already be removed from the pool's workers so it can't start another
+func (p *workerPool) retire(ctx context.Context, w *worker.Worker, keep <-chan struct{}) {
+	events, unsubscribe := w.Subscribe()
+	defer unsubscribe()
+	if s := w.State(); s != worker.StateIdle {
+		log.Printf("Mine: device %d: %s; waiting for it to finish before removing\n", w.Device, s)
+	}
+	for w.State() != worker.StateIdle && ctx.Err() == nil {
+		select {
+		case <-ctx.Done():
+		case <-keep:
+			return
+		case <-events:
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-keep:
+		return
+	default:
+	}
+	delete(p.retiring, w)
+	p.cancels[w]()
+	delete(p.cancels, w)
+	if ctx.Err() == nil {
+		log.Printf("Mine: device %d removed\n", w.Device)
+	}
+}
+
+// stopMiners stops the cryptominers of all active workers
+func (p *workerPool) stopMiners() {
+	for _, w := range p.list() {
+		w.Miner.Stop()
+	}
+}
@@ -0,0 +1,156 @@
+package notebook
+
+import (
+	"context"
+	"fmt"
+	"github.com/wminshew/emrys/pkg/check"
+	"github.com/wminshew/emrysclient/cmd/version"
+	"github.com/wminshew/emrysclient/pkg/job"
+	"github.com/wminshew/emrysclient/pkg/token"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// execute dispatches notebook j to the emrys api at u with client, forwards local requests to it
+// with the command forward returns, & saves its output once the user stops it by sending on stop.
+// It returns the notebook's output directory, or blank if it was canceled before it ran
+func execute(ctx context.Context, client *http.Client, u url.URL, j *job.Job, stop <-chan os.Signal, refreshAt time.Time,
+	forward func(ctx context.Context, sshKeyFile string) *exec.Cmd) (string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	j.Client = client
+	var mu sync.Mutex
+	jobCanceled := false
+	auctionComplete := false
+	go func() {
+		select {
+		case <-stop:
+			mu.Lock()
+			jobCanceled = true
+			mu.Unlock()
+			log.Printf("Cancellation request received: please wait for notebook to successfully cancel\n")
+			log.Printf("Warning: failure to successfully cancel notebook may result in undesirable charges\n")
+			if err := j.Cancel(u); err != nil {
+				log.Printf("Notebook: error canceling: %v", err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if !auctionComplete {
+				cancel()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}()
+	canceled := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return jobCanceled
+	}
+
+	if err := version.CheckRun(ctx, client, u); err != nil {
+		log.Printf("Please execute emrys update")
+		return "", fmt.Errorf("version: %v", err)
+	}
+
+	if err := j.Send(ctx, u); err != nil {
+		return "", fmt.Errorf("sending requirements: %v", err)
+	}
+	go func() {
+		for {
+			if err := token.Monitor(ctx, client, u, &j.AuthToken, refreshAt); err != nil {
+				log.Printf("Token: refresh error: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+		}
+	}()
+
+	sshKeyFile, err := j.SaveSSHKey()
+	if err != nil {
+		return "", fmt.Errorf("saving key: %v", err)
+	}
+	defer func() {
+		if err := os.Remove(sshKeyFile); err != nil {
+			log.Printf("Notebook: error removing ssh key: %v", err)
+			return
+		}
+	}()
+
+	if err := check.ContextCanceled(ctx); err != nil {
+		return "", nil
+	}
+	errCh := make(chan error, 2)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go j.BuildImage(ctx, &wg, errCh, u)
+	go j.SyncData(ctx, &wg, errCh, u)
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-ctx.Done():
+		return "", nil
+	case err := <-errCh:
+		if err := j.Cancel(u); err != nil {
+			log.Printf("Notebook: error canceling: %v", err)
+		}
+		return "", fmt.Errorf("preparing notebook: %v", err)
+	case <-done:
+	}
+
+	if err := j.RunAuction(ctx, u); err != nil {
+		if err := j.Cancel(u); err != nil {
+			log.Printf("Notebook: error canceling: %v", err)
+		}
+		return "", fmt.Errorf("running auction: %v", err)
+	}
+	mu.Lock()
+	auctionComplete = true
+	mu.Unlock()
+
+	if canceled() {
+		return "", nil
+	}
+	outputDir := filepath.Join(j.Output, j.ID)
+	if err = os.MkdirAll(outputDir, 0755); err != nil {
+		return "", fmt.Errorf("making output dir %v: %v", outputDir, err)
+	}
+
+	log.Printf("Executing notebook %s...\n", j.ID)
+	sshCmd := forward(ctx, sshKeyFile)
+	if err := sshCmd.Start(); err != nil {
+		return "", fmt.Errorf("local forwarding requests: %v", err)
+	}
+	defer func() {
+		if err := sshCmd.Process.Kill(); err != nil {
+			log.Printf("Notebook: error killing local forwarding process: %v", err)
+			return
+		}
+	}()
+	if err := j.StreamOutputLog(ctx, u); err != nil {
+		return "", fmt.Errorf("streaming output log: %v", err)
+	}
+	// TODO: replace w/ longpoll checking when miner has started uploading output data
+	time.Sleep(buffer)
+	if err := j.DownloadOutputData(ctx, u); err != nil {
+		return "", fmt.Errorf("downloading output data: %v", err)
+	}
+
+	if !canceled() {
+		log.Printf("Complete!\n")
+	}
+	return outputDir, nil
+}
@@ -6,9 +6,7 @@ import (
 	"github.com/dgrijalva/jwt-go"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"github.com/wminshew/emrys/pkg/check"
 	specs "github.com/wminshew/emrys/pkg/job"
-	"github.com/wminshew/emrysclient/cmd/version"
 	"github.com/wminshew/emrysclient/pkg/job"
 	"github.com/wminshew/emrysclient/pkg/token"
 	"log"
@@ -19,7 +17,6 @@ import (
 	"os/user"
 	"path/filepath"
 	"strconv"
-	"sync"
 	"time"
 )
 
@@ -33,7 +30,8 @@ func init() {
 	Cmd.Flags().StringP("conda-env", "e", "", "Path to conda environment yaml")
 	Cmd.Flags().StringP("pip-reqs", "r", "", "Path to pip requirements file")
 	Cmd.Flags().StringP("main", "m", "", "Path to main execution file")
-	Cmd.Flags().StringP("data", "d", "", "Path to the data directory")
+	Cmd.Flags().StringP("data", "d", "", "Path to the data directory, or an s3://, gs:// or https:// URL the miner fetches into ./data (pinned by emrys-data.lock)")
+	Cmd.Flags().String("dataset", "", "Named dataset to use instead of a data directory, as name[@version or tag] (see emrys data). Defaults to the latest version")
 	Cmd.Flags().StringP("output", "o", "", "Path to save the output directory (required)")
 	Cmd.Flags().Float64("rate", 0, "Maximum $ / hr willing to pay for job")
 	Cmd.Flags().String("gpu", "k80", "Minimum acceptable gpu for job. Defaults to k80")
@@ -73,6 +71,9 @@ var Cmd = &cobra.Command{
 			if err := viper.BindPFlag("user.data", cmd.Flags().Lookup("data")); err != nil {
 				return err
 			}
+			if err := viper.BindPFlag("user.dataset", cmd.Flags().Lookup("dataset")); err != nil {
+				return err
+			}
 			if err := viper.BindPFlag("user.output", cmd.Flags().Lookup("output")); err != nil {
 				return err
 			}
@@ -155,7 +156,6 @@ var Cmd = &cobra.Command{
 		}
 
 		j := &job.Job{
-			Client:    client,
 			AuthToken: authToken,
 			Project:   viper.GetString("user.project"),
 			CondaEnv:  viper.GetString("user.conda-env"),
@@ -163,6 +163,7 @@ var Cmd = &cobra.Command{
 			Main:      viper.GetString("user.main"),
 			Notebook:  true,
 			Data:      viper.GetString("user.data"),
+			Dataset:   viper.GetString("user.dataset"),
 			Output:    viper.GetString("user.output"),
 			GPURaw:    viper.GetString("user.gpu"),
 			RAMStr:    viper.GetString("user.ram"),
@@ -179,133 +180,11 @@ var Cmd = &cobra.Command{
 
 		stop := make(chan os.Signal, 1)
 		signal.Notify(stop, os.Interrupt)
-		ctx, cancel := context.WithCancel(context.Background())
-		defer func() {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				cancel()
-			}
-		}()
-		jobCanceled := false
-		auctionComplete := false
-		go func() {
-			select {
-			case <-stop:
-				jobCanceled = true
-				log.Printf("Cancellation request received: please wait for notebook to successfully cancel\n")
-				log.Printf("Warning: failure to successfully cancel notebook may result in undesirable charges\n")
-				if err := j.Cancel(u); err != nil {
-					log.Printf("Run: error canceling: %v", err)
-					return
-				}
-				if !auctionComplete {
-					cancel()
-				}
-			case <-ctx.Done():
-				return
-			}
-		}()
-
-		if err := version.CheckRun(ctx, client, u); err != nil {
-			log.Printf("Notebook: version error: %v", err)
-			log.Printf("Please execute emrys update")
-			return
-		}
-
-		if err := j.Send(ctx, u); err != nil {
-			log.Printf("Notebook: error sending requirements: %v", err)
-			return
-		}
-		go func() {
-			for {
-				if err := token.Monitor(ctx, client, u, &j.AuthToken, refreshAt); err != nil {
-					log.Printf("Token: refresh error: %v", err)
-				}
-				select {
-				case <-ctx.Done():
-					return
-				default:
-				}
-			}
-		}()
-
-		sshKeyFile, err := j.SaveSSHKey()
+		outputDir, err := execute(context.Background(), client, u, j, stop, refreshAt, j.SSHLocalForward)
 		if err != nil {
-			log.Printf("Notebook: error saving key: %v", err)
+			log.Printf("Notebook: error %v", err)
 			return
-		}
-		defer func() {
-			if err := os.Remove(sshKeyFile); err != nil {
-				log.Printf("Notebook: error removing ssh key: %v", err)
-				return
-			}
-		}()
-
-		if err := check.ContextCanceled(ctx); err != nil {
-			return
-		}
-		errCh := make(chan error, 2)
-		var wg sync.WaitGroup
-		wg.Add(2)
-		go j.BuildImage(ctx, &wg, errCh, u)
-		go j.SyncData(ctx, &wg, errCh, u)
-		done := make(chan struct{})
-		go func() {
-			wg.Wait()
-			close(done)
-		}()
-		select {
-		case <-ctx.Done():
-			return
-		case <-errCh:
-			if err := j.Cancel(u); err != nil {
-				log.Printf("Run: error canceling: %v", err)
-				return
-			}
-			return
-		case <-done:
-		}
-
-		if err := j.RunAuction(ctx, u); err != nil {
-			if err := j.Cancel(u); err != nil {
-				log.Printf("Run: error canceling: %v", err)
-				return
-			}
-			return // already logged
-		}
-		auctionComplete = true
-
-		if jobCanceled {
-			return
-		}
-		outputDir := filepath.Join(j.Output, j.ID)
-		if err = os.MkdirAll(outputDir, 0755); err != nil {
-			log.Printf("Output data: error making output dir %v: %v", outputDir, err)
-			return
-		}
-
-		log.Printf("Executing notebook %s...\n", j.ID)
-		sshCmd := j.SSHLocalForward(ctx, sshKeyFile)
-		if err := sshCmd.Start(); err != nil {
-			log.Printf("Notebook: error local forwarding requests: %v", err)
-			return
-		}
-		defer func() {
-			if err := sshCmd.Process.Kill(); err != nil {
-				log.Printf("Notebook: error killing local forwarding process: %v", err)
-				return
-			}
-		}()
-		if err := j.StreamOutputLog(ctx, u); err != nil {
-			log.Printf("Output log: error: %v", err)
-			return
-		}
-		// TODO: replace w/ longpoll checking when miner has started uploading output data
-		time.Sleep(buffer)
-		if err := j.DownloadOutputData(ctx, u); err != nil {
-			log.Printf("Output data: error: %v", err)
+		} else if outputDir == "" {
 			return
 		}
 
@@ -327,9 +206,5 @@ var Cmd = &cobra.Command{
 				log.Printf("Notebook: error walking output directory: %v", err)
 			}
 		}
-
-		if !jobCanceled {
-			log.Printf("Complete!\n")
-		}
 	},
 }
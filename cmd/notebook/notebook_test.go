@@ -0,0 +1,115 @@
+package notebook
+
+import (
+	"context"
+	specs "github.com/wminshew/emrys/pkg/job"
+	"github.com/wminshew/emrysclient/pkg/fakeserver"
+	"github.com/wminshew/emrysclient/pkg/job"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// forwardNothing stands in for ssh, which can't reach the fake server
+func forwardNothing(ctx context.Context, sshKeyFile string) *exec.Cmd {
+	return exec.CommandContext(ctx, "sleep", "60")
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name     string
+		scenario func(s *fakeserver.Scenario)
+		wantErr  string
+		canceled bool
+	}{
+		{
+			name: "bad gateway storm",
+			scenario: func(s *fakeserver.Scenario) {
+				s.BadGatewayStorm = 1
+			},
+		},
+		{
+			name: "auction payment required",
+			scenario: func(s *fakeserver.Scenario) {
+				s.AuctionPaymentRequired = true
+			},
+			wantErr: "running auction",
+		},
+		{
+			name: "canceled after logs",
+			scenario: func(s *fakeserver.Scenario) {
+				s.CancelAfterLogs = 1
+			},
+			canceled: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := fakeserver.DefaultScenario()
+			s.Miner = &fakeserver.ScriptedMiner{
+				Log:       []string{"[I NotebookApp] Serving notebooks\n", "[I NotebookApp] Saving file\n"},
+				LogPeriod: 50 * time.Millisecond,
+				Output:    map[string]string{"notebook.ipynb": "{}"},
+			}
+			tt.scenario(s)
+			srv := fakeserver.New(s)
+			defer srv.Close()
+
+			dir, err := ioutil.TempDir("", "emrys-notebook-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			j := &job.Job{
+				AuthToken: s.Token,
+				Project:   "test",
+				Notebook:  true,
+				Output:    filepath.Join(dir, "output"),
+				GPURaw:    "k80",
+				RAMStr:    "1gb",
+				DiskStr:   "1gb",
+				PCIEStr:   "8x",
+				Specs:     &specs.Specs{},
+			}
+			if err := j.ValidateAndTransform(); err != nil {
+				t.Fatal(err)
+			}
+
+			stop := make(chan os.Signal, 1)
+			outputDir, err := execute(context.Background(), srv.Client(), srv.URL(), j, stop, time.Now().Add(time.Hour), forwardNothing)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %s", err, tt.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(j.SSHKey) != string(s.SSHKey) {
+				t.Errorf("ssh key = %q, want %q", j.SSHKey, s.SSHKey)
+			}
+			b, err := ioutil.ReadFile(filepath.Join(outputDir, "data", "notebook.ipynb"))
+			if err != nil {
+				t.Fatal(err)
+			} else if string(b) != "{}" {
+				t.Errorf("notebook.ipynb = %q, want %q", b, "{}")
+			}
+			js, err := srv.Job(j.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if js.Canceled != tt.canceled {
+				t.Errorf("canceled = %v, want %v", js.Canceled, tt.canceled)
+			}
+			if !strings.Contains(string(js.Log), "Serving notebooks") {
+				t.Errorf("log = %q, want the notebook's startup", js.Log)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"github.com/spf13/cobra"
+	"github.com/wminshew/emrysclient/cmd/data"
 	"github.com/wminshew/emrysclient/cmd/feedback"
 	"github.com/wminshew/emrysclient/cmd/login"
 	"github.com/wminshew/emrysclient/cmd/mine"
@@ -36,6 +37,7 @@ func init() {
 	rootCmd.AddCommand(login.Cmd)
 	rootCmd.AddCommand(run.Cmd)
 	rootCmd.AddCommand(notebook.Cmd)
+	rootCmd.AddCommand(data.Cmd)
 	rootCmd.AddCommand(mine.Cmd)
 	rootCmd.AddCommand(update.Cmd)
 	rootCmd.AddCommand(feedback.Cmd)
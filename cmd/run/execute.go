@@ -0,0 +1,162 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"github.com/wminshew/emrys/pkg/check"
+	"github.com/wminshew/emrysclient/cmd/version"
+	"github.com/wminshew/emrysclient/pkg/job"
+	"github.com/wminshew/emrysclient/pkg/token"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// execute dispatches j to the emrys api at u with client & saves its output, until it completes
+// or the user cancels it by sending on stop. It returns the path the output was saved to: the
+// job's output directory, or the file listing its URLs if it went to an object store. The path
+// is blank if the job was canceled before it ran
+func execute(ctx context.Context, client *http.Client, u url.URL, j *job.Job, stop <-chan os.Signal, refreshAt time.Time, checkpoints bool) (string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	j.Client = client
+	var mu sync.Mutex
+	jobCanceled := false
+	auctionComplete := false
+	go func() {
+		select {
+		case <-stop:
+			mu.Lock()
+			jobCanceled = true
+			mu.Unlock()
+			log.Printf("Cancellation request received: please wait for job to successfully cancel\n")
+			log.Printf("Warning: failure to successfully cancel job may result in undesirable charges\n")
+			// j.cancel returns when job successfully canceled
+			if err := j.Cancel(u); err != nil {
+				log.Printf("Run: error canceling: %v", err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if !auctionComplete {
+				cancel()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}()
+	canceled := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return jobCanceled
+	}
+
+	if err := version.CheckRun(ctx, client, u); err != nil {
+		log.Printf("Please execute emrys update")
+		return "", fmt.Errorf("version: %v", err)
+	}
+
+	if err := j.Send(ctx, u); err != nil {
+		return "", fmt.Errorf("sending requirements: %v", err)
+	}
+	if j.OutputLocation != nil {
+		if err := j.SendOutputDestination(ctx, u); err != nil {
+			if err := j.Cancel(u); err != nil {
+				log.Printf("Run: error canceling: %v", err)
+			}
+			return "", fmt.Errorf("sending output destination: %v", err)
+		}
+	}
+
+	go func() {
+		for {
+			if err := token.Monitor(ctx, client, u, &j.AuthToken, refreshAt); err != nil {
+				log.Printf("Run: token: refresh error: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+		}
+	}()
+
+	if err := check.ContextCanceled(ctx); err != nil {
+		return "", nil
+	}
+	errCh := make(chan error, 2)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go j.BuildImage(ctx, &wg, errCh, u)
+	go j.SyncData(ctx, &wg, errCh, u)
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-ctx.Done():
+		return "", nil
+	case err := <-errCh:
+		if err := j.Cancel(u); err != nil {
+			log.Printf("Run: error canceling: %v", err)
+		}
+		return "", fmt.Errorf("preparing job: %v", err)
+	case <-done:
+	}
+
+	if err := j.RunAuction(ctx, u); err != nil {
+		if err := j.Cancel(u); err != nil {
+			log.Printf("Run: error canceling: %v", err)
+		}
+		return "", fmt.Errorf("running auction: %v", err)
+	}
+	mu.Lock()
+	auctionComplete = true
+	mu.Unlock()
+
+	if canceled() {
+		return "", nil
+	}
+	outputDir := filepath.Join(j.Output, j.ID)
+	if j.OutputLocation == nil {
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			return "", fmt.Errorf("making output dir %v: %v", outputDir, err)
+		}
+	}
+
+	log.Printf("Executing job %s...\n", j.ID)
+	checkpointCtx, stopCheckpoints := context.WithCancel(ctx)
+	checkpointsDone := make(chan struct{})
+	go func() {
+		defer close(checkpointsDone)
+		if checkpoints && j.OutputLocation == nil {
+			j.DownloadCheckpoints(checkpointCtx, u)
+		}
+	}()
+	err := j.StreamOutputLog(ctx, u)
+	stopCheckpoints()
+	<-checkpointsDone
+	if err != nil {
+		return "", fmt.Errorf("streaming output log: %v", err)
+	}
+	// TODO: replace w/ longpoll checking when miner has started uploading output data
+	time.Sleep(buffer)
+	saved := outputDir
+	if j.OutputLocation != nil {
+		if saved, err = j.RecordOutputURLs(ctx, u); err != nil {
+			return "", fmt.Errorf("recording output urls: %v", err)
+		}
+	} else if err := j.DownloadOutputData(ctx, u); err != nil {
+		return "", fmt.Errorf("downloading output data: %v", err)
+	}
+
+	if !canceled() {
+		log.Printf("Complete!\n")
+	}
+	return saved, nil
+}
@@ -6,9 +6,7 @@ import (
 	"github.com/dgrijalva/jwt-go"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"github.com/wminshew/emrys/pkg/check"
 	specs "github.com/wminshew/emrys/pkg/job"
-	"github.com/wminshew/emrysclient/cmd/version"
 	"github.com/wminshew/emrysclient/pkg/job"
 	"github.com/wminshew/emrysclient/pkg/token"
 	"log"
@@ -19,7 +17,6 @@ import (
 	"os/user"
 	"path/filepath"
 	"strconv"
-	"sync"
 	"time"
 )
 
@@ -33,13 +30,17 @@ func init() {
 	Cmd.Flags().StringP("conda-env", "e", "", "Path to conda environment yaml")
 	Cmd.Flags().StringP("pip-reqs", "r", "", "Path to pip requirements file")
 	Cmd.Flags().StringP("main", "m", "", "Path to main execution file (required)")
-	Cmd.Flags().StringP("data", "d", "", "Path to the data directory")
-	Cmd.Flags().StringP("output", "o", "", "Path to save the output directory (required)")
+	Cmd.Flags().StringP("data", "d", "", "Path to the data directory, or an s3://, gs:// or https:// URL the miner fetches into ./data (pinned by emrys-data.lock)")
+	Cmd.Flags().String("dataset", "", "Named dataset to use instead of a data directory, as name[@version or tag] (see emrys data). Defaults to the latest version")
+	Cmd.Flags().StringP("output", "o", "", "Path to save the output directory, or s3://bucket/prefix to have the miner upload it there (required)")
+	Cmd.Flags().StringSlice("output-include", []string{}, "Only download output files matching these globs, e.g. '*.json' or 'results/*'. A glob matching a directory includes everything in it")
+	Cmd.Flags().StringSlice("output-exclude", []string{}, "Don't download output files matching these globs, e.g. 'checkpoints'. Applied after output-include")
 	Cmd.Flags().Float64("rate", 0, "Maximum $ / hr willing to pay for job")
 	Cmd.Flags().String("gpu", "k80", "Minimum acceptable gpu for job. Defaults to k80")
 	Cmd.Flags().String("ram", "8gb", "Minimum acceptable gb of available ram for job. Defaults to 8gb")
 	Cmd.Flags().String("disk", "25gb", "Minimum acceptable gb of disk space for job. Defaults to 25gb")
 	Cmd.Flags().String("pcie", "8x", "Minimum acceptable gpu pci-e for job. Defaults to 8x")
+	Cmd.Flags().Bool("checkpoints", true, "Download output checkpoints while the job runs, so they're kept if the job fails. Defaults to true")
 	Cmd.Flags().SortFlags = false
 }
 
@@ -73,9 +74,18 @@ var Cmd = &cobra.Command{
 			if err := viper.BindPFlag("user.data", cmd.Flags().Lookup("data")); err != nil {
 				return err
 			}
+			if err := viper.BindPFlag("user.dataset", cmd.Flags().Lookup("dataset")); err != nil {
+				return err
+			}
 			if err := viper.BindPFlag("user.output", cmd.Flags().Lookup("output")); err != nil {
 				return err
 			}
+			if err := viper.BindPFlag("user.output-include", cmd.Flags().Lookup("output-include")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("user.output-exclude", cmd.Flags().Lookup("output-exclude")); err != nil {
+				return err
+			}
 			if err := viper.BindPFlag("user.rate", cmd.Flags().Lookup("rate")); err != nil {
 				return err
 			}
@@ -91,6 +101,9 @@ var Cmd = &cobra.Command{
 			if err := viper.BindPFlag("user.pcie", cmd.Flags().Lookup("pcie")); err != nil {
 				return err
 			}
+			if err := viper.BindPFlag("user.checkpoints", cmd.Flags().Lookup("checkpoints")); err != nil {
+				return err
+			}
 			return nil
 		}(); err != nil {
 			log.Printf("Run: error binding pflag: %v", err)
@@ -155,7 +168,6 @@ var Cmd = &cobra.Command{
 		}
 
 		j := &job.Job{
-			Client:    client,
 			AuthToken: authToken,
 			Notebook:  false,
 			Project:   viper.GetString("user.project"),
@@ -163,11 +175,16 @@ var Cmd = &cobra.Command{
 			PipReqs:   viper.GetString("user.pip-reqs"),
 			Main:      viper.GetString("user.main"),
 			Data:      viper.GetString("user.data"),
+			Dataset:   viper.GetString("user.dataset"),
 			Output:    viper.GetString("user.output"),
-			GPURaw:    viper.GetString("user.gpu"),
-			RAMStr:    viper.GetString("user.ram"),
-			DiskStr:   viper.GetString("user.disk"),
-			PCIEStr:   viper.GetString("user.pcie"),
+			OutputFilter: job.OutputFilter{
+				Include: viper.GetStringSlice("user.output-include"),
+				Exclude: viper.GetStringSlice("user.output-exclude"),
+			},
+			GPURaw:  viper.GetString("user.gpu"),
+			RAMStr:  viper.GetString("user.ram"),
+			DiskStr: viper.GetString("user.disk"),
+			PCIEStr: viper.GetString("user.pcie"),
 			Specs: &specs.Specs{
 				Rate: viper.GetFloat64("user.rate"),
 			},
@@ -179,121 +196,24 @@ var Cmd = &cobra.Command{
 
 		stop := make(chan os.Signal, 1)
 		signal.Notify(stop, os.Interrupt)
-		ctx, cancel := context.WithCancel(context.Background())
-		defer func() {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				cancel()
-			}
-		}()
-		jobCanceled := false
-		auctionComplete := false
-		go func() {
-			select {
-			case <-stop:
-				jobCanceled = true
-				log.Printf("Cancellation request received: please wait for job to successfully cancel\n")
-				log.Printf("Warning: failure to successfully cancel job may result in undesirable charges\n")
-				// j.cancel returns when job successfully canceled
-				if err := j.Cancel(u); err != nil {
-					log.Printf("Run: error canceling: %v", err)
-					return
-				}
-				if !auctionComplete {
-					cancel()
-				}
-			case <-ctx.Done():
-				return
-			}
-		}()
-
-		if err := version.CheckRun(ctx, client, u); err != nil {
-			log.Printf("Run: version error: %v", err)
-			log.Printf("Please execute emrys update")
-			return
-		}
-
-		if err := j.Send(ctx, u); err != nil {
-			log.Printf("Run: error sending requirements: %v", err)
-			return
-		}
-
-		go func() {
-			for {
-				if err := token.Monitor(ctx, client, u, &j.AuthToken, refreshAt); err != nil {
-					log.Printf("Run: token: refresh error: %v", err)
-				}
-				select {
-				case <-ctx.Done():
-					return
-				default:
-				}
-			}
-		}()
-
-		if err := check.ContextCanceled(ctx); err != nil {
-			return
-		}
-		errCh := make(chan error, 2)
-		var wg sync.WaitGroup
-		wg.Add(2)
-		go j.BuildImage(ctx, &wg, errCh, u)
-		go j.SyncData(ctx, &wg, errCh, u)
-		done := make(chan struct{})
-		go func() {
-			wg.Wait()
-			close(done)
-		}()
-		select {
-		case <-ctx.Done():
+		saved, err := execute(context.Background(), client, u, j, stop, refreshAt, viper.GetBool("user.checkpoints"))
+		if err != nil {
+			log.Printf("Run: error %v", err)
 			return
-		case <-errCh:
-			if err := j.Cancel(u); err != nil {
-				log.Printf("Run: error canceling: %v", err)
-				return
-			}
+		} else if saved == "" {
 			return
-		case <-done:
 		}
 
-		if err := j.RunAuction(ctx, u); err != nil {
-			if err := j.Cancel(u); err != nil {
-				log.Printf("Run: error canceling: %v", err)
-				return
+		if os.Geteuid() == 0 && os.Getenv("SUDO_USER") != "" && j.OutputLocation != nil {
+			if err = os.Chown(saved, uid, gid); err != nil {
+				log.Printf("Run: error changing ownership: %v", err)
 			}
-			return // already logged
-		}
-		auctionComplete = true
-
-		if jobCanceled {
-			return
-		}
-		outputDir := filepath.Join(j.Output, j.ID)
-		if err = os.MkdirAll(outputDir, 0755); err != nil {
-			log.Printf("Output data: error making output dir %v: %v", outputDir, err)
-			return
-		}
-
-		log.Printf("Executing job %s...\n", j.ID)
-		if err := j.StreamOutputLog(ctx, u); err != nil {
-			log.Printf("Output log: error: %v", err)
-			return
-		}
-		// TODO: replace w/ longpoll checking when miner has started uploading output data
-		time.Sleep(buffer)
-		if err := j.DownloadOutputData(ctx, u); err != nil {
-			log.Printf("Output data: error: %v", err)
-			return
-		}
-
-		if os.Geteuid() == 0 && os.Getenv("SUDO_USER") != "" {
+		} else if os.Geteuid() == 0 && os.Getenv("SUDO_USER") != "" {
 			if err = os.Chown(j.Output, uid, gid); err != nil {
 				log.Printf("Run: error changing ownership: %v", err)
 			}
 
-			if err := filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+			if err := filepath.Walk(saved, func(path string, info os.FileInfo, err error) error {
 				if err != nil {
 					return err
 				}
@@ -306,9 +226,5 @@ var Cmd = &cobra.Command{
 				log.Printf("Run: error walking output directory: %v", err)
 			}
 		}
-
-		if !jobCanceled {
-			log.Printf("Complete!\n")
-		}
 	},
 }
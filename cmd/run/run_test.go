@@ -0,0 +1,124 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	specs "github.com/wminshew/emrys/pkg/job"
+	"github.com/wminshew/emrysclient/pkg/fakeserver"
+	"github.com/wminshew/emrysclient/pkg/job"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testJob returns a valid job in a temporary directory, which the returned func removes
+func testJob(t *testing.T, authToken string) (*job.Job, func()) {
+	dir, err := ioutil.TempDir("", "emrys-run-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	main := filepath.Join(dir, "main.py")
+	if err := ioutil.WriteFile(main, []byte("print('training')\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	j := &job.Job{
+		AuthToken: authToken,
+		Project:   "test",
+		Main:      main,
+		Output:    filepath.Join(dir, "output"),
+		GPURaw:    "k80",
+		RAMStr:    "1gb",
+		DiskStr:   "1gb",
+		PCIEStr:   "8x",
+		Specs:     &specs.Specs{},
+	}
+	if err := j.ValidateAndTransform(); err != nil {
+		t.Fatal(err)
+	}
+	return j, func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name     string
+		scenario func(s *fakeserver.Scenario)
+		wantErr  string
+		canceled bool
+	}{
+		{
+			name: "bad gateway storm",
+			scenario: func(s *fakeserver.Scenario) {
+				s.BadGatewayStorm = 1
+			},
+		},
+		{
+			name: "auction payment required",
+			scenario: func(s *fakeserver.Scenario) {
+				s.AuctionPaymentRequired = true
+			},
+			wantErr: "running auction",
+		},
+		{
+			name: "canceled after logs",
+			scenario: func(s *fakeserver.Scenario) {
+				s.CancelAfterLogs = 1
+			},
+			canceled: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := fakeserver.DefaultScenario()
+			s.Miner = &fakeserver.ScriptedMiner{
+				Log:       []string{"epoch 1\n", "epoch 2\n", "epoch 3\n"},
+				LogPeriod: 50 * time.Millisecond,
+				Output:    map[string]string{"model.txt": "trained"},
+			}
+			tt.scenario(s)
+			srv := fakeserver.New(s)
+			defer srv.Close()
+			j, cleanup := testJob(t, s.Token)
+			defer cleanup()
+
+			stop := make(chan os.Signal, 1)
+			saved, err := execute(context.Background(), srv.Client(), srv.URL(), j, stop, time.Now().Add(time.Hour), false)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %s", err, tt.wantErr)
+				}
+				if js, _ := srv.Job(j.ID); !js.Canceled {
+					t.Errorf("failed job wasn't canceled")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := filepath.Join(j.Output, j.ID); saved != want {
+				t.Errorf("saved = %s, want %s", saved, want)
+			}
+			b, err := ioutil.ReadFile(filepath.Join(saved, "data", "model.txt"))
+			if err != nil {
+				t.Fatal(err)
+			} else if string(b) != "trained" {
+				t.Errorf("model.txt = %q, want %q", b, "trained")
+			}
+			js, err := srv.Job(j.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if js.Canceled != tt.canceled {
+				t.Errorf("canceled = %v, want %v", js.Canceled, tt.canceled)
+			}
+			if canceled := bytes.Contains(js.Log, []byte("JOB CANCELED")); canceled != tt.canceled {
+				t.Errorf("log records cancellation = %v, want %v:\n%s", canceled, tt.canceled, js.Log)
+			}
+		})
+	}
+}
@@ -4,10 +4,10 @@ import (
 	"context"
 	"fmt"
 	"github.com/cenkalti/backoff"
-	"github.com/mholt/archiver"
 	"github.com/spf13/cobra"
 	"github.com/wminshew/emrys/pkg/check"
 	"github.com/wminshew/emrysclient/cmd/version"
+	"github.com/wminshew/emrysclient/pkg/extract"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -20,7 +20,12 @@ import (
 	"time"
 )
 
-const maxRetries = 10
+const (
+	maxRetries = 10
+	// maxUpdateBytes & maxUpdateFiles bound the client release archive
+	maxUpdateBytes = 500 * 1000 * 1000
+	maxUpdateFiles = 100
+)
 
 // Cmd exports version subcommand to root
 var Cmd = &cobra.Command{
@@ -92,7 +97,10 @@ var Cmd = &cobra.Command{
 					return backoff.Permanent(fmt.Errorf("server: %v", string(b)))
 				}
 
-				if err := archiver.TarGz.Read(resp.Body, tempDir); err != nil {
+				if err := extract.TarGz(resp.Body, tempDir, extract.Limits{
+					MaxBytes: maxUpdateBytes,
+					MaxFiles: maxUpdateFiles,
+				}); err != nil {
 					return backoff.Permanent(err)
 				}
 
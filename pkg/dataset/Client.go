@@ -0,0 +1,186 @@
+package dataset
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cenkalti/backoff"
+	"github.com/wminshew/emrys/pkg/check"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+)
+
+const (
+	maxRetries = 10
+	dataHost   = "data.emrys.io"
+)
+
+// Client manages the user's datasets with the server
+type Client struct {
+	AuthToken string
+	Client    *http.Client
+}
+
+// Dataset is a named dataset & its versions
+type Dataset struct {
+	Name     string    `json:"name"`
+	Versions []Version `json:"versions"`
+	// Tags maps each of the dataset's tags to the version it names
+	Tags map[string]string `json:"tags"`
+}
+
+// Version is an immutable snapshot of a dataset
+type Version struct {
+	Version string    `json:"version"`
+	Files   int       `json:"files"`
+	Size    int64     `json:"size"`
+	Created time.Time `json:"created"`
+}
+
+// PushResponse is the server's reply to a push: the version being created & the files it
+// doesn't already hold
+type PushResponse struct {
+	Version string   `json:"version"`
+	Upload  []string `json:"upload"`
+}
+
+// Push uploads the files under dir as a new version of dataset name, returning the version.
+// Only files the server doesn't already hold, from any version, are uploaded
+func (c *Client) Push(ctx context.Context, u url.URL, name, dir string) (string, error) {
+	old, err := readMetadataCache(name)
+	if err != nil {
+		return "", fmt.Errorf("retrieving dataset metadata: %v", err)
+	}
+	log.Printf("Dataset: hashing %s...\n", dir)
+	metadata, err := Scan(dir, old)
+	if err != nil {
+		return "", fmt.Errorf("walking directory %s: %v", dir, err)
+	} else if len(metadata) == 0 {
+		return "", fmt.Errorf("no files in %s", dir)
+	}
+	if err := writeMetadataCache(name, metadata); err != nil {
+		return "", fmt.Errorf("storing dataset metadata: %v", err)
+	}
+	b, err := json.Marshal(metadata)
+	if err != nil {
+		return "", fmt.Errorf("encoding metadata: %v", err)
+	}
+
+	u.Host = dataHost
+	u.Path = path.Join("user", "dataset", name)
+	push := PushResponse{}
+	if err := c.do(ctx, http.MethodPost, u, b, &push); err != nil {
+		return "", err
+	}
+	for _, relPath := range push.Upload {
+		if _, ok := metadata[relPath]; !ok {
+			return "", fmt.Errorf("server requested unknown file %s", relPath)
+		}
+	}
+	log.Printf("Dataset: %d of %d file(s) to upload\n", len(push.Upload), len(metadata))
+
+	u.Path = path.Join("user", "dataset", name, "version", push.Version)
+	if err := c.upload(ctx, u, dir, push.Upload); err != nil {
+		return "", err
+	}
+	u.Path = path.Join("user", "dataset", name, "version", push.Version, "commit")
+	if err := c.do(ctx, http.MethodPost, u, nil, nil); err != nil {
+		return "", fmt.Errorf("committing version %s: %v", push.Version, err)
+	}
+	return push.Version, nil
+}
+
+// List returns the user's datasets
+func (c *Client) List(ctx context.Context, u url.URL) ([]Dataset, error) {
+	u.Host = dataHost
+	u.Path = path.Join("user", "dataset")
+	datasets := []Dataset{}
+	if err := c.do(ctx, http.MethodGet, u, nil, &datasets); err != nil {
+		return nil, err
+	}
+	return datasets, nil
+}
+
+// Get returns dataset name
+func (c *Client) Get(ctx context.Context, u url.URL, name string) (*Dataset, error) {
+	u.Host = dataHost
+	u.Path = path.Join("user", "dataset", name)
+	d := &Dataset{}
+	if err := c.do(ctx, http.MethodGet, u, nil, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Remove deletes the version ref names, or the whole dataset if ref has no version. Files only
+// the deleted versions hold are removed from the server
+func (c *Client) Remove(ctx context.Context, u url.URL, ref Ref) error {
+	u.Host = dataHost
+	u.Path = path.Join("user", "dataset", ref.Name)
+	if ref.Version != "" {
+		u.Path = path.Join(u.Path, "version", ref.Version)
+	}
+	return c.do(ctx, http.MethodDelete, u, nil, nil)
+}
+
+// Tag points tag at the version ref names, moving it if it's already in use
+func (c *Client) Tag(ctx context.Context, u url.URL, ref Ref, tag string) error {
+	u.Host = dataHost
+	u.Path = path.Join("user", "dataset", ref.Name, "tag", tag)
+	return c.do(ctx, http.MethodPut, u, []byte(ref.Version), nil)
+}
+
+// Untag deletes tag from dataset name
+func (c *Client) Untag(ctx context.Context, u url.URL, name, tag string) error {
+	u.Host = dataHost
+	u.Path = path.Join("user", "dataset", name, "tag", tag)
+	return c.do(ctx, http.MethodDelete, u, nil, nil)
+}
+
+// do sends body, if any, to u & decodes the JSON response into out, if any
+func (c *Client) do(ctx context.Context, method string, u url.URL, body []byte, out interface{}) error {
+	operation := func() error {
+		var r io.Reader
+		if body != nil {
+			r = bytes.NewReader(body)
+		}
+		req, err := http.NewRequest(method, u.String(), r)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", c.AuthToken))
+		req = req.WithContext(ctx)
+
+		resp, err := c.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer check.Err(resp.Body.Close)
+
+		if resp.StatusCode == http.StatusBadGateway {
+			return fmt.Errorf("server: temporary error")
+		} else if resp.StatusCode >= 300 {
+			b, _ := ioutil.ReadAll(resp.Body)
+			return backoff.Permanent(fmt.Errorf("server: %v", string(b)))
+		}
+
+		if out != nil {
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				return fmt.Errorf("decoding json response: %v", err)
+			}
+		}
+		return nil
+	}
+	return backoff.RetryNotify(operation,
+		backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxRetries), ctx),
+		func(err error, t time.Duration) {
+			log.Printf("Dataset: error: %v", err)
+			log.Printf("Retrying in %s seconds\n", t.Round(time.Second).String())
+		})
+}
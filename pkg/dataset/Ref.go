@@ -0,0 +1,51 @@
+package dataset
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const namePattern = "^[a-z0-9][a-z0-9._-]{0,63}$"
+
+var nameRegexp = regexp.MustCompile(namePattern)
+
+// Ref names a version of a dataset, written name@version. The version may also be a tag, and
+// without one refers to the latest version
+type Ref struct {
+	Name    string
+	Version string
+}
+
+// ParseRef parses a name[@version] reference
+func ParseRef(s string) (Ref, error) {
+	r := Ref{Name: s}
+	if i := strings.Index(s, "@"); i >= 0 {
+		r.Name, r.Version = s[:i], s[i+1:]
+		if r.Version == "" {
+			return Ref{}, fmt.Errorf("dataset %s: empty version", s)
+		}
+	}
+	if err := ValidateName(r.Name); err != nil {
+		return Ref{}, err
+	}
+	if r.Version != "" && !nameRegexp.MatchString(r.Version) {
+		return Ref{}, fmt.Errorf("dataset version or tag (%s) must satisfy regex constraints: %s", r.Version, namePattern)
+	}
+	return r, nil
+}
+
+// ValidateName checks name can name a dataset
+func ValidateName(name string) error {
+	if !nameRegexp.MatchString(name) {
+		return fmt.Errorf("dataset name (%s) must satisfy regex constraints: %s", name, namePattern)
+	}
+	return nil
+}
+
+func (r Ref) String() string {
+	if r.Version == "" {
+		return r.Name
+	}
+	return r.Name + "@" + r.Version
+}
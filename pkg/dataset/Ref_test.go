@@ -0,0 +1,52 @@
+package dataset
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRef(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    Ref
+		wantErr bool
+	}{
+		{s: "imagenet", want: Ref{Name: "imagenet"}},
+		{s: "imagenet@v1", want: Ref{Name: "imagenet", Version: "v1"}},
+		{s: "imagenet@latest", want: Ref{Name: "imagenet", Version: "latest"}},
+		{s: "coco-2017.val_set@3", want: Ref{Name: "coco-2017.val_set", Version: "3"}},
+		{s: "0@0", want: Ref{Name: "0", Version: "0"}},
+		{s: strings.Repeat("a", 64), want: Ref{Name: strings.Repeat("a", 64)}},
+		{s: "", wantErr: true},
+		{s: "@v1", wantErr: true},
+		{s: "imagenet@", wantErr: true},
+		{s: "imagenet@v1@v2", wantErr: true},
+		{s: "ImageNet", wantErr: true},
+		{s: "image net", wantErr: true},
+		{s: "-imagenet", wantErr: true},
+		{s: ".imagenet", wantErr: true},
+		{s: "imagenet@-v1", wantErr: true},
+		{s: "imagenet@V1", wantErr: true},
+		{s: "image/net", wantErr: true},
+		{s: strings.Repeat("a", 65), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseRef(tt.s)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseRef(%q) = %+v, want error", tt.s, got)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("ParseRef(%q): %v", tt.s, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRef(%q) = %+v, want %+v", tt.s, got, tt.want)
+			}
+			if got.String() != tt.s {
+				t.Errorf("%+v.String() = %q, want %q", got, got.String(), tt.s)
+			}
+		})
+	}
+}
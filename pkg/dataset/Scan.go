@@ -0,0 +1,63 @@
+package dataset
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"github.com/wminshew/emrys/pkg/check"
+	"github.com/wminshew/emrys/pkg/job"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Scan returns the metadata of every file under dir, keyed by relative path. Files whose
+// modification time matches their entry in old keep its hash instead of being rehashed
+func Scan(dir string, old map[string]job.FileMetadata) (map[string]job.FileMetadata, error) {
+	metadata := make(map[string]job.FileMetadata)
+	if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rP, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		mT := info.ModTime().UnixNano()
+		if oldFileMd, ok := old[rP]; ok {
+			if oldFileMd.ModTime == mT {
+				metadata[rP] = oldFileMd
+				return nil
+			}
+		}
+		hStr, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		metadata[rP] = job.FileMetadata{
+			ModTime: mT,
+			Hash:    hStr,
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// hashFile returns the base64 MD5 of the file at p
+func hashFile(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer check.Err(f.Close)
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,91 @@
+package dataset
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/wminshew/emrys/pkg/check"
+	"github.com/wminshew/emrys/pkg/job"
+	"io"
+	"os"
+	"os/user"
+	"path"
+	"strconv"
+)
+
+// cacheUser returns the user whose config directory caches dataset metadata: the user who
+// invoked sudo, if any
+func cacheUser() (*user.User, error) {
+	u, err := user.Current()
+	if err != nil {
+		return nil, fmt.Errorf("getting current user: %v", err)
+	}
+	if os.Geteuid() == 0 && os.Getenv("SUDO_USER") != "" {
+		u, err = user.Lookup(os.Getenv("SUDO_USER"))
+		if err != nil {
+			return nil, fmt.Errorf("getting current sudo user: %v", err)
+		}
+	}
+	return u, nil
+}
+
+// readMetadataCache returns the metadata of dataset name's last push, or none
+func readMetadataCache(name string) (map[string]job.FileMetadata, error) {
+	metadata := make(map[string]job.FileMetadata)
+	u, err := cacheUser()
+	if err != nil {
+		return nil, err
+	}
+	p := path.Join(u.HomeDir, ".config", "emrys", "datasets", name, ".data_sync_metadata")
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return metadata, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("opening file: %v", err)
+	}
+	defer check.Err(f.Close)
+	if err := json.NewDecoder(f).Decode(&metadata); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("decoding json: %v", err)
+	}
+	return metadata, nil
+}
+
+// writeMetadataCache saves the metadata of dataset name's last push, so unchanged files
+// needn't be rehashed
+func writeMetadataCache(name string, metadata map[string]job.FileMetadata) error {
+	u, err := cacheUser()
+	if err != nil {
+		return err
+	}
+	var uid, gid int
+	if uid, err = strconv.Atoi(u.Uid); err != nil {
+		return fmt.Errorf("converting uid to int: %v", err)
+	}
+	if gid, err = strconv.Atoi(u.Gid); err != nil {
+		return fmt.Errorf("converting gid to int: %v", err)
+	}
+
+	dir := path.Join(u.HomeDir, ".config")
+	for _, elem := range []string{"emrys", "datasets", name} {
+		dir = path.Join(dir, elem)
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("making directory: %v", err)
+		}
+		if err = os.Chown(dir, uid, gid); err != nil {
+			return fmt.Errorf("changing ownership: %v", err)
+		}
+	}
+
+	p := path.Join(dir, ".data_sync_metadata")
+	f, err := os.Create(p)
+	if err != nil {
+		return fmt.Errorf("creating file: %v", err)
+	}
+	defer check.Err(f.Close)
+	if err = os.Chown(p, uid, gid); err != nil {
+		return fmt.Errorf("changing ownership: %v", err)
+	}
+	if err = json.NewEncoder(f).Encode(metadata); err != nil {
+		return fmt.Errorf("encoding json: %v", err)
+	}
+	return nil
+}
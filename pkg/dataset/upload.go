@@ -0,0 +1,116 @@
+package dataset
+
+import (
+	"compress/zlib"
+	"context"
+	"fmt"
+	"github.com/cenkalti/backoff"
+	"github.com/wminshew/emrys/pkg/check"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const numUploaders = 5
+
+// upload PUTs each of relPaths under dir to u, zlib compressed, with numUploaders at a time
+func (c *Client) upload(ctx context.Context, u url.URL, dir string, relPaths []string) error {
+	if len(relPaths) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	pathCh := make(chan string)
+	errCh := make(chan error, numUploaders)
+	var wg sync.WaitGroup
+	for i := 0; i < numUploaders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for relPath := range pathCh {
+				if err := c.uploadFile(ctx, u, dir, relPath); err != nil {
+					errCh <- fmt.Errorf("uploading %s: %v", relPath, err)
+					cancel()
+					return
+				}
+				log.Printf("Dataset: uploaded %s\n", relPath)
+			}
+		}()
+	}
+
+feed:
+	for _, relPath := range relPaths {
+		select {
+		case <-ctx.Done():
+			break feed
+		case pathCh <- relPath:
+		}
+	}
+	close(pathCh)
+	wg.Wait()
+
+	select {
+	case err := <-errCh:
+		return err
+	default:
+		return ctx.Err()
+	}
+}
+
+func (c *Client) uploadFile(ctx context.Context, u url.URL, dir, relPath string) error {
+	basePath := u.Path
+	u.Path = path.Join(basePath, filepath.ToSlash(relPath))
+	operation := func() error {
+		p := filepath.Join(dir, relPath)
+		f, err := os.Open(p)
+		if err != nil {
+			return backoff.Permanent(fmt.Errorf("opening file %v: %v", p, err))
+		}
+		r, w := io.Pipe()
+		zw := zlib.NewWriter(w)
+		go func() {
+			defer check.Err(w.Close)
+			defer check.Err(zw.Close)
+			defer check.Err(f.Close)
+			if _, err := io.Copy(zw, f); err != nil {
+				log.Printf("Dataset: error: copying file to zlib writer: %v", err)
+				return
+			}
+		}()
+
+		req, err := http.NewRequest(http.MethodPut, u.String(), r)
+		if err != nil {
+			return fmt.Errorf("creating request: %v", err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", c.AuthToken))
+		req = req.WithContext(ctx)
+
+		resp, err := c.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer check.Err(resp.Body.Close)
+
+		if resp.StatusCode == http.StatusBadGateway {
+			return fmt.Errorf("server: temporary error")
+		} else if resp.StatusCode >= 300 {
+			b, _ := ioutil.ReadAll(resp.Body)
+			return backoff.Permanent(fmt.Errorf("server: %v", string(b)))
+		}
+
+		return nil
+	}
+	return backoff.RetryNotify(operation,
+		backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxRetries), ctx),
+		func(err error, t time.Duration) {
+			log.Printf("Dataset: error uploading %s: %v", relPath, err)
+			log.Printf("Retrying in %s seconds\n", t.Round(time.Second).String())
+		})
+}
@@ -0,0 +1,233 @@
+package extract
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"github.com/wminshew/emrys/pkg/check"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Limits bound what an archive may unpack; zero values are unlimited
+type Limits struct {
+	// MaxBytes is the total size of the archive's files
+	MaxBytes int64
+	// MaxFiles is the number of entries in the archive
+	MaxFiles int
+}
+
+// UnsafeError is returned when an archive is rejected for writing outside its target
+// directory, containing unsupported entries, or exceeding its limits. Retrying won't help
+type UnsafeError struct {
+	msg string
+}
+
+func (e *UnsafeError) Error() string {
+	return fmt.Sprintf("unsafe archive: %s", e.msg)
+}
+
+func unsafe(format string, a ...interface{}) error {
+	return &UnsafeError{msg: fmt.Sprintf(format, a...)}
+}
+
+// IsUnsafe returns true if err rejected an archive as unsafe
+func IsUnsafe(err error) bool {
+	_, ok := err.(*UnsafeError)
+	return ok
+}
+
+// TarGz unpacks the .tar.gz stream r into dir. Entries may not escape dir, whether by absolute
+// or ../ paths, links pointing outside dir, or writing through symlinks. Only directories,
+// regular files & links are unpacked, & setuid, setgid & sticky bits are dropped. Files
+// unpacked before an entry is rejected are left in place
+func TarGz(r io.Reader, dir string, limits Limits) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("making directory %s: %v", dir, err)
+	}
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("reading gzip: %v", err)
+	}
+	defer check.Err(gr.Close)
+	tr := tar.NewReader(gr)
+
+	var totalBytes int64
+	numFiles := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("reading tar: %v", err)
+		}
+		numFiles++
+		if limits.MaxFiles > 0 && numFiles > limits.MaxFiles {
+			return unsafe("more than %d files", limits.MaxFiles)
+		}
+
+		rel, err := relPath(hdr.Name)
+		if err != nil {
+			return err
+		} else if rel == "." {
+			continue
+		}
+		target := filepath.Join(dir, rel)
+		if err := checkParents(dir, rel); err != nil {
+			return err
+		}
+		mode := os.FileMode(hdr.Mode).Perm()
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, mode|0700); err != nil {
+				return fmt.Errorf("making directory %s: %v", rel, err)
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			totalBytes += hdr.Size
+			if limits.MaxBytes > 0 && totalBytes > limits.MaxBytes {
+				return unsafe("more than %d bytes", limits.MaxBytes)
+			}
+			if err := writeFile(tr, target, mode, hdr.Size); err != nil {
+				return fmt.Errorf("writing %s: %v", rel, err)
+			}
+		case tar.TypeSymlink:
+			// symlinks are resolved relative to their own directory, which checkParents keeps a real
+			// directory. Only leading ..s are allowed, since a .. following another link (e.g. d/..
+			// with d -> .) climbs from wherever that link points, not from where it's written
+			linkTarget := filepath.FromSlash(hdr.Linkname)
+			if filepath.IsAbs(linkTarget) || climbsAfterName(linkTarget) ||
+				escapes(filepath.Join(filepath.Dir(rel), linkTarget)) {
+				return unsafe("symlink %s points outside the target directory (%s)", hdr.Name, hdr.Linkname)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return fmt.Errorf("making directory %s: %v", filepath.Dir(rel), err)
+			}
+			if err := replace(target); err != nil {
+				return err
+			}
+			if err := os.Symlink(linkTarget, target); err != nil {
+				return fmt.Errorf("making symlink %s: %v", rel, err)
+			}
+		case tar.TypeLink:
+			// hard links are resolved relative to the archive's root
+			linkRel, err := relPath(hdr.Linkname)
+			if err != nil {
+				return err
+			}
+			if err := checkParents(dir, linkRel); err != nil {
+				return err
+			}
+			linkTarget := filepath.Join(dir, linkRel)
+			if fi, err := os.Lstat(linkTarget); err != nil || !fi.Mode().IsRegular() {
+				return unsafe("hard link %s must point to a file earlier in the archive (%s)", hdr.Name, hdr.Linkname)
+			}
+			if err := replace(target); err != nil {
+				return err
+			}
+			if err := os.Link(linkTarget, target); err != nil {
+				return fmt.Errorf("making hard link %s: %v", rel, err)
+			}
+		case tar.TypeXGlobalHeader:
+		default:
+			return unsafe("unsupported entry %s (type %c)", hdr.Name, hdr.Typeflag)
+		}
+	}
+}
+
+// relPath returns the cleaned, OS-specific form of the archive entry name, which must be relative
+// & stay within the archive's root
+func relPath(name string) (string, error) {
+	p := filepath.FromSlash(name)
+	if filepath.IsAbs(p) || filepath.VolumeName(p) != "" || strings.HasPrefix(name, "/") {
+		return "", unsafe("absolute path %s", name)
+	}
+	rel := filepath.Clean(p)
+	if escapes(rel) {
+		return "", unsafe("path %s escapes the target directory", name)
+	}
+	return rel, nil
+}
+
+// escapes returns true if the relative path p leaves the directory it's relative to
+func escapes(p string) bool {
+	p = filepath.Clean(p)
+	return p == ".." || strings.HasPrefix(p, ".."+string(filepath.Separator))
+}
+
+// climbsAfterName returns true if the relative path p has a .. component after any other name
+func climbsAfterName(p string) bool {
+	named := false
+	for _, part := range strings.Split(p, string(filepath.Separator)) {
+		switch part {
+		case "..":
+			if named {
+				return true
+			}
+		case ".", "":
+		default:
+			named = true
+		}
+	}
+	return false
+}
+
+// checkParents rejects writing to rel if any of its parent directories within dir is a symlink,
+// which an earlier entry could have pointed anywhere
+func checkParents(dir, rel string) error {
+	parts := strings.Split(filepath.Dir(rel), string(filepath.Separator))
+	p := dir
+	for _, part := range parts {
+		if part == "." {
+			continue
+		}
+		p = filepath.Join(p, part)
+		fi, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return unsafe("path %s is inside a symlink", rel)
+		}
+	}
+	return nil
+}
+
+// replace removes whatever non-directory is at target, so it isn't followed or modified
+func replace(target string) error {
+	fi, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return unsafe("%s already exists as a directory", target)
+	}
+	return os.Remove(target)
+}
+
+// writeFile writes size bytes from r to a new file at target
+func writeFile(r io.Reader, target string, mode os.FileMode, size int64) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := replace(target); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	defer check.Err(f.Close)
+	_, err = io.CopyN(f, r, size)
+	return err
+}
@@ -0,0 +1,207 @@
+package extract
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// entry is an entry of a test archive
+type entry struct {
+	name     string
+	typeflag byte
+	linkname string
+	body     string
+	mode     int64
+}
+
+func file(name, body string) entry {
+	return entry{name: name, typeflag: tar.TypeReg, body: body, mode: 0644}
+}
+
+func symlink(name, linkname string) entry {
+	return entry{name: name, typeflag: tar.TypeSymlink, linkname: linkname}
+}
+
+func hardlink(name, linkname string) entry {
+	return entry{name: name, typeflag: tar.TypeLink, linkname: linkname}
+}
+
+func dir(name string) entry {
+	return entry{name: name, typeflag: tar.TypeDir, mode: 0755}
+}
+
+// tarGz returns a .tar.gz archive of entries
+func tarGz(t *testing.T, entries []entry) []byte {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Name:     e.name,
+			Typeflag: e.typeflag,
+			Linkname: e.linkname,
+			Mode:     e.mode,
+			Size:     int64(len(e.body)),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestTarGz(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []entry
+		limits  Limits
+		unsafe  bool
+		// want maps paths under the target directory to their contents
+		want map[string]string
+	}{
+		{
+			name:    "files & directories",
+			entries: []entry{dir("a/"), file("a/b.txt", "b"), file("c/d.txt", "d"), file("./e.txt", "e")},
+			want:    map[string]string{"a/b.txt": "b", "c/d.txt": "d", "e.txt": "e"},
+		},
+		{
+			name:    "links inside the directory",
+			entries: []entry{file("a/b.txt", "b"), symlink("a/sym", "b.txt"), symlink("up", "a/b.txt"), hardlink("hard", "a/b.txt")},
+			want:    map[string]string{"a/sym": "b", "up": "b", "hard": "b"},
+		},
+		{
+			name:    "later entries replace earlier files",
+			entries: []entry{file("a.txt", "old"), file("a.txt", "new")},
+			want:    map[string]string{"a.txt": "new"},
+		},
+		{name: "absolute path", entries: []entry{file("/etc/evil", "x")}, unsafe: true},
+		{name: "parent path", entries: []entry{file("../evil", "x")}, unsafe: true},
+		{name: "nested parent path", entries: []entry{file("a/../../evil", "x")}, unsafe: true},
+		{name: "absolute symlink", entries: []entry{symlink("evil", "/etc/passwd")}, unsafe: true},
+		{name: "escaping symlink", entries: []entry{symlink("a/evil", "../../outside")}, unsafe: true},
+		{
+			name:    "climbing through an earlier symlink",
+			entries: []entry{symlink("d", "."), symlink("m", "d/..")},
+			unsafe:  true,
+		},
+		{
+			name:    "climbing through a later symlink",
+			entries: []entry{symlink("m", "d/.."), symlink("d", ".")},
+			unsafe:  true,
+		},
+		{
+			name:    "climbing through a nested symlink",
+			entries: []entry{dir("a/b/"), symlink("a/b/d", ".."), symlink("a/m", "b/d/../..")},
+			unsafe:  true,
+		},
+		{
+			name:    "leading climbs",
+			entries: []entry{file("a/b.txt", "b"), symlink("c/d/sym", "../../a/./b.txt")},
+			want:    map[string]string{"c/d/sym": "b"},
+		},
+		{
+			name:    "writing through a symlinked directory",
+			entries: []entry{symlink("a", "."), file("a/b.txt", "x")},
+			unsafe:  true,
+		},
+		{
+			name:    "overwriting through a symlink",
+			entries: []entry{file("b.txt", "b"), symlink("sym", "b.txt"), file("sym", "x")},
+			want:    map[string]string{"b.txt": "b", "sym": "x"},
+		},
+		{name: "escaping hard link", entries: []entry{hardlink("evil", "../outside")}, unsafe: true},
+		{name: "hard link to a missing file", entries: []entry{hardlink("evil", "missing")}, unsafe: true},
+		{
+			name:    "hard link through a symlink",
+			entries: []entry{symlink("a", "."), hardlink("evil", "a/outside")},
+			unsafe:  true,
+		},
+		{name: "device", entries: []entry{{name: "dev", typeflag: tar.TypeChar}}, unsafe: true},
+		{name: "fifo", entries: []entry{{name: "fifo", typeflag: tar.TypeFifo}}, unsafe: true},
+		{
+			name:    "too many files",
+			entries: []entry{file("a", "a"), file("b", "b"), file("c", "c")},
+			limits:  Limits{MaxFiles: 2},
+			unsafe:  true,
+		},
+		{
+			name:    "too many bytes",
+			entries: []entry{file("a", "aaaa"), file("b", "bbbb")},
+			limits:  Limits{MaxBytes: 6},
+			unsafe:  true,
+		},
+		{
+			name:    "within limits",
+			entries: []entry{file("a", "aaaa"), file("b", "bbbb")},
+			limits:  Limits{MaxBytes: 8, MaxFiles: 2},
+			want:    map[string]string{"a": "aaaa", "b": "bbbb"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := ioutil.TempDir("", "emrys-extract-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(root)
+			target := filepath.Join(root, "target")
+
+			err = TarGz(bytes.NewReader(tarGz(t, tt.entries)), target, tt.limits)
+			if tt.unsafe {
+				if !IsUnsafe(err) {
+					t.Errorf("TarGz() = %v, want an unsafe archive error", err)
+				}
+			} else if err != nil {
+				t.Fatalf("TarGz(): %v", err)
+			}
+			for p, want := range tt.want {
+				b, err := ioutil.ReadFile(filepath.Join(target, filepath.FromSlash(p)))
+				if err != nil {
+					t.Errorf("reading %s: %v", p, err)
+				} else if string(b) != want {
+					t.Errorf("%s = %q, want %q", p, b, want)
+				}
+			}
+			// nothing may be written beside the target directory
+			if fis, err := ioutil.ReadDir(root); err != nil {
+				t.Fatal(err)
+			} else if len(fis) != 1 {
+				t.Errorf("%d entries beside the target directory, want none", len(fis)-1)
+			}
+		})
+	}
+}
+
+func TestTarGzDropsSpecialBits(t *testing.T) {
+	target, err := ioutil.TempDir("", "emrys-extract-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(target)
+	e := file("setuid", "x")
+	e.mode = 04755
+	if err := TarGz(bytes.NewReader(tarGz(t, []entry{e})), target, Limits{}); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(filepath.Join(target, "setuid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode()&(os.ModeSetuid|os.ModeSetgid|os.ModeSticky) != 0 {
+		t.Errorf("mode = %s, want setuid, setgid & sticky bits dropped", fi.Mode())
+	}
+}
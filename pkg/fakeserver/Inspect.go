@@ -0,0 +1,102 @@
+package fakeserver
+
+import (
+	"fmt"
+	"sort"
+)
+
+// CancelJob cancels job jID as if the user had canceled it, notifying the
+// miner's cancel long-poll
+func (srv *Server) CancelJob(jID string) error {
+	j := srv.job(jID)
+	if j == nil {
+		return fmt.Errorf("job %s not found", jID)
+	}
+	srv.mu.Lock()
+	alreadyCanceled := j.canceled
+	j.canceled = true
+	srv.mu.Unlock()
+	if alreadyCanceled {
+		return nil
+	}
+	return j.cancel.publish("cancel", struct{}{})
+}
+
+// Jobs returns the IDs of every job created on the server
+func (srv *Server) Jobs() []string {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	jIDs := make([]string, 0, len(srv.jobs))
+	for jID := range srv.jobs {
+		jIDs = append(jIDs, jID)
+	}
+	sort.Strings(jIDs)
+	return jIDs
+}
+
+// JobState summarizes the server-side state of a job
+type JobState struct {
+	Project   string
+	Notebook  bool
+	Canceled  bool
+	Winner    string
+	Data      map[string][]byte
+	LogChunks int
+	LogDone   bool
+	// Log is the job's log as uploaded so far
+	Log      []byte
+	Output   []byte
+	Manifest []byte
+	// Dataset is the dataset version the job uses, if any
+	Dataset string
+	// RemoteData is the data set the user told the job's miner to fetch from its source, if any
+	RemoteData []byte
+	// Destination is the upload policy the job's user sent, if its output goes to an object store
+	Destination []byte
+	// Checkpoints are the .tar.gz output files uploaded while the job ran, in order
+	Checkpoints [][]byte
+}
+
+// Job returns the current state of job jID
+func (srv *Server) Job(jID string) (JobState, error) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	j, ok := srv.jobs[jID]
+	if !ok {
+		return JobState{}, fmt.Errorf("job %s not found", jID)
+	}
+	data := make(map[string][]byte, len(j.data))
+	for k, v := range j.data {
+		data[k] = v
+	}
+	return JobState{
+		Project:     j.project,
+		Notebook:    j.notebook,
+		Canceled:    j.canceled,
+		Winner:      j.winner,
+		Data:        data,
+		LogChunks:   j.logChunks,
+		LogDone:     j.logDone,
+		Log:         append([]byte{}, j.logData...),
+		Output:      j.output,
+		Manifest:    j.manifest,
+		Dataset:     j.dataset,
+		RemoteData:  j.remoteData,
+		Destination: j.destination,
+		Checkpoints: append([][]byte{}, j.checkpoints...),
+	}, nil
+}
+
+// Stats returns the raw bodies of every miner/stats post received
+func (srv *Server) Stats() [][]byte {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return append([][]byte{}, srv.stats...)
+}
+
+// Hits returns how many times route ("METHOD host path") has been requested
+func (srv *Server) Hits(route string) int {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.hits[route]
+}
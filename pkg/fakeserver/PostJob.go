@@ -0,0 +1,49 @@
+package fakeserver
+
+import (
+	"fmt"
+	"github.com/satori/go.uuid"
+	"github.com/wminshew/emrys/pkg/job"
+)
+
+// PostJob creates a job in project & immediately puts it up for auction, as if a
+// user had run it; it returns the new job's ID
+func (srv *Server) PostJob(project string, notebook bool) (string, error) {
+	j := srv.newJob(project, notebook)
+	if err := srv.publishAuction(j.id); err != nil {
+		return "", err
+	}
+	return j.id, nil
+}
+
+// newJob registers a new job with a deterministic ID
+func (srv *Server) newJob(project string, notebook bool) *fakeJob {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.created++
+	jUUID := uuid.NewV5(uuid.NamespaceOID, fmt.Sprintf("fakeserver/job/%d", srv.created))
+	j := &fakeJob{
+		id:       jUUID.String(),
+		project:  project,
+		notebook: notebook,
+		data:     make(map[string][]byte),
+		log:      newStream(),
+		cancel:   newStream(),
+	}
+	srv.jobs[j.id] = j
+	return j
+}
+
+// publishAuction notifies connected miners that job jID is up for auction
+func (srv *Server) publishAuction(jID string) error {
+	jUUID, err := uuid.FromString(jID)
+	if err != nil {
+		return err
+	}
+	msg := &job.Message{
+		Job: &job.Job{
+			ID: jUUID,
+		},
+	}
+	return srv.auctions.publish("miner", msg)
+}
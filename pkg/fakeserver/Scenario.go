@@ -0,0 +1,44 @@
+package fakeserver
+
+import (
+	"github.com/wminshew/emrysclient/pkg/worker"
+	"time"
+)
+
+// Scenario scripts how the fake server responds to clients
+type Scenario struct {
+	// BadGatewayStorm is the number of 502s each route returns before it begins responding normally
+	BadGatewayStorm int
+	// AuctionPaymentRequired makes every auction fail with a 402, as if no miner met the job's requirements,
+	// & rejects every miner's bid with a 402
+	AuctionPaymentRequired bool
+	// CancelAfterLogs cancels a job once the miner has uploaded this many log chunks (0 never cancels)
+	CancelAfterLogs int
+	// PollTimeout caps how long a long-poll request is held open before returning no events
+	PollTimeout time.Duration
+	// UserVersion & MinerVersion are reported by the version endpoints
+	UserVersion  string
+	MinerVersion string
+	// Token is returned by the auth endpoint
+	Token string
+	// SSHKey is returned to users & winning miners for notebook jobs
+	SSHKey []byte
+	// InputData is the .tar.gz body served to miners downloading a job's data set
+	InputData []byte
+	// BaseImages is the manifest of base images miners are told to pre-pull
+	BaseImages []worker.BaseImage
+	// Miner, if set, wins every auction users run & plays the job out, so the run & notebook flows can
+	// be exercised without a real miner
+	Miner *ScriptedMiner
+}
+
+// DefaultScenario returns a scenario where every request succeeds on the first try
+func DefaultScenario() *Scenario {
+	return &Scenario{
+		PollTimeout:  100 * time.Millisecond,
+		UserVersion:  "0.14.0",
+		MinerVersion: "0.14.0",
+		Token:        "fake-token",
+		SSHKey:       []byte("fake-ssh-key"),
+	}
+}
@@ -0,0 +1,112 @@
+package fakeserver
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/wminshew/emrysclient/pkg/wire"
+	"sort"
+	"time"
+)
+
+// scriptedMinerID is the winner recorded for jobs played out by a ScriptedMiner
+const scriptedMinerID = "scripted-miner"
+
+// ScriptedMiner plays out jobs on the server as a winning miner would: it uploads Log a chunk
+// at a time, then Output & its manifest. A job canceled while its log is uploading stops early
+type ScriptedMiner struct {
+	// Log is uploaded a chunk every LogPeriod
+	Log       []string
+	LogPeriod time.Duration
+	// Output maps slash separated paths, relative to the output directory, to file contents
+	Output map[string]string
+}
+
+// playJob wins job j & plays it out as m
+func (srv *Server) playJob(j *fakeJob, m *ScriptedMiner) {
+	srv.mu.Lock()
+	if j.winner != "" {
+		srv.mu.Unlock()
+		return
+	}
+	j.winner = scriptedMinerID
+	srv.mu.Unlock()
+
+	canceled := false
+	for _, chunk := range m.Log {
+		time.Sleep(m.LogPeriod)
+		srv.mu.Lock()
+		canceled = j.canceled
+		srv.mu.Unlock()
+		if canceled {
+			break
+		}
+		if err := srv.appendLog(j, []byte(chunk), 0); err != nil {
+			return
+		}
+	}
+	if canceled {
+		if err := srv.appendLog(j, []byte("JOB CANCELED BY USER.\n"), 0); err != nil {
+			return
+		}
+	}
+
+	output, manifest, err := packOutput(m.Output)
+	if err != nil {
+		return
+	}
+	srv.mu.Lock()
+	j.output = output
+	j.manifest = manifest
+	srv.mu.Unlock()
+	_ = srv.finishLog(j)
+}
+
+// packOutput returns files as a .tar.gz & the json manifest listing them
+func packOutput(files map[string]string) ([]byte, []byte, error) {
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	m := &wire.OutputManifest{Files: []wire.ManifestFile{}}
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	for _, p := range paths {
+		contents := []byte(files[p])
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     p,
+			Mode:     0644,
+			Size:     int64(len(contents)),
+			Typeflag: tar.TypeReg,
+			ModTime:  time.Now(),
+		}); err != nil {
+			return nil, nil, err
+		}
+		if _, err := tw.Write(contents); err != nil {
+			return nil, nil, err
+		}
+		sum := sha256.Sum256(contents)
+		m.Files = append(m.Files, wire.ManifestFile{
+			Path:   p,
+			Size:   int64(len(contents)),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+	}
+	if err := tw.Close(); err != nil {
+		return nil, nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, nil, err
+	}
+	manifest, err := json.Marshal(m)
+	if err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), manifest, nil
+}
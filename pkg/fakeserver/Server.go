@@ -0,0 +1,213 @@
+package fakeserver
+
+import (
+	"fmt"
+	"github.com/wminshew/emrys/pkg/job"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	dataHost = "data.emrys.io"
+)
+
+// Server is an in-process fake of the emrys api & data servers, used to exercise
+// the run, notebook & mine flows offline
+type Server struct {
+	Scenario *Scenario
+	ts       *httptest.Server
+	mu       sync.Mutex
+	hits     map[string]int
+	created  int
+	jobs     map[string]*fakeJob
+	auctions *stream
+	stats    [][]byte
+	datasets map[string]*fakeDataset
+	// blobs holds the contents of every dataset file uploaded, by hash
+	blobs map[string][]byte
+	// projectData holds the metadata of the data files uploaded for each project
+	projectData map[string]map[string]job.FileMetadata
+}
+
+// fakeJob holds the server-side state of a single job
+type fakeJob struct {
+	id        string
+	project   string
+	notebook  bool
+	canceled  bool
+	winner    string
+	data      map[string][]byte
+	metadata  map[string]job.FileMetadata
+	logChunks int
+	logSeq    int
+	logDone   bool
+	logData   []byte
+	output    []byte
+	manifest  []byte
+	// dataset is the dataset version the job uses, if any
+	dataset string
+	// remoteData is the data set the job's miner fetches from its source, if any
+	remoteData []byte
+	// destination is the upload policy for the object store the job's output goes to, if any
+	destination []byte
+	// checkpoints are the .tar.gz output files uploaded while the job runs, in order
+	checkpoints [][]byte
+	log         *stream
+	cancel      *stream
+}
+
+// New starts a fake server running scenario s (DefaultScenario if nil)
+func New(s *Scenario) *Server {
+	if s == nil {
+		s = DefaultScenario()
+	}
+	srv := &Server{
+		Scenario:    s,
+		hits:        make(map[string]int),
+		jobs:        make(map[string]*fakeJob),
+		auctions:    newStream(),
+		datasets:    make(map[string]*fakeDataset),
+		blobs:       make(map[string][]byte),
+		projectData: make(map[string]map[string]job.FileMetadata),
+	}
+	srv.ts = httptest.NewServer(srv)
+	return srv
+}
+
+// Close shuts down the fake server
+func (srv *Server) Close() {
+	srv.ts.Close()
+}
+
+// URL returns the base url clients should use; any host works with Client
+func (srv *Server) URL() url.URL {
+	return url.URL{
+		Scheme: "https",
+		Host:   "api.emrys.io",
+	}
+}
+
+// Client returns an http client that routes requests for every emrys host
+// (api.emrys.io, data.emrys.io, ...) to the fake server
+func (srv *Server) Client() *http.Client {
+	target, _ := url.Parse(srv.ts.URL)
+	return &http.Client{
+		Transport: &rewriteTransport{
+			target: target,
+			next:   srv.ts.Client().Transport,
+		},
+	}
+}
+
+// rewriteTransport sends every request to target, keeping the original Host header
+type rewriteTransport struct {
+	target *url.URL
+	next   http.RoundTripper
+}
+
+func (t *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.WithContext(req.Context())
+	u := *req.URL
+	u.Scheme = t.target.Scheme
+	u.Host = t.target.Host
+	r.URL = &u
+	r.Host = req.URL.Host
+	return t.next.RoundTrip(r)
+}
+
+// ServeHTTP routes requests to the fake api or data handlers
+func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segs := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	route := fmt.Sprintf("%s %s %s", r.Method, r.Host, r.URL.Path)
+	if srv.storm(route) {
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+		return
+	}
+
+	if strings.HasPrefix(r.Host, dataHost) {
+		srv.serveData(w, r, segs)
+		return
+	}
+
+	switch {
+	case len(segs) == 2 && segs[1] == "version":
+		srv.handleVersion(w, r, segs[0])
+	case len(segs) == 2 && segs[0] == "auth" && segs[1] == "token":
+		srv.handleToken(w, r)
+	case len(segs) == 4 && segs[0] == "user" && segs[1] == "project" && segs[3] == "job":
+		srv.handleJobCreate(w, r, segs[2])
+	case len(segs) == 6 && segs[0] == "user" && segs[1] == "project" && segs[5] == "cancel":
+		srv.handleJobCancel(w, r, segs[4])
+	case len(segs) == 2 && segs[0] == "user" && segs[1] == "feedback":
+		w.WriteHeader(http.StatusOK)
+	case len(segs) == 3 && segs[0] == "image" && segs[1] == "downloaded":
+		srv.handleOK(w, r, segs[2])
+	case len(segs) == 3 && segs[0] == "image":
+		srv.handleOK(w, r, segs[2])
+	case len(segs) == 2 && segs[0] == "auction":
+		srv.handleAuction(w, r, segs[1])
+	case len(segs) == 2 && segs[0] == "miner" && segs[1] == "connect":
+		srv.auctions.serve(w, r, srv.Scenario.PollTimeout)
+	case len(segs) == 3 && segs[0] == "miner" && segs[1] == "images" && segs[2] == "base":
+		srv.handleBaseImages(w, r)
+	case len(segs) == 2 && segs[0] == "miner" && segs[1] == "stats":
+		srv.handleStats(w, r)
+	case len(segs) == 4 && segs[0] == "miner" && segs[1] == "job" && segs[3] == "bid":
+		srv.handleBid(w, r, segs[2])
+	case len(segs) == 3 && segs[0] == "job" && segs[2] == "cancel":
+		srv.handleCancelPoll(w, r, segs[1])
+	case len(segs) == 3 && segs[0] == "job" && segs[2] == "log":
+		srv.handleLog(w, r, segs[1])
+	case len(segs) == 3 && segs[0] == "job" && segs[2] == "data":
+		srv.handleOutput(w, r, segs[1])
+	case len(segs) == 4 && segs[0] == "job" && segs[2] == "data" && segs[3] == "select":
+		srv.handleOutputSelect(w, r, segs[1])
+	case len(segs) == 3 && segs[0] == "job" && segs[2] == "manifest":
+		srv.handleManifest(w, r, segs[1])
+	case len(segs) == 3 && segs[0] == "job" && segs[2] == "destination":
+		srv.handleDestination(w, r, segs[1])
+	case len(segs) == 3 && segs[0] == "job" && segs[2] == "checkpoint":
+		srv.handleCheckpoint(w, r, segs[1])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (srv *Server) serveData(w http.ResponseWriter, r *http.Request, segs []string) {
+	switch {
+	case len(segs) >= 2 && segs[0] == "user" && segs[1] == "dataset":
+		srv.serveDatasets(w, r, segs)
+	case len(segs) == 4 && segs[0] == "user" && segs[1] == "project" && segs[3] == "data":
+		srv.handleProjectData(w, r, segs[2])
+	case len(segs) == 5 && segs[0] == "user" && segs[1] == "project" && segs[3] == "data" && segs[4] == "prune":
+		srv.handleProjectDataPrune(w, r, segs[2])
+	case len(segs) == 5 && segs[0] == "user" && segs[1] == "project" && segs[3] == "job":
+		srv.handleDataMetadata(w, r, segs[4])
+	case len(segs) > 5 && segs[0] == "user" && segs[1] == "project" && segs[3] == "job":
+		srv.handleDataUpload(w, r, segs[4], strings.Join(segs[5:], "/"))
+	case len(segs) == 3 && segs[0] == "miner" && segs[1] == "job":
+		srv.handleDataDownload(w, r, segs[2])
+	case len(segs) == 4 && segs[0] == "miner" && segs[1] == "job" && segs[3] == "remote":
+		srv.handleRemoteData(w, r, segs[2])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// storm reports whether route should still fail with a 502 under the scenario
+func (srv *Server) storm(route string) bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.hits[route]++
+	return srv.hits[route] <= srv.Scenario.BadGatewayStorm
+}
+
+// job returns the job with ID jID, or nil
+func (srv *Server) job(jID string) *fakeJob {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.jobs[jID]
+}
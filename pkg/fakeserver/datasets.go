@@ -0,0 +1,265 @@
+package fakeserver
+
+import (
+	"compress/zlib"
+	"encoding/json"
+	"fmt"
+	"github.com/wminshew/emrys/pkg/job"
+	"github.com/wminshew/emrysclient/pkg/dataset"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// fakeDataset holds the server-side state of a named dataset
+type fakeDataset struct {
+	versions []*fakeVersion
+	tags     map[string]string
+}
+
+// fakeVersion is a version of a fakeDataset, whose files' contents are kept in Server.blobs
+type fakeVersion struct {
+	version   string
+	metadata  map[string]job.FileMetadata
+	committed bool
+	created   time.Time
+}
+
+func (srv *Server) serveDatasets(w http.ResponseWriter, r *http.Request, segs []string) {
+	switch {
+	case len(segs) == 2 && r.Method == http.MethodGet:
+		srv.handleDatasetList(w, r)
+	case len(segs) == 3 && r.Method == http.MethodGet:
+		srv.handleDatasetGet(w, r, segs[2])
+	case len(segs) == 3 && r.Method == http.MethodPost:
+		srv.handleDatasetPush(w, r, segs[2])
+	case len(segs) == 3 && r.Method == http.MethodDelete:
+		srv.handleDatasetRemove(w, r, segs[2], "")
+	case len(segs) == 5 && segs[3] == "version" && r.Method == http.MethodDelete:
+		srv.handleDatasetRemove(w, r, segs[2], segs[4])
+	case len(segs) == 6 && segs[3] == "version" && segs[5] == "commit" && r.Method == http.MethodPost:
+		srv.handleDatasetCommit(w, r, segs[2], segs[4])
+	case len(segs) > 5 && segs[3] == "version" && r.Method == http.MethodPut:
+		srv.handleDatasetUpload(w, r, segs[2], segs[4], strings.Join(segs[5:], "/"))
+	case len(segs) == 5 && segs[3] == "tag":
+		srv.handleDatasetTag(w, r, segs[2], segs[4])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// resolve returns the committed version of d named by version, a tag or "" for the latest
+func (d *fakeDataset) resolve(version string) *fakeVersion {
+	if v, ok := d.tags[version]; ok {
+		version = v
+	}
+	for i := len(d.versions) - 1; i >= 0; i-- {
+		v := d.versions[i]
+		if v.committed && (version == "" || v.version == version) {
+			return v
+		}
+	}
+	return nil
+}
+
+// summary returns d as the api reports it. Callers hold srv.mu
+func (srv *Server) summary(name string, d *fakeDataset) dataset.Dataset {
+	s := dataset.Dataset{Name: name, Versions: []dataset.Version{}, Tags: map[string]string{}}
+	for _, v := range d.versions {
+		if !v.committed {
+			continue
+		}
+		var size int64
+		for _, md := range v.metadata {
+			size += int64(len(srv.blobs[md.Hash]))
+		}
+		s.Versions = append(s.Versions, dataset.Version{
+			Version: v.version,
+			Files:   len(v.metadata),
+			Size:    size,
+			Created: v.created,
+		})
+	}
+	for tag, v := range d.tags {
+		s.Tags[tag] = v
+	}
+	return s
+}
+
+func (srv *Server) handleDatasetList(w http.ResponseWriter, r *http.Request) {
+	srv.mu.Lock()
+	list := []dataset.Dataset{}
+	for name, d := range srv.datasets {
+		list = append(list, srv.summary(name, d))
+	}
+	srv.mu.Unlock()
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+func (srv *Server) handleDatasetGet(w http.ResponseWriter, r *http.Request, name string) {
+	srv.mu.Lock()
+	d, ok := srv.datasets[name]
+	var s dataset.Dataset
+	if ok {
+		s = srv.summary(name, d)
+	}
+	srv.mu.Unlock()
+	if !ok {
+		http.Error(w, "dataset not found", http.StatusNotFound)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(s)
+}
+
+func (srv *Server) handleDatasetPush(w http.ResponseWriter, r *http.Request, name string) {
+	metadata := make(map[string]job.FileMetadata)
+	if err := json.NewDecoder(r.Body).Decode(&metadata); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	srv.mu.Lock()
+	d, ok := srv.datasets[name]
+	if !ok {
+		d = &fakeDataset{tags: map[string]string{}}
+		srv.datasets[name] = d
+	}
+	v := &fakeVersion{
+		version:  fmt.Sprintf("v%d", len(d.versions)+1),
+		metadata: metadata,
+		created:  time.Now(),
+	}
+	d.versions = append(d.versions, v)
+	resp := dataset.PushResponse{Version: v.version, Upload: []string{}}
+	for relPath, md := range metadata {
+		if _, ok := srv.blobs[md.Hash]; !ok {
+			resp.Upload = append(resp.Upload, relPath)
+		}
+	}
+	srv.mu.Unlock()
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (srv *Server) handleDatasetUpload(w http.ResponseWriter, r *http.Request, name, version, relPath string) {
+	zr, err := zlib.NewReader(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	b, err := ioutil.ReadAll(zr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	d, ok := srv.datasets[name]
+	if !ok {
+		http.Error(w, "dataset not found", http.StatusNotFound)
+		return
+	}
+	for _, v := range d.versions {
+		if v.version == version {
+			md, ok := v.metadata[relPath]
+			if !ok {
+				http.Error(w, "file not in version", http.StatusBadRequest)
+				return
+			}
+			srv.blobs[md.Hash] = b
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+	}
+	http.Error(w, "version not found", http.StatusNotFound)
+}
+
+func (srv *Server) handleDatasetCommit(w http.ResponseWriter, r *http.Request, name, version string) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	d, ok := srv.datasets[name]
+	if !ok {
+		http.Error(w, "dataset not found", http.StatusNotFound)
+		return
+	}
+	for _, v := range d.versions {
+		if v.version != version {
+			continue
+		}
+		for relPath, md := range v.metadata {
+			if _, ok := srv.blobs[md.Hash]; !ok {
+				http.Error(w, fmt.Sprintf("%s not uploaded", relPath), http.StatusConflict)
+				return
+			}
+		}
+		v.committed = true
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	http.Error(w, "version not found", http.StatusNotFound)
+}
+
+func (srv *Server) handleDatasetRemove(w http.ResponseWriter, r *http.Request, name, version string) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	d, ok := srv.datasets[name]
+	if !ok {
+		http.Error(w, "dataset not found", http.StatusNotFound)
+		return
+	}
+	if version == "" {
+		delete(srv.datasets, name)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	v := d.resolve(version)
+	if v == nil {
+		http.Error(w, "version not found", http.StatusNotFound)
+		return
+	}
+	for i := range d.versions {
+		if d.versions[i] == v {
+			d.versions = append(d.versions[:i], d.versions[i+1:]...)
+			break
+		}
+	}
+	for tag, tagged := range d.tags {
+		if tagged == v.version {
+			delete(d.tags, tag)
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (srv *Server) handleDatasetTag(w http.ResponseWriter, r *http.Request, name, tag string) {
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	d, ok := srv.datasets[name]
+	if !ok {
+		http.Error(w, "dataset not found", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		v := d.resolve(string(b))
+		if v == nil {
+			http.Error(w, "version not found", http.StatusNotFound)
+			return
+		}
+		d.tags[tag] = v.version
+	case http.MethodDelete:
+		if _, ok := d.tags[tag]; !ok {
+			http.Error(w, "tag not found", http.StatusNotFound)
+			return
+		}
+		delete(d.tags, tag)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,478 @@
+package fakeserver
+
+import (
+	"compress/zlib"
+	"encoding/json"
+	"github.com/wminshew/emrys/pkg/creds"
+	"github.com/wminshew/emrys/pkg/job"
+	"github.com/wminshew/emrysclient/pkg/worker"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+func (srv *Server) handleVersion(w http.ResponseWriter, r *http.Request, client string) {
+	verResp := creds.VersionResp{}
+	switch client {
+	case "user":
+		verResp.Version = srv.Scenario.UserVersion
+	case "miner":
+		verResp.Version = srv.Scenario.MinerVersion
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(&verResp)
+}
+
+func (srv *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	_ = json.NewEncoder(w).Encode(&creds.LoginResp{
+		Token: srv.Scenario.Token,
+	})
+}
+
+func (srv *Server) handleOK(w http.ResponseWriter, r *http.Request, jID string) {
+	if srv.job(jID) == nil {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	_, _ = io.Copy(ioutil.Discard, r.Body)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (srv *Server) handleJobCreate(w http.ResponseWriter, r *http.Request, project string) {
+	j := srv.newJob(project, r.URL.Query().Get("notebook") == "1")
+	w.Header().Set("X-Job-ID", j.id)
+	w.WriteHeader(http.StatusOK)
+	if j.notebook {
+		_, _ = w.Write(srv.Scenario.SSHKey)
+	}
+}
+
+func (srv *Server) handleJobCancel(w http.ResponseWriter, r *http.Request, jID string) {
+	if err := srv.CancelJob(jID); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (srv *Server) handleDataMetadata(w http.ResponseWriter, r *http.Request, jID string) {
+	j := srv.job(jID)
+	if j == nil {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	if ref := r.URL.Query().Get("dataset"); ref != "" {
+		srv.mu.Lock()
+		j.dataset = ref
+		srv.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.URL.Query().Get("remote") == "1" {
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		srv.mu.Lock()
+		j.remoteData = b
+		srv.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	metadata := make(map[string]job.FileMetadata)
+	if err := json.NewDecoder(r.Body).Decode(&metadata); err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	uploadList := []string{}
+	srv.mu.Lock()
+	j.metadata = metadata
+	held := srv.projectData[j.project]
+	for relPath, md := range metadata {
+		if heldMd, ok := held[relPath]; !ok || heldMd.Hash != md.Hash {
+			uploadList = append(uploadList, relPath)
+		}
+	}
+	srv.mu.Unlock()
+	_ = json.NewEncoder(w).Encode(uploadList)
+}
+
+func (srv *Server) handleDataUpload(w http.ResponseWriter, r *http.Request, jID, relPath string) {
+	j := srv.job(jID)
+	if j == nil {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	zr, err := zlib.NewReader(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	b, err := ioutil.ReadAll(zr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	srv.mu.Lock()
+	j.data[relPath] = b
+	if md, ok := j.metadata[relPath]; ok {
+		if srv.projectData[j.project] == nil {
+			srv.projectData[j.project] = make(map[string]job.FileMetadata)
+		}
+		srv.projectData[j.project][relPath] = md
+	}
+	srv.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (srv *Server) handleDataDownload(w http.ResponseWriter, r *http.Request, jID string) {
+	if srv.job(jID) == nil {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(srv.Scenario.InputData)))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(srv.Scenario.InputData)
+}
+
+func (srv *Server) handleProjectData(w http.ResponseWriter, r *http.Request, project string) {
+	srv.mu.Lock()
+	held := make(map[string]job.FileMetadata, len(srv.projectData[project]))
+	for relPath, md := range srv.projectData[project] {
+		held[relPath] = md
+	}
+	srv.mu.Unlock()
+	_ = json.NewEncoder(w).Encode(held)
+}
+
+func (srv *Server) handleProjectDataPrune(w http.ResponseWriter, r *http.Request, project string) {
+	pruned := []string{}
+	if err := json.NewDecoder(r.Body).Decode(&pruned); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	srv.mu.Lock()
+	for _, relPath := range pruned {
+		delete(srv.projectData[project], relPath)
+	}
+	srv.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (srv *Server) handleRemoteData(w http.ResponseWriter, r *http.Request, jID string) {
+	j := srv.job(jID)
+	if j == nil {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	srv.mu.Lock()
+	remoteData := j.remoteData
+	srv.mu.Unlock()
+	if remoteData == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(remoteData)
+}
+
+func (srv *Server) handleAuction(w http.ResponseWriter, r *http.Request, jID string) {
+	j := srv.job(jID)
+	if j == nil {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	if srv.Scenario.AuctionPaymentRequired {
+		w.WriteHeader(http.StatusPaymentRequired)
+		return
+	}
+	specs := &job.Specs{}
+	if err := json.NewDecoder(r.Body).Decode(specs); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := srv.publishAuction(jID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if srv.Scenario.Miner != nil {
+		go srv.playJob(j, srv.Scenario.Miner)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (srv *Server) handleBid(w http.ResponseWriter, r *http.Request, jID string) {
+	j := srv.job(jID)
+	if j == nil {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	b := &job.Bid{}
+	if err := json.NewDecoder(r.Body).Decode(b); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	srv.mu.Lock()
+	won := j.winner == "" && !srv.Scenario.AuctionPaymentRequired
+	if won {
+		j.winner = b.DeviceID.String()
+	}
+	srv.mu.Unlock()
+	if !won {
+		w.WriteHeader(http.StatusPaymentRequired)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if j.notebook {
+		_, _ = w.Write(srv.Scenario.SSHKey)
+	}
+}
+
+func (srv *Server) handleBaseImages(w http.ResponseWriter, r *http.Request) {
+	baseImages := srv.Scenario.BaseImages
+	if baseImages == nil {
+		baseImages = []worker.BaseImage{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(baseImages)
+}
+
+func (srv *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	srv.mu.Lock()
+	srv.stats = append(srv.stats, b)
+	srv.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (srv *Server) handleCancelPoll(w http.ResponseWriter, r *http.Request, jID string) {
+	j := srv.job(jID)
+	if j == nil {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	j.cancel.serve(w, r, srv.Scenario.PollTimeout)
+}
+
+func (srv *Server) handleLog(w http.ResponseWriter, r *http.Request, jID string) {
+	j := srv.job(jID)
+	if j == nil {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodGet {
+		j.log.serve(w, r, srv.Scenario.PollTimeout)
+		return
+	}
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(b) == 0 {
+		// empty body signifies log upload complete
+		err = srv.finishLog(j)
+	} else {
+		seq, _ := strconv.Atoi(r.URL.Query().Get("seq"))
+		err = srv.appendLog(j, b, seq)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// appendLog appends b to job j's log. A positive seq numbers the batch; batches the miner retries
+// after they were appended are acknowledged & dropped
+func (srv *Server) appendLog(j *fakeJob, b []byte, seq int) error {
+	srv.mu.Lock()
+	if seq > 0 {
+		if seq <= j.logSeq {
+			srv.mu.Unlock()
+			return nil
+		}
+		j.logSeq = seq
+	}
+	j.logChunks++
+	j.logData = append(j.logData, b...)
+	cancelNow := j.logChunks == srv.Scenario.CancelAfterLogs
+	srv.mu.Unlock()
+	if err := j.log.publish("log", b); err != nil {
+		return err
+	}
+	if cancelNow {
+		return srv.CancelJob(j.id)
+	}
+	return nil
+}
+
+// finishLog marks job j's log upload complete
+func (srv *Server) finishLog(j *fakeJob) error {
+	srv.mu.Lock()
+	j.logDone = true
+	srv.mu.Unlock()
+	return j.log.publish("log", struct{}{})
+}
+
+func (srv *Server) handleOutput(w http.ResponseWriter, r *http.Request, jID string) {
+	j := srv.job(jID)
+	if j == nil {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodGet {
+		srv.mu.Lock()
+		output := j.output
+		srv.mu.Unlock()
+		if output == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		_, _ = w.Write(output)
+		return
+	}
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	srv.mu.Lock()
+	j.output = b
+	srv.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (srv *Server) handleOutputSelect(w http.ResponseWriter, r *http.Request, jID string) {
+	j := srv.job(jID)
+	if j == nil {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	sel := struct {
+		Paths []string `json:"paths"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&sel); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	srv.mu.Lock()
+	output := j.output
+	srv.mu.Unlock()
+	if output == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	b, err := selectTarGz(output, sel.Paths)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write(b)
+}
+
+func (srv *Server) handleManifest(w http.ResponseWriter, r *http.Request, jID string) {
+	j := srv.job(jID)
+	if j == nil {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodGet {
+		srv.mu.Lock()
+		manifest := j.manifest
+		srv.mu.Unlock()
+		if manifest == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(manifest)
+		return
+	}
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	srv.mu.Lock()
+	j.manifest = b
+	srv.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (srv *Server) handleDestination(w http.ResponseWriter, r *http.Request, jID string) {
+	j := srv.job(jID)
+	if j == nil {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodGet {
+		srv.mu.Lock()
+		destination := j.destination
+		srv.mu.Unlock()
+		if destination == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(destination)
+		return
+	}
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	srv.mu.Lock()
+	j.destination = b
+	srv.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (srv *Server) handleCheckpoint(w http.ResponseWriter, r *http.Request, jID string) {
+	j := srv.job(jID)
+	if j == nil {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodGet {
+		// serves the first checkpoint after the one numbered ?after
+		after, _ := strconv.Atoi(r.URL.Query().Get("after"))
+		srv.mu.Lock()
+		var checkpoint []byte
+		if after >= 0 && after < len(j.checkpoints) {
+			checkpoint = j.checkpoints[after]
+		}
+		srv.mu.Unlock()
+		if checkpoint == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("X-Checkpoint", strconv.Itoa(after+1))
+		_, _ = w.Write(checkpoint)
+		return
+	}
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	srv.mu.Lock()
+	j.checkpoints = append(j.checkpoints, b)
+	srv.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
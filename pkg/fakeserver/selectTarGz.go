@@ -0,0 +1,50 @@
+package fakeserver
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"path"
+)
+
+// selectTarGz returns a .tar.gz of the regular files in the .tar.gz archive whose paths are in paths
+func selectTarGz(archive []byte, paths []string) ([]byte, error) {
+	want := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		want[path.Clean(p)] = true
+	}
+	gr, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gr)
+
+	out := &bytes.Buffer{}
+	gw := gzip.NewWriter(out)
+	tw := tar.NewWriter(gw)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg || !want[path.Clean(hdr.Name)] {
+			continue
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,93 @@
+package fakeserver
+
+import (
+	"encoding/json"
+	"github.com/wminshew/emrysclient/pkg/poll"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// stream is a single long-poll category, e.g. a job's log or the miner auction feed
+type stream struct {
+	mu      sync.Mutex
+	events  []poll.Event
+	lastTS  int64
+	updated chan struct{}
+}
+
+func newStream() *stream {
+	return &stream{
+		updated: make(chan struct{}),
+	}
+}
+
+// publish appends data to the stream & wakes any waiting pollers
+func (s *stream) publish(category string, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ts := time.Now().UnixNano() / int64(time.Millisecond)
+	if ts <= s.lastTS {
+		ts = s.lastTS + 1
+	}
+	s.lastTS = ts
+	s.events = append(s.events, poll.Event{
+		Timestamp: ts,
+		Category:  category,
+		Data:      b,
+	})
+	close(s.updated)
+	s.updated = make(chan struct{})
+	return nil
+}
+
+// since returns the events published after sinceTime, the latest timestamp, & a channel
+// closed on the next publish
+func (s *stream) since(sinceTime int64) ([]poll.Event, int64, chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := []poll.Event{}
+	for _, e := range s.events {
+		if e.Timestamp > sinceTime {
+			events = append(events, e)
+		}
+	}
+	return events, s.lastTS, s.updated
+}
+
+// serve answers a long-poll request in the same format as the emrys server
+func (s *stream) serve(w http.ResponseWriter, r *http.Request, maxWait time.Duration) {
+	sinceTime, _ := strconv.ParseInt(r.URL.Query().Get("since_time"), 10, 64)
+	timeout := maxWait
+	if t, err := strconv.Atoi(r.URL.Query().Get("timeout")); err == nil {
+		if d := time.Duration(t) * time.Second; d < timeout {
+			timeout = d
+		}
+	}
+
+	events, lastTS, updated := s.since(sinceTime)
+	if len(events) == 0 {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-updated:
+			events, lastTS, _ = s.since(sinceTime)
+		case <-time.After(timeout):
+		}
+	}
+
+	// report the latest published timestamp rather than now, so an event published
+	// in the same millisecond isn't skipped by the client's next since_time
+	pr := poll.Response{
+		Events:    events,
+		Timestamp: lastTS,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(&pr)
+}
@@ -0,0 +1,355 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/cenkalti/backoff"
+	"github.com/dustin/go-humanize"
+	"github.com/wminshew/emrys/pkg/check"
+	"github.com/wminshew/emrysclient/pkg/s3"
+	"github.com/wminshew/emrysclient/pkg/wire"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// dataLockName is the name of the lockfile, next to main, pinning a remote data set
+	dataLockName = "emrys-data.lock"
+	// remoteDataAge is how long the job's miner may fetch its remote data set for
+	remoteDataAge = 7 * 24 * time.Hour
+)
+
+// DataLock pins the files of a remote data set, so every job run on it sees the same data
+type DataLock struct {
+	Source string `json:"source"`
+	// Files' s3:// & gs:// URLs are presigned for each job
+	Files []wire.RemoteFile `json:"files"`
+}
+
+// IsDataURL returns true if data names a remote data set, rather than a local directory
+func IsDataURL(data string) bool {
+	return s3.IsURL(data) || s3.IsGSURL(data) || strings.HasPrefix(data, "https://")
+}
+
+// dataLockPath returns the path of the job's data lockfile
+func (j *Job) dataLockPath() string {
+	return filepath.Join(filepath.Dir(j.Main), dataLockName)
+}
+
+// lockRemoteData returns the lock of the job's remote data set, creating it by hashing every
+// file at its source if it doesn't exist yet
+func (j *Job) lockRemoteData(ctx context.Context) (*DataLock, error) {
+	p := j.dataLockPath()
+	lock, err := readDataLock(p)
+	if err != nil {
+		return nil, err
+	} else if lock != nil {
+		if lock.Source != j.Data {
+			return nil, fmt.Errorf("%s locks %s, not %s: delete it to lock the new data set", p, lock.Source, j.Data)
+		}
+		return lock, nil
+	}
+
+	log.Printf("Data: no lockfile: hashing %s to create %s...\n", j.Data, p)
+	files, err := j.listRemoteData(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing %s: %v", j.Data, err)
+	}
+	if err := (&wire.RemoteData{Files: files}).Validate(); err != nil {
+		return nil, fmt.Errorf("locking %s: %v", j.Data, err)
+	}
+	creds := map[string]*s3.Credentials{}
+	for i := range files {
+		if files[i].Size, files[i].SHA256, err = j.hashRemoteFile(ctx, files[i].URL, creds); err != nil {
+			return nil, fmt.Errorf("hashing %s: %v", files[i].URL, err)
+		}
+		log.Printf("Data: hashed %s\n", files[i].Path)
+	}
+	lock = &DataLock{
+		Source: j.Data,
+		Files:  files,
+	}
+	if err := lock.write(p); err != nil {
+		return nil, err
+	}
+	log.Printf("Data: locked %d file(s) in %s\n", len(files), p)
+	return lock, nil
+}
+
+// readDataLock reads the lockfile at p, or returns nil if it doesn't exist
+func readDataLock(p string) (*DataLock, error) {
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("opening lockfile: %v", err)
+	}
+	defer check.Err(f.Close)
+	lock := &DataLock{}
+	if err := json.NewDecoder(f).Decode(lock); err != nil {
+		return nil, fmt.Errorf("decoding lockfile %s: %v", p, err)
+	}
+	if err := (&wire.RemoteData{Files: lock.Files}).Validate(); err != nil {
+		return nil, fmt.Errorf("lockfile %s: %v", p, err)
+	}
+	for _, f := range lock.Files {
+		if len(f.SHA256) != sha256.Size*2 {
+			return nil, fmt.Errorf("lockfile %s: %s: invalid sha256 %q", p, f.Path, f.SHA256)
+		}
+	}
+	return lock, nil
+}
+
+// write saves the lock to p, owned by the user who invoked sudo if any
+func (l *DataLock) write(p string) error {
+	b, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding lockfile: %v", err)
+	}
+	if err := ioutil.WriteFile(p, append(b, '\n'), 0644); err != nil {
+		return fmt.Errorf("writing lockfile: %v", err)
+	}
+	if os.Geteuid() == 0 && os.Getenv("SUDO_USER") != "" {
+		u, err := user.Lookup(os.Getenv("SUDO_USER"))
+		if err != nil {
+			return fmt.Errorf("getting current sudo user: %v", err)
+		}
+		uid, err := strconv.Atoi(u.Uid)
+		if err != nil {
+			return fmt.Errorf("converting uid to int: %v", err)
+		}
+		gid, err := strconv.Atoi(u.Gid)
+		if err != nil {
+			return fmt.Errorf("converting gid to int: %v", err)
+		}
+		if err = os.Chown(p, uid, gid); err != nil {
+			return fmt.Errorf("changing ownership: %v", err)
+		}
+	}
+	return nil
+}
+
+// listRemoteData lists the files of the job's remote data set: every object under an s3:// or
+// gs:// prefix (or the object itself), or the single file of an https:// URL
+func (j *Job) listRemoteData(ctx context.Context) ([]wire.RemoteFile, error) {
+	files := []wire.RemoteFile{}
+	if !s3.IsURL(j.Data) && !s3.IsGSURL(j.Data) {
+		u, err := url.Parse(j.Data)
+		if err != nil {
+			return nil, err
+		}
+		name := path.Base(u.Path)
+		if name == "." || name == "/" {
+			return nil, fmt.Errorf("url must name a file")
+		}
+		return append(files, wire.RemoteFile{Path: name, URL: j.Data}), nil
+	}
+
+	loc, err := s3.ParseURL(j.Data)
+	if err != nil {
+		return nil, err
+	}
+	creds, err := dataCredentials(loc)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := creds.List(ctx, j.Client, loc.Bucket, loc.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range objects {
+		var rel string
+		switch {
+		case loc.Prefix == "":
+			rel = o.Key
+		case o.Key == loc.Prefix:
+			rel = path.Base(o.Key)
+		case strings.HasPrefix(o.Key, loc.Prefix+"/"):
+			rel = strings.TrimPrefix(o.Key, loc.Prefix+"/")
+		default:
+			// a sibling sharing the prefix, e.g. train2/ for train
+			continue
+		}
+		files = append(files, wire.RemoteFile{
+			Path: rel,
+			URL:  fmt.Sprintf("%s://%s/%s", loc.Scheme, loc.Bucket, o.Key),
+		})
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files found")
+	}
+	return files, nil
+}
+
+// hashRemoteFile streams the file at rawURL from its source, returning its size & hex SHA-256
+func (j *Job) hashRemoteFile(ctx context.Context, rawURL string, creds map[string]*s3.Credentials) (int64, string, error) {
+	fetchURL, err := remoteFetchURL(rawURL, creds)
+	if err != nil {
+		return 0, "", err
+	}
+	var size int64
+	var sum string
+	operation := func() error {
+		req, err := http.NewRequest(http.MethodGet, fetchURL, nil)
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+		req = req.WithContext(ctx)
+
+		resp, err := j.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer check.Err(resp.Body.Close)
+		if resp.StatusCode >= 300 {
+			b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+			err := fmt.Errorf("source: %d: %s", resp.StatusCode, string(b))
+			if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+				return backoff.Permanent(err)
+			}
+			return err
+		}
+
+		h := sha256.New()
+		if size, err = io.Copy(h, resp.Body); err != nil {
+			return err
+		}
+		sum = hex.EncodeToString(h.Sum(nil))
+		return nil
+	}
+	if err := backoff.RetryNotify(operation,
+		backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxRetries), ctx),
+		func(err error, t time.Duration) {
+			log.Printf("Data: error: %v", err)
+			log.Printf("Retrying in %s seconds\n", t.Round(time.Second).String())
+		}); err != nil {
+		return 0, "", err
+	}
+	return size, sum, nil
+}
+
+// resolveRemoteData returns the lock's files with URLs the job's miner can fetch them from
+func (l *DataLock) resolveRemoteData() (*wire.RemoteData, error) {
+	d := &wire.RemoteData{Files: make([]wire.RemoteFile, 0, len(l.Files))}
+	creds := map[string]*s3.Credentials{}
+	for _, f := range l.Files {
+		fetchURL, err := remoteFetchURL(f.URL, creds)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Path, err)
+		}
+		f.URL = fetchURL
+		d.Files = append(d.Files, f)
+	}
+	return d, nil
+}
+
+// remoteFetchURL presigns s3:// & gs:// URLs so they can be fetched without credentials.
+// creds caches each scheme's credentials
+func remoteFetchURL(rawURL string, creds map[string]*s3.Credentials) (string, error) {
+	if !s3.IsURL(rawURL) && !s3.IsGSURL(rawURL) {
+		return rawURL, nil
+	}
+	loc, err := s3.ParseURL(rawURL)
+	if err != nil {
+		return "", err
+	}
+	c, ok := creds[loc.Scheme]
+	if !ok {
+		if c, err = dataCredentials(loc); err != nil {
+			return "", err
+		}
+		creds[loc.Scheme] = c
+	}
+	// the location's prefix is the object's key
+	return c.PresignGet(loc.Bucket, loc.Prefix, nil, remoteDataAge)
+}
+
+// dataCredentials loads the credentials for a data set at loc, falling back to anonymous
+// requests for public s3 buckets
+func dataCredentials(loc *s3.Location) (*s3.Credentials, error) {
+	c, err := loc.Credentials()
+	if err != nil && loc.Scheme == "s3" {
+		log.Printf("Data: %v: fetching anonymously\n", err)
+		return s3.AnonymousCredentials(), nil
+	}
+	return c, err
+}
+
+// syncRemoteData locks the job's remote data set & sends the server the locked files, which the
+// job's miner fetches from their source
+func (j *Job) syncRemoteData(ctx context.Context, u url.URL) error {
+	lock, err := j.lockRemoteData(ctx)
+	if err != nil {
+		return err
+	}
+	d, err := lock.resolveRemoteData()
+	if err != nil {
+		return err
+	}
+	diskBuffer, err := humanize.ParseBytes(diskBufferStr)
+	if err != nil {
+		return fmt.Errorf("error parsing disk buffer: %v", err)
+	}
+	if uint64(d.Size()) > j.Specs.Disk+diskBuffer {
+		return fmt.Errorf("insufficient requested disk space (data set: %s "+
+			" + required disk buffer %s > requested disk space %s)", humanize.Bytes(uint64(d.Size())),
+			humanize.Bytes(diskBuffer), humanize.Bytes(j.Specs.Disk))
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("encoding remote data set: %v", err)
+	}
+
+	u.Host = "data.emrys.io"
+	u.Path = path.Join("user", "project", j.Project, "job", j.ID)
+	u.RawQuery = url.Values{"remote": []string{"1"}}.Encode()
+	operation := func() error {
+		req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(b))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", j.AuthToken))
+		req.Header.Set("Content-Type", "application/json")
+		req = req.WithContext(ctx)
+
+		resp, err := j.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer check.Err(resp.Body.Close)
+
+		if resp.StatusCode == http.StatusBadGateway {
+			return fmt.Errorf("server: temporary error")
+		} else if resp.StatusCode >= 300 {
+			b, _ := ioutil.ReadAll(resp.Body)
+			return backoff.Permanent(fmt.Errorf("server: %v", string(b)))
+		}
+
+		return nil
+	}
+	if err := backoff.RetryNotify(operation,
+		backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxRetries), ctx),
+		func(err error, t time.Duration) {
+			log.Printf("Data: error: %v", err)
+			log.Printf("Retrying in %s seconds\n", t.Round(time.Second).String())
+		}); err != nil {
+		return err
+	}
+	log.Printf("Data: miner will fetch %d locked file(s) (%s) from %s\n", len(d.Files),
+		humanize.Bytes(uint64(d.Size())), j.Data)
+	return nil
+}
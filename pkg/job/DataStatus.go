@@ -0,0 +1,205 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cenkalti/backoff"
+	"github.com/wminshew/emrys/pkg/check"
+	"github.com/wminshew/emrys/pkg/job"
+	"github.com/wminshew/emrysclient/pkg/dataset"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// DataStatus is how the files of a data directory differ from a baseline
+type DataStatus struct {
+	Added     []string
+	Modified  []string
+	Deleted   []string
+	Unchanged []string
+}
+
+// DiffData compares the current metadata of a data directory to baseline
+func DiffData(baseline, current map[string]job.FileMetadata) *DataStatus {
+	s := &DataStatus{
+		Added:     []string{},
+		Modified:  []string{},
+		Deleted:   []string{},
+		Unchanged: []string{},
+	}
+	for p, md := range current {
+		if old, ok := baseline[p]; !ok {
+			s.Added = append(s.Added, p)
+		} else if old.Hash != md.Hash {
+			s.Modified = append(s.Modified, p)
+		} else {
+			s.Unchanged = append(s.Unchanged, p)
+		}
+	}
+	for p := range baseline {
+		if _, ok := current[p]; !ok {
+			s.Deleted = append(s.Deleted, p)
+		}
+	}
+	sort.Strings(s.Added)
+	sort.Strings(s.Modified)
+	sort.Strings(s.Deleted)
+	sort.Strings(s.Unchanged)
+	return s
+}
+
+// DataStatus compares the job's data directory to the project's last sync or, if remote, to
+// the files the server holds for the project. Nothing is uploaded
+func (j *Job) DataStatus(ctx context.Context, u url.URL, remote bool) (*DataStatus, error) {
+	lastSync := make(map[string]job.FileMetadata)
+	if err := j.getProjectDataMetadata(&lastSync); err != nil {
+		return nil, fmt.Errorf("retrieving data directory metadata: %v", err)
+	}
+	baseline := lastSync
+	if remote {
+		var err error
+		if baseline, err = j.RemoteDataMetadata(ctx, u); err != nil {
+			return nil, err
+		}
+	}
+	// files unchanged since the last sync keep their hashes
+	current, err := dataset.Scan(j.Data, lastSync)
+	if err != nil {
+		return nil, fmt.Errorf("walking data directory %s: %v", j.Data, err)
+	}
+	return DiffData(baseline, current), nil
+}
+
+// RemoteDataMetadata returns the metadata of the data files the server holds for the job's project
+func (j *Job) RemoteDataMetadata(ctx context.Context, u url.URL) (map[string]job.FileMetadata, error) {
+	u.Host = "data.emrys.io"
+	u.Path = path.Join("user", "project", j.Project, "data")
+	metadata := make(map[string]job.FileMetadata)
+	operation := func() error {
+		req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", j.AuthToken))
+		req = req.WithContext(ctx)
+
+		resp, err := j.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer check.Err(resp.Body.Close)
+
+		if resp.StatusCode == http.StatusBadGateway {
+			return fmt.Errorf("server: temporary error")
+		} else if resp.StatusCode >= 300 {
+			b, _ := ioutil.ReadAll(resp.Body)
+			return backoff.Permanent(fmt.Errorf("server: %v", string(b)))
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+			return fmt.Errorf("decoding json response: %v", err)
+		}
+		return nil
+	}
+	if err := backoff.RetryNotify(operation,
+		backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxRetries), ctx),
+		func(err error, t time.Duration) {
+			log.Printf("Data: error: %v", err)
+			log.Printf("Retrying in %s seconds\n", t.Round(time.Second).String())
+		}); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// StaleData lists the data files the server holds for the job's project that are no longer in
+// the job's data directory
+func (j *Job) StaleData(ctx context.Context, u url.URL) ([]string, error) {
+	remote, err := j.RemoteDataMetadata(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	stale := []string{}
+	for p := range remote {
+		if _, err := os.Lstat(filepath.Join(j.Data, p)); os.IsNotExist(err) {
+			stale = append(stale, p)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(stale)
+	return stale, nil
+}
+
+// PruneData removes pruned, paths listed by StaleData, from the data files the server holds for
+// the job's project
+func (j *Job) PruneData(ctx context.Context, u url.URL, pruned []string) error {
+	if len(pruned) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(pruned)
+	if err != nil {
+		return fmt.Errorf("encoding pruned files: %v", err)
+	}
+
+	u.Host = "data.emrys.io"
+	u.Path = path.Join("user", "project", j.Project, "data", "prune")
+	operation := func() error {
+		req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(b))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", j.AuthToken))
+		req.Header.Set("Content-Type", "application/json")
+		req = req.WithContext(ctx)
+
+		resp, err := j.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer check.Err(resp.Body.Close)
+
+		if resp.StatusCode == http.StatusBadGateway {
+			return fmt.Errorf("server: temporary error")
+		} else if resp.StatusCode >= 300 {
+			b, _ := ioutil.ReadAll(resp.Body)
+			return backoff.Permanent(fmt.Errorf("server: %v", string(b)))
+		}
+
+		return nil
+	}
+	if err := backoff.RetryNotify(operation,
+		backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxRetries), ctx),
+		func(err error, t time.Duration) {
+			log.Printf("Data: error: %v", err)
+			log.Printf("Retrying in %s seconds\n", t.Round(time.Second).String())
+		}); err != nil {
+		return err
+	}
+
+	// drop the pruned files from the last sync's metadata too, so it stops growing
+	lastSync := make(map[string]job.FileMetadata)
+	if err := j.getProjectDataMetadata(&lastSync); err != nil {
+		return fmt.Errorf("retrieving data directory metadata: %v", err)
+	}
+	for _, p := range pruned {
+		delete(lastSync, p)
+	}
+	md, err := json.Marshal(lastSync)
+	if err != nil {
+		return fmt.Errorf("encoding directory as json: %v", err)
+	}
+	if err := j.storeProjectDataMetadata(bytes.NewReader(md)); err != nil {
+		return fmt.Errorf("storing data directory metadata: %v", err)
+	}
+	return nil
+}
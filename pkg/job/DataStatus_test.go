@@ -0,0 +1,72 @@
+package job
+
+import (
+	"github.com/wminshew/emrys/pkg/job"
+	"reflect"
+	"testing"
+)
+
+func TestDiffData(t *testing.T) {
+	md := func(hash string) job.FileMetadata {
+		return job.FileMetadata{ModTime: 1, Hash: hash}
+	}
+	tests := []struct {
+		name     string
+		baseline map[string]job.FileMetadata
+		current  map[string]job.FileMetadata
+		want     *DataStatus
+	}{
+		{
+			name: "empty",
+			want: &DataStatus{Added: []string{}, Modified: []string{}, Deleted: []string{}, Unchanged: []string{}},
+		},
+		{
+			name:    "first sync",
+			current: map[string]job.FileMetadata{"b.csv": md("b"), "a.csv": md("a")},
+			want:    &DataStatus{Added: []string{"a.csv", "b.csv"}, Modified: []string{}, Deleted: []string{}, Unchanged: []string{}},
+		},
+		{
+			name:     "everything deleted",
+			baseline: map[string]job.FileMetadata{"a.csv": md("a"), "sub/b.csv": md("b")},
+			want:     &DataStatus{Added: []string{}, Modified: []string{}, Deleted: []string{"a.csv", "sub/b.csv"}, Unchanged: []string{}},
+		},
+		{
+			name: "mixed",
+			baseline: map[string]job.FileMetadata{
+				"same.csv":    md("s"),
+				"changed.csv": md("old"),
+				"gone.csv":    md("g"),
+			},
+			current: map[string]job.FileMetadata{
+				"same.csv":    md("s"),
+				"changed.csv": md("new"),
+				"new.csv":     md("n"),
+			},
+			want: &DataStatus{
+				Added:     []string{"new.csv"},
+				Modified:  []string{"changed.csv"},
+				Deleted:   []string{"gone.csv"},
+				Unchanged: []string{"same.csv"},
+			},
+		},
+		{
+			name:     "touched files are unchanged",
+			baseline: map[string]job.FileMetadata{"a.csv": {ModTime: 1, Hash: "a"}},
+			current:  map[string]job.FileMetadata{"a.csv": {ModTime: 2, Hash: "a"}},
+			want:     &DataStatus{Added: []string{}, Modified: []string{}, Deleted: []string{}, Unchanged: []string{"a.csv"}},
+		},
+		{
+			name:     "moved file",
+			baseline: map[string]job.FileMetadata{"old/a.csv": md("a")},
+			current:  map[string]job.FileMetadata{"new/a.csv": md("a")},
+			want:     &DataStatus{Added: []string{"new/a.csv"}, Modified: []string{}, Deleted: []string{"old/a.csv"}, Unchanged: []string{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DiffData(tt.baseline, tt.current); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffData() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
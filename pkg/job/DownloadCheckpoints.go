@@ -0,0 +1,110 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"github.com/cenkalti/backoff"
+	"github.com/wminshew/emrys/pkg/check"
+	"github.com/wminshew/emrysclient/pkg/extract"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// checkpointPeriod is how often the server is checked for new output checkpoints
+const checkpointPeriod = 30 * time.Second
+
+// DownloadCheckpoints downloads the output checkpoints the Job's miner uploads while the job
+// runs into the Job's output directory, until ctx is canceled. The final output downloaded by
+// DownloadOutputData replaces them
+func (j *Job) DownloadCheckpoints(ctx context.Context, u url.URL) {
+	outputDir := filepath.Join(j.Output, j.ID, "data")
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		log.Printf("Output checkpoint: error making output directory %v: %v", outputDir, err)
+		return
+	}
+
+	after := 0
+	ticker := time.NewTicker(checkpointPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for {
+			n, err := j.downloadCheckpoint(ctx, u, outputDir, after)
+			if err != nil {
+				if check.ContextCanceled(ctx) == nil {
+					log.Printf("Output checkpoint: error: %v", err)
+				}
+				break
+			} else if n == 0 {
+				break
+			}
+			log.Printf("Output checkpoint: %d downloaded to %s\n", n, outputDir)
+			after = n
+		}
+	}
+}
+
+// downloadCheckpoint unpacks the first checkpoint after checkpoint number after into outputDir,
+// returning its number, or 0 if there isn't one yet
+func (j *Job) downloadCheckpoint(ctx context.Context, u url.URL, outputDir string, after int) (int, error) {
+	u.Path = path.Join("job", j.ID, "checkpoint")
+	q := url.Values{}
+	q.Set("after", strconv.Itoa(after))
+	u.RawQuery = q.Encode()
+	n := 0
+	operation := func() error {
+		req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", j.AuthToken))
+		req = req.WithContext(ctx)
+
+		resp, err := j.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer check.Err(resp.Body.Close)
+
+		if resp.StatusCode == http.StatusBadGateway {
+			return fmt.Errorf("server: temporary error")
+		} else if resp.StatusCode >= 300 {
+			b, _ := ioutil.ReadAll(resp.Body)
+			return backoff.Permanent(fmt.Errorf("server: %v", string(b)))
+		} else if resp.StatusCode == http.StatusNoContent {
+			return nil
+		}
+
+		if n, err = strconv.Atoi(resp.Header.Get("X-Checkpoint")); err != nil {
+			return backoff.Permanent(fmt.Errorf("parsing checkpoint number: %v", err))
+		}
+		if err = extract.TarGz(resp.Body, outputDir, j.outputLimits()); err != nil {
+			if extract.IsUnsafe(err) {
+				return backoff.Permanent(err)
+			}
+			return fmt.Errorf("unpacking .tar.gz into output directory %v: %v", outputDir, err)
+		}
+
+		return nil
+	}
+	if err := backoff.RetryNotify(operation,
+		backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxRetries), ctx),
+		func(err error, t time.Duration) {
+			log.Printf("Output checkpoint: error: %v", err)
+			log.Printf("Retrying in %s seconds\n", t.Round(time.Second).String())
+		}); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
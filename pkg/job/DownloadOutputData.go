@@ -1,11 +1,14 @@
 package job
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/cenkalti/backoff"
-	"github.com/mholt/archiver"
 	"github.com/wminshew/emrys/pkg/check"
+	"github.com/wminshew/emrysclient/pkg/extract"
+	"github.com/wminshew/emrysclient/pkg/wire"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -16,19 +19,86 @@ import (
 	"time"
 )
 
-// DownloadOutputData downloads the Job's output data
+// DownloadOutputData downloads the Job's output data, or just the files its OutputFilter selects
+// from the server's listing, & verifies them against the miner's manifest
 func (j *Job) DownloadOutputData(ctx context.Context, u url.URL) error {
-	log.Printf("Output data: downloading...\n")
-
 	outputDir := filepath.Join(j.Output, j.ID, "data")
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
 		return fmt.Errorf("making output directory %v: %v", outputDir, err)
 	}
 
-	p := path.Join("job", j.ID, "data")
-	u.Path = p
+	var m *wire.OutputManifest
+	var selected []string
+	if !j.OutputFilter.Empty() {
+		log.Printf("Output data: listing files...\n")
+		listing, err := j.getOutputManifest(ctx, u, true)
+		if err != nil {
+			return fmt.Errorf("listing output files: %v", err)
+		}
+		m = &wire.OutputManifest{Files: []wire.ManifestFile{}}
+		for _, f := range listing.Files {
+			if j.OutputFilter.Match(f.Path) {
+				m.Files = append(m.Files, f)
+				selected = append(selected, f.Path)
+			}
+		}
+		if len(selected) == 0 {
+			log.Printf("Output data: none of the job's %d output file(s) match the output filters\n", len(listing.Files))
+			return nil
+		}
+		log.Printf("Output data: %d of %d output file(s) selected\n", len(selected), len(listing.Files))
+	}
+
+	log.Printf("Output data: downloading...\n")
+	if err := j.downloadOutputArchive(ctx, u, outputDir, selected); err != nil {
+		return err
+	}
+	log.Printf("Output data: downloaded!\n")
+
+	if m == nil {
+		var err error
+		if m, err = j.getOutputManifest(ctx, u, false); err != nil {
+			return fmt.Errorf("getting output manifest: %v", err)
+		} else if m == nil {
+			log.Printf("Output data: warning: the miner didn't upload a manifest, so the output can't be verified\n")
+			return nil
+		}
+	}
+	missing, corrupted, err := m.Verify(outputDir)
+	if err != nil {
+		return fmt.Errorf("verifying output data: %v", err)
+	}
+	for _, p := range missing {
+		log.Printf("Output data: missing %s\n", p)
+	}
+	for _, p := range corrupted {
+		log.Printf("Output data: corrupted %s\n", p)
+	}
+	if len(missing) > 0 || len(corrupted) > 0 {
+		return fmt.Errorf("%d missing & %d corrupted of %d output files", len(missing), len(corrupted), len(m.Files))
+	}
+	log.Printf("Output data: verified %d file(s)\n", len(m.Files))
+	return nil
+}
+
+// downloadOutputArchive unpacks the Job's output data into outputDir. If paths isn't nil, only
+// those files are downloaded
+func (j *Job) downloadOutputArchive(ctx context.Context, u url.URL, outputDir string, paths []string) error {
+	method := http.MethodGet
+	u.Path = path.Join("job", j.ID, "data")
+	var body []byte
+	if paths != nil {
+		method = http.MethodPost
+		u.Path = path.Join("job", j.ID, "data", "select")
+		var err error
+		if body, err = json.Marshal(struct {
+			Paths []string `json:"paths"`
+		}{paths}); err != nil {
+			return fmt.Errorf("encoding selected output files: %v", err)
+		}
+	}
 	operation := func() error {
-		req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+		req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
 		if err != nil {
 			return err
 		}
@@ -50,7 +120,10 @@ func (j *Job) DownloadOutputData(ctx context.Context, u url.URL) error {
 			return fmt.Errorf("server: output data not yet uploaded")
 		}
 
-		if err = archiver.TarGz.Read(resp.Body, outputDir); err != nil {
+		if err = extract.TarGz(resp.Body, outputDir, j.outputLimits()); err != nil {
+			if extract.IsUnsafe(err) {
+				return backoff.Permanent(err)
+			}
 			return fmt.Errorf("unpacking .tar.gz into output directory %v: %v", outputDir, err)
 		}
 
@@ -64,7 +137,53 @@ func (j *Job) DownloadOutputData(ctx context.Context, u url.URL) error {
 		}); err != nil {
 		return fmt.Errorf("%s", err)
 	}
-
-	log.Printf("Output data: downloaded!\n")
 	return nil
 }
+
+// getOutputManifest downloads the manifest listing the Job's output files, or nil if the miner didn't
+// upload one. If wait is true, it retries until the manifest is uploaded instead
+func (j *Job) getOutputManifest(ctx context.Context, u url.URL, wait bool) (*wire.OutputManifest, error) {
+	u.Path = path.Join("job", j.ID, "manifest")
+	var m *wire.OutputManifest
+	operation := func() error {
+		req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", j.AuthToken))
+		req = req.WithContext(ctx)
+
+		resp, err := j.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer check.Err(resp.Body.Close)
+
+		if resp.StatusCode == http.StatusBadGateway {
+			return fmt.Errorf("server: temporary error")
+		} else if resp.StatusCode >= 300 {
+			b, _ := ioutil.ReadAll(resp.Body)
+			return backoff.Permanent(fmt.Errorf("server: %v", string(b)))
+		} else if resp.StatusCode == http.StatusNoContent {
+			if wait {
+				return fmt.Errorf("server: output manifest not yet uploaded")
+			}
+			return nil
+		}
+
+		m = &wire.OutputManifest{}
+		if err := json.NewDecoder(resp.Body).Decode(m); err != nil {
+			return backoff.Permanent(fmt.Errorf("decoding manifest: %v", err))
+		}
+		return nil
+	}
+	if err := backoff.RetryNotify(operation,
+		backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxRetries), ctx),
+		func(err error, t time.Duration) {
+			log.Printf("Output data: error: %v", err)
+			log.Printf("Retrying in %s seconds\n", t.Round(time.Second).String())
+		}); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,175 @@
+package job
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	specs "github.com/wminshew/emrys/pkg/job"
+	"github.com/wminshew/emrysclient/pkg/fakeserver"
+	"github.com/wminshew/emrysclient/pkg/wire"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// packFiles returns files, keyed by slash separated path, as a .tar.gz
+func packFiles(t *testing.T, files map[string]string) []byte {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	for p, contents := range files {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     p,
+			Mode:     0644,
+			Size:     int64(len(contents)),
+			Typeflag: tar.TypeReg,
+			ModTime:  time.Now(),
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// uploadOutput posts body to job jID's route on srv, as the job's miner would
+func uploadOutput(t *testing.T, srv *fakeserver.Server, authToken, jID, route string, body []byte) {
+	u := srv.URL()
+	u.Path = path.Join("job", jID, route)
+	req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", authToken))
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("uploading %s: %s", route, resp.Status)
+	}
+}
+
+func TestDownloadOutputData(t *testing.T) {
+	files := map[string]string{
+		"model.pt":          "weights",
+		"logs/epoch-1.json": "{}",
+	}
+	tests := []struct {
+		name       string
+		change     func(m *wire.OutputManifest)
+		noManifest bool
+		wantErr    string
+	}{
+		{
+			name:   "verified",
+			change: func(m *wire.OutputManifest) {},
+		},
+		{
+			name:       "no manifest",
+			noManifest: true,
+		},
+		{
+			name: "missing file",
+			change: func(m *wire.OutputManifest) {
+				m.Files = append(m.Files, wire.ManifestFile{Path: "gone.pt", Size: 4, SHA256: "00"})
+			},
+			wantErr: "1 missing & 0 corrupted of 3 output files",
+		},
+		{
+			name: "corrupted file",
+			change: func(m *wire.OutputManifest) {
+				m.Files[0].SHA256 = strings.Repeat("0", 64)
+			},
+			wantErr: "0 missing & 1 corrupted of 2 output files",
+		},
+		{
+			name: "traversal path",
+			change: func(m *wire.OutputManifest) {
+				m.Files = append(m.Files, wire.ManifestFile{Path: "../../model.pt", Size: 7, SHA256: m.Files[0].SHA256})
+			},
+			wantErr: "invalid path",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "emrys-download-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			srcDir := filepath.Join(dir, "src")
+			for p, contents := range files {
+				p = filepath.Join(srcDir, filepath.FromSlash(p))
+				if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(p, []byte(contents), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			srv := fakeserver.New(nil)
+			defer srv.Close()
+			jID, err := srv.PostJob("test", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			uploadOutput(t, srv, srv.Scenario.Token, jID, "data", packFiles(t, files))
+			if !tt.noManifest {
+				m, err := wire.BuildOutputManifest(srcDir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				tt.change(m)
+				b, err := json.Marshal(m)
+				if err != nil {
+					t.Fatal(err)
+				}
+				uploadOutput(t, srv, srv.Scenario.Token, jID, "manifest", b)
+			}
+
+			j := &Job{
+				ID:        jID,
+				AuthToken: srv.Scenario.Token,
+				Client:    srv.Client(),
+				Output:    filepath.Join(dir, "output"),
+				Specs:     &specs.Specs{Disk: 1000 * 1000},
+			}
+			err = j.DownloadOutputData(context.Background(), srv.URL())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			for p, contents := range files {
+				b, err := ioutil.ReadFile(filepath.Join(j.Output, jID, "data", filepath.FromSlash(p)))
+				if err != nil {
+					t.Fatal(err)
+				} else if string(b) != contents {
+					t.Errorf("%s = %q, want %q", p, b, contents)
+				}
+			}
+		})
+	}
+}
@@ -9,6 +9,9 @@ import (
 	"github.com/wminshew/emrys/pkg/check"
 	specs "github.com/wminshew/emrys/pkg/job"
 	"github.com/wminshew/emrys/pkg/validate"
+	"github.com/wminshew/emrysclient/pkg/dataset"
+	"github.com/wminshew/emrysclient/pkg/extract"
+	"github.com/wminshew/emrysclient/pkg/s3"
 	"github.com/wminshew/emrysclient/pkg/worker"
 	"io/ioutil"
 	"log"
@@ -18,6 +21,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -33,18 +37,26 @@ type Job struct {
 	Notebook  bool
 	SSHKey    []byte
 	Data      string
-	Output    string
-	GPURaw    string
-	RAMStr    string
-	DiskStr   string
-	PCIEStr   string
-	Specs     *specs.Specs
+	// Dataset names a dataset version to use instead of Data, as name[@version]
+	Dataset string
+	Output  string
+	// OutputLocation is where the miner uploads the output, if Output is an s3:// URL
+	OutputLocation *s3.Location
+	// OutputFilter selects the output files to download
+	OutputFilter OutputFilter
+	GPURaw       string
+	RAMStr       string
+	DiskStr      string
+	PCIEStr      string
+	Specs        *specs.Specs
 }
 
 const (
 	pciePattern   = "^(16|8|4|2|1)x?$"
 	maxRetries    = 10
 	diskBufferStr = "5GB"
+	// maxOutputFiles bounds the number of files in a job's output archives
+	maxOutputFiles = 1000000
 )
 
 var (
@@ -171,18 +183,44 @@ func (j *Job) ValidateAndTransform() error {
 	if j.Output == "" {
 		return fmt.Errorf("must specify an output directory in config or with flag")
 	}
+	if err := j.OutputFilter.Validate(); err != nil {
+		return err
+	}
+	if s3.IsURL(j.Output) {
+		if j.Notebook {
+			return fmt.Errorf("can't upload notebook output to %s", j.Output)
+		} else if !j.OutputFilter.Empty() {
+			return fmt.Errorf("can't filter output uploaded to %s", j.Output)
+		}
+		var err error
+		if j.OutputLocation, err = s3.ParseURL(j.Output); err != nil {
+			return err
+		}
+	}
+	if j.Dataset != "" {
+		if j.Data != "" {
+			return fmt.Errorf("can't use both a data directory and a dataset")
+		}
+		if _, err := dataset.ParseRef(j.Dataset); err != nil {
+			return err
+		}
+	}
 	if j.Data == j.Output {
 		return fmt.Errorf("can't use same directory for data and output")
 	}
-	if filepath.Base(j.Data) == "output" {
+	if strings.HasPrefix(j.Data, "http://") {
+		return fmt.Errorf("remote data must be fetched over https")
+	}
+	remoteData := IsDataURL(j.Data)
+	if !remoteData && filepath.Base(j.Data) == "output" {
 		return fmt.Errorf("can't name data directory \"output\"")
 	}
-	if j.Data != "" {
+	if j.Data != "" && !remoteData {
 		if filepath.Dir(j.Main) != filepath.Dir(j.Data) {
 			return fmt.Errorf("main (%v) and data (%v) must be in the same directory", j.Main, j.Data)
 		}
 	}
-	if j.Main != "" && filepath.Dir(j.Main) != filepath.Dir(j.Output) {
+	if j.Main != "" && j.OutputLocation == nil && filepath.Dir(j.Main) != filepath.Dir(j.Output) {
 		log.Printf("warning! Main (%v) will still only be able to save locally to "+
 			"./output when executing, even though output (%v) has been set to a different "+
 			"directory. Local output to ./output will be saved to your output (%v) at the end "+
@@ -204,7 +242,8 @@ func (j *Job) ValidateAndTransform() error {
 	if j.Specs.Disk, err = humanize.ParseBytes(j.DiskStr); err != nil {
 		return fmt.Errorf("error parsing disk: %v", err)
 	}
-	if j.Data != "" {
+	// remote data sets are sized when they're locked
+	if j.Data != "" && !remoteData {
 		diskBuffer, err := humanize.ParseBytes(diskBufferStr)
 		if err != nil {
 			return fmt.Errorf("error parsing disk buffer: %v", err)
@@ -230,3 +269,11 @@ func (j *Job) ValidateAndTransform() error {
 	}
 	return nil
 }
+
+// outputLimits bounds the output archives the Job's miner can send to its disk allocation
+func (j *Job) outputLimits() extract.Limits {
+	return extract.Limits{
+		MaxBytes: int64(j.Specs.Disk),
+		MaxFiles: maxOutputFiles,
+	}
+}
@@ -0,0 +1,105 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cenkalti/backoff"
+	"github.com/wminshew/emrys/pkg/check"
+	"github.com/wminshew/emrysclient/pkg/s3"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// outputDestinationAge is how long the job's miner may upload to its output destination
+const outputDestinationAge = 7 * 24 * time.Hour
+
+// SendOutputDestination signs an upload policy for the job's output location with the user's
+// local s3 credentials & sends it to the server, so the miner can upload the job's output there.
+// The credentials themselves never leave the user's machine
+func (j *Job) SendOutputDestination(ctx context.Context, u url.URL) error {
+	creds, err := s3.LoadCredentials()
+	if err != nil {
+		return fmt.Errorf("loading s3 credentials: %v", err)
+	}
+	policy, err := creds.NewPostPolicy(j.OutputLocation.Bucket, j.OutputLocation.Key(j.ID)+"/",
+		outputDestinationAge, int64(j.Specs.Disk))
+	if err != nil {
+		return fmt.Errorf("signing upload policy: %v", err)
+	}
+	b, err := json.Marshal(policy)
+	if err != nil {
+		return fmt.Errorf("encoding upload policy: %v", err)
+	}
+
+	u.Path = path.Join("job", j.ID, "destination")
+	operation := func() error {
+		req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(b))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", j.AuthToken))
+		req.Header.Set("Content-Type", "application/json")
+		req = req.WithContext(ctx)
+
+		resp, err := j.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer check.Err(resp.Body.Close)
+
+		if resp.StatusCode == http.StatusBadGateway {
+			return fmt.Errorf("server: temporary error")
+		} else if resp.StatusCode >= 300 {
+			b, _ := ioutil.ReadAll(resp.Body)
+			return backoff.Permanent(fmt.Errorf("server: %v", string(b)))
+		}
+
+		return nil
+	}
+	if err := backoff.RetryNotify(operation,
+		backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxRetries), ctx),
+		func(err error, t time.Duration) {
+			log.Printf("Output destination: error: %v", err)
+			log.Printf("Retrying in %s seconds\n", t.Round(time.Second).String())
+		}); err != nil {
+		return err
+	}
+
+	log.Printf("Output will be uploaded to %s/%s\n", j.OutputLocation, j.ID)
+	return nil
+}
+
+// RecordOutputURLs waits for the manifest of the job's output, which the miner uploaded to the
+// job's output location, & saves it next to main, returning the saved file's path
+func (j *Job) RecordOutputURLs(ctx context.Context, u url.URL) (string, error) {
+	log.Printf("Output data: waiting for upload to %s/%s...\n", j.OutputLocation, j.ID)
+	m, err := j.getOutputManifest(ctx, u, true)
+	if err != nil {
+		return "", err
+	}
+	for _, f := range m.Files {
+		if f.URL == "" {
+			return "", fmt.Errorf("output file %s has no url: miner didn't upload it to %s", f.Path, j.OutputLocation)
+		}
+		log.Printf("Output data: %s\n", f.URL)
+	}
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("encoding manifest: %v", err)
+	}
+	p := filepath.Join(filepath.Dir(j.Main), "output-"+j.ID+".json")
+	if err := ioutil.WriteFile(p, b, 0644); err != nil {
+		return "", fmt.Errorf("writing %s: %v", p, err)
+	}
+
+	log.Printf("Output data: %d file(s) uploaded, urls saved to %s\n", len(m.Files), p)
+	return p, nil
+}
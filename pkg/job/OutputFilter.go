@@ -0,0 +1,57 @@
+package job
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// OutputFilter selects the output files to download with include & exclude globs. A glob
+// matches a file if it matches the file's path relative to the output directory, or one
+// of its parent directories; globs without a / also match the file's or a parent's name,
+// at any depth. With no include globs, every file not excluded is selected
+type OutputFilter struct {
+	Include []string
+	Exclude []string
+}
+
+// Validate checks the filter's globs are well formed
+func (f OutputFilter) Validate() error {
+	for _, g := range append(append([]string{}, f.Include...), f.Exclude...) {
+		if _, err := path.Match(g, ""); err != nil {
+			return fmt.Errorf("invalid output glob %s: %v", g, err)
+		}
+	}
+	return nil
+}
+
+// Empty returns true if the filter selects every file
+func (f OutputFilter) Empty() bool {
+	return len(f.Include) == 0 && len(f.Exclude) == 0
+}
+
+// Match returns true if the filter selects the file at slash separated path p
+func (f OutputFilter) Match(p string) bool {
+	if len(f.Include) > 0 && !matchAny(f.Include, p) {
+		return false
+	}
+	return !matchAny(f.Exclude, p)
+}
+
+// matchAny returns true if any of globs matches p or one of its parent directories
+func matchAny(globs []string, p string) bool {
+	for _, g := range globs {
+		g = strings.Trim(g, "/")
+		for q := p; q != "." && q != "/" && q != ""; q = path.Dir(q) {
+			if ok, _ := path.Match(g, q); ok {
+				return true
+			}
+			if !strings.Contains(g, "/") {
+				if ok, _ := path.Match(g, path.Base(q)); ok {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package job
+
+import (
+	"testing"
+)
+
+func TestOutputFilterMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		path    string
+		want    bool
+	}{
+		{name: "empty filter", path: "model.pt", want: true},
+		{name: "include by name", include: []string{"*.pt"}, path: "model.pt", want: true},
+		{name: "include by name at any depth", include: []string{"*.pt"}, path: "checkpoints/epoch1/model.pt", want: true},
+		{name: "not included", include: []string{"*.pt"}, path: "train.log", want: false},
+		{name: "include a directory by name", include: []string{"checkpoints"}, path: "runs/checkpoints/1.pt", want: true},
+		{name: "include by path", include: []string{"runs/*.log"}, path: "runs/train.log", want: true},
+		{name: "paths are anchored at the output directory", include: []string{"runs/*.log"}, path: "old/runs/train.log", want: false},
+		{name: "path globs don't cross directories", include: []string{"runs/*.log"}, path: "runs/a/train.log", want: false},
+		{name: "include a directory by path", include: []string{"runs/best"}, path: "runs/best/model.pt", want: true},
+		{name: "trailing slash", include: []string{"runs/best/"}, path: "runs/best/model.pt", want: true},
+		{name: "leading slash", include: []string{"/runs"}, path: "runs/train.log", want: true},
+		{name: "exclude", exclude: []string{"*.tmp"}, path: "cache/x.tmp", want: false},
+		{name: "not excluded", exclude: []string{"*.tmp"}, path: "model.pt", want: true},
+		{name: "exclude a directory", exclude: []string{"cache"}, path: "cache/a/b.pt", want: false},
+		{name: "exclude wins", include: []string{"*.pt"}, exclude: []string{"checkpoints"}, path: "checkpoints/1.pt", want: false},
+		{name: "include & not excluded", include: []string{"*.pt"}, exclude: []string{"checkpoints"}, path: "best.pt", want: true},
+		{name: "any of several includes", include: []string{"*.log", "*.pt"}, path: "model.pt", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := OutputFilter{Include: tt.include, Exclude: tt.exclude}
+			if got := f.Match(tt.path); got != tt.want {
+				t.Errorf("%+v.Match(%s) = %v, want %v", f, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputFilterValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  OutputFilter
+		wantErr bool
+	}{
+		{"empty", OutputFilter{}, false},
+		{"valid globs", OutputFilter{Include: []string{"*.pt", "runs/[0-9]*"}, Exclude: []string{"cache"}}, false},
+		{"invalid include", OutputFilter{Include: []string{"runs/[0-9"}}, true},
+		{"invalid exclude", OutputFilter{Exclude: []string{"\\"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.filter.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -4,13 +4,12 @@ import (
 	"bytes"
 	"compress/zlib"
 	"context"
-	"crypto/md5"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"github.com/cenkalti/backoff"
 	"github.com/wminshew/emrys/pkg/check"
 	"github.com/wminshew/emrys/pkg/job"
+	"github.com/wminshew/emrysclient/pkg/dataset"
 	"io"
 	"io/ioutil"
 	"log"
@@ -18,7 +17,6 @@ import (
 	"net/url"
 	"os"
 	"path"
-	"path/filepath"
 	"sync"
 	"time"
 )
@@ -27,6 +25,24 @@ import (
 func (j *Job) SyncData(ctx context.Context, wg *sync.WaitGroup, errCh chan<- error, u url.URL) {
 	defer wg.Done()
 	log.Printf("Data: syncing...\n")
+	if j.Dataset != "" {
+		if err := j.useDataset(ctx, u); err != nil {
+			log.Printf("Data: error: %v", err)
+			errCh <- err
+			return
+		}
+		log.Printf("Data: synced!\n")
+		return
+	}
+	if IsDataURL(j.Data) {
+		if err := j.syncRemoteData(ctx, u); err != nil {
+			log.Printf("Data: error: %v", err)
+			errCh <- err
+			return
+		}
+		log.Printf("Data: synced!\n")
+		return
+	}
 
 	bodyBuf := &bytes.Buffer{}
 	var b []byte
@@ -37,43 +53,8 @@ func (j *Job) SyncData(ctx context.Context, wg *sync.WaitGroup, errCh chan<- err
 				return fmt.Errorf("retrieving data directory metadata: %v", err)
 			}
 
-			newMetadata := make(map[string]job.FileMetadata)
-			if err := filepath.Walk(j.Data, func(path string, info os.FileInfo, err error) error {
-				if err != nil {
-					return err
-				}
-				if info.IsDir() {
-					return nil
-				}
-
-				rP, err := filepath.Rel(j.Data, path)
-				if err != nil {
-					return err
-				}
-				mT := info.ModTime().UnixNano()
-				f, err := os.Open(path)
-				if err != nil {
-					return err
-				}
-				defer check.Err(f.Close)
-				if oldFileMd, ok := oldMetadata[rP]; ok {
-					if oldFileMd.ModTime == mT {
-						newMetadata[rP] = oldFileMd
-						return nil
-					}
-				}
-				h := md5.New()
-				if _, err := io.Copy(h, f); err != nil {
-					return err
-				}
-				hStr := base64.StdEncoding.EncodeToString(h.Sum(nil))
-				fileMd := job.FileMetadata{
-					ModTime: mT,
-					Hash:    hStr,
-				}
-				newMetadata[rP] = fileMd
-				return nil
-			}); err != nil {
+			newMetadata, err := dataset.Scan(j.Data, oldMetadata)
+			if err != nil {
 				return fmt.Errorf("walking data directory %s: %v", j.Data, err)
 			}
 
@@ -172,7 +153,7 @@ func (j *Job) SyncData(ctx context.Context, wg *sync.WaitGroup, errCh chan<- err
 				errCh <- err
 				return
 			case result := <-results:
-				log.Printf(result)
+				log.Print(result)
 				n++
 				if n == len(uploadList) {
 					log.Printf("Data: synced!\n")
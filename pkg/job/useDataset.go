@@ -0,0 +1,55 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"github.com/cenkalti/backoff"
+	"github.com/wminshew/emrys/pkg/check"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+)
+
+// useDataset tells the server to give the job's miner the job's dataset, which the server
+// already holds, as its data set
+func (j *Job) useDataset(ctx context.Context, u url.URL) error {
+	u.Host = "data.emrys.io"
+	u.Path = path.Join("user", "project", j.Project, "job", j.ID)
+	u.RawQuery = url.Values{"dataset": []string{j.Dataset}}.Encode()
+	operation := func() error {
+		req, err := http.NewRequest(http.MethodPost, u.String(), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", j.AuthToken))
+		req = req.WithContext(ctx)
+
+		resp, err := j.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer check.Err(resp.Body.Close)
+
+		if resp.StatusCode == http.StatusBadGateway {
+			return fmt.Errorf("server: temporary error")
+		} else if resp.StatusCode >= 300 {
+			b, _ := ioutil.ReadAll(resp.Body)
+			return backoff.Permanent(fmt.Errorf("server: %v", string(b)))
+		}
+
+		return nil
+	}
+	if err := backoff.RetryNotify(operation,
+		backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxRetries), ctx),
+		func(err error, t time.Duration) {
+			log.Printf("Data: error: %v", err)
+			log.Printf("Retrying in %s seconds\n", t.Round(time.Second).String())
+		}); err != nil {
+		return err
+	}
+	log.Printf("Data: using dataset %s\n", j.Dataset)
+	return nil
+}
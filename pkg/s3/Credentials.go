@@ -0,0 +1,183 @@
+package s3
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/wminshew/emrys/pkg/check"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	defaultRegion = "us-east-1"
+	gcsEndpoint   = "https://storage.googleapis.com"
+)
+
+// Credentials sign requests to an S3-compatible store
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Region          string
+	// Endpoint is the base URL of a non-AWS store, e.g. https://storage.googleapis.com for GCS
+	// interoperability or a MinIO server. Blank is AWS
+	Endpoint string
+}
+
+// LoadCredentials reads credentials from the standard AWS environment variables (AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN, AWS_REGION & AWS_ENDPOINT_URL), falling back to the
+// AWS_PROFILE (or default) profile in ~/.aws/credentials & ~/.aws/config
+func LoadCredentials() (*Credentials, error) {
+	c := &Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		Region:          os.Getenv("AWS_REGION"),
+		Endpoint:        os.Getenv("AWS_ENDPOINT_URL"),
+	}
+	if c.Region == "" {
+		c.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+
+	if c.AccessKeyID == "" || c.Region == "" || c.Endpoint == "" {
+		profile := os.Getenv("AWS_PROFILE")
+		if profile == "" {
+			profile = "default"
+		}
+		home, err := homeDir()
+		if err != nil {
+			return nil, err
+		}
+		if c.AccessKeyID == "" {
+			creds, err := readProfile(filepath.Join(home, ".aws", "credentials"), profile)
+			if err != nil {
+				return nil, err
+			}
+			c.AccessKeyID = creds["aws_access_key_id"]
+			c.SecretAccessKey = creds["aws_secret_access_key"]
+			c.SessionToken = creds["aws_session_token"]
+		}
+		// profiles other than default are prefixed in the config file
+		configProfile := profile
+		if profile != "default" {
+			configProfile = "profile " + profile
+		}
+		config, err := readProfile(filepath.Join(home, ".aws", "config"), configProfile)
+		if err != nil {
+			return nil, err
+		}
+		if c.Region == "" {
+			c.Region = config["region"]
+		}
+		if c.Endpoint == "" {
+			c.Endpoint = config["endpoint_url"]
+		}
+	}
+
+	if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+		return nil, fmt.Errorf("no s3 credentials found: set AWS_ACCESS_KEY_ID & AWS_SECRET_ACCESS_KEY, or configure a profile in ~/.aws/credentials")
+	}
+	if c.Region == "" {
+		c.Region = defaultRegion
+	}
+	c.Endpoint = strings.TrimRight(c.Endpoint, "/")
+	return c, nil
+}
+
+// LoadGCSCredentials returns credentials for the S3-compatible XML API of Google Cloud Storage,
+// signed with the HMAC keys in GS_ACCESS_KEY_ID & GS_SECRET_ACCESS_KEY. Without them, requests
+// are anonymous & only reach public buckets
+func LoadGCSCredentials() *Credentials {
+	return &Credentials{
+		AccessKeyID:     os.Getenv("GS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("GS_SECRET_ACCESS_KEY"),
+		Region:          "auto",
+		Endpoint:        gcsEndpoint,
+	}
+}
+
+// AnonymousCredentials returns credentials for unsigned requests to public AWS buckets
+func AnonymousCredentials() *Credentials {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = defaultRegion
+	}
+	return &Credentials{
+		Region:   region,
+		Endpoint: strings.TrimRight(os.Getenv("AWS_ENDPOINT_URL"), "/"),
+	}
+}
+
+// Anonymous returns true if the credentials can't sign requests
+func (c *Credentials) Anonymous() bool {
+	return c.AccessKeyID == ""
+}
+
+// BucketURL returns the URL of bucket, which objects' keys are appended to
+func (c *Credentials) BucketURL(bucket string) string {
+	if c.Endpoint != "" {
+		return fmt.Sprintf("%s/%s", c.Endpoint, bucket)
+	}
+	host := "s3.amazonaws.com"
+	if c.Region != defaultRegion {
+		host = fmt.Sprintf("s3.%s.amazonaws.com", c.Region)
+	}
+	// dotted bucket names don't match the wildcard certificate of virtual-hosted URLs
+	if strings.Contains(bucket, ".") {
+		return fmt.Sprintf("https://%s/%s", host, bucket)
+	}
+	return fmt.Sprintf("https://%s.%s", bucket, host)
+}
+
+// readProfile returns the keys of section profile in the ini file at p, or none if the file doesn't exist
+func readProfile(p, profile string) (map[string]string, error) {
+	keys := make(map[string]string)
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return keys, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("opening %s: %v", p, err)
+	}
+	defer check.Err(f.Close)
+
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if section != profile {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) == 2 {
+			keys[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %v", p, err)
+	}
+	return keys, nil
+}
+
+// homeDir returns the home directory of the user, or of the user who invoked sudo
+func homeDir() (string, error) {
+	u, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("getting current user: %v", err)
+	}
+	if os.Geteuid() == 0 && os.Getenv("SUDO_USER") != "" {
+		u, err = user.Lookup(os.Getenv("SUDO_USER"))
+		if err != nil {
+			return "", fmt.Errorf("getting current sudo user: %v", err)
+		}
+	}
+	return u.HomeDir, nil
+}
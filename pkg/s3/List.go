@@ -0,0 +1,87 @@
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"github.com/wminshew/emrys/pkg/check"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// listAge is how long each signed list request is valid for
+const listAge = 15 * time.Minute
+
+// Object is an object listed in a bucket
+type Object struct {
+	Key  string
+	Size int64
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key  string `xml:"Key"`
+		Size int64  `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List returns every object in bucket whose key starts with prefix, skipping directory markers
+func (c *Credentials) List(ctx context.Context, client *http.Client, bucket, prefix string) ([]Object, error) {
+	objects := []Object{}
+	token := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		u, err := c.PresignGet(bucket, "", query, listAge)
+		if err != nil {
+			return nil, err
+		}
+		result, err := getListPage(ctx, client, u)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range result.Contents {
+			if strings.HasSuffix(o.Key, "/") {
+				continue
+			}
+			objects = append(objects, Object{Key: o.Key, Size: o.Size})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func getListPage(ctx context.Context, client *http.Client, u string) (*listBucketResult, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer check.Err(resp.Body.Close)
+	if resp.StatusCode >= 300 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("s3: listing: %d: %s", resp.StatusCode, string(b))
+	}
+
+	result := &listBucketResult{}
+	if err := xml.NewDecoder(resp.Body).Decode(result); err != nil {
+		return nil, fmt.Errorf("decoding list: %v", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,64 @@
+package s3
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Location is a bucket & key prefix, written s3://bucket/prefix, or gs://bucket/prefix for
+// Google Cloud Storage
+type Location struct {
+	Scheme string
+	Bucket string
+	Prefix string
+}
+
+// IsURL returns true if s is an s3:// URL
+func IsURL(s string) bool {
+	return strings.HasPrefix(s, "s3://")
+}
+
+// IsGSURL returns true if s is a gs:// URL
+func IsGSURL(s string) bool {
+	return strings.HasPrefix(s, "gs://")
+}
+
+// ParseURL parses an s3://bucket/prefix or gs://bucket/prefix URL
+func ParseURL(s string) (*Location, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", s, err)
+	}
+	if (u.Scheme != "s3" && u.Scheme != "gs") || u.Host == "" {
+		return nil, fmt.Errorf("invalid url %s: must be s3://bucket/prefix or gs://bucket/prefix", s)
+	}
+	return &Location{
+		Scheme: u.Scheme,
+		Bucket: u.Host,
+		Prefix: strings.Trim(u.Path, "/"),
+	}, nil
+}
+
+// Credentials loads the credentials for the location's store
+func (l *Location) Credentials() (*Credentials, error) {
+	if l.Scheme == "gs" {
+		return LoadGCSCredentials(), nil
+	}
+	return LoadCredentials()
+}
+
+// Key returns the key of name under the location's prefix
+func (l *Location) Key(name string) string {
+	if l.Prefix == "" {
+		return name
+	}
+	return l.Prefix + "/" + name
+}
+
+func (l *Location) String() string {
+	if l.Prefix == "" {
+		return fmt.Sprintf("%s://%s", l.Scheme, l.Bucket)
+	}
+	return fmt.Sprintf("%s://%s/%s", l.Scheme, l.Bucket, l.Prefix)
+}
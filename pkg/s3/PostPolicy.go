@@ -0,0 +1,153 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/wminshew/emrys/pkg/check"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxPostPolicyAge is the longest a SigV4 POST policy may be valid for
+const maxPostPolicyAge = 7 * 24 * time.Hour
+
+// PostPolicy lets its holder upload objects under a key prefix with form POSTs, without the
+// credentials that signed it
+type PostPolicy struct {
+	// URL is the bucket's URL, which the form is posted to
+	URL       string            `json:"url"`
+	KeyPrefix string            `json:"key_prefix"`
+	Fields    map[string]string `json:"fields"`
+	Expires   time.Time         `json:"expires"`
+}
+
+// NewPostPolicy signs a policy allowing uploads of objects of up to maxSize bytes to keys
+// starting with keyPrefix in bucket, until expires has passed (at most 7 days)
+func (c *Credentials) NewPostPolicy(bucket, keyPrefix string, expires time.Duration, maxSize int64) (*PostPolicy, error) {
+	return c.newPostPolicy(bucket, keyPrefix, expires, maxSize, time.Now())
+}
+
+func (c *Credentials) newPostPolicy(bucket, keyPrefix string, expires time.Duration, maxSize int64, now time.Time) (*PostPolicy, error) {
+	if expires > maxPostPolicyAge {
+		expires = maxPostPolicyAge
+	}
+	now = now.UTC()
+	date := now.Format("20060102")
+	credential := fmt.Sprintf("%s/%s/%s/s3/aws4_request", c.AccessKeyID, date, c.Region)
+	fields := map[string]string{
+		"x-amz-algorithm":  "AWS4-HMAC-SHA256",
+		"x-amz-credential": credential,
+		"x-amz-date":       now.Format("20060102T150405Z"),
+	}
+	if c.SessionToken != "" {
+		fields["x-amz-security-token"] = c.SessionToken
+	}
+
+	conditions := []interface{}{
+		map[string]string{"bucket": bucket},
+		[]interface{}{"starts-with", "$key", keyPrefix},
+		[]interface{}{"content-length-range", 0, maxSize},
+	}
+	names := []string{}
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		conditions = append(conditions, map[string]string{name: fields[name]})
+	}
+	expiration := now.Add(expires)
+	policy, err := json.Marshal(map[string]interface{}{
+		"expiration": expiration.Format("2006-01-02T15:04:05.000Z"),
+		"conditions": conditions,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encoding policy: %v", err)
+	}
+	policyB64 := base64.StdEncoding.EncodeToString(policy)
+	fields["policy"] = policyB64
+	fields["x-amz-signature"] = hex.EncodeToString(hmacSHA256(c.signingKey(date), policyB64))
+
+	return &PostPolicy{
+		URL:       c.BucketURL(bucket),
+		KeyPrefix: keyPrefix,
+		Fields:    fields,
+		Expires:   expiration,
+	}, nil
+}
+
+// ObjectURL returns the URL of the object at key
+func (p *PostPolicy) ObjectURL(key string) string {
+	segs := strings.Split(key, "/")
+	for i, seg := range segs {
+		segs[i] = url.PathEscape(seg)
+	}
+	return p.URL + "/" + strings.Join(segs, "/")
+}
+
+// Upload uploads the size bytes of r as the object name under the policy's key prefix,
+// returning the object's URL
+func (p *PostPolicy) Upload(ctx context.Context, client *http.Client, name string, r io.Reader, size int64) (string, error) {
+	key := p.KeyPrefix + name
+	// the form's fields precede the file, which must be its last part
+	head := &bytes.Buffer{}
+	mw := multipart.NewWriter(head)
+	names := []string{}
+	for field := range p.Fields {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+	if err := mw.WriteField("key", key); err != nil {
+		return "", err
+	}
+	for _, field := range names {
+		if err := mw.WriteField(field, p.Fields[field]); err != nil {
+			return "", err
+		}
+	}
+	if _, err := mw.CreateFormFile("file", name); err != nil {
+		return "", err
+	}
+	tail := fmt.Sprintf("\r\n--%s--\r\n", mw.Boundary())
+
+	// S3 rejects chunked POSTs, so the body's length is set up front
+	body := io.MultiReader(head, io.LimitReader(r, size), strings.NewReader(tail))
+	req, err := http.NewRequest(http.MethodPost, p.URL, body)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = int64(head.Len()) + size + int64(len(tail))
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req = req.WithContext(ctx)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer check.Err(resp.Body.Close)
+	if resp.StatusCode >= 300 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return "", &UploadError{StatusCode: resp.StatusCode, Body: string(b)}
+	}
+	return p.ObjectURL(key), nil
+}
+
+// UploadError is returned when the store rejects an upload
+type UploadError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *UploadError) Error() string {
+	return fmt.Sprintf("s3: %d: %s", e.StatusCode, e.Body)
+}
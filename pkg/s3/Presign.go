@@ -0,0 +1,127 @@
+package s3
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPresignAge is the longest a SigV4 presigned URL may be valid for
+const maxPresignAge = 7 * 24 * time.Hour
+
+// PresignGet returns a URL that GETs key in bucket, with query, for expires (at most 7 days)
+// without further credentials. Anonymous credentials return the unsigned URL
+func (c *Credentials) PresignGet(bucket, key string, query url.Values, expires time.Duration) (string, error) {
+	return c.presign("GET", bucket, key, query, expires, time.Now())
+}
+
+func (c *Credentials) presign(method, bucket, key string, query url.Values, expires time.Duration, now time.Time) (string, error) {
+	base, err := url.Parse(c.BucketURL(bucket))
+	if err != nil {
+		return "", fmt.Errorf("parsing bucket url: %v", err)
+	}
+	uri := base.EscapedPath()
+	if key != "" {
+		uri = strings.TrimRight(uri, "/") + "/" + escapePath(key)
+	}
+	if uri == "" {
+		uri = "/"
+	}
+	params := url.Values{}
+	for k, vs := range query {
+		params[k] = vs
+	}
+	if c.Anonymous() {
+		return fmt.Sprintf("%s://%s%s%s", base.Scheme, base.Host, uri, queryPrefix(canonicalQuery(params))), nil
+	}
+
+	if expires > maxPresignAge {
+		expires = maxPresignAge
+	}
+	now = now.UTC()
+	date := now.Format("20060102")
+	amzDate := now.Format("20060102T150405Z")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, c.Region)
+	params.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	params.Set("X-Amz-Credential", c.AccessKeyID+"/"+scope)
+	params.Set("X-Amz-Date", amzDate)
+	params.Set("X-Amz-Expires", strconv.Itoa(int(expires.Seconds())))
+	params.Set("X-Amz-SignedHeaders", "host")
+	if c.SessionToken != "" {
+		params.Set("X-Amz-Security-Token", c.SessionToken)
+	}
+	cq := canonicalQuery(params)
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		uri,
+		cq,
+		"host:" + base.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	h := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(h[:]),
+	}, "\n")
+	signature := hex.EncodeToString(hmacSHA256(c.signingKey(date), stringToSign))
+
+	return fmt.Sprintf("%s://%s%s?%s&X-Amz-Signature=%s", base.Scheme, base.Host, uri, cq, signature), nil
+}
+
+// canonicalQuery encodes params sorted by key, as SigV4 requires
+func canonicalQuery(params url.Values) string {
+	keys := []string{}
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := []string{}
+	for _, k := range keys {
+		vs := append([]string{}, params[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			pairs = append(pairs, escape(k)+"="+escape(v))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func queryPrefix(q string) string {
+	if q == "" {
+		return ""
+	}
+	return "?" + q
+}
+
+// escapePath escapes each segment of key, keeping its slashes
+func escapePath(key string) string {
+	segs := strings.Split(key, "/")
+	for i, seg := range segs {
+		segs[i] = escape(seg)
+	}
+	return strings.Join(segs, "/")
+}
+
+// escape percent-encodes every byte of s but SigV4's unreserved characters
+func escape(s string) string {
+	b := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,20 @@
+package s3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+)
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// signingKey derives the SigV4 key for s3 requests on date (YYYYMMDD)
+func (c *Credentials) signingKey(date string) []byte {
+	k := hmacSHA256([]byte("AWS4"+c.SecretAccessKey), date)
+	k = hmacSHA256(k, c.Region)
+	k = hmacSHA256(k, "s3")
+	return hmacSHA256(k, "aws4_request")
+}
@@ -0,0 +1,44 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+)
+
+// Fans controls a simulated GPU's fans
+type Fans struct {
+	GPU   *GPU
+	state int
+}
+
+// SetControlState enables (1) or disables (0) manual fan control
+func (f *Fans) SetControlState(ctx context.Context, state int) error {
+	if state != 0 && state != 1 {
+		return fmt.Errorf("improper new fan control state: %d", state)
+	}
+	f.GPU.mu.Lock()
+	defer f.GPU.mu.Unlock()
+	f.state = state
+	return nil
+}
+
+// ControlState returns the current fan control state
+func (f *Fans) ControlState(ctx context.Context) (int, error) {
+	f.GPU.mu.Lock()
+	defer f.GPU.mu.Unlock()
+	return f.state, nil
+}
+
+// SetSpeed sets the simulated fan speed (%), which cools the GPU's synthetic temperature
+func (f *Fans) SetSpeed(ctx context.Context, speed int) error {
+	if speed < 0 || speed > 100 {
+		return fmt.Errorf("improper fan speed: %d", speed)
+	}
+	f.GPU.mu.Lock()
+	defer f.GPU.mu.Unlock()
+	if f.state != 1 {
+		return fmt.Errorf("fan control disabled")
+	}
+	f.GPU.fanSpeed = uint(speed)
+	return nil
+}
@@ -0,0 +1,116 @@
+package sim
+
+import (
+	"fmt"
+	"github.com/satori/go.uuid"
+	"github.com/wminshew/emrys/pkg/job"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	defaultName = "GeForce GTX 1080 Ti"
+	idleTemp    = 35.0
+	loadTemp    = 82.0
+	fanCooling  = 0.2 // degrees C shed per % of fan speed
+	tempInertia = 0.25
+	tempNoise   = 0.5
+)
+
+// GPU is a simulated device reporting synthetic stats & temperatures
+type GPU struct {
+	Index    uint
+	Name     string
+	mu       sync.Mutex
+	temp     float64
+	fanSpeed uint
+	busy     bool
+}
+
+// NewGPU returns a simulated GPU at device index
+func NewGPU(index uint) *GPU {
+	return &GPU{
+		Index:    index,
+		Name:     defaultName,
+		temp:     idleTemp,
+		fanSpeed: 30,
+	}
+}
+
+// Init records the simulated device's static specs in snapshot
+func (g *GPU) Init(snapshot *job.DeviceSnapshot) error {
+	var ok bool
+	if snapshot.Name, ok = job.ValidateGPU(g.Name); !ok {
+		return fmt.Errorf("device %d: simulated gpu %s is not supported by the emrys network", g.Index, g.Name)
+	}
+	snapshot.ID = uuid.NewV5(uuid.NamespaceOID, fmt.Sprintf("emrys/sim/gpu/%d", g.Index))
+	snapshot.MinorNumber = g.Index
+	snapshot.DefaultPowerLimit = 250000
+	snapshot.GrMaxClock = 1911
+	snapshot.SMMaxClock = 1911
+	snapshot.MemMaxClock = 5505
+	snapshot.PcieMaxGeneration = 3
+	snapshot.PcieMaxWidth = 16
+	return nil
+}
+
+// Verify always succeeds; simulated devices can't be misconfigured
+func (g *GPU) Verify(snapshot *job.DeviceSnapshot) error {
+	return nil
+}
+
+// Sample records synthetic stats in snapshot; busy devices look fully loaded
+func (g *GPU) Sample(period time.Duration, snapshot *job.DeviceSnapshot) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.step()
+
+	snapshot.TotalMemory = 11 * 1024 * 1024 * 1024
+	snapshot.Temperature = uint(g.temp + 0.5)
+	snapshot.FanSpeed = g.fanSpeed
+	snapshot.PcieGeneration = 3
+	snapshot.PcieWidth = 16
+	if g.busy {
+		snapshot.UsedMemory = 8 * 1024 * 1024 * 1024
+		snapshot.AvgGPUUtilization = 97
+		snapshot.AvgPowerUsage = 235000
+		snapshot.GrClock = 1860
+		snapshot.SMClock = 1860
+		snapshot.MemClock = 5505
+	} else {
+		snapshot.AvgPowerUsage = 12000
+		snapshot.GrClock = 139
+		snapshot.SMClock = 139
+		snapshot.MemClock = 405
+	}
+	return nil
+}
+
+// Thermals returns the device's synthetic temperature (C) & fan speed (%)
+func (g *GPU) Thermals() (uint, uint, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.step()
+	return uint(g.temp + 0.5), g.fanSpeed, nil
+}
+
+// SetBusy marks whether a job is running on the device
+func (g *GPU) SetBusy(busy bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.busy = busy
+}
+
+// step moves the temperature toward its load & fan dependent equilibrium
+func (g *GPU) step() {
+	target := idleTemp
+	if g.busy {
+		target = loadTemp
+	}
+	target -= float64(g.fanSpeed) * fanCooling
+	if target < idleTemp-10 {
+		target = idleTemp - 10
+	}
+	g.temp += (target-g.temp)*tempInertia + rand.NormFloat64()*tempNoise
+}
@@ -0,0 +1,286 @@
+package sim
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/wminshew/emrysclient/pkg/worker"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultJobDuration = 30 * time.Second
+	defaultLogPeriod   = 2 * time.Second
+	simRootFsSize      = 2 * 1000 * 1000 * 1000
+	simSubnet          = "10.89.0.0/24"
+	simImageSize       = 500 * 1000 * 1000
+	simBaseLayer       = "sha256:simulated-base-layer"
+)
+
+// Runtime is a fake container runtime that "runs" jobs by echoing log lines
+// & writing a small output file
+type Runtime struct {
+	JobDuration time.Duration
+	LogPeriod   time.Duration
+	gpus        map[string]*GPU
+	mu          sync.Mutex
+	created     int
+	images      map[string]time.Time
+	containers  map[string]*container
+}
+
+type container struct {
+	spec *worker.ContainerSpec
+	// startedAt times the simulated job, so following the logs again doesn't restart it
+	startedAt time.Time
+	started   bool
+	stopped   bool
+	done      chan struct{}
+	written   int64
+}
+
+// NewRuntime returns a fake runtime that marks gpus busy while their containers run
+func NewRuntime(gpus []*GPU) *Runtime {
+	r := &Runtime{
+		JobDuration: defaultJobDuration,
+		LogPeriod:   defaultLogPeriod,
+		gpus:        make(map[string]*GPU),
+		images:      make(map[string]time.Time),
+		containers:  make(map[string]*container),
+	}
+	for _, g := range gpus {
+		r.gpus[strconv.Itoa(int(g.Index))] = g
+	}
+	return r
+}
+
+// ImagePull "pulls" ref, returning json progress messages like dockerd
+func (r *Runtime) ImagePull(ctx context.Context, ref, registryAuth string) (io.ReadCloser, error) {
+	r.mu.Lock()
+	if _, ok := r.images[ref]; !ok {
+		r.images[ref] = time.Now()
+	}
+	r.mu.Unlock()
+
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	for _, status := range []string{"Pulling from simulated registry", "Pull complete"} {
+		if err := enc.Encode(map[string]string{"status": status, "id": ref}); err != nil {
+			return nil, err
+		}
+	}
+	return ioutil.NopCloser(buf), nil
+}
+
+// ImageRemove forgets ref
+func (r *Runtime) ImageRemove(ctx context.Context, ref string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.images[ref]; !ok {
+		return fmt.Errorf("no such image: %s", ref)
+	}
+	delete(r.images, ref)
+	return nil
+}
+
+// ImageList lists the "pulled" images, which all share a simulated base layer
+func (r *Runtime) ImageList(ctx context.Context) ([]worker.Image, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	images := []worker.Image{}
+	for ref, pulled := range r.images {
+		images = append(images, worker.Image{
+			ID:      fmt.Sprintf("sim-%s", ref),
+			Refs:    []string{ref},
+			Size:    simImageSize,
+			Created: pulled,
+			Layers:  []string{simBaseLayer, fmt.Sprintf("sha256:simulated-%s", ref)},
+		})
+	}
+	return images, nil
+}
+
+// ImagesPrune does nothing since simulated images are never left dangling
+func (r *Runtime) ImagesPrune(ctx context.Context) error {
+	return nil
+}
+
+// ContainerCreate creates a fake container from spec
+func (r *Runtime) ContainerCreate(ctx context.Context, spec *worker.ContainerSpec) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.images[spec.Image]; !ok {
+		return "", fmt.Errorf("no such image: %s", spec.Image)
+	}
+	if _, ok := r.gpus[spec.Device]; !ok {
+		return "", fmt.Errorf("no such simulated device: %s", spec.Device)
+	}
+	r.created++
+	id := fmt.Sprintf("sim-%d", r.created)
+	r.containers[id] = &container{
+		spec: spec,
+		done: make(chan struct{}),
+	}
+	return id, nil
+}
+
+// ContainerStart marks the container's gpu busy until the simulated job finishes
+func (r *Runtime) ContainerStart(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.containers[id]
+	if !ok {
+		return fmt.Errorf("no such container: %s", id)
+	}
+	if c.started {
+		return fmt.Errorf("container %s already started", id)
+	}
+	c.started = true
+	c.startedAt = time.Now()
+	r.gpus[c.spec.Device].SetBusy(true)
+	return nil
+}
+
+// ContainerLogs echoes a log line every LogPeriod until JobDuration has elapsed since the
+// container started, then writes the job's output file
+func (r *Runtime) ContainerLogs(ctx context.Context, id string) (io.ReadCloser, error) {
+	r.mu.Lock()
+	c, ok := r.containers[id]
+	var start time.Time
+	if ok {
+		start = c.startedAt
+	}
+	r.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no such container: %s", id)
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		for i := 1; time.Since(start) < r.JobDuration; i++ {
+			select {
+			case <-ctx.Done():
+				_ = pw.CloseWithError(ctx.Err())
+				return
+			case <-c.done:
+				_ = pw.Close()
+				return
+			case <-time.After(r.LogPeriod):
+			}
+			line := fmt.Sprintf("simulated epoch %d: loss %.4f\n", i, 1/float64(i+1))
+			if _, err := io.WriteString(pw, line); err != nil {
+				return
+			}
+		}
+
+		output := []byte(fmt.Sprintf("simulated job output from container %s\n", id))
+		outputPath := filepath.Join(c.spec.HostOutputDir, "sim_output.txt")
+		if err := ioutil.WriteFile(outputPath, output, 0644); err != nil {
+			_ = pw.CloseWithError(err)
+			return
+		}
+		r.mu.Lock()
+		c.written = int64(len(output))
+		r.mu.Unlock()
+		r.gpus[c.spec.Device].SetBusy(false)
+		_ = pw.Close()
+	}()
+	return pr, nil
+}
+
+// ContainerStats returns a minimal json-encoded docker stats sample
+func (r *Runtime) ContainerStats(ctx context.Context, id string) (io.ReadCloser, error) {
+	r.mu.Lock()
+	c, ok := r.containers[id]
+	r.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no such container: %s", id)
+	}
+
+	stats := map[string]interface{}{
+		"read": time.Now(),
+		"memory_stats": map[string]int64{
+			"usage": c.spec.Memory / 2,
+			"limit": c.spec.Memory,
+		},
+	}
+	b, err := json.Marshal(stats)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
+
+// ContainerDiskUsage returns the simulated disk used by the container
+func (r *Runtime) ContainerDiskUsage(ctx context.Context, id string) (worker.ContainerDiskUsage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.containers[id]
+	if !ok {
+		return worker.ContainerDiskUsage{}, fmt.Errorf("no such container: %s", id)
+	}
+	return worker.ContainerDiskUsage{
+		SizeRw:     c.written,
+		SizeRootFs: simRootFsSize,
+	}, nil
+}
+
+// ContainerKill stops the container, freeing its gpu
+func (r *Runtime) ContainerKill(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.containers[id]
+	if !ok {
+		return fmt.Errorf("no such container: %s", id)
+	}
+	r.stop(c)
+	return nil
+}
+
+// ContainerList lists the fake containers
+func (r *Runtime) ContainerList(ctx context.Context) ([]worker.Container, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	containers := []worker.Container{}
+	for id, c := range r.containers {
+		containers = append(containers, worker.Container{
+			ID:     id,
+			Image:  c.spec.Image,
+			Labels: c.spec.Labels,
+		})
+	}
+	return containers, nil
+}
+
+// ContainerRemove stops & forgets the container, freeing its gpu
+func (r *Runtime) ContainerRemove(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.containers[id]
+	if !ok {
+		return fmt.Errorf("no such container: %s", id)
+	}
+	r.stop(c)
+	delete(r.containers, id)
+	return nil
+}
+
+// stop must be called with mu held
+func (r *Runtime) stop(c *container) {
+	if !c.stopped {
+		c.stopped = true
+		close(c.done)
+	}
+	r.gpus[c.spec.Device].SetBusy(false)
+}
+
+// NetworkEnsure "creates" network name
+func (r *Runtime) NetworkEnsure(ctx context.Context, name string) (string, error) {
+	return simSubnet, nil
+}
@@ -0,0 +1,160 @@
+package sim
+
+import (
+	"context"
+	"github.com/wminshew/emrysclient/pkg/worker"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func (g *GPU) isBusy() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.busy
+}
+
+// startContainer pulls an image & starts a container on gpu 0 writing its output to outputDir
+func startContainer(t *testing.T, r *Runtime, outputDir string) string {
+	ctx := context.Background()
+	if _, err := r.ImagePull(ctx, "registry.emrys.io/job", ""); err != nil {
+		t.Fatal(err)
+	}
+	id, err := r.ContainerCreate(ctx, &worker.ContainerSpec{Image: "registry.emrys.io/job", Device: "0", HostOutputDir: outputDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ContainerStart(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestRuntimeRunsJob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "emrys-sim-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	gpu := NewGPU(0)
+	r := NewRuntime([]*GPU{gpu})
+	r.JobDuration = 200 * time.Millisecond
+	r.LogPeriod = 50 * time.Millisecond
+
+	id := startContainer(t, r, dir)
+	if !gpu.isBusy() {
+		t.Errorf("gpu idle while its container runs")
+	}
+	if err := r.ContainerStart(context.Background(), id); err == nil {
+		t.Errorf("started container %s twice", id)
+	}
+	logs, err := r.ContainerLogs(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), "simulated epoch"); n < 2 {
+		t.Errorf("log has %d epochs, want several:\n%s", n, b)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sim_output.txt")); err != nil {
+		t.Errorf("job output: %v", err)
+	}
+	if gpu.isBusy() {
+		t.Errorf("gpu busy after its job finished")
+	}
+}
+
+// TestRuntimeLogsResume follows a container's logs again, as a miner resuming the job after a
+// restart does, which mustn't restart the simulated job
+func TestRuntimeLogsResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "emrys-sim-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	r := NewRuntime([]*GPU{NewGPU(0)})
+	r.JobDuration = 200 * time.Millisecond
+	r.LogPeriod = 50 * time.Millisecond
+
+	id := startContainer(t, r, dir)
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		logs, err := r.ContainerLogs(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ioutil.ReadAll(logs); err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 {
+			if took := time.Since(start); took >= r.JobDuration {
+				t.Errorf("following the logs again took %s, want the job to have finished already", took)
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sim_output.txt")); err != nil {
+		t.Errorf("job output: %v", err)
+	}
+}
+
+func TestRuntimeKill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "emrys-sim-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	gpu := NewGPU(0)
+	r := NewRuntime([]*GPU{gpu})
+	r.LogPeriod = 10 * time.Millisecond
+
+	id := startContainer(t, r, dir)
+	logs, err := r.ContainerLogs(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(50*time.Millisecond, func() {
+		_ = r.ContainerKill(context.Background(), id)
+	})
+	done := make(chan struct{})
+	go func() {
+		_, _ = ioutil.ReadAll(logs)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("log still streaming after the container was killed")
+	}
+	if gpu.isBusy() {
+		t.Errorf("gpu busy after its container was killed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sim_output.txt")); !os.IsNotExist(err) {
+		t.Errorf("killed job wrote output: %v", err)
+	}
+	if err := r.ContainerRemove(context.Background(), id); err != nil {
+		t.Fatal(err)
+	}
+	if containers, err := r.ContainerList(context.Background()); err != nil || len(containers) != 0 {
+		t.Errorf("containers after removal = %v, %v, want none", containers, err)
+	}
+}
+
+func TestRuntimeCreateErrors(t *testing.T) {
+	r := NewRuntime([]*GPU{NewGPU(0)})
+	ctx := context.Background()
+	if _, err := r.ContainerCreate(ctx, &worker.ContainerSpec{Image: "registry.emrys.io/job", Device: "0"}); err == nil {
+		t.Errorf("created a container from an image that wasn't pulled")
+	}
+	if _, err := r.ImagePull(ctx, "registry.emrys.io/job", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ContainerCreate(ctx, &worker.ContainerSpec{Image: "registry.emrys.io/job", Device: "1"}); err == nil {
+		t.Errorf("created a container on a device that isn't simulated")
+	}
+}
@@ -0,0 +1,112 @@
+package wire
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/wminshew/emrys/pkg/check"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// OutputManifest lists the files of a job's output, so the output users download can be verified
+type OutputManifest struct {
+	Files []ManifestFile `json:"files"`
+}
+
+// ManifestFile is a single file of an OutputManifest
+type ManifestFile struct {
+	// Path is slash separated & relative to the output directory
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	// URL is where the file was uploaded, if the job's output went straight to an object store
+	URL string `json:"url,omitempty"`
+}
+
+// BuildOutputManifest hashes every regular file under dir
+func BuildOutputManifest(dir string) (*OutputManifest, error) {
+	m := &OutputManifest{Files: []ManifestFile{}}
+	if err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		size, sum, err := hashFile(p)
+		if err != nil {
+			return err
+		}
+		m.Files = append(m.Files, ManifestFile{
+			Path:   filepath.ToSlash(rel),
+			Size:   size,
+			SHA256: sum,
+		})
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("walking output directory %s: %v", dir, err)
+	}
+	return m, nil
+}
+
+// Verify checks the files under dir against the manifest, returning the paths of those missing
+// from dir & those whose size or hash don't match. Files in dir not in the manifest are ignored.
+// Manifests come from the miner, so any path that isn't clean & inside dir is an error
+func (m *OutputManifest) Verify(dir string) ([]string, []string, error) {
+	missing, corrupted := []string{}, []string{}
+	for _, f := range m.Files {
+		if !validManifestPath(f.Path) {
+			return nil, nil, fmt.Errorf("invalid path in manifest: %q", f.Path)
+		}
+		p := filepath.Join(dir, filepath.FromSlash(f.Path))
+		info, err := os.Stat(p)
+		if os.IsNotExist(err) {
+			missing = append(missing, f.Path)
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+		if !info.Mode().IsRegular() || info.Size() != f.Size {
+			corrupted = append(corrupted, f.Path)
+			continue
+		}
+		_, sum, err := hashFile(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		if sum != f.SHA256 {
+			corrupted = append(corrupted, f.Path)
+		}
+	}
+	return missing, corrupted, nil
+}
+
+// validManifestPath returns true if p is a clean, relative, slash separated path that doesn't climb out of
+// its directory
+func validManifestPath(p string) bool {
+	return p != "." && path.Clean(p) == p && !path.IsAbs(p) && p != ".." && !strings.HasPrefix(p, "../") &&
+		!strings.Contains(p, "\\")
+}
+
+// hashFile returns the size & hex SHA-256 of the file at p
+func hashFile(p string) (int64, string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, "", err
+	}
+	defer check.Err(f.Close)
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", fmt.Errorf("hashing %s: %v", p, err)
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,160 @@
+package wire
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes files, keyed by slash separated path, under dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for p, contents := range files {
+		p = filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBuildOutputManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "emrys-manifest-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"model.pt":          "weights",
+		"logs/epoch-1.json": "{}",
+	})
+	if err := os.Symlink("model.pt", filepath.Join(dir, "latest.pt")); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := BuildOutputManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// symlinks & dirs aren't listed
+	want := []ManifestFile{
+		{Path: "logs/epoch-1.json", Size: 2, SHA256: "44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"},
+		{Path: "model.pt", Size: 7, SHA256: "9a129038d9a00aed0cf6a7ea059ca50a813449061ab87848cf1a13eafdf33b2c"},
+	}
+	if !reflect.DeepEqual(m.Files, want) {
+		t.Errorf("files = %+v, want %+v", m.Files, want)
+	}
+}
+
+func TestOutputManifestVerify(t *testing.T) {
+	files := map[string]string{
+		"model.pt":          "weights",
+		"logs/epoch-1.json": "{}",
+	}
+	tests := []struct {
+		name          string
+		change        func(t *testing.T, dir string, m *OutputManifest)
+		wantMissing   []string
+		wantCorrupted []string
+	}{
+		{
+			name:   "round trip",
+			change: func(t *testing.T, dir string, m *OutputManifest) {},
+		},
+		{
+			name: "extra files are ignored",
+			change: func(t *testing.T, dir string, m *OutputManifest) {
+				writeFiles(t, dir, map[string]string{"notes.txt": "hi"})
+			},
+		},
+		{
+			name: "missing file",
+			change: func(t *testing.T, dir string, m *OutputManifest) {
+				if err := os.Remove(filepath.Join(dir, "model.pt")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantMissing: []string{"model.pt"},
+		},
+		{
+			name: "corrupted file",
+			change: func(t *testing.T, dir string, m *OutputManifest) {
+				writeFiles(t, dir, map[string]string{"model.pt": "weighty"})
+			},
+			wantCorrupted: []string{"model.pt"},
+		},
+		{
+			name: "truncated file",
+			change: func(t *testing.T, dir string, m *OutputManifest) {
+				writeFiles(t, dir, map[string]string{"logs/epoch-1.json": "{"})
+			},
+			wantCorrupted: []string{"logs/epoch-1.json"},
+		},
+		{
+			name: "dir in place of a file",
+			change: func(t *testing.T, dir string, m *OutputManifest) {
+				if err := os.Remove(filepath.Join(dir, "model.pt")); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Mkdir(filepath.Join(dir, "model.pt"), 0755); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantCorrupted: []string{"model.pt"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "emrys-manifest-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			writeFiles(t, dir, files)
+			m, err := BuildOutputManifest(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.change(t, dir, m)
+
+			missing, corrupted, err := m.Verify(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantMissing == nil {
+				tt.wantMissing = []string{}
+			}
+			if tt.wantCorrupted == nil {
+				tt.wantCorrupted = []string{}
+			}
+			if !reflect.DeepEqual(missing, tt.wantMissing) {
+				t.Errorf("missing = %v, want %v", missing, tt.wantMissing)
+			}
+			if !reflect.DeepEqual(corrupted, tt.wantCorrupted) {
+				t.Errorf("corrupted = %v, want %v", corrupted, tt.wantCorrupted)
+			}
+		})
+	}
+}
+
+func TestOutputManifestVerifyInvalidPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "emrys-manifest-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{"logs/epoch-1.json": "{}"})
+
+	for _, p := range []string{"", ".", "..", "../model.pt", "logs/../../model.pt", "/etc/passwd", "logs/./epoch-1.json", "logs//epoch-1.json", "logs/"} {
+		t.Run(p, func(t *testing.T) {
+			m := &OutputManifest{Files: []ManifestFile{{Path: p}}}
+			if _, _, err := m.Verify(dir); err == nil || !strings.Contains(err.Error(), "invalid path") {
+				t.Errorf("error = %v, want invalid path", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package wire
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// RemoteData lists the files of a data set the miner fetches from its source, instead of from
+// the server
+type RemoteData struct {
+	Files []RemoteFile `json:"files"`
+}
+
+// RemoteFile is a single file of a RemoteData set
+type RemoteFile struct {
+	// Path is slash separated & relative to the data directory
+	Path   string `json:"path"`
+	URL    string `json:"url"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Validate checks every file stays inside the data directory, appears once & is fetched from an
+// https:// URL, or an s3:// or gs:// URL presigned before it's sent to the miner
+func (d *RemoteData) Validate() error {
+	seen := make(map[string]bool, len(d.Files))
+	for _, f := range d.Files {
+		if f.Path == "" || path.IsAbs(f.Path) || path.Clean(f.Path) != f.Path ||
+			f.Path == ".." || strings.HasPrefix(f.Path, "../") || strings.Contains(f.Path, "\\") {
+			return fmt.Errorf("invalid data file path %q", f.Path)
+		}
+		if seen[f.Path] {
+			return fmt.Errorf("duplicate data file path %q", f.Path)
+		}
+		seen[f.Path] = true
+		if f.Size < 0 {
+			return fmt.Errorf("invalid size of data file %q: %d", f.Path, f.Size)
+		}
+		if err := validateURL(f.URL); err != nil {
+			return fmt.Errorf("invalid url of data file %q: %v", f.Path, err)
+		}
+	}
+	return nil
+}
+
+// validateURL checks rawURL names a file on a host, over https or in an s3 or gs bucket
+func validateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "https", "s3", "gs":
+	default:
+		return fmt.Errorf("scheme must be https, s3 or gs, not %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("missing host")
+	} else if u.User != nil {
+		return fmt.Errorf("credentials not allowed")
+	}
+	return nil
+}
+
+// Size returns the total size of the data set's files
+func (d *RemoteData) Size() int64 {
+	var n int64
+	for _, f := range d.Files {
+		n += f.Size
+	}
+	return n
+}
@@ -0,0 +1,11 @@
+package worker
+
+// BaseImage is an image from the server's manifest of recommended base images, which the
+// miner pre-pulls & keeps cached so job images built on it only download their own layers
+type BaseImage struct {
+	Ref    string `json:"ref"`
+	CUDA   string `json:"cuda"`
+	Ubuntu string `json:"ubuntu"`
+	// Size is the image's compressed download size in bytes, if known
+	Size uint64 `json:"size"`
+}
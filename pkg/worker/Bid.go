@@ -6,7 +6,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/cenkalti/backoff"
-	"github.com/dustin/go-humanize"
 	"github.com/pkg/errors"
 	"github.com/shirou/gopsutil/disk"
 	"github.com/shirou/gopsutil/mem"
@@ -20,48 +19,106 @@ import (
 	"time"
 )
 
-// Bid submits a bid on behalf of the Worker for a given job
-func (w *Worker) Bid(ctx context.Context, u url.URL, msg *job.Message) error {
-	*w.BidsOut++
-	defer func() { *w.BidsOut-- }()
+// Bid submits a bid on behalf of the Worker for a given job. Workers have at most one bid
+// in flight, so Bid returns immediately if the Worker isn't idle
+func (w *Worker) Bid(ctx context.Context, u url.URL, msg *job.Message, limits JobLimits) error {
 	u.RawQuery = ""
 	jID := msg.Job.ID.String()
+	if err := w.transition(StateBidding, jID); err != nil {
+		return nil
+	}
+	winner := false
+	defer func() {
+		if !winner {
+			w.finishJob()
+		}
+	}()
+	settings := w.Settings()
+
+	now := time.Now()
+	if !settings.BidSchedule.Open(now) {
+		log.Printf("Mine: bid: device %d: outside bid schedule; skipping job %s\n", w.Device, jID)
+		return nil
+	}
+	if closes := settings.BidSchedule.Closes(now); !closes.IsZero() {
+		if est := w.estimateRuntime(limits); now.Add(est).After(closes) {
+			log.Printf("Mine: bid: device %d: job %s would likely run past the bid schedule (estimated runtime %s, window closes %s); skipping\n",
+				w.Device, jID, est.Round(time.Minute), closes.Format("Mon 15:04"))
+			return nil
+		}
+	}
+
+	if !settings.NetworkPolicy.Allows(limits.Network) {
+		log.Printf("Mine: bid: device %d: job %s needs network access disallowed by network policy %s; skipping\n", w.Device, jID, settings.NetworkPolicy)
+		return nil
+	}
+
+	snapshot := w.Snapshot()
+	strategy := settings.BidStrategy
+	if strategy == nil {
+		strategy = &FixedStrategy{}
+	}
+	rate, ok, err := strategy.Rate(ctx, &BidRequest{
+		Message:    msg,
+		Snapshot:   &snapshot,
+		BidRate:    settings.BidRate,
+		MaxRuntime: limits.MaxRuntime,
+		History:    w.history(),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting bid rate", w.Device)
+	} else if !ok {
+		log.Printf("Mine: bid: device %d: bid strategy skipped job %s\n", w.Device, jID)
+		return nil
+	}
+
+	if settings.ElectricityPrice > 0 || settings.MiningRevenue > 0 {
+		if breakEven := w.BreakEvenRate(settings); rate < breakEven {
+			if settings.BreakEvenPolicy == BreakEvenSkip {
+				log.Printf("Mine: bid: device %d: rate %v below break-even %v; skipping job %s\n", w.Device, rate, breakEven, jID)
+				return nil
+			}
+			log.Printf("Mine: bid: device %d: raising rate %v to break-even %v\n", w.Device, rate, breakEven)
+			rate = breakEven
+		}
+	}
 
 	b := &job.Bid{
-		DeviceID: w.Snapshot.ID,
+		DeviceID: snapshot.ID,
 		Specs: &job.Specs{
-			Rate: w.BidRate,
-			GPU:  w.Snapshot.Name,
-			RAM:  w.RAM,
-			Disk: w.Disk,
-			Pcie: int(w.Snapshot.PcieMaxWidth),
+			Rate: rate,
+			GPU:  snapshot.Name,
+			RAM:  settings.RAM,
+			Disk: settings.Disk,
+			Pcie: int(snapshot.PcieMaxWidth),
 		},
 	}
 
-	// TODO: account for mem reserved for other in-process jobs
-	// have to check for busy workers (w.Busy), add reserved ram (w.RAM), and then delete already-allocated-to-job RAM [via docker]
+	fs, err := MountPoint(settings.Workdir)
+	if err != nil {
+		return errors.Wrapf(err, "device %d: finding workdir filesystem", w.Device)
+	}
 	memStats, err := mem.VirtualMemoryWithContext(ctx)
 	if err != nil {
 		return errors.Wrapf(err, "device %d: getting memory stats", w.Device)
-	} else if w.RAM > memStats.Available {
-		return fmt.Errorf("device %d: insufficient available memory (requested for bidding: %s "+
-			"> system memory available %s)", w.Device, humanize.Bytes(w.RAM), humanize.Bytes(memStats.Available))
 	}
-
-	// TODO: account for disk reserved for other in-process jobs
-	// have to check for busy workers (w.Busy), add reserved disk (w.Disk), and then delete already-allocated-to-job Disk [via gopsutil, docker]
-	diskUsage, err := disk.UsageWithContext(ctx, "/")
+	diskUsage, err := disk.UsageWithContext(ctx, fs)
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting disk usage of %s", w.Device, fs)
+	}
+	res, err := w.Ledger.Reserve(settings.RAM, settings.Disk, fs, memStats.Available, diskUsage.Free)
 	if err != nil {
-		return errors.Wrapf(err, "device %d: getting disk usage", w.Device)
-	} else if w.Disk > diskUsage.Free {
-		return fmt.Errorf("device %d: insufficient available disk space (requested for bidding: %s "+
-			"> system disk space available %s)", w.Device, humanize.Bytes(w.Disk), humanize.Bytes(diskUsage.Free))
+		return errors.Wrapf(err, "device %d", w.Device)
 	}
+	defer func() {
+		if !winner {
+			res.Release()
+		}
+	}()
 
 	log.Printf("Mine: bid: device %d: sending bid with rate: %v...\n", w.Device, b.Specs.Rate)
 	p := path.Join("miner", "job", jID, "bid")
 	u.Path = p
-	winner := false
 	operation := func() error {
 		body := &bytes.Buffer{}
 		if err := json.NewEncoder(body).Encode(b); err != nil {
@@ -81,17 +138,14 @@ func (w *Worker) Bid(ctx context.Context, u url.URL, msg *job.Message) error {
 		}
 		defer check.Err(resp.Body.Close)
 
-		if w.Busy {
-			return backoff.Permanent(fmt.Errorf("already busy with job %s", w.JobID))
-		} else if resp.StatusCode == http.StatusOK {
+		if resp.StatusCode == http.StatusOK {
 			winner = true
 			sshKeyBytes, err := ioutil.ReadAll(resp.Body)
 			if err != nil {
 				return backoff.Permanent(fmt.Errorf("reading response: %v", err))
 			}
 			if len(sshKeyBytes) > 0 {
-				w.sshKey = sshKeyBytes
-				w.notebook = true
+				w.setNotebookKey(sshKeyBytes)
 			}
 		} else if resp.StatusCode == http.StatusPaymentRequired {
 			log.Printf("Mine: bid: device %d: bid not selected\n", w.Device)
@@ -109,12 +163,25 @@ func (w *Worker) Bid(ctx context.Context, u url.URL, msg *job.Message) error {
 		func(err error, t time.Duration) {
 			log.Printf("Mine: bid: device %d: bid error: %v. Retrying in %s seconds\n", w.Device, err, t.Round(time.Second).String())
 		}); err != nil {
+		winner = false
 		return errors.Wrapf(err, "device %d: sending bid to server", w.Device)
 	}
 
+	w.recordBid(BidRecord{
+		JobID: jID,
+		Time:  time.Now(),
+		Rate:  rate,
+		Won:   winner,
+	})
+
 	if winner {
 		log.Printf("Mine: bid: device %d: you won job %v!\n", w.Device, jID)
-		go w.executeJob(ctx, u, jID)
+		if err := w.transition(StateWon, jID); err != nil {
+			winner = false
+			return errors.Wrapf(err, "device %d", w.Device)
+		}
+		res.Commit()
+		go w.executeJob(ctx, u, jID, res)
 	}
 
 	return nil
@@ -0,0 +1,80 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"github.com/wminshew/emrys/pkg/job"
+	"strings"
+	"time"
+)
+
+// BidStrategy decides what a Worker bids on a job
+type BidStrategy interface {
+	// Rate returns the rate ($/hr) to bid on req's job, or false to skip the job
+	Rate(ctx context.Context, req *BidRequest) (float64, bool, error)
+}
+
+// BidRequest is the information available to a BidStrategy
+type BidRequest struct {
+	Message  *job.Message        `json:"message"`
+	Snapshot *job.DeviceSnapshot `json:"snapshot"`
+	// BidRate is the device's configured bid-rate
+	BidRate float64 `json:"bid_rate"`
+	// MaxRuntime is the job's declared maximum runtime in seconds; zero if undeclared
+	MaxRuntime int64   `json:"max_runtime"`
+	History    History `json:"history"`
+}
+
+// History is a Worker's recent bidding & job record
+type History struct {
+	Bids []BidRecord `json:"bids"`
+	Jobs []JobRecord `json:"jobs"`
+}
+
+// BidRecord is a single bid sent by a Worker
+type BidRecord struct {
+	JobID string    `json:"job_id"`
+	Time  time.Time `json:"time"`
+	Rate  float64   `json:"rate"`
+	Won   bool      `json:"won"`
+}
+
+// JobRecord is a single job executed by a Worker. End is zero while the job is running
+type JobRecord struct {
+	JobID string    `json:"job_id"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// ParseBidStrategy returns the BidStrategy described by spec, which is one of:
+//
+//	fixed
+//	schedule:HH:MM-HH:MM=RATE[;HH:MM-HH:MM=RATE...]
+//	utilization:MIN-MAX
+//	script:COMMAND
+func ParseBidStrategy(spec string) (BidStrategy, error) {
+	split := strings.SplitN(spec, ":", 2)
+	name := strings.TrimSpace(split[0])
+	args := ""
+	if len(split) == 2 {
+		args = strings.TrimSpace(split[1])
+	}
+
+	switch name {
+	case "", "fixed":
+		return &FixedStrategy{}, nil
+	case "schedule":
+		return ParseScheduleStrategy(args)
+	case "utilization":
+		return ParseUtilizationStrategy(args)
+	case "script":
+		if args == "" {
+			return nil, fmt.Errorf("script bid strategy requires a command")
+		}
+		return &ScriptStrategy{
+			Command: args,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown bid strategy %s", name)
+	}
+}
@@ -0,0 +1,22 @@
+package worker
+
+import (
+	"math"
+)
+
+// Policies for bids below a device's break-even rate
+const (
+	BreakEvenRaise = "raise"
+	BreakEvenSkip  = "skip"
+)
+
+// BreakEvenRate returns the lowest rate ($/hr) at which an emrys job earns at least as
+// much as the device's alternative (crypto mining if configured, otherwise idling) after
+// electricity costs. Jobs are assumed to draw the device's default power limit; the
+// alternative's draw is the average power last sampled while the device was between jobs
+func (w *Worker) BreakEvenRate(s Settings) float64 {
+	jobKW := float64(w.Snapshot().DefaultPowerLimit) / 1000 / 1000 // mW -> kW
+	altKW := float64(w.altPowerUsage()) / 1000 / 1000
+	breakEven := s.MiningRevenue - altKW*s.ElectricityPrice + jobKW*s.ElectricityPrice
+	return math.Ceil(breakEven*100) / 100 // round up to the cent
+}
@@ -0,0 +1,36 @@
+package worker
+
+import (
+	"github.com/wminshew/emrys/pkg/job"
+	"testing"
+)
+
+func TestBreakEvenRate(t *testing.T) {
+	tests := []struct {
+		name          string
+		powerLimit    uint // mW
+		altPowerUsage uint // mW
+		settings      Settings
+		want          float64
+	}{
+		{"free electricity, idle", 250000, 50000, Settings{}, 0},
+		{"idle", 300000, 0, Settings{ElectricityPrice: 0.1}, 0.03},
+		{"idle draw offsets job draw", 300000, 100000, Settings{ElectricityPrice: 0.1}, 0.02},
+		{"rounds up to the cent", 250000, 0, Settings{ElectricityPrice: 0.1}, 0.03},
+		{"mining", 250000, 200000, Settings{ElectricityPrice: 0.12, MiningRevenue: 1}, 1.01},
+		{"mining draws more than jobs", 250000, 300000, Settings{ElectricityPrice: 0.2, MiningRevenue: 0.5}, 0.49},
+		{"mining, free electricity", 250000, 200000, Settings{MiningRevenue: 0.75}, 0.75},
+		{"unmonitored device", 0, 200000, Settings{ElectricityPrice: 0.1, MiningRevenue: 1}, 0.98},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Worker{lastAltPowerUsage: tt.altPowerUsage}
+			if tt.powerLimit > 0 {
+				w.snapshot = &job.DeviceSnapshot{DefaultPowerLimit: tt.powerLimit}
+			}
+			if got := w.BreakEvenRate(tt.settings); got != tt.want {
+				t.Errorf("BreakEvenRate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
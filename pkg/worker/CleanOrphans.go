@@ -0,0 +1,66 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// jobImagePrefix prefixes the refs of job images
+const jobImagePrefix = emrysRegistry + "miner/"
+
+// CleanOrphans removes the job containers of miner minerID & job dirs in workdirs left behind by
+// previous runs of the miner, e.g. after a crash, except those of the jobs in keep, which workers have recovered.
+// It must be called after workers Recover & before any starts a new job. Job images are left to
+// the ImageCache, which prunes danglings & evicts the rest by age & size
+func CleanOrphans(ctx context.Context, runtime ContainerRuntime, minerID string, workdirs, keep []string) error {
+	kept := make(map[string]bool)
+	for _, jID := range keep {
+		kept[jID] = true
+	}
+
+	containers, err := runtime.ContainerList(ctx)
+	if err != nil {
+		return fmt.Errorf("listing containers: %v", err)
+	}
+	for _, c := range containers {
+		// containers of other miners sharing the runtime are theirs to clean up
+		if !strings.HasPrefix(c.Image, jobImagePrefix) || c.Labels[labelMiner] != minerID || kept[c.Labels[labelJob]] {
+			continue
+		}
+		log.Printf("Mine: removing orphaned job container %s (%s)\n", c.ID, c.Image)
+		if err := runtime.ContainerRemove(ctx, c.ID); err != nil {
+			return fmt.Errorf("removing container %s: %v", c.ID, err)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, workdir := range workdirs {
+		if seen[workdir] {
+			continue
+		}
+		seen[workdir] = true
+		fileInfos, err := ioutil.ReadDir(workdir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("reading workdir %s: %v", workdir, err)
+		}
+		for _, fi := range fileInfos {
+			// anything the operator keeps alongside job dirs is left alone
+			if !fi.IsDir() || !jobIDPattern.MatchString(fi.Name()) || kept[fi.Name()] {
+				continue
+			}
+			jobDir := filepath.Join(workdir, fi.Name())
+			log.Printf("Mine: removing orphaned job dir %s\n", jobDir)
+			if err := os.RemoveAll(jobDir); err != nil {
+				return fmt.Errorf("removing job dir %s: %v", jobDir, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package worker_test
+
+import (
+	"context"
+	"github.com/wminshew/emrys/pkg/check"
+	"github.com/wminshew/emrysclient/pkg/sim"
+	"github.com/wminshew/emrysclient/pkg/worker"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestCleanOrphans(t *testing.T) {
+	const (
+		minerID    = "test-miner"
+		jobImage   = "registry.emrys.io/miner/test"
+		otherImage = "nvidia/cuda:10.0-base"
+		orphanJob  = "0f8fad5b-d9cb-469f-a165-70867728950e"
+		keptJob    = "7c9e6679-7425-40de-944b-e07fc1f90ae7"
+		otherJob   = "3f333df6-90a4-4fda-8dd3-9485d27cee36"
+	)
+	workdir, err := ioutil.TempDir("", "emrys-clean-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(workdir)
+	for _, d := range []string{orphanJob, keptJob, "datasets"} {
+		if err := os.MkdirAll(filepath.Join(workdir, d, "output"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// only dirs are job dirs
+	if err := ioutil.WriteFile(filepath.Join(workdir, otherJob), []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	runtime := sim.NewRuntime([]*sim.GPU{sim.NewGPU(0)})
+	for _, ref := range []string{jobImage, otherImage} {
+		out, err := runtime.ImagePull(ctx, ref, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		check.Err(out.Close)
+	}
+	containers := []struct {
+		name   string
+		image  string
+		labels map[string]string
+		want   bool
+	}{
+		{"orphan", jobImage, worker.JobLabels(minerID, orphanJob, 0), false},
+		{"kept", jobImage, worker.JobLabels(minerID, keptJob, 0), true},
+		{"other miner's", jobImage, worker.JobLabels("other-miner", otherJob, 0), true},
+		{"unlabeled", jobImage, nil, true},
+		{"non-job", otherImage, worker.JobLabels(minerID, orphanJob, 0), true},
+	}
+	wantIDs := []string{}
+	for _, c := range containers {
+		id, err := runtime.ContainerCreate(ctx, &worker.ContainerSpec{
+			Image:  c.image,
+			Device: "0",
+			Labels: c.labels,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.want {
+			wantIDs = append(wantIDs, id)
+		}
+	}
+
+	// repeated & missing workdirs are skipped
+	workdirs := []string{workdir, workdir, filepath.Join(workdir, "missing")}
+	if err := worker.CleanOrphans(ctx, runtime, minerID, workdirs, []string{keptJob}); err != nil {
+		t.Fatal(err)
+	}
+
+	left, err := runtime.ContainerList(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leftIDs := []string{}
+	for _, c := range left {
+		leftIDs = append(leftIDs, c.ID)
+	}
+	sort.Strings(leftIDs)
+	sort.Strings(wantIDs)
+	if len(leftIDs) != len(wantIDs) {
+		t.Fatalf("containers left = %v, want %v", leftIDs, wantIDs)
+	}
+	for i := range leftIDs {
+		if leftIDs[i] != wantIDs[i] {
+			t.Fatalf("containers left = %v, want %v", leftIDs, wantIDs)
+		}
+	}
+
+	for _, tt := range []struct {
+		name string
+		want bool
+	}{
+		{orphanJob, false},
+		{keptJob, true},
+		{"datasets", true},
+		{otherJob, true},
+	} {
+		if _, err := os.Stat(filepath.Join(workdir, tt.name)); (err == nil) != tt.want {
+			t.Errorf("%s left = %v, want %v", tt.name, err == nil, tt.want)
+		}
+	}
+}
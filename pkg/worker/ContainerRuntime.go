@@ -0,0 +1,85 @@
+package worker
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// ContainerRuntime pulls images & runs job containers on behalf of a Worker
+type ContainerRuntime interface {
+	// ImagePull pulls ref, returning a stream of json progress messages
+	ImagePull(ctx context.Context, ref, registryAuth string) (io.ReadCloser, error)
+	// ImageRemove force-removes ref
+	ImageRemove(ctx context.Context, ref string) error
+	// ImageList lists the images held by the runtime
+	ImageList(ctx context.Context) ([]Image, error)
+	// ImagesPrune removes dangling images
+	ImagesPrune(ctx context.Context) error
+	// ContainerCreate creates a container from spec, returning its ID
+	ContainerCreate(ctx context.Context, spec *ContainerSpec) (string, error)
+	// ContainerStart starts container id
+	ContainerStart(ctx context.Context, id string) error
+	// ContainerLogs follows the stdout & stderr of container id until it exits
+	ContainerLogs(ctx context.Context, id string) (io.ReadCloser, error)
+	// ContainerStats returns a single json-encoded docker stats sample for container id
+	ContainerStats(ctx context.Context, id string) (io.ReadCloser, error)
+	// ContainerKill kills container id
+	ContainerKill(ctx context.Context, id string) error
+	// ContainerDiskUsage returns the disk used by container id
+	ContainerDiskUsage(ctx context.Context, id string) (ContainerDiskUsage, error)
+	// ContainerList lists all containers, running or not
+	ContainerList(ctx context.Context) ([]Container, error)
+	// ContainerRemove force-removes container id
+	ContainerRemove(ctx context.Context, id string) error
+	// NetworkEnsure creates bridge network name, using name as its bridge interface & with
+	// inter-container communication disabled, if it doesn't exist. It returns the network's subnet
+	NetworkEnsure(ctx context.Context, name string) (string, error)
+}
+
+// ContainerSpec describes a job container
+type ContainerSpec struct {
+	Image              string
+	Device             string
+	HostDataDir        string
+	ContainerDataDir   string
+	HostOutputDir      string
+	ContainerOutputDir string
+	Memory             int64
+	ShmSize            int64
+	// DiskQuota caps the container's writable layer in bytes where the runtime's storage
+	// driver supports it (e.g. overlay2 on xfs with pquota); 0 is unlimited
+	DiskQuota int64
+	// NotebookPort is the host port bound to the container's jupyter port; blank for non-notebook jobs
+	NotebookPort string
+	// Network is the network to attach the container to: a network name, none, or blank for the default
+	Network  string
+	Security SecurityProfile
+	// Labels identify the container's job so it can be recovered if the miner restarts
+	Labels map[string]string
+}
+
+// Container describes a container held by a runtime
+type Container struct {
+	ID     string
+	Image  string
+	Labels map[string]string
+}
+
+// ContainerDiskUsage holds the disk used by a container's writable layer & root filesystem
+type ContainerDiskUsage struct {
+	SizeRw     int64
+	SizeRootFs int64
+}
+
+// Image describes an image held by a container runtime
+type Image struct {
+	ID   string
+	Refs []string
+	// Size is the disk used by the image's layers that aren't shared with other images, where the
+	// runtime reports shared sizes; otherwise its total size
+	Size    int64
+	Created time.Time
+	// Layers are the digests of the image's uncompressed layers
+	Layers []string
+}
@@ -0,0 +1,501 @@
+package worker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/dustin/go-humanize"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const nerdctlCmd = "nerdctl"
+
+// ContainerdRuntime runs job containers with containerd by shelling out to nerdctl
+type ContainerdRuntime struct {
+	// Address is containerd's socket; blank uses nerdctl's default
+	Address string
+	// Namespace is the containerd namespace jobs run in
+	Namespace string
+	networkMu sync.Mutex
+}
+
+// NewContainerdRuntime returns a ContainerRuntime backed by containerd at address
+func NewContainerdRuntime(address string) *ContainerdRuntime {
+	return &ContainerdRuntime{
+		Address:   address,
+		Namespace: "emrys",
+	}
+}
+
+// ContainerdInfo holds the parts of nerdctl info the miner checks at startup
+type ContainerdInfo struct {
+	ServerVersion   string
+	SecurityOptions []string
+}
+
+// Info returns containerd's version & security options
+func (r *ContainerdRuntime) Info(ctx context.Context) (ContainerdInfo, error) {
+	info := ContainerdInfo{}
+	out, err := r.command(ctx, "info", "--format", "{{json .}}").Output()
+	if err != nil {
+		return info, fmt.Errorf("nerdctl info: %v", cmdErr(err))
+	}
+	if err := json.Unmarshal(out, &info); err != nil {
+		return info, fmt.Errorf("decoding nerdctl info: %v", err)
+	}
+	return info, nil
+}
+
+// ImagePull pulls ref, returning a stream of json progress messages
+func (r *ContainerdRuntime) ImagePull(ctx context.Context, ref, registryAuth string) (io.ReadCloser, error) {
+	configDir, err := writeRegistryConfig(ref, registryAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := r.command(ctx, "pull", "--quiet", ref)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("DOCKER_CONFIG=%s", configDir))
+	pr, pw := io.Pipe()
+	go func() {
+		defer func() { _ = os.RemoveAll(configDir) }()
+		enc := json.NewEncoder(pw)
+		if _, err := cmd.Output(); err != nil {
+			msg := cmdErr(err).Error()
+			_ = enc.Encode(map[string]interface{}{
+				"errorDetail": map[string]string{"message": msg},
+				"error":       msg,
+			})
+			_ = pw.Close()
+			return
+		}
+		_ = enc.Encode(map[string]string{"status": "Pull complete", "id": ref})
+		_ = pw.Close()
+	}()
+	return pr, nil
+}
+
+// ImageRemove force-removes ref
+func (r *ContainerdRuntime) ImageRemove(ctx context.Context, ref string) error {
+	if err := r.command(ctx, "rmi", "--force", ref).Run(); err != nil {
+		return cmdErr(err)
+	}
+	return nil
+}
+
+// nerdctlImage is a line of nerdctl images output
+type nerdctlImage struct {
+	ID         string
+	Repository string
+	Tag        string
+	CreatedAt  string
+	Size       string
+}
+
+// nerdctlImageInspect is the output of nerdctl image inspect
+type nerdctlImageInspect struct {
+	RootFS struct {
+		Layers []string
+	}
+}
+
+// ImageList lists the images held by containerd. nerdctl doesn't report shared sizes, so
+// each image's Size is its total size
+func (r *ContainerdRuntime) ImageList(ctx context.Context) ([]Image, error) {
+	out, err := r.command(ctx, "images", "--no-trunc", "--format", "{{json .}}").Output()
+	if err != nil {
+		return nil, fmt.Errorf("nerdctl images: %v", cmdErr(err))
+	}
+
+	images := []Image{}
+	index := make(map[string]int)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		img := nerdctlImage{}
+		if err := json.Unmarshal(scanner.Bytes(), &img); err != nil {
+			return nil, fmt.Errorf("decoding nerdctl images: %v", err)
+		}
+		// nerdctl lists an image once per tag
+		if i, ok := index[img.ID]; ok {
+			if img.Repository != "<none>" {
+				images[i].Refs = append(images[i].Refs, fmt.Sprintf("%s:%s", img.Repository, img.Tag))
+			}
+			continue
+		}
+
+		size, err := humanize.ParseBytes(img.Size)
+		if err != nil {
+			return nil, fmt.Errorf("parsing image size %s: %v", img.Size, err)
+		}
+		created, err := time.Parse("2006-01-02 15:04:05 -0700 MST", img.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("parsing image creation time %s: %v", img.CreatedAt, err)
+		}
+		inspectOut, err := r.command(ctx, "image", "inspect", "--mode", "dockercompat", img.ID).Output()
+		if err != nil {
+			return nil, fmt.Errorf("inspecting image %s: %v", img.ID, cmdErr(err))
+		}
+		inspect := []nerdctlImageInspect{}
+		if err := json.Unmarshal(inspectOut, &inspect); err != nil {
+			return nil, fmt.Errorf("decoding nerdctl image inspect: %v", err)
+		}
+
+		image := Image{
+			ID:      img.ID,
+			Size:    int64(size),
+			Created: created,
+		}
+		if img.Repository != "<none>" {
+			image.Refs = []string{fmt.Sprintf("%s:%s", img.Repository, img.Tag)}
+		}
+		if len(inspect) > 0 {
+			image.Layers = inspect[0].RootFS.Layers
+		}
+		index[img.ID] = len(images)
+		images = append(images, image)
+	}
+	return images, scanner.Err()
+}
+
+// ImagesPrune removes dangling images
+func (r *ContainerdRuntime) ImagesPrune(ctx context.Context) error {
+	if err := r.command(ctx, "image", "prune", "--force").Run(); err != nil {
+		return cmdErr(err)
+	}
+	return nil
+}
+
+// ContainerCreate creates a container from spec, returning its ID
+func (r *ContainerdRuntime) ContainerCreate(ctx context.Context, spec *ContainerSpec) (string, error) {
+	args := []string{
+		"create",
+		"--tty",
+		"--gpus", fmt.Sprintf("device=%s", spec.Device),
+		"--volume", fmt.Sprintf("%s:%s:rw", spec.HostDataDir, spec.ContainerDataDir),
+		"--volume", fmt.Sprintf("%s:%s:rw", spec.HostOutputDir, spec.ContainerOutputDir),
+		"--cap-drop", "ALL",
+		"--security-opt", "no-new-privileges",
+		"--memory", fmt.Sprintf("%d", spec.Memory),
+		"--memory-swap", fmt.Sprintf("%d", spec.Memory),
+		"--shm-size", fmt.Sprintf("%d", spec.ShmSize),
+	}
+	// nerdctl doesn't support per-container storage quotas, so spec.DiskQuota is left to the
+	// worker's disk watchdog
+	if spec.NotebookPort != "" {
+		args = append(args, "--publish", fmt.Sprintf("0.0.0.0:%s:8888/tcp", spec.NotebookPort))
+	}
+
+	if spec.Network != "" {
+		args = append(args, "--network", spec.Network)
+	}
+	labelKeys := []string{}
+	for k := range spec.Labels {
+		labelKeys = append(labelKeys, k)
+	}
+	sort.Strings(labelKeys)
+	for _, k := range labelKeys {
+		args = append(args, "--label", fmt.Sprintf("%s=%s", k, spec.Labels[k]))
+	}
+
+	sec := spec.Security
+	args = append(args, "--ipc", sec.IpcMode)
+	if sec.PidsLimit > 0 {
+		args = append(args, "--pids-limit", fmt.Sprintf("%d", sec.PidsLimit))
+	}
+	if sec.ReadOnlyRootfs {
+		args = append(args, "--read-only")
+		for _, dir := range scratchDirs {
+			args = append(args, "--tmpfs", fmt.Sprintf("%s:%s", dir, sec.tmpfsOptions()))
+		}
+		for _, env := range scratchEnv {
+			args = append(args, "--env", env)
+		}
+	}
+	if sec.AppArmor != "" {
+		args = append(args, "--security-opt", fmt.Sprintf("apparmor=%s", sec.AppArmor))
+	}
+	seccomp, err := sec.seccompProfile()
+	if err != nil {
+		return "", err
+	}
+	if seccomp == SeccompUnconfined {
+		args = append(args, "--security-opt", "seccomp=unconfined")
+	} else if seccomp != "" {
+		// nerdctl only reads seccomp profiles from disk; the profile is copied into the
+		// container's spec on create
+		f, err := ioutil.TempFile("", "emrys-seccomp")
+		if err != nil {
+			return "", fmt.Errorf("creating seccomp profile: %v", err)
+		}
+		defer func() { _ = os.Remove(f.Name()) }()
+		if _, err := f.WriteString(seccomp); err != nil {
+			_ = f.Close()
+			return "", fmt.Errorf("writing seccomp profile: %v", err)
+		}
+		if err := f.Close(); err != nil {
+			return "", fmt.Errorf("closing seccomp profile: %v", err)
+		}
+		args = append(args, "--security-opt", fmt.Sprintf("seccomp=%s", f.Name()))
+	}
+	args = append(args, spec.Image)
+
+	out, err := r.command(ctx, args...).Output()
+	if err != nil {
+		return "", cmdErr(err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// ContainerStart starts container id
+func (r *ContainerdRuntime) ContainerStart(ctx context.Context, id string) error {
+	if err := r.command(ctx, "start", id).Run(); err != nil {
+		return cmdErr(err)
+	}
+	return nil
+}
+
+// ContainerLogs follows the stdout & stderr of container id until it exits
+func (r *ContainerdRuntime) ContainerLogs(ctx context.Context, id string) (io.ReadCloser, error) {
+	cmd := r.command(ctx, "logs", "--follow", id)
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	go func() {
+		_ = pw.CloseWithError(cmd.Wait())
+	}()
+	return pr, nil
+}
+
+// nerdctlStats is a single line of nerdctl stats --format '{{json .}}'
+type nerdctlStats struct {
+	MemUsage string
+	PIDs     string
+}
+
+// ContainerStats returns a single json-encoded docker stats sample for container id
+func (r *ContainerdRuntime) ContainerStats(ctx context.Context, id string) (io.ReadCloser, error) {
+	out, err := r.command(ctx, "stats", "--no-stream", "--format", "{{json .}}", id).Output()
+	if err != nil {
+		return nil, cmdErr(err)
+	}
+	ns := nerdctlStats{}
+	if err := json.Unmarshal(bytes.TrimSpace(out), &ns); err != nil {
+		return nil, fmt.Errorf("decoding nerdctl stats: %v", err)
+	}
+
+	stats := types.StatsJSON{
+		ID: id,
+	}
+	stats.Read = time.Now()
+	if split := strings.Split(ns.MemUsage, "/"); len(split) == 2 {
+		if stats.MemoryStats.Usage, err = humanize.ParseBytes(strings.TrimSpace(split[0])); err != nil {
+			return nil, fmt.Errorf("parsing memory usage %s: %v", ns.MemUsage, err)
+		}
+		if stats.MemoryStats.Limit, err = humanize.ParseBytes(strings.TrimSpace(split[1])); err != nil {
+			return nil, fmt.Errorf("parsing memory limit %s: %v", ns.MemUsage, err)
+		}
+	}
+	_, _ = fmt.Sscanf(ns.PIDs, "%d", &stats.PidsStats.Current)
+
+	b, err := json.Marshal(stats)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
+
+// nerdctlPs is a single line of nerdctl ps --format '{{json .}}'
+type nerdctlPs struct {
+	ID    string
+	Image string
+	Size  string
+	// Labels are comma-separated key=value pairs
+	Labels string
+}
+
+// ContainerKill kills container id
+func (r *ContainerdRuntime) ContainerKill(ctx context.Context, id string) error {
+	if err := r.command(ctx, "kill", id).Run(); err != nil {
+		return cmdErr(err)
+	}
+	return nil
+}
+
+// ContainerDiskUsage returns the disk used by container id
+func (r *ContainerdRuntime) ContainerDiskUsage(ctx context.Context, id string) (ContainerDiskUsage, error) {
+	usage := ContainerDiskUsage{}
+	out, err := r.command(ctx, "ps", "--all", "--size", "--no-trunc", "--format", "{{json .}}").Output()
+	if err != nil {
+		return usage, cmdErr(err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		ps := nerdctlPs{}
+		if err := json.Unmarshal(scanner.Bytes(), &ps); err != nil {
+			return usage, fmt.Errorf("decoding nerdctl ps: %v", err)
+		}
+		if ps.ID != id {
+			continue
+		}
+		// e.g. "12.3 MB (virtual 2.1 GB)"
+		split := strings.SplitN(ps.Size, "(virtual", 2)
+		sizeRw, err := humanize.ParseBytes(strings.TrimSpace(split[0]))
+		if err != nil {
+			return usage, fmt.Errorf("parsing container size %s: %v", ps.Size, err)
+		}
+		usage.SizeRw = int64(sizeRw)
+		if len(split) == 2 {
+			sizeRootFs, err := humanize.ParseBytes(strings.TrimSpace(strings.TrimSuffix(split[1], ")")))
+			if err != nil {
+				return usage, fmt.Errorf("parsing container size %s: %v", ps.Size, err)
+			}
+			usage.SizeRootFs = int64(sizeRootFs) // should be image size
+		}
+	}
+	return usage, scanner.Err()
+}
+
+// ContainerList lists all containers, running or not
+func (r *ContainerdRuntime) ContainerList(ctx context.Context) ([]Container, error) {
+	out, err := r.command(ctx, "ps", "--all", "--no-trunc", "--format", "{{json .}}").Output()
+	if err != nil {
+		return nil, fmt.Errorf("nerdctl ps: %v", cmdErr(err))
+	}
+
+	containers := []Container{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		ps := nerdctlPs{}
+		if err := json.Unmarshal(scanner.Bytes(), &ps); err != nil {
+			return nil, fmt.Errorf("decoding nerdctl ps: %v", err)
+		}
+		labels := make(map[string]string)
+		for _, kv := range strings.Split(ps.Labels, ",") {
+			if split := strings.SplitN(kv, "=", 2); len(split) == 2 {
+				labels[split[0]] = split[1]
+			}
+		}
+		containers = append(containers, Container{
+			ID:     ps.ID,
+			Image:  ps.Image,
+			Labels: labels,
+		})
+	}
+	return containers, scanner.Err()
+}
+
+// ContainerRemove force-removes container id
+func (r *ContainerdRuntime) ContainerRemove(ctx context.Context, id string) error {
+	if err := r.command(ctx, "rm", "--force", id).Run(); err != nil {
+		return cmdErr(err)
+	}
+	return nil
+}
+
+// nerdctlNetwork is the output of nerdctl network inspect
+type nerdctlNetwork struct {
+	IPAM struct {
+		Config []struct {
+			Subnet string
+		}
+	}
+}
+
+// NetworkEnsure creates bridge network name, using name as its bridge interface & with
+// inter-container communication disabled, if it doesn't exist. It returns the network's subnet
+func (r *ContainerdRuntime) NetworkEnsure(ctx context.Context, name string) (string, error) {
+	r.networkMu.Lock()
+	defer r.networkMu.Unlock()
+	out, err := r.command(ctx, "network", "inspect", "--mode", "dockercompat", name).Output()
+	if err != nil {
+		if err := r.command(ctx, "network", "create",
+			"--driver", "bridge",
+			"--opt", fmt.Sprintf("com.docker.network.bridge.name=%s", name),
+			"--opt", "com.docker.network.bridge.enable_icc=false",
+			name).Run(); err != nil {
+			return "", fmt.Errorf("creating network %s: %v", name, cmdErr(err))
+		}
+		if out, err = r.command(ctx, "network", "inspect", "--mode", "dockercompat", name).Output(); err != nil {
+			return "", fmt.Errorf("inspecting network %s: %v", name, cmdErr(err))
+		}
+	}
+
+	networks := []nerdctlNetwork{}
+	if err := json.Unmarshal(out, &networks); err != nil {
+		return "", fmt.Errorf("decoding nerdctl network inspect: %v", err)
+	}
+	if len(networks) == 0 || len(networks[0].IPAM.Config) == 0 || networks[0].IPAM.Config[0].Subnet == "" {
+		return "", fmt.Errorf("network %s has no subnet", name)
+	}
+	return networks[0].IPAM.Config[0].Subnet, nil
+}
+
+func (r *ContainerdRuntime) command(ctx context.Context, args ...string) *exec.Cmd {
+	globalArgs := []string{"--namespace", r.Namespace}
+	if r.Address != "" {
+		globalArgs = append(globalArgs, "--address", r.Address)
+	}
+	return exec.CommandContext(ctx, nerdctlCmd, append(globalArgs, args...)...)
+}
+
+// writeRegistryConfig writes registryAuth for ref's registry to a temporary docker config
+// directory, since nerdctl only reads registry credentials from disk
+func writeRegistryConfig(ref, registryAuth string) (string, error) {
+	authJSON, err := base64.URLEncoding.DecodeString(registryAuth)
+	if err != nil {
+		return "", fmt.Errorf("decoding registry auth: %v", err)
+	}
+	authConfig := types.AuthConfig{}
+	if err := json.Unmarshal(authJSON, &authConfig); err != nil {
+		return "", fmt.Errorf("unmarshaling registry auth: %v", err)
+	}
+	registry := strings.SplitN(ref, "/", 2)[0]
+
+	configDir, err := ioutil.TempDir("", "emrys-registry")
+	if err != nil {
+		return "", fmt.Errorf("creating registry config dir: %v", err)
+	}
+	config := map[string]map[string]types.AuthConfig{
+		"auths": {
+			registry: authConfig,
+		},
+	}
+	f, err := os.OpenFile(filepath.Join(configDir, "config.json"), os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		_ = os.RemoveAll(configDir)
+		return "", fmt.Errorf("creating registry config: %v", err)
+	}
+	if err := json.NewEncoder(f).Encode(config); err != nil {
+		_ = f.Close()
+		_ = os.RemoveAll(configDir)
+		return "", fmt.Errorf("writing registry config: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		_ = os.RemoveAll(configDir)
+		return "", fmt.Errorf("closing registry config: %v", err)
+	}
+	return configDir, nil
+}
+
+// cmdErr surfaces a failed command's stderr when available
+func cmdErr(err error) error {
+	if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err
+}
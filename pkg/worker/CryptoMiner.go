@@ -7,15 +7,21 @@ import (
 	"os"
 	"os/exec"
 	"strconv"
+	"sync"
 	"syscall"
+	"time"
 )
 
 // CryptoMiner allows workers to mine cryptocurrencies inbetween emrys jobs
 type CryptoMiner struct {
 	Command string
 	Device  uint
-	startCh chan struct{}
-	stopCh  chan struct{}
+	// Schedule restricts when the cryptominer may run; nil is always
+	Schedule *Schedule
+	mu       sync.Mutex
+	stopped  bool
+	startCh  chan struct{}
+	stopCh   chan struct{}
 }
 
 // Init initializes the cryptominer
@@ -28,13 +34,15 @@ func (cm *CryptoMiner) Init(ctx context.Context) {
 	go func() {
 		for {
 			mining := false
-			args := append([]string{"-c"}, cm.Command) // miner may wish to hot-reload config with new mining command
+			cmdArg, schedule := cm.config()
+			args := append([]string{"-c"}, cmdArg) // miner may wish to hot-reload config with new mining command
 			cmd := exec.CommandContext(ctx, cmdStr, args...)
 			cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 			cmd.Stdout = os.Stdout
 			cmd.Stderr = os.Stderr
 			cmd.Env = append(os.Environ(), fmt.Sprintf("DEVICE=%s", dStr))
-			if cm.Command != "" {
+			now := time.Now()
+			if cmdArg != "" && schedule.Open(now) {
 				mining = true
 				log.Printf("Device %s: begin mining...\n", dStr)
 				if err := cmd.Start(); err != nil {
@@ -42,9 +50,16 @@ func (cm *CryptoMiner) Init(ctx context.Context) {
 					return
 				}
 			}
+			var transition <-chan time.Time
+			if next := schedule.NextTransition(now); !next.IsZero() {
+				transition = time.After(next.Sub(now))
+			}
+			stopped := true
 			select {
 			case <-ctx.Done():
 			case <-cm.stopCh:
+			case <-transition:
+				stopped = false
 			}
 			if mining {
 				log.Printf("Device %s: halt mining...\n", dStr)
@@ -57,6 +72,10 @@ func (cm *CryptoMiner) Init(ctx context.Context) {
 					return
 				}
 			}
+			if !stopped {
+				// schedule opened or closed; re-evaluate without waiting for Start
+				continue
+			}
 			select {
 			case <-ctx.Done():
 				return
@@ -68,10 +87,40 @@ func (cm *CryptoMiner) Init(ctx context.Context) {
 
 // Start starts the cryptominer
 func (cm *CryptoMiner) Start() {
+	cm.mu.Lock()
+	cm.stopped = false
+	cm.mu.Unlock()
 	cm.startCh <- struct{}{}
 }
 
 // Stop stops the cryptominer
 func (cm *CryptoMiner) Stop() {
+	cm.mu.Lock()
+	cm.stopped = true
+	cm.mu.Unlock()
 	cm.stopCh <- struct{}{}
 }
+
+// Configure replaces the mining command & schedule, restarting the cryptominer if it's running
+func (cm *CryptoMiner) Configure(command string, schedule *Schedule) {
+	cm.mu.Lock()
+	if cm.Command == command && cm.Schedule.equal(schedule) {
+		cm.mu.Unlock()
+		return
+	}
+	cm.Command = command
+	cm.Schedule = schedule
+	restart := !cm.stopped
+	cm.mu.Unlock()
+
+	if restart {
+		cm.Stop()
+		cm.Start()
+	}
+}
+
+func (cm *CryptoMiner) config() (string, *Schedule) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.Command, cm.Schedule
+}
@@ -0,0 +1,304 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	docker "github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DockerRuntime runs job containers with dockerd
+type DockerRuntime struct {
+	Client    *docker.Client
+	networkMu sync.Mutex
+	quotaMu   sync.Mutex
+	// noStorageQuota is set once the storage driver rejects per-container size limits
+	noStorageQuota bool
+}
+
+// NewDockerRuntime returns a ContainerRuntime backed by dockerd
+func NewDockerRuntime(c *docker.Client) *DockerRuntime {
+	return &DockerRuntime{
+		Client: c,
+	}
+}
+
+// ImagePull pulls ref, returning a stream of json progress messages
+func (d *DockerRuntime) ImagePull(ctx context.Context, ref, registryAuth string) (io.ReadCloser, error) {
+	return d.Client.ImagePull(ctx, ref, types.ImagePullOptions{
+		RegistryAuth: registryAuth,
+	})
+}
+
+// ImageRemove force-removes ref
+func (d *DockerRuntime) ImageRemove(ctx context.Context, ref string) error {
+	_, err := d.Client.ImageRemove(ctx, ref, types.ImageRemoveOptions{
+		Force: true,
+	})
+	return err
+}
+
+// ImageList lists the images held by dockerd
+func (d *DockerRuntime) ImageList(ctx context.Context) ([]Image, error) {
+	// disk usage, unlike image list, reports the size each image shares with others
+	dockerDisk, err := d.Client.DiskUsage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	images := []Image{}
+	for _, summary := range dockerDisk.Images {
+		inspect, _, err := d.Client.ImageInspectWithRaw(ctx, summary.ID)
+		if docker.IsErrNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("inspecting image %s: %v", summary.ID, err)
+		}
+		size := summary.Size
+		if summary.SharedSize > 0 {
+			size -= summary.SharedSize
+		}
+		images = append(images, Image{
+			ID:      summary.ID,
+			Refs:    summary.RepoTags,
+			Size:    size,
+			Created: time.Unix(summary.Created, 0),
+			Layers:  inspect.RootFS.Layers,
+		})
+	}
+	return images, nil
+}
+
+// ImagesPrune removes dangling images
+func (d *DockerRuntime) ImagesPrune(ctx context.Context) error {
+	filter := filters.NewArgs()
+	filter.Add("dangling", "true")
+	_, err := d.Client.ImagesPrune(ctx, filter)
+	return err
+}
+
+// ContainerCreate creates a container from spec, returning its ID
+func (d *DockerRuntime) ContainerCreate(ctx context.Context, spec *ContainerSpec) (string, error) {
+	config, hostConfig, err := dockerContainerConfig(spec)
+	if err != nil {
+		return "", err
+	}
+	return d.create(ctx, config, hostConfig)
+}
+
+// create creates a container, retrying without a storage quota if the storage driver doesn't support them
+func (d *DockerRuntime) create(ctx context.Context, config *container.Config, hostConfig *container.HostConfig) (string, error) {
+	d.quotaMu.Lock()
+	noStorageQuota := d.noStorageQuota
+	d.quotaMu.Unlock()
+	if noStorageQuota {
+		hostConfig.StorageOpt = nil
+	}
+
+	c, err := d.Client.ContainerCreate(ctx, config, hostConfig, nil, "")
+	if err != nil && hostConfig.StorageOpt != nil && strings.Contains(err.Error(), "storage-opt") {
+		d.quotaMu.Lock()
+		d.noStorageQuota = true
+		d.quotaMu.Unlock()
+		hostConfig.StorageOpt = nil
+		c, err = d.Client.ContainerCreate(ctx, config, hostConfig, nil, "")
+	}
+	if err != nil {
+		return "", err
+	}
+	return c.ID, nil
+}
+
+// dockerContainerConfig translates spec into docker's container & host configs
+func dockerContainerConfig(spec *ContainerSpec) (*container.Config, *container.HostConfig, error) {
+	var exposedPorts nat.PortSet
+	var portBindings nat.PortMap
+	if spec.NotebookPort != "" {
+		exposedPorts = nat.PortSet{
+			"8888/tcp": struct{}{},
+		}
+		portBindings = nat.PortMap{
+			"8888/tcp": []nat.PortBinding{
+				nat.PortBinding{
+					HostIP:   "0.0.0.0",
+					HostPort: spec.NotebookPort,
+				},
+			},
+		}
+	}
+
+	securityOpt := []string{
+		"no-new-privileges",
+	}
+	seccomp, err := spec.Security.seccompProfile()
+	if err != nil {
+		return nil, nil, err
+	}
+	if seccomp != "" {
+		securityOpt = append(securityOpt, fmt.Sprintf("seccomp=%s", seccomp))
+	}
+	if spec.Security.AppArmor != "" {
+		securityOpt = append(securityOpt, fmt.Sprintf("apparmor=%s", spec.Security.AppArmor))
+	}
+
+	var env []string
+	var tmpfs map[string]string
+	if spec.Security.ReadOnlyRootfs {
+		env = scratchEnv
+		tmpfs = make(map[string]string)
+		for _, dir := range scratchDirs {
+			tmpfs[dir] = spec.Security.tmpfsOptions()
+		}
+	}
+
+	var storageOpt map[string]string
+	if spec.DiskQuota > 0 {
+		storageOpt = map[string]string{
+			"size": fmt.Sprintf("%d", spec.DiskQuota),
+		}
+	}
+
+	var pidsLimit *int64
+	if spec.Security.PidsLimit > 0 {
+		pidsLimit = &spec.Security.PidsLimit
+	}
+
+	return &container.Config{
+		Env:          env,
+		ExposedPorts: exposedPorts,
+		Image:        spec.Image,
+		Labels:       spec.Labels,
+		Tty:          true,
+	}, &container.HostConfig{
+		Binds: []string{
+			fmt.Sprintf("%s:%s:rw", spec.HostDataDir, spec.ContainerDataDir),
+			fmt.Sprintf("%s:%s:rw", spec.HostOutputDir, spec.ContainerOutputDir),
+		},
+		CapDrop: []string{
+			"ALL",
+		},
+		IpcMode:        container.IpcMode(spec.Security.IpcMode),
+		NetworkMode:    container.NetworkMode(spec.Network),
+		PortBindings:   portBindings,
+		ReadonlyRootfs: spec.Security.ReadOnlyRootfs,
+		Resources: container.Resources{
+			DeviceRequests: []container.DeviceRequest{
+				container.DeviceRequest{
+					DeviceIDs:    []string{spec.Device},
+					Capabilities: [][]string{[]string{"gpu"}},
+				},
+			},
+			Memory:     spec.Memory,
+			MemorySwap: spec.Memory,
+			PidsLimit:  pidsLimit,
+		},
+		SecurityOpt: securityOpt,
+		ShmSize:     spec.ShmSize,
+		StorageOpt:  storageOpt,
+		Tmpfs:       tmpfs,
+	}, nil
+}
+
+// ContainerStart starts container id
+func (d *DockerRuntime) ContainerStart(ctx context.Context, id string) error {
+	return d.Client.ContainerStart(ctx, id, types.ContainerStartOptions{})
+}
+
+// ContainerLogs follows the stdout & stderr of container id until it exits
+func (d *DockerRuntime) ContainerLogs(ctx context.Context, id string) (io.ReadCloser, error) {
+	return d.Client.ContainerLogs(ctx, id, types.ContainerLogsOptions{
+		Follow:     true,
+		ShowStdout: true,
+		ShowStderr: true,
+	})
+}
+
+// ContainerStats returns a single json-encoded docker stats sample for container id
+func (d *DockerRuntime) ContainerStats(ctx context.Context, id string) (io.ReadCloser, error) {
+	stats, err := d.Client.ContainerStats(ctx, id, false)
+	if err != nil {
+		return nil, err
+	}
+	return stats.Body, nil
+}
+
+// ContainerKill kills container id
+func (d *DockerRuntime) ContainerKill(ctx context.Context, id string) error {
+	return d.Client.ContainerKill(ctx, id, "KILL")
+}
+
+// ContainerDiskUsage returns the disk used by container id
+func (d *DockerRuntime) ContainerDiskUsage(ctx context.Context, id string) (ContainerDiskUsage, error) {
+	usage := ContainerDiskUsage{}
+	dockerDisk, err := d.Client.DiskUsage(ctx)
+	if err != nil {
+		return usage, err
+	}
+	for _, c := range dockerDisk.Containers {
+		if c.ID == id {
+			usage.SizeRw = c.SizeRw
+			usage.SizeRootFs = c.SizeRootFs // should be image size
+		}
+	}
+	return usage, nil
+}
+
+// ContainerList lists all containers, running or not
+func (d *DockerRuntime) ContainerList(ctx context.Context) ([]Container, error) {
+	list, err := d.Client.ContainerList(ctx, types.ContainerListOptions{
+		All: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	containers := []Container{}
+	for _, c := range list {
+		containers = append(containers, Container{
+			ID:     c.ID,
+			Image:  c.Image,
+			Labels: c.Labels,
+		})
+	}
+	return containers, nil
+}
+
+// ContainerRemove force-removes container id
+func (d *DockerRuntime) ContainerRemove(ctx context.Context, id string) error {
+	return d.Client.ContainerRemove(ctx, id, types.ContainerRemoveOptions{
+		Force: true,
+	})
+}
+
+// NetworkEnsure creates bridge network name, using name as its bridge interface & with
+// inter-container communication disabled, if it doesn't exist. It returns the network's subnet
+func (d *DockerRuntime) NetworkEnsure(ctx context.Context, name string) (string, error) {
+	d.networkMu.Lock()
+	defer d.networkMu.Unlock()
+	n, err := d.Client.NetworkInspect(ctx, name, types.NetworkInspectOptions{})
+	if docker.IsErrNotFound(err) {
+		if _, err := d.Client.NetworkCreate(ctx, name, types.NetworkCreate{
+			CheckDuplicate: true,
+			Driver:         "bridge",
+			Options: map[string]string{
+				"com.docker.network.bridge.name":       name,
+				"com.docker.network.bridge.enable_icc": "false",
+			},
+		}); err != nil {
+			return "", fmt.Errorf("creating network %s: %v", name, err)
+		}
+		n, err = d.Client.NetworkInspect(ctx, name, types.NetworkInspectOptions{})
+	}
+	if err != nil {
+		return "", fmt.Errorf("inspecting network %s: %v", name, err)
+	}
+	if len(n.IPAM.Config) == 0 || n.IPAM.Config[0].Subnet == "" {
+		return "", fmt.Errorf("network %s has no subnet", name)
+	}
+	return n.IPAM.Config[0].Subnet, nil
+}
@@ -0,0 +1,11 @@
+package worker
+
+import (
+	"context"
+)
+
+// Firewall enforces a NetworkPolicy on a job network
+type Firewall interface {
+	// Apply restricts traffic from network, which uses subnet & bridge interface bridge, to policy
+	Apply(ctx context.Context, network, subnet, bridge string, policy NetworkPolicy) error
+}
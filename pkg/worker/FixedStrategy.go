@@ -0,0 +1,13 @@
+package worker
+
+import (
+	"context"
+)
+
+// FixedStrategy always bids the device's configured bid-rate
+type FixedStrategy struct{}
+
+// Rate returns the configured bid-rate
+func (s *FixedStrategy) Rate(ctx context.Context, req *BidRequest) (float64, bool, error) {
+	return req.BidRate, true, nil
+}
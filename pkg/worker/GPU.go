@@ -0,0 +1,29 @@
+package worker
+
+import (
+	"context"
+	"github.com/wminshew/emrys/pkg/job"
+	"time"
+)
+
+// GPU is the hardware backend for a Worker's device
+type GPU interface {
+	// Init configures the device for emrys & records its static specs in snapshot
+	Init(snapshot *job.DeviceSnapshot) error
+	// Verify checks the device is still configured the way Init left it
+	Verify(snapshot *job.DeviceSnapshot) error
+	// Sample records the device's current stats in snapshot, averaging over period where supported
+	Sample(period time.Duration, snapshot *job.DeviceSnapshot) error
+	// Thermals returns the device's temperature (C) & fan speed (%)
+	Thermals() (uint, uint, error)
+}
+
+// FanController controls a device's fans
+type FanController interface {
+	// SetControlState enables (1) or disables (0) manual fan control
+	SetControlState(ctx context.Context, state int) error
+	// ControlState returns the current fan control state
+	ControlState(ctx context.Context) (int, error)
+	// SetSpeed sets the target fan speed (%)
+	SetSpeed(ctx context.Context, speed int) error
+}
@@ -0,0 +1,251 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"github.com/dustin/go-humanize"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// emrysRegistry hosts job & base images; the cache never touches images from elsewhere
+const emrysRegistry = "registry.emrys.io/"
+
+// ImageCache keeps emrys images on the rig between jobs so later jobs can reuse their layers,
+// evicting the least recently used once the cache exceeds its disk budget
+type ImageCache struct {
+	Runtime ContainerRuntime
+	mu      sync.Mutex
+	// budget is the disk cached images may use in bytes; 0 removes job images once their job finishes
+	budget uint64
+	// maxAge evicts images that haven't been used for longer; 0 never evicts by age
+	maxAge   time.Duration
+	lastUsed map[string]time.Time
+	inUse    map[string]int
+	pinned   map[string]bool
+	evictMu  sync.Mutex
+}
+
+// ImageCacheStats summarizes the cache for the server, which prefers miners already holding a job's layers
+type ImageCacheStats struct {
+	Budget uint64        `json:"budget"`
+	Used   uint64        `json:"used"`
+	Images []CachedImage `json:"images"`
+	// BaseImages are the pinned base images already held by the runtime
+	BaseImages []string `json:"base_images"`
+	// Layers are the digests of every layer held by the runtime, cached or not
+	Layers []string `json:"layers"`
+}
+
+// CachedImage is an emrys image held in the cache
+type CachedImage struct {
+	Refs     []string  `json:"refs"`
+	Size     uint64    `json:"size"`
+	LastUsed time.Time `json:"last_used"`
+	Pinned   bool      `json:"pinned"`
+}
+
+// NewImageCache returns an ImageCache of images held by runtime
+func NewImageCache(runtime ContainerRuntime, budget uint64, maxAge time.Duration) *ImageCache {
+	return &ImageCache{
+		Runtime:  runtime,
+		budget:   budget,
+		maxAge:   maxAge,
+		lastUsed: make(map[string]time.Time),
+		inUse:    make(map[string]int),
+		pinned:   make(map[string]bool),
+	}
+}
+
+// SetLimits updates the cache's disk budget & max age; they're applied on the next eviction
+func (c *ImageCache) SetLimits(budget uint64, maxAge time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.budget = budget
+	c.maxAge = maxAge
+}
+
+// SetPinned keeps refs, e.g. the base images most jobs build on, from ever being evicted. Previously
+// pinned images not in refs are left to be evicted like any other
+func (c *ImageCache) SetPinned(refs []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pinned = make(map[string]bool)
+	for _, ref := range refs {
+		c.pinned[ref] = true
+		c.lastUsed[ref] = time.Now()
+	}
+}
+
+// Acquire protects ref from eviction while a job pulls & runs it. Each Acquire must be paired with a Release
+func (c *ImageCache) Acquire(ref string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inUse[ref]++
+	c.lastUsed[ref] = time.Now()
+}
+
+// Release marks ref as just used & no longer protected from eviction by the caller
+func (c *ImageCache) Release(ref string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.inUse[ref]--; c.inUse[ref] <= 0 {
+		delete(c.inUse, ref)
+	}
+	c.lastUsed[ref] = time.Now()
+}
+
+// cachedImage is an emrys image & its cache bookkeeping
+type cachedImage struct {
+	Image
+	lastUsed time.Time
+	inUse    bool
+	pinned   bool
+}
+
+// images returns the runtime's emrys images, & the layers of all its images. Images also tagged
+// outside the emrys registry belong to the operator & are left out
+func (c *ImageCache) images(ctx context.Context) ([]cachedImage, []string, error) {
+	images, err := c.Runtime.ImageList(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("listing images: %v", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached := []cachedImage{}
+	layers := []string{}
+	seenLayers := make(map[string]bool)
+	for _, img := range images {
+		for _, l := range img.Layers {
+			if !seenLayers[l] {
+				seenLayers[l] = true
+				layers = append(layers, l)
+			}
+		}
+
+		if len(img.Refs) == 0 {
+			continue
+		}
+		ci := cachedImage{
+			Image: img,
+			// images pulled before the miner started are dated by their creation
+			lastUsed: img.Created,
+		}
+		emrys := true
+		for _, ref := range img.Refs {
+			if !strings.HasPrefix(ref, emrysRegistry) {
+				emrys = false
+				break
+			}
+			if t, ok := c.lastUsed[ref]; ok && t.After(ci.lastUsed) {
+				ci.lastUsed = t
+			}
+			ci.inUse = ci.inUse || c.inUse[ref] > 0
+			ci.pinned = ci.pinned || c.pinned[ref]
+		}
+		if emrys {
+			cached = append(cached, ci)
+		}
+	}
+	sort.Slice(cached, func(i, j int) bool {
+		return cached[i].lastUsed.Before(cached[j].lastUsed)
+	})
+	return cached, layers, nil
+}
+
+// Evict prunes dangling images, then removes cached images unused for longer than maxAge & the
+// least recently used until the cache fits its budget. Pinned & in-use images are never removed
+func (c *ImageCache) Evict(ctx context.Context) error {
+	c.evictMu.Lock()
+	defer c.evictMu.Unlock()
+	if err := c.Runtime.ImagesPrune(ctx); err != nil {
+		return fmt.Errorf("pruning dangling images: %v", err)
+	}
+
+	c.mu.Lock()
+	budget, maxAge := c.budget, c.maxAge
+	c.mu.Unlock()
+	for {
+		// images are relisted after each removal since shared layers may now belong to a single image
+		images, _, err := c.images(ctx)
+		if err != nil {
+			return err
+		}
+		var used uint64
+		for _, img := range images {
+			used += uint64(img.Size)
+		}
+
+		var victim *cachedImage
+		reason := ""
+		for i := range images {
+			img := &images[i]
+			if img.inUse || img.pinned {
+				continue
+			}
+			if maxAge > 0 && time.Since(img.lastUsed) > maxAge {
+				victim, reason = img, fmt.Sprintf("unused for %s", time.Since(img.lastUsed).Round(time.Minute))
+				break
+			}
+			if used > budget && victim == nil {
+				victim, reason = img, fmt.Sprintf("cache over budget (%s > %s)", humanize.Bytes(used), humanize.Bytes(budget))
+			}
+		}
+		if victim == nil {
+			return nil
+		}
+
+		log.Printf("Image cache: removing %s (%s): %s\n", strings.Join(victim.Refs, ", "), humanize.Bytes(uint64(victim.Size)), reason)
+		for _, ref := range victim.Refs {
+			if err := c.Runtime.ImageRemove(ctx, ref); err != nil {
+				return fmt.Errorf("removing image %s: %v", ref, err)
+			}
+			c.mu.Lock()
+			delete(c.lastUsed, ref)
+			c.mu.Unlock()
+		}
+	}
+}
+
+// Stats returns the cache's budget, usage, images & the layers held by the runtime
+func (c *ImageCache) Stats(ctx context.Context) (*ImageCacheStats, error) {
+	images, layers, err := c.images(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	stats := &ImageCacheStats{
+		Budget:     c.budget,
+		Images:     []CachedImage{},
+		BaseImages: []string{},
+		Layers:     layers,
+	}
+	c.mu.Unlock()
+	for _, img := range images {
+		stats.Used += uint64(img.Size)
+		stats.Images = append(stats.Images, CachedImage{
+			Refs:     img.Refs,
+			Size:     uint64(img.Size),
+			LastUsed: img.lastUsed,
+			Pinned:   img.pinned,
+		})
+		if img.pinned {
+			for _, ref := range img.Refs {
+				if c.isPinned(ref) {
+					stats.BaseImages = append(stats.BaseImages, ref)
+				}
+			}
+		}
+	}
+	return stats, nil
+}
+
+func (c *ImageCache) isPinned(ref string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pinned[ref]
+}
@@ -0,0 +1,137 @@
+package worker
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// imageRuntime holds images for an ImageCache; its other ContainerRuntime methods are unimplemented
+type imageRuntime struct {
+	ContainerRuntime
+	images []Image
+}
+
+func (r *imageRuntime) ImageList(ctx context.Context) ([]Image, error) {
+	return r.images, nil
+}
+
+func (r *imageRuntime) ImagesPrune(ctx context.Context) error {
+	return nil
+}
+
+// ImageRemove untags ref, dropping its image with its last ref
+func (r *imageRuntime) ImageRemove(ctx context.Context, ref string) error {
+	images := []Image{}
+	for _, img := range r.images {
+		refs := []string{}
+		for _, imgRef := range img.Refs {
+			if imgRef != ref {
+				refs = append(refs, imgRef)
+			}
+		}
+		if img.Refs = refs; len(refs) > 0 {
+			images = append(images, img)
+		}
+	}
+	r.images = images
+	return nil
+}
+
+func (r *imageRuntime) refs() []string {
+	refs := []string{}
+	for _, img := range r.images {
+		refs = append(refs, img.Refs...)
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+func TestImageCacheEvict(t *testing.T) {
+	now := time.Now()
+	image := func(ref string, size int64, age time.Duration) Image {
+		return Image{ID: ref, Refs: []string{ref}, Size: size, Created: now.Add(-age)}
+	}
+	const (
+		base   = emrysRegistry + "base"
+		oldJob = emrysRegistry + "job-old"
+		midJob = emrysRegistry + "job-mid"
+		newJob = emrysRegistry + "job-new"
+		ops    = "docker.io/library/postgres"
+	)
+	images := []Image{
+		image(base, 500, 30*24*time.Hour),
+		image(oldJob, 100, 3*time.Hour),
+		image(midJob, 100, 2*time.Hour),
+		image(newJob, 100, time.Hour),
+		image(ops, 1000, 60*24*time.Hour),
+	}
+	tests := []struct {
+		name     string
+		budget   uint64
+		maxAge   time.Duration
+		pinned   []string
+		acquired []string
+		images   []Image
+		want     []string
+	}{
+		{name: "under budget", budget: 800, want: []string{ops, base, midJob, newJob, oldJob}},
+		{name: "over budget evicts least recently used", budget: 700,
+			want: []string{ops, oldJob, midJob, newJob}},
+		{name: "pinned images are kept", budget: 600, pinned: []string{base},
+			want: []string{ops, base, newJob}},
+		{name: "in use images are kept", budget: 600, pinned: []string{base}, acquired: []string{oldJob},
+			want: []string{ops, base, oldJob}},
+		{name: "zero budget evicts every unprotected image", budget: 0, pinned: []string{base},
+			want: []string{ops, base}},
+		{name: "max age", budget: 800, maxAge: 90 * time.Minute, pinned: []string{base},
+			want: []string{ops, base, newJob}},
+		{name: "images also tagged elsewhere are the operator's", budget: 0,
+			images: []Image{{ID: "shared", Refs: []string{oldJob, ops}, Size: 100, Created: now.Add(-time.Hour)}},
+			want:   []string{ops, oldJob}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &imageRuntime{images: append([]Image{}, images...)}
+			if tt.images != nil {
+				r.images = tt.images
+			}
+			c := NewImageCache(r, tt.budget, tt.maxAge)
+			c.SetPinned(tt.pinned)
+			for _, ref := range tt.acquired {
+				c.Acquire(ref)
+			}
+			if err := c.Evict(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(tt.want)
+			if got := r.refs(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("images after eviction = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageCacheReleaseRefreshesLastUse(t *testing.T) {
+	const job = emrysRegistry + "job"
+	r := &imageRuntime{images: []Image{{ID: "job", Refs: []string{job}, Size: 100, Created: time.Now().Add(-time.Hour)}}}
+	c := NewImageCache(r, 0, 30*time.Minute)
+	c.Acquire(job)
+	c.Release(job)
+	c.SetLimits(1000, 30*time.Minute)
+	if err := c.Evict(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.refs(); len(got) != 1 {
+		t.Errorf("images after eviction = %v, want the just released %s", got, job)
+	}
+	c.SetLimits(0, 30*time.Minute)
+	if err := c.Evict(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.refs(); len(got) != 0 {
+		t.Errorf("images after eviction = %v, want none once over budget", got)
+	}
+}
@@ -0,0 +1,104 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sync"
+)
+
+const (
+	iptablesCmd = "iptables"
+	// dockerUserChain is evaluated by dockerd before its own forwarding rules
+	dockerUserChain = "DOCKER-USER"
+)
+
+// IptablesFirewall enforces network policies with per-network iptables chains, jumped to
+// for traffic leaving a job network & traffic from a job network to the host
+type IptablesFirewall struct {
+	mu      sync.Mutex
+	applied map[string]string
+}
+
+// NewIptablesFirewall returns a Firewall backed by iptables
+func NewIptablesFirewall() *IptablesFirewall {
+	return &IptablesFirewall{
+		applied: make(map[string]string),
+	}
+}
+
+// Apply restricts traffic from network, which uses subnet & bridge interface bridge, to policy.
+// Chains are only rebuilt when policy's rules (including resolved host addresses) change
+func (f *IptablesFirewall) Apply(ctx context.Context, network, subnet, bridge string, policy NetworkPolicy) error {
+	rules, err := policy.forwardRules(ctx)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fwdChain, inChain := fmt.Sprintf("%s-fwd", network), fmt.Sprintf("%s-in", network)
+	if key := fmt.Sprint(subnet, bridge, rules); f.applied[network] != key {
+		// connections the job didn't open are left to the runtime's rules
+		if err := f.resetChain(ctx, fwdChain); err != nil {
+			return err
+		}
+		if err := f.run(ctx, "-A", fwdChain, "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "RETURN"); err != nil {
+			return err
+		}
+		for _, rule := range rules {
+			if err := f.run(ctx, append([]string{"-A", fwdChain}, rule...)...); err != nil {
+				return err
+			}
+		}
+
+		// the job may only reach the host to answer connections it didn't open & for dns
+		if err := f.resetChain(ctx, inChain); err != nil {
+			return err
+		}
+		for _, rule := range [][]string{
+			{"-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "ACCEPT"},
+			{"-p", "udp", "--dport", "53", "-j", "ACCEPT"},
+			{"-p", "tcp", "--dport", "53", "-j", "ACCEPT"},
+			{"-j", "DROP"},
+		} {
+			if err := f.run(ctx, append([]string{"-A", inChain}, rule...)...); err != nil {
+				return err
+			}
+		}
+		f.applied[network] = key
+	}
+
+	// jumps are checked every time since a runtime restart may reorder or flush them
+	forward := "FORWARD"
+	if err := f.run(ctx, "-n", "-L", dockerUserChain); err == nil {
+		forward = dockerUserChain
+	}
+	if err := f.ensureJump(ctx, forward, "-s", subnet, "-j", fwdChain); err != nil {
+		return err
+	}
+	return f.ensureJump(ctx, "INPUT", "-i", bridge, "-j", inChain)
+}
+
+// resetChain creates chain, or flushes it if it exists
+func (f *IptablesFirewall) resetChain(ctx context.Context, chain string) error {
+	if err := f.run(ctx, "-n", "-L", chain); err != nil {
+		return f.run(ctx, "-N", chain)
+	}
+	return f.run(ctx, "-F", chain)
+}
+
+// ensureJump inserts rule at the top of chain unless it's already there
+func (f *IptablesFirewall) ensureJump(ctx context.Context, chain string, rule ...string) error {
+	if err := f.run(ctx, append([]string{"-C", chain}, rule...)...); err == nil {
+		return nil
+	}
+	return f.run(ctx, append([]string{"-I", chain, "1"}, rule...)...)
+}
+
+func (f *IptablesFirewall) run(ctx context.Context, args ...string) error {
+	if _, err := exec.CommandContext(ctx, iptablesCmd, append([]string{"-w"}, args...)...).Output(); err != nil {
+		return fmt.Errorf("iptables %v: %v", args, cmdErr(err))
+	}
+	return nil
+}
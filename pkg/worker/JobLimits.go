@@ -0,0 +1,50 @@
+package worker
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// defaultRuntimeEstimate is assumed for jobs without a declared max runtime when the
+// Worker has no completed jobs to estimate from
+const defaultRuntimeEstimate = 1 * time.Hour
+
+// JobLimits are optional limits declared alongside a job up for auction
+type JobLimits struct {
+	// MaxRuntime is the job's declared maximum runtime in seconds; zero if undeclared
+	MaxRuntime int64 `json:"max_runtime"`
+	// Network is the job's declared network needs; nil if undeclared
+	Network *JobNetwork `json:"network"`
+}
+
+// ParseJobLimits reads any JobLimits declared with the job in an auction message
+func ParseJobLimits(data []byte) JobLimits {
+	msg := struct {
+		Job *JobLimits `json:"job"`
+	}{}
+	if err := json.Unmarshal(data, &msg); err != nil || msg.Job == nil {
+		return JobLimits{}
+	}
+	return *msg.Job
+}
+
+// estimateRuntime returns the job's declared max runtime, or else the Worker's
+// average completed job duration
+func (w *Worker) estimateRuntime(limits JobLimits) time.Duration {
+	if limits.MaxRuntime > 0 {
+		return time.Duration(limits.MaxRuntime) * time.Second
+	}
+
+	var total time.Duration
+	n := 0
+	for _, j := range w.history().Jobs {
+		if !j.End.IsZero() {
+			total += j.End.Sub(j.Start)
+			n++
+		}
+	}
+	if n == 0 {
+		return defaultRuntimeEstimate
+	}
+	return total / time.Duration(n)
+}
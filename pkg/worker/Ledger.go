@@ -0,0 +1,166 @@
+package worker
+
+import (
+	"fmt"
+	"github.com/dustin/go-humanize"
+	"sync"
+)
+
+// Ledger tracks the rig's ram & disk promised to bids & jobs across all workers. Disk is
+// tracked per filesystem, keyed by mount point, since workers' workdirs may be on different disks
+type Ledger struct {
+	mu           sync.Mutex
+	ramCapacity  uint64
+	diskCapacity map[string]uint64
+	nextID       int
+	reservations map[int]*Reservation
+}
+
+// Reservation is ram & disk held in a Ledger for a single bid, & for its job if won
+type Reservation struct {
+	RAM  uint64
+	Disk uint64
+	// Filesystem is the mount point of the filesystem Disk is held on
+	Filesystem string
+	ledger     *Ledger
+	id         int
+	committed  bool
+}
+
+// NewLedger returns an empty Ledger with no capacity
+func NewLedger() *Ledger {
+	return &Ledger{
+		diskCapacity: make(map[string]uint64),
+		reservations: make(map[int]*Reservation),
+	}
+}
+
+// SetCapacity sets the total ram, & disk on each filesystem, available to emrys jobs on the rig
+func (l *Ledger) SetCapacity(ram uint64, disk map[string]uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ramCapacity = ram
+	l.diskCapacity = disk
+}
+
+// Reserve holds ram, & disk on filesystem fs, for a bid, returning an error if the rig lacks the unreserved
+// capacity. availableRAM & availableDisk are the memory & free space on fs the system reports now: the bid
+// must also fit in them less the other outstanding bids, in case something besides emrys used them up
+func (l *Ledger) Reserve(ram, disk uint64, fs string, availableRAM, availableDisk uint64) (*Reservation, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	allocatedRAM, allocatedDisk := l.allocated()
+	outstandingRAM, outstandingDisk := l.outstanding()
+	unreservedRAM := min(sub(l.ramCapacity, allocatedRAM), sub(availableRAM, outstandingRAM))
+	if ram > unreservedRAM {
+		return nil, fmt.Errorf("insufficient unreserved memory (requested for bidding: %s > unreserved %s)",
+			humanize.Bytes(ram), humanize.Bytes(unreservedRAM))
+	}
+	unreservedDisk := min(sub(l.diskCapacity[fs], allocatedDisk[fs]), sub(availableDisk, outstandingDisk[fs]))
+	if disk > unreservedDisk {
+		return nil, fmt.Errorf("insufficient unreserved disk space on %s (requested for bidding: %s > unreserved %s)",
+			fs, humanize.Bytes(disk), humanize.Bytes(unreservedDisk))
+	}
+
+	r := &Reservation{
+		RAM:        ram,
+		Disk:       disk,
+		Filesystem: fs,
+		ledger:     l,
+		id:         l.nextID,
+	}
+	l.nextID++
+	l.reservations[r.id] = r
+	return r, nil
+}
+
+// Hold commits ram, & disk on filesystem fs, for a job already running on the rig, e.g. one
+// recovered after the miner restarted, even if it exceeds the unreserved capacity
+func (l *Ledger) Hold(ram, disk uint64, fs string) *Reservation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r := &Reservation{
+		RAM:        ram,
+		Disk:       disk,
+		Filesystem: fs,
+		ledger:     l,
+		id:         l.nextID,
+		committed:  true,
+	}
+	l.nextID++
+	l.reservations[r.id] = r
+	return r
+}
+
+// Allocated returns the ram, & disk per filesystem, held by all reservations, committed or not
+func (l *Ledger) Allocated() (uint64, map[string]uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.allocated()
+}
+
+// Committed returns the ram, & disk per filesystem, held by reservations for won jobs
+func (l *Ledger) Committed() (uint64, map[string]uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var ram uint64
+	disk := make(map[string]uint64)
+	for _, r := range l.reservations {
+		if r.committed {
+			ram += r.RAM
+			disk[r.Filesystem] += r.Disk
+		}
+	}
+	return ram, disk
+}
+
+func (l *Ledger) allocated() (uint64, map[string]uint64) {
+	var ram uint64
+	disk := make(map[string]uint64)
+	for _, r := range l.reservations {
+		ram += r.RAM
+		disk[r.Filesystem] += r.Disk
+	}
+	return ram, disk
+}
+
+// outstanding returns the ram, & disk per filesystem, held by bids that haven't won a job yet
+func (l *Ledger) outstanding() (uint64, map[string]uint64) {
+	var ram uint64
+	disk := make(map[string]uint64)
+	for _, r := range l.reservations {
+		if !r.committed {
+			ram += r.RAM
+			disk[r.Filesystem] += r.Disk
+		}
+	}
+	return ram, disk
+}
+
+// Commit marks the reservation as held by a won job
+func (r *Reservation) Commit() {
+	r.ledger.mu.Lock()
+	defer r.ledger.mu.Unlock()
+	r.committed = true
+}
+
+// Release returns the reservation's ram & disk to the ledger. Releasing twice is a no-op
+func (r *Reservation) Release() {
+	r.ledger.mu.Lock()
+	defer r.ledger.mu.Unlock()
+	delete(r.ledger.reservations, r.id)
+}
+
+func sub(a, b uint64) uint64 {
+	if b > a {
+		return 0
+	}
+	return a - b
+}
+
+func min(a, b uint64) uint64 {
+	if b < a {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,112 @@
+package worker
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	gb   = 1000 * 1000 * 1000
+	fsA  = "/mnt/a"
+	fsB  = "/mnt/b"
+	many = 1000 * gb
+)
+
+// held is a reservation taken before the one under test
+type held struct {
+	ram, disk uint64
+	fs        string
+	committed bool
+}
+
+func TestLedgerReserve(t *testing.T) {
+	tests := []struct {
+		name          string
+		held          []held
+		ram, disk     uint64
+		fs            string
+		availableRAM  uint64
+		availableDisk uint64
+		wantErr       string
+	}{
+		{name: "fits", ram: 4 * gb, disk: 10 * gb, fs: fsA, availableRAM: many, availableDisk: many},
+		{name: "fills capacity", ram: 16 * gb, disk: 100 * gb, fs: fsA, availableRAM: many, availableDisk: many},
+		{name: "exceeds ram capacity", ram: 17 * gb, disk: 10 * gb, fs: fsA, availableRAM: many, availableDisk: many,
+			wantErr: "memory"},
+		{name: "exceeds disk capacity", ram: 4 * gb, disk: 101 * gb, fs: fsA, availableRAM: many, availableDisk: many,
+			wantErr: "disk"},
+		{name: "unknown filesystem", ram: 4 * gb, disk: 1, fs: "/mnt/c", availableRAM: many, availableDisk: many,
+			wantErr: "disk"},
+		{name: "other bids hold ram", held: []held{{ram: 10 * gb, fs: fsA}}, ram: 8 * gb, fs: fsA,
+			availableRAM: many, availableDisk: many, wantErr: "memory"},
+		{name: "jobs hold disk", held: []held{{disk: 60 * gb, fs: fsA, committed: true}}, disk: 50 * gb, fs: fsA,
+			availableRAM: many, availableDisk: many, wantErr: "disk"},
+		{name: "disk held on another filesystem", held: []held{{disk: 60 * gb, fs: fsB, committed: true}}, disk: 50 * gb,
+			fs: fsA, availableRAM: many, availableDisk: many},
+		{name: "live memory short", ram: 4 * gb, fs: fsA, availableRAM: 3 * gb, availableDisk: many, wantErr: "memory"},
+		{name: "live disk short", disk: 10 * gb, fs: fsA, availableRAM: many, availableDisk: 9 * gb, wantErr: "disk"},
+		// a running job's usage is already out of the live figures, so only other bids are netted from them
+		{name: "live check ignores jobs", held: []held{{ram: 8 * gb, disk: 50 * gb, fs: fsA, committed: true}},
+			ram: 8 * gb, disk: 50 * gb, fs: fsA, availableRAM: 8 * gb, availableDisk: 50 * gb},
+		{name: "live check nets other bids", held: []held{{ram: 4 * gb, fs: fsA}}, ram: 4 * gb, fs: fsA,
+			availableRAM: 6 * gb, availableDisk: many, wantErr: "memory"},
+		{name: "live check nets other bids' disk", held: []held{{disk: 5 * gb, fs: fsA}}, disk: 5 * gb, fs: fsA,
+			availableRAM: many, availableDisk: 9 * gb, wantErr: "disk"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLedger()
+			l.SetCapacity(16*gb, map[string]uint64{fsA: 100 * gb, fsB: 100 * gb})
+			for _, h := range tt.held {
+				if h.committed {
+					l.Hold(h.ram, h.disk, h.fs)
+				} else if _, err := l.Reserve(h.ram, h.disk, h.fs, many, many); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r, err := l.Reserve(tt.ram, tt.disk, tt.fs, tt.availableRAM, tt.availableDisk)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Reserve() error = %v, want insufficient %s", err, tt.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("Reserve(): %v", err)
+			}
+			if r.RAM != tt.ram || r.Disk != tt.disk || r.Filesystem != tt.fs {
+				t.Errorf("Reserve() = %+v, want %d ram & %d disk on %s", r, tt.ram, tt.disk, tt.fs)
+			}
+		})
+	}
+}
+
+func TestLedgerCommitRelease(t *testing.T) {
+	l := NewLedger()
+	l.SetCapacity(16*gb, map[string]uint64{fsA: 100 * gb})
+	bid, err := l.Reserve(4*gb, 10*gb, fsA, many, many)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recovered := l.Hold(2*gb, 20*gb, fsA)
+
+	if ram, disk := l.Allocated(); ram != 6*gb || disk[fsA] != 30*gb {
+		t.Errorf("Allocated() = %d, %v, want %d, %d", ram, disk, 6*gb, 30*gb)
+	}
+	if ram, disk := l.Committed(); ram != 2*gb || disk[fsA] != 20*gb {
+		t.Errorf("Committed() = %d, %v before commit, want %d, %d", ram, disk, 2*gb, 20*gb)
+	}
+	bid.Commit()
+	if ram, disk := l.Committed(); ram != 6*gb || disk[fsA] != 30*gb {
+		t.Errorf("Committed() = %d, %v after commit, want %d, %d", ram, disk, 6*gb, 30*gb)
+	}
+
+	bid.Release()
+	bid.Release()
+	recovered.Release()
+	if ram, disk := l.Allocated(); ram != 0 || disk[fsA] != 0 {
+		t.Errorf("Allocated() = %d, %v after release, want nothing", ram, disk)
+	}
+	if _, err := l.Reserve(16*gb, 100*gb, fsA, many, many); err != nil {
+		t.Errorf("reserving the released capacity: %v", err)
+	}
+}
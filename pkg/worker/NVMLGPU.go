@@ -0,0 +1,224 @@
+package worker
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+	"github.com/wminshew/emrys/pkg/job"
+	"github.com/wminshew/gonvml"
+	"math"
+	"time"
+)
+
+const (
+	nvmlFeatureEnabled          = 1
+	nvmlComputeExclusiveProcess = 3
+)
+
+// NVMLGPU is a GPU backed by nvidia's management library
+type NVMLGPU struct {
+	Index  uint
+	device gonvml.Device
+}
+
+// NewNVMLGPU returns the nvml GPU for device index
+func NewNVMLGPU(index uint) *NVMLGPU {
+	return &NVMLGPU{
+		Index: index,
+	}
+}
+
+// Init configures the device for emrys & records its static specs in snapshot
+func (g *NVMLGPU) Init(snapshot *job.DeviceSnapshot) error {
+	var err error
+	g.device, err = gonvml.DeviceHandleByIndex(g.Index)
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting handle by index", g.Index)
+	}
+
+	// initialize
+	if err := g.device.SetPersistenceMode(nvmlFeatureEnabled); err != nil {
+		return errors.Wrapf(err, "device %d: setting persistence mode", g.Index)
+	}
+
+	if err := g.device.SetComputeMode(nvmlComputeExclusiveProcess); err != nil {
+		return errors.Wrapf(err, "device %d: setting compute mode", g.Index)
+	}
+
+	name, err := g.device.Name()
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting name", g.Index)
+	}
+	var ok bool
+	if snapshot.Name, ok = job.ValidateGPU(name); !ok {
+		return errors.Wrapf(err, "device %d: this device is not currently supported by the emrys network. "+
+			"Please check https://docs.emrys.io/docs/suppliers/valid_gpus and contact support@emrys.io if you think there has been a mistake.", g.Index)
+	}
+
+	snapshot.MinorNumber, err = g.device.MinorNumber()
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting minor number", g.Index)
+	}
+
+	uuidStr, err := g.device.UUID()
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting uuid", g.Index)
+	}
+	snapshot.ID, err = uuid.FromString(uuidStr[4:]) // strip off "gpu-" prepend
+	if err != nil {
+		return errors.Wrapf(err, "device %d: converting uuid.uuid", g.Index)
+	}
+
+	snapshot.Brand, err = g.device.Brand()
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting brand", g.Index)
+	}
+
+	snapshot.DefaultPowerLimit, err = g.device.DefaultPowerLimit()
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting default power limit", g.Index)
+	}
+
+	snapshot.GrMaxClock, err = g.device.GrMaxClock()
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting max gr clock", g.Index)
+	}
+
+	snapshot.SMMaxClock, err = g.device.SMMaxClock()
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting max sm clock", g.Index)
+	}
+
+	snapshot.MemMaxClock, err = g.device.MemMaxClock()
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting max mem clock", g.Index)
+	}
+
+	snapshot.PcieMaxGeneration, err = g.device.PcieMaxGeneration()
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting max pcie gen", g.Index)
+	}
+
+	snapshot.PcieMaxWidth, err = g.device.PcieMaxWidth()
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting max pcie width", g.Index)
+	}
+
+	return nil
+}
+
+// Verify checks the device is still configured the way Init left it
+func (g *NVMLGPU) Verify(snapshot *job.DeviceSnapshot) error {
+	persistenceMode, err := g.device.PersistenceMode()
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting persistence mode", g.Index)
+	}
+	if persistenceMode != nvmlFeatureEnabled {
+		return errors.New("persistence mode disabled")
+	}
+
+	computeMode, err := g.device.ComputeMode()
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting compute mode", g.Index)
+	}
+	if computeMode != nvmlComputeExclusiveProcess {
+		return errors.New("exclusive compute mode disabled")
+	}
+
+	powerLimit, err := g.device.PowerLimit()
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting power limit", g.Index)
+	}
+	if powerLimit != snapshot.DefaultPowerLimit {
+		return fmt.Errorf("power limit (%d) not set to default (%d)", powerLimit, snapshot.DefaultPowerLimit)
+	}
+
+	return nil
+}
+
+// Sample records the device's current stats in snapshot, averaging over period where supported
+func (g *NVMLGPU) Sample(period time.Duration, snapshot *job.DeviceSnapshot) error {
+	var err error
+	snapshot.TotalMemory, snapshot.UsedMemory, err = g.device.MemoryInfo()
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting memory info", g.Index)
+	}
+
+	snapshot.PerformanceState, err = g.device.PerformanceState()
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting performance state", g.Index)
+	}
+
+	samplingPeriod := time.Duration(math.Max(float64(period), float64(1000*time.Millisecond)))
+	snapshot.AvgGPUUtilization, err = g.device.AverageGPUUtilization(samplingPeriod)
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting average utilization rate", g.Index)
+	}
+
+	snapshot.AvgPowerUsage, err = g.device.AveragePowerUsage(samplingPeriod)
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting average power usage", g.Index)
+	}
+
+	snapshot.GrClock, err = g.device.GrClock()
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting gr clock", g.Index)
+	}
+
+	snapshot.SMClock, err = g.device.SMClock()
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting sm clock", g.Index)
+	}
+
+	snapshot.MemClock, err = g.device.MemClock()
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting mem clock", g.Index)
+	}
+
+	snapshot.PcieTxThroughput, err = g.device.PcieTxThroughput()
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting pcie tx throughput", g.Index)
+	}
+
+	snapshot.PcieRxThroughput, err = g.device.PcieRxThroughput()
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting pcie rx throughput", g.Index)
+	}
+
+	snapshot.PcieGeneration, err = g.device.PcieGeneration()
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting pcie gen", g.Index)
+	}
+
+	snapshot.PcieWidth, err = g.device.PcieWidth()
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting pcie width", g.Index)
+	}
+
+	snapshot.Temperature, err = g.device.Temperature()
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting temperature", g.Index)
+	}
+
+	snapshot.FanSpeed, err = g.device.FanSpeed()
+	if err != nil {
+		return errors.Wrapf(err, "device %d: getting fanspeed", g.Index)
+	}
+
+	return nil
+}
+
+// Thermals returns the device's temperature (C) & fan speed (%)
+func (g *NVMLGPU) Thermals() (uint, uint, error) {
+	temp, err := g.device.Temperature()
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "device %d: getting temperature", g.Index)
+	}
+
+	fanSpeed, err := g.device.FanSpeed()
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "device %d: getting fan speed", g.Index)
+	}
+
+	return uint(temp), uint(fanSpeed), nil
+}
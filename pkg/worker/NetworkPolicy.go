@@ -0,0 +1,218 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Network policy modes
+const (
+	NetworkNone         = "none"
+	NetworkInternetOnly = "internet-only"
+	NetworkAllowlist    = "allow"
+)
+
+// internetOnlyNetwork is the job network used by NetworkInternetOnly policies
+const internetOnlyNetwork = "emrys-inet"
+
+// privateNets are blocked by NetworkInternetOnly: RFC1918, carrier-grade NAT, link-local
+// (including cloud metadata services) & multicast
+var privateNets = []string{
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"100.64.0.0/10",
+	"169.254.0.0/16",
+	"224.0.0.0/4",
+}
+
+// NetworkPolicy restricts the network access of a Worker's job containers
+type NetworkPolicy struct {
+	// Mode is NetworkNone, NetworkInternetOnly, or NetworkAllowlist
+	Mode string
+	// Allow holds the endpoints reachable under NetworkAllowlist
+	Allow []Endpoint
+}
+
+// Endpoint is a host (name, ip, or cidr) & port. Port 0 matches any port
+type Endpoint struct {
+	Host string
+	Port uint16
+}
+
+func (e Endpoint) String() string {
+	if e.Port == 0 {
+		return e.Host
+	}
+	return net.JoinHostPort(e.Host, strconv.Itoa(int(e.Port)))
+}
+
+// JobNetwork is the network access a job declares it needs
+type JobNetwork struct {
+	// Internet is true if the job needs general internet access
+	Internet bool `json:"internet"`
+	// Hosts are specific host:port endpoints the job needs
+	Hosts []string `json:"hosts"`
+}
+
+// ParseNetworkPolicy parses none, internet-only, or allow:HOST[:PORT];HOST[:PORT];...
+// A blank spec is internet-only
+func ParseNetworkPolicy(spec string) (NetworkPolicy, error) {
+	spec = strings.TrimSpace(spec)
+	switch {
+	case spec == NetworkNone:
+		return NetworkPolicy{Mode: NetworkNone}, nil
+	case spec == NetworkInternetOnly || spec == "":
+		return NetworkPolicy{Mode: NetworkInternetOnly}, nil
+	case strings.HasPrefix(spec, NetworkAllowlist+":"):
+		p := NetworkPolicy{Mode: NetworkAllowlist}
+		for _, endpointStr := range strings.Split(strings.TrimPrefix(spec, NetworkAllowlist+":"), ";") {
+			endpointStr = strings.TrimSpace(endpointStr)
+			if endpointStr == "" {
+				continue
+			}
+			e, err := parseEndpoint(endpointStr)
+			if err != nil {
+				return p, err
+			}
+			p.Allow = append(p.Allow, e)
+		}
+		if len(p.Allow) == 0 {
+			return p, fmt.Errorf("allow policy must list at least one endpoint")
+		}
+		return p, nil
+	}
+	return NetworkPolicy{}, fmt.Errorf("unknown network policy %s (must be %s, %s, or %s:HOST[:PORT];...)",
+		spec, NetworkNone, NetworkInternetOnly, NetworkAllowlist)
+}
+
+// parseEndpoint parses HOST[:PORT], where HOST may be a name, ip, or cidr
+func parseEndpoint(s string) (Endpoint, error) {
+	host, portStr, err := net.SplitHostPort(s)
+	if err != nil {
+		return Endpoint{Host: s}, nil
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return Endpoint{}, fmt.Errorf("invalid port in endpoint %s: %v", s, err)
+	}
+	return Endpoint{Host: host, Port: uint16(port)}, nil
+}
+
+func (p NetworkPolicy) String() string {
+	if p.Mode != NetworkAllowlist {
+		return p.Mode
+	}
+	endpoints := []string{}
+	for _, e := range p.Allow {
+		endpoints = append(endpoints, e.String())
+	}
+	return fmt.Sprintf("%s:%s", NetworkAllowlist, strings.Join(endpoints, ";"))
+}
+
+// Allows returns true if a job needing n can run under the policy. Jobs that don't declare
+// their network needs are assumed to need the internet
+func (p NetworkPolicy) Allows(n *JobNetwork) bool {
+	if n == nil {
+		n = &JobNetwork{Internet: true}
+	}
+	switch p.Mode {
+	case NetworkNone:
+		return !n.Internet && len(n.Hosts) == 0
+	case NetworkAllowlist:
+		if n.Internet {
+			return false
+		}
+		for _, h := range n.Hosts {
+			need, err := parseEndpoint(h)
+			if err != nil || !p.allowsEndpoint(need) {
+				return false
+			}
+		}
+		return true
+	}
+	return true
+}
+
+func (p NetworkPolicy) allowsEndpoint(need Endpoint) bool {
+	for _, e := range p.Allow {
+		if e.Host == need.Host && (e.Port == 0 || e.Port == need.Port) {
+			return true
+		}
+	}
+	return false
+}
+
+// network returns the name of the job network for the policy, which doubles as its bridge
+// interface name so must be at most 15 characters
+func (p NetworkPolicy) network() string {
+	switch p.Mode {
+	case NetworkNone:
+		return NetworkNone
+	case NetworkAllowlist:
+		return fmt.Sprintf("emrys-%x", sha256.Sum256([]byte(p.String())))[:14]
+	}
+	return internetOnlyNetwork
+}
+
+// forwardRules returns the iptables rules, in order, applied to new connections leaving
+// the policy's job network. Host names are resolved to their current ipv4 addresses
+func (p NetworkPolicy) forwardRules(ctx context.Context) ([][]string, error) {
+	// dns may be served from the lan, depending on the runtime
+	rules := [][]string{
+		{"-p", "udp", "--dport", "53", "-j", "RETURN"},
+		{"-p", "tcp", "--dport", "53", "-j", "RETURN"},
+	}
+	switch p.Mode {
+	case NetworkInternetOnly:
+		for _, cidr := range privateNets {
+			rules = append(rules, []string{"-d", cidr, "-j", "DROP"})
+		}
+		return append(rules, []string{"-j", "RETURN"}), nil
+	case NetworkAllowlist:
+		for _, e := range p.Allow {
+			dsts, err := resolveIPv4(ctx, e.Host)
+			if err != nil {
+				return nil, fmt.Errorf("resolving %s: %v", e.Host, err)
+			}
+			for _, dst := range dsts {
+				if e.Port == 0 {
+					rules = append(rules, []string{"-d", dst, "-j", "RETURN"})
+					continue
+				}
+				for _, proto := range []string{"tcp", "udp"} {
+					rules = append(rules, []string{"-d", dst, "-p", proto, "--dport", strconv.Itoa(int(e.Port)), "-j", "RETURN"})
+				}
+			}
+		}
+	}
+	return append(rules, []string{"-j", "DROP"}), nil
+}
+
+// resolveIPv4 returns host's ipv4 addresses; ips & cidrs are returned as is
+func resolveIPv4(ctx context.Context, host string) ([]string, error) {
+	if _, _, err := net.ParseCIDR(host); err == nil {
+		return []string{host}, nil
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return []string{host}, nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := []string{}
+	for _, addr := range addrs {
+		if ip4 := addr.IP.To4(); ip4 != nil {
+			ips = append(ips, ip4.String())
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no ipv4 addresses")
+	}
+	return ips, nil
+}
@@ -0,0 +1,86 @@
+package worker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNetworkPolicy(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    NetworkPolicy
+		wantErr bool
+	}{
+		{spec: "", want: NetworkPolicy{Mode: NetworkInternetOnly}},
+		{spec: "internet-only", want: NetworkPolicy{Mode: NetworkInternetOnly}},
+		{spec: " none ", want: NetworkPolicy{Mode: NetworkNone}},
+		{spec: "allow:pypi.org:443; files.pythonhosted.org:443;10.1.0.0/16", want: NetworkPolicy{
+			Mode: NetworkAllowlist,
+			Allow: []Endpoint{
+				{Host: "pypi.org", Port: 443},
+				{Host: "files.pythonhosted.org", Port: 443},
+				{Host: "10.1.0.0/16"},
+			},
+		}},
+		{spec: "allow:[2001:db8::1]:8080", want: NetworkPolicy{
+			Mode:  NetworkAllowlist,
+			Allow: []Endpoint{{Host: "2001:db8::1", Port: 8080}},
+		}},
+		{spec: "allow:", wantErr: true},
+		{spec: "allow: ; ", wantErr: true},
+		{spec: "allow:pypi.org:https", wantErr: true},
+		{spec: "allow:pypi.org:65536", wantErr: true},
+		{spec: "open", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			p, err := ParseNetworkPolicy(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseNetworkPolicy(%q) = %+v, want error", tt.spec, p)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("ParseNetworkPolicy(%q): %v", tt.spec, err)
+			}
+			if !reflect.DeepEqual(p, tt.want) {
+				t.Errorf("ParseNetworkPolicy(%q) = %+v, want %+v", tt.spec, p, tt.want)
+			}
+			if reparsed, err := ParseNetworkPolicy(p.String()); err != nil || !reflect.DeepEqual(reparsed, p) {
+				t.Errorf("reparsing %s = %+v, %v, want %+v", p, reparsed, err, p)
+			}
+			if n := p.network(); len(n) > 15 {
+				t.Errorf("network name %s longer than an interface name", n)
+			}
+		})
+	}
+}
+
+func TestNetworkPolicyAllows(t *testing.T) {
+	allow := NetworkPolicy{Mode: NetworkAllowlist, Allow: []Endpoint{{Host: "pypi.org", Port: 443}, {Host: "10.1.2.3"}}}
+	tests := []struct {
+		name   string
+		policy NetworkPolicy
+		job    *JobNetwork
+		want   bool
+	}{
+		{"internet-only, undeclared", NetworkPolicy{Mode: NetworkInternetOnly}, nil, true},
+		{"internet-only, internet", NetworkPolicy{Mode: NetworkInternetOnly}, &JobNetwork{Internet: true}, true},
+		{"none, undeclared", NetworkPolicy{Mode: NetworkNone}, nil, false},
+		{"none, offline", NetworkPolicy{Mode: NetworkNone}, &JobNetwork{}, true},
+		{"none, hosts", NetworkPolicy{Mode: NetworkNone}, &JobNetwork{Hosts: []string{"pypi.org:443"}}, false},
+		{"allow, undeclared", allow, nil, false},
+		{"allow, offline", allow, &JobNetwork{}, true},
+		{"allow, listed hosts", allow, &JobNetwork{Hosts: []string{"pypi.org:443", "10.1.2.3:5432"}}, true},
+		{"allow, wrong port", allow, &JobNetwork{Hosts: []string{"pypi.org:80"}}, false},
+		{"allow, unlisted host", allow, &JobNetwork{Hosts: []string{"pypi.org:443", "example.com:443"}}, false},
+		{"allow, internet", allow, &JobNetwork{Internet: true, Hosts: []string{"pypi.org:443"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Allows(tt.job); got != tt.want {
+				t.Errorf("%s.Allows(%+v) = %v, want %v", tt.policy, tt.job, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// NvidiaSettingsFans controls a device's fans with nvidia-settings
+type NvidiaSettingsFans struct {
+	Index uint
+}
+
+// SetSpeed sets the target fan speed (%)
+func (f *NvidiaSettingsFans) SetSpeed(ctx context.Context, speed int) error {
+	// nvidia-settings -a '[fan:{f.Index}]/GPUTargetFanSpeed={speed}'
+	cmdStr := "nvidia-settings"
+	args := append([]string{"-a"}, fmt.Sprintf("[fan:%d]/GPUTargetFanSpeed=%d", f.Index, speed))
+	cmd := exec.CommandContext(ctx, cmdStr, args...)
+	return cmd.Run()
+}
+
+// SetControlState enables (1) or disables (0) manual fan control
+func (f *NvidiaSettingsFans) SetControlState(ctx context.Context, state int) error {
+	if state != 0 && state != 1 {
+		return fmt.Errorf("improper new fan control state: %d", state)
+	}
+	// nvidia-settings -a '[gpu:{f.Index}]/GPUFanControlState={state}'
+	cmdStr := "nvidia-settings"
+	args := append([]string{"-a"}, fmt.Sprintf("[gpu:%d]/GPUFanControlState=%d", f.Index, state))
+	cmd := exec.CommandContext(ctx, cmdStr, args...)
+	return cmd.Run()
+}
+
+// ControlState returns the current fan control state
+func (f *NvidiaSettingsFans) ControlState(ctx context.Context) (int, error) {
+	// nvidia-settings -q "[gpu:0]/GPUFanControlState" | sed -n 's/Attribute//p' - | awk '{print $NF}' | sed 's/[^0-9]*//g -'
+	// TODO: use idiomatic go pipes instead of shelling out?
+	cmdStr := fmt.Sprintf("nvidia-settings -q \"[gpu:%d]/GPUFanControlState\" | sed -n 's/Attribute//p' - | awk '{print $NF}' | sed 's/[^0-9]*//g' -", f.Index)
+	cmd := exec.CommandContext(ctx, "bash", "-c", cmdStr)
+	// Output runs the command and returns its standard output.
+	// Any returned error will usually be of type *ExitError.
+	// If c.Stderr was nil, Output populates ExitError.Stderr.
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, err
+	}
+
+	// TODO: use strings.TrimSpace instead for more general correction?
+	fanControlState, err := strconv.Atoi(strings.TrimSuffix(string(output), "\n"))
+	if err != nil {
+		return 0, err
+	}
+
+	return fanControlState, nil
+}
@@ -0,0 +1,37 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types/container"
+	docker "github.com/docker/docker/client"
+)
+
+// PodmanRuntime runs job containers with podman through its docker-compatible API
+type PodmanRuntime struct {
+	*DockerRuntime
+}
+
+// NewPodmanRuntime returns a ContainerRuntime backed by podman's api service
+func NewPodmanRuntime(c *docker.Client) *PodmanRuntime {
+	return &PodmanRuntime{
+		DockerRuntime: NewDockerRuntime(c),
+	}
+}
+
+// ContainerCreate creates a container from spec, returning its ID
+func (p *PodmanRuntime) ContainerCreate(ctx context.Context, spec *ContainerSpec) (string, error) {
+	config, hostConfig, err := dockerContainerConfig(spec)
+	if err != nil {
+		return "", err
+	}
+	// podman exposes gpus through the container device interface instead of device requests
+	hostConfig.Resources.DeviceRequests = nil
+	hostConfig.Resources.Devices = []container.DeviceMapping{
+		container.DeviceMapping{
+			PathOnHost:        fmt.Sprintf("nvidia.com/gpu=%s", spec.Device),
+			CgroupPermissions: "rwm",
+		},
+	}
+	return p.create(ctx, config, hostConfig)
+}
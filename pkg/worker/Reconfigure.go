@@ -0,0 +1,125 @@
+package worker
+
+import (
+	"github.com/dustin/go-humanize"
+	"log"
+	"time"
+)
+
+// Settings are the miner-configurable parameters of a Worker
+type Settings struct {
+	BidRate float64
+	RAM     uint64
+	Disk    uint64
+	// Workdir is the directory job data & output are kept in while a job runs
+	Workdir       string
+	MiningCommand string
+	// MiningSchedule restricts when MiningCommand may run; nil is always
+	MiningSchedule *Schedule
+	// BidSchedule restricts when the Worker may bid on jobs; nil is always
+	BidSchedule *Schedule
+	BidStrategy BidStrategy
+	// ElectricityPrice is the cost of power ($/kWh)
+	ElectricityPrice float64
+	// MiningRevenue is the expected revenue ($/hr) of MiningCommand on the device
+	MiningRevenue float64
+	// BreakEvenPolicy is BreakEvenRaise or BreakEvenSkip
+	BreakEvenPolicy string
+	// Security restricts the Worker's job containers
+	Security SecurityProfile
+	// NetworkPolicy restricts the network access of the Worker's job containers
+	NetworkPolicy NetworkPolicy
+	// OutputSyncInterval is how often new & changed output is uploaded while a job runs; zero disables it
+	OutputSyncInterval time.Duration
+	// OutputSyncThreshold is the bytes of new output that triggers an upload before the interval passes
+	OutputSyncThreshold uint64
+}
+
+// Reconfigure applies s to the Worker. If the Worker is bidding on or busy with a job, s is
+// applied once the bid is lost or the job finishes
+func (w *Worker) Reconfigure(s Settings) {
+	w.settingsMu.Lock()
+	defer w.settingsMu.Unlock()
+	// hold stateMu too, so the Worker can't start bidding or finish a job while deciding
+	w.stateMu.Lock()
+	defer w.stateMu.Unlock()
+	if w.state == StateBidding {
+		log.Printf("Device %d: bidding on job %s; new settings will apply after the bid\n", w.Device, w.jobID)
+		w.pendingSettings = &s
+		return
+	} else if w.state != StateIdle {
+		log.Printf("Device %d: busy with job %s; new settings will apply after it finishes\n", w.Device, w.jobID)
+		w.pendingSettings = &s
+		return
+	}
+	w.applySettings(s)
+}
+
+// finishJob applies any settings deferred by Reconfigure while the Worker was bidding or busy &
+// returns it to idle, so it never bids with the old settings or misses the new ones
+func (w *Worker) finishJob() {
+	w.settingsMu.Lock()
+	defer w.settingsMu.Unlock()
+	if w.pendingSettings != nil {
+		w.applySettings(*w.pendingSettings)
+		w.pendingSettings = nil
+	}
+	_ = w.transition(StateIdle, "")
+}
+
+// applySettings must be called with settingsMu held
+func (w *Worker) applySettings(s Settings) {
+	if w.BidRate != s.BidRate || w.RAM != s.RAM || w.Disk != s.Disk {
+		log.Printf("Device %d: bid-rate: %v, ram: %s, disk: %s\n", w.Device, s.BidRate, humanize.Bytes(s.RAM), humanize.Bytes(s.Disk))
+	}
+	if w.Workdir != s.Workdir {
+		log.Printf("Device %d: workdir: %s\n", w.Device, s.Workdir)
+	}
+	if w.OutputSyncInterval != s.OutputSyncInterval || w.OutputSyncThreshold != s.OutputSyncThreshold {
+		log.Printf("Device %d: output-sync-interval: %v, output-sync-threshold: %s\n", w.Device, s.OutputSyncInterval, humanize.Bytes(s.OutputSyncThreshold))
+	}
+	if w.Security != s.Security {
+		log.Printf("Device %d: job security profile: %s\n", w.Device, s.Security)
+	}
+	if w.NetworkPolicy.String() != s.NetworkPolicy.String() {
+		log.Printf("Device %d: job network policy: %s\n", w.Device, s.NetworkPolicy)
+	}
+	w.BidRate = s.BidRate
+	w.RAM = s.RAM
+	w.Disk = s.Disk
+	w.Workdir = s.Workdir
+	w.BidStrategy = s.BidStrategy
+	w.ElectricityPrice = s.ElectricityPrice
+	w.MiningRevenue = s.MiningRevenue
+	w.BreakEvenPolicy = s.BreakEvenPolicy
+	w.BidSchedule = s.BidSchedule
+	w.Security = s.Security
+	w.NetworkPolicy = s.NetworkPolicy
+	w.OutputSyncInterval = s.OutputSyncInterval
+	w.OutputSyncThreshold = s.OutputSyncThreshold
+	w.Miner.Configure(s.MiningCommand, s.MiningSchedule)
+}
+
+// Settings returns the Worker's current settings
+func (w *Worker) Settings() Settings {
+	miningCmd, miningSchedule := w.Miner.config()
+	w.settingsMu.Lock()
+	defer w.settingsMu.Unlock()
+	return Settings{
+		BidRate:             w.BidRate,
+		RAM:                 w.RAM,
+		Disk:                w.Disk,
+		Workdir:             w.Workdir,
+		MiningCommand:       miningCmd,
+		MiningSchedule:      miningSchedule,
+		BidSchedule:         w.BidSchedule,
+		BidStrategy:         w.BidStrategy,
+		ElectricityPrice:    w.ElectricityPrice,
+		MiningRevenue:       w.MiningRevenue,
+		BreakEvenPolicy:     w.BreakEvenPolicy,
+		Security:            w.Security,
+		NetworkPolicy:       w.NetworkPolicy,
+		OutputSyncInterval:  w.OutputSyncInterval,
+		OutputSyncThreshold: w.OutputSyncThreshold,
+	}
+}
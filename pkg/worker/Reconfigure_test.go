@@ -0,0 +1,37 @@
+package worker
+
+import (
+	"testing"
+)
+
+func TestReconfigure(t *testing.T) {
+	tests := []struct {
+		name      string
+		state     State
+		wantApply bool
+	}{
+		{"idle", StateIdle, true},
+		{"bidding", StateBidding, false},
+		{"won", StateWon, false},
+		{"running", StateRunning, false},
+		{"uploading", StateUploading, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Worker{BidRate: 1, Miner: &CryptoMiner{}, state: tt.state}
+			s := w.Settings()
+			s.BidRate = 2
+			w.Reconfigure(s)
+			if applied := w.Settings().BidRate == s.BidRate; applied != tt.wantApply {
+				t.Errorf("settings applied in state %s = %v, want %v", tt.state, applied, tt.wantApply)
+			}
+			w.finishJob()
+			if got := w.Settings().BidRate; got != s.BidRate {
+				t.Errorf("bid rate after finishing = %v, want %v", got, s.BidRate)
+			}
+			if st := w.State(); st != StateIdle {
+				t.Errorf("state after finishing = %s, want %s", st, StateIdle)
+			}
+		})
+	}
+}
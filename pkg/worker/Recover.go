@@ -0,0 +1,169 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"github.com/wminshew/emrys/pkg/check"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Recover resumes the job the Worker was running when the miner last exited, if its container
+// survived, & reports any other job left behind by the Worker's device to the server as failed. It
+// must be called before the Worker bids, & returns the ID of the resumed job, if any
+func (w *Worker) Recover(ctx context.Context, u url.URL) (string, error) {
+	dStr := strconv.Itoa(int(w.Device))
+	rec, err := w.loadJobRecord()
+	if err != nil {
+		return "", err
+	}
+	if rec != nil && rec.MinerID != w.MinerID {
+		// left in place for the miner that owns it
+		log.Printf("Device %s: ignoring job record of another miner (%s)\n", dStr, rec.MinerID)
+		rec = nil
+	}
+	containers, err := w.Runtime.ContainerList(ctx)
+	if err != nil {
+		return "", fmt.Errorf("listing containers: %v", err)
+	}
+
+	resumable, reported := false, false
+	for _, c := range containers {
+		if c.Labels[labelMiner] != w.MinerID || c.Labels[labelDevice] != dStr {
+			continue
+		}
+		jID := c.Labels[labelJob]
+		if rec != nil && rec.JobID == jID && rec.ContainerID == c.ID && !rec.Notebook {
+			resumable = true
+			continue
+		}
+
+		reason := "the miner restarted before the job's state was saved"
+		outputDir := filepath.Join(w.Settings().Workdir, jID, "output")
+		var logSeq int64
+		if rec != nil && rec.JobID == jID {
+			// notebook port forwarding depends on the job's ssh key, which isn't saved
+			reason = "the miner restarted & notebooks can't be resumed"
+			outputDir = rec.OutputDir
+			logSeq = rec.LogSeq
+			reported = true
+		}
+		if err := w.reportJobFailed(ctx, u, jID, outputDir, logSeq, reason); err != nil {
+			log.Printf("Device %s: error reporting job %s failed: %v", dStr, jID, err)
+		}
+		log.Printf("Device %s: removing container of failed job %s...\n", dStr, jID)
+		if err := w.Runtime.ContainerRemove(ctx, c.ID); err != nil {
+			return "", fmt.Errorf("removing container %s: %v", c.ID, err)
+		}
+	}
+
+	if rec == nil {
+		return "", nil
+	}
+	if !resumable {
+		if !reported {
+			if err := w.reportJobFailed(ctx, u, rec.JobID, rec.OutputDir, rec.LogSeq, "the job's container was lost when the miner restarted"); err != nil {
+				log.Printf("Device %s: error reporting job %s failed: %v", dStr, rec.JobID, err)
+			}
+		}
+		if err := os.RemoveAll(rec.JobDir); err != nil {
+			return "", fmt.Errorf("removing job dir %s: %v", rec.JobDir, err)
+		}
+		return "", w.removeJobRecord()
+	}
+
+	fs, err := MountPoint(rec.JobDir)
+	if err != nil {
+		return "", fmt.Errorf("finding job dir filesystem: %v", err)
+	}
+	res := w.Ledger.Hold(rec.RAM, rec.Disk, fs)
+	if err := w.resume(rec.JobID); err != nil {
+		res.Release()
+		return "", err
+	}
+	log.Printf("Device %s: resuming job %s from log offset %d...\n", dStr, rec.JobID, rec.LogOffset)
+	go w.resumeJob(ctx, u, rec, res)
+	return rec.JobID, nil
+}
+
+// resumeJob finishes streaming the log & uploading the output of job rec, whose container
+// outlived the previous run of the miner
+func (w *Worker) resumeJob(ctx context.Context, u url.URL, rec *jobRecord, res *Reservation) {
+	defer w.finishJob()
+	// released before going idle, as in executeJob
+	defer res.Release()
+	w.recordJobStart(rec.JobID)
+	defer w.recordJobEnd(rec.JobID)
+	dStr := strconv.Itoa(int(w.Device))
+	w.Miner.Stop()
+	defer w.Miner.Start()
+
+	jobCanceled, stopPolling := w.pollJobCanceled(ctx, u, rec.JobID, rec.Started)
+	defer stopPolling()
+
+	defer check.Err(func() error { return os.RemoveAll(rec.JobDir) })
+	w.Images.Acquire(rec.Image)
+	defer func() {
+		w.Images.Release(rec.Image)
+		if err := w.Images.Evict(context.Background()); err != nil {
+			log.Printf("Device %s: error evicting cached images: %v", dStr, err)
+		}
+	}()
+	w.setJobDirs(rec.DataDir, rec.OutputDir)
+
+	// the quota set by the previous run is still in place; setting it again returns its clear func
+	jobDirQuota := rec.JobDirQuota
+	if jobDirQuota == 0 {
+		// recorded before the allocation was split with the container
+		jobDirQuota = rec.Disk
+	}
+	if clearQuota, err := setProjectQuota(rec.JobDir, uint32(w.Device), jobDirQuota); err != nil {
+		log.Printf("Device %s: error setting job dir disk quota, relying on disk watchdog: %v", dStr, err)
+	} else if clearQuota != nil {
+		defer func() {
+			if err := clearQuota(); err != nil {
+				log.Printf("Device %s: error clearing job dir disk quota: %v", dStr, err)
+			}
+		}()
+	}
+
+	w.setContainerID(rec.ContainerID)
+	defer w.setContainerID("")
+	defer func() {
+		ctx := context.Background()
+		log.Printf("Device %s: removing container...\n", dStr)
+		if err := w.Runtime.ContainerRemove(ctx, rec.ContainerID); err != nil {
+			log.Printf("Device %s: error removing job container %v: %v", dStr, rec.JobID, err)
+		}
+	}()
+	defer func() {
+		if err := w.removeJobRecord(); err != nil {
+			log.Printf("Device %s: %v", dStr, err)
+		}
+	}()
+
+	w.runJob(ctx, u, rec, jobCanceled, "")
+}
+
+// reportJobFailed tells the server job jID failed for reason, uploading whatever output it left in outputDir.
+// logSeq is the sequence number of the last log batch the server acknowledged for the job, if any
+func (w *Worker) reportJobFailed(ctx context.Context, u url.URL, jID, outputDir string, logSeq int64, reason string) error {
+	log.Printf("Device %d: reporting job %s failed: %s\n", w.Device, jID, reason)
+	if err := w.postLog(ctx, u, jID, fmt.Sprintf("\nJOB FAILED: %s\n", strings.ToUpper(reason)), logSeq+1); err != nil {
+		return err
+	}
+	// POST with empty body signifies log upload complete
+	if err := w.postLog(ctx, u, jID, "", 0); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("making output dir %s: %v", outputDir, err)
+	}
+	q := url.Values{}
+	q.Set("jobfailed", "1")
+	return w.uploadOutput(ctx, u, jID, outputDir, q)
+}
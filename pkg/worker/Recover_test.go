@@ -0,0 +1,221 @@
+package worker_test
+
+import (
+	"context"
+	"github.com/wminshew/emrys/pkg/check"
+	"github.com/wminshew/emrysclient/pkg/fakeserver"
+	"github.com/wminshew/emrysclient/pkg/sim"
+	"github.com/wminshew/emrysclient/pkg/worker"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecover(t *testing.T) {
+	const (
+		minerID    = "test-miner"
+		otherMiner = "other-miner"
+		image      = "registry.emrys.io/miner/test"
+	)
+	tests := []struct {
+		name           string
+		notebook       bool
+		recordMiner    string
+		containerMiner string
+		wantResumed    bool
+		wantLog        string
+		wantRecord     bool
+		wantContainer  bool
+		wantJobDir     bool
+	}{
+		{
+			name:           "resumes a surviving container",
+			recordMiner:    minerID,
+			containerMiner: minerID,
+			wantResumed:    true,
+			wantLog:        "simulated epoch 1",
+		},
+		{
+			name:        "reports a lost container",
+			recordMiner: minerID,
+			wantLog:     "JOB FAILED: THE JOB'S CONTAINER WAS LOST WHEN THE MINER RESTARTED",
+		},
+		{
+			name:           "reports a notebook",
+			notebook:       true,
+			recordMiner:    minerID,
+			containerMiner: minerID,
+			wantLog:        "JOB FAILED: THE MINER RESTARTED & NOTEBOOKS CAN'T BE RESUMED",
+		},
+		{
+			name:           "reports an unrecorded container",
+			containerMiner: minerID,
+			wantLog:        "JOB FAILED: THE MINER RESTARTED BEFORE THE JOB'S STATE WAS SAVED",
+			wantJobDir:     true,
+		},
+		{
+			name:           "leaves another miner's job",
+			recordMiner:    otherMiner,
+			containerMiner: otherMiner,
+			wantRecord:     true,
+			wantContainer:  true,
+			wantJobDir:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workdir, err := ioutil.TempDir("", "emrys-recover-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(workdir)
+			configDir, err := ioutil.TempDir("", "emrys-recover-test-config")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(configDir)
+
+			gpu := sim.NewGPU(0)
+			runtime := sim.NewRuntime([]*sim.GPU{gpu})
+			runtime.JobDuration = 500 * time.Millisecond
+			runtime.LogPeriod = 50 * time.Millisecond
+			srv := fakeserver.New(nil)
+			defer srv.Close()
+			authToken := srv.Scenario.Token
+			w := &worker.Worker{
+				MinerID:         minerID,
+				Client:          srv.Client(),
+				Runtime:         runtime,
+				AuthToken:       &authToken,
+				Ledger:          worker.NewLedger(),
+				Images:          worker.NewImageCache(runtime, 0, 0),
+				GPU:             gpu,
+				Fans:            &sim.Fans{GPU: gpu},
+				RAM:             1000 * 1000,
+				Disk:            1000 * 1000,
+				Workdir:         workdir,
+				ConfigDir:       configDir,
+				BreakEvenPolicy: worker.BreakEvenRaise,
+				Miner:           &worker.CryptoMiner{},
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			w.Miner.Init(ctx)
+			defer w.Miner.Stop()
+
+			jID, err := srv.PostJob("test", tt.notebook)
+			if err != nil {
+				t.Fatal(err)
+			}
+			jobDir := filepath.Join(workdir, jID)
+			outputDir := filepath.Join(jobDir, "output")
+			if err := os.MkdirAll(outputDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			var cID string
+			if tt.containerMiner != "" {
+				out, err := runtime.ImagePull(ctx, image, "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				check.Err(out.Close)
+				cID, err = runtime.ContainerCreate(ctx, &worker.ContainerSpec{
+					Image:         image,
+					Device:        "0",
+					HostOutputDir: outputDir,
+					Labels:        worker.JobLabels(tt.containerMiner, jID, 0),
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := runtime.ContainerStart(ctx, cID); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.recordMiner != "" {
+				if err := w.SaveJob(&worker.SavedJob{
+					JobID:       jID,
+					MinerID:     tt.recordMiner,
+					ContainerID: cID,
+					Image:       image,
+					JobDir:      jobDir,
+					DataDir:     filepath.Join(jobDir, "data"),
+					OutputDir:   outputDir,
+					RAM:         w.RAM,
+					Disk:        w.Disk,
+					Notebook:    tt.notebook,
+					Started:     time.Now(),
+				}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			events, unsubscribe := w.Subscribe()
+			defer unsubscribe()
+			resumed, err := w.Recover(ctx, srv.URL())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantResumed {
+				if resumed != jID {
+					t.Fatalf("resumed job = %q, want %q", resumed, jID)
+				}
+				timeout := time.After(30 * time.Second)
+				for finished := false; !finished; {
+					select {
+					case e := <-events:
+						finished = e.To == worker.StateIdle
+					case <-timeout:
+						t.Fatalf("timed out in state %s", w.State())
+					}
+				}
+			} else if resumed != "" {
+				t.Errorf("resumed job %q, want none", resumed)
+			}
+
+			j, err := srv.Job(jID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantLog == "" {
+				if len(j.Log) > 0 || j.LogDone || j.Output != nil {
+					t.Errorf("job reported (log %q, done %v, output %v), want untouched", j.Log, j.LogDone, j.Output != nil)
+				}
+			} else {
+				if !strings.Contains(string(j.Log), tt.wantLog) {
+					t.Errorf("job log %q doesn't contain %q", j.Log, tt.wantLog)
+				}
+				if !j.LogDone {
+					t.Errorf("job log not marked done")
+				}
+				if j.Output == nil {
+					t.Errorf("job output not uploaded")
+				}
+			}
+
+			rec, err := w.LoadJob()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (rec != nil) != tt.wantRecord {
+				t.Errorf("job record left = %v, want %v", rec != nil, tt.wantRecord)
+			}
+			containers, err := runtime.ContainerList(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (len(containers) > 0) != tt.wantContainer {
+				t.Errorf("containers left = %d, want container %v", len(containers), tt.wantContainer)
+			}
+			if _, err := os.Stat(jobDir); (err == nil) != tt.wantJobDir {
+				t.Errorf("job dir left = %v, want %v", err == nil, tt.wantJobDir)
+			}
+			if w.Busy() {
+				t.Errorf("worker busy in state %s after recovering", w.State())
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package worker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxScheduleLookahead bounds searches for a Schedule's next transition
+const maxScheduleLookahead = 8 * 24 * time.Hour
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Schedule is a cron-like set of weekly windows in local time. A nil Schedule is always open
+type Schedule struct {
+	Windows []ScheduleWindow
+}
+
+// ScheduleWindow is open on Days from Start until End, which are offsets from midnight.
+// Windows with End before Start wrap past midnight into the following day
+type ScheduleWindow struct {
+	Days  [7]bool
+	Start time.Duration
+	End   time.Duration
+}
+
+// ParseSchedule parses windows of the form [DAYS ]HH:MM-HH:MM separated by semicolons, e.g.
+// "mon-fri 18:00-08:00; sat,sun 00:00-24:00". DAYS is * (the default), or a list of days
+// (sun-sat or 0-6) & day ranges. A blank spec returns a nil (always open) Schedule
+func ParseSchedule(spec string) (*Schedule, error) {
+	s := &Schedule{}
+	for _, windowStr := range strings.Split(spec, ";") {
+		fields := strings.Fields(windowStr)
+		if len(fields) == 0 {
+			continue
+		}
+		w := ScheduleWindow{}
+		daysStr, hoursStr := "*", fields[0]
+		if len(fields) == 2 {
+			daysStr, hoursStr = fields[0], fields[1]
+		} else if len(fields) > 2 {
+			return nil, fmt.Errorf("invalid schedule window %s: must be [DAYS ]HH:MM-HH:MM", windowStr)
+		}
+
+		var err error
+		if w.Days, err = parseDays(daysStr); err != nil {
+			return nil, fmt.Errorf("invalid schedule window %s: %v", windowStr, err)
+		}
+		bounds := strings.SplitN(hoursStr, "-", 2)
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("invalid schedule window %s: must be [DAYS ]HH:MM-HH:MM", windowStr)
+		}
+		if w.Start, err = parseScheduleTime(bounds[0]); err != nil {
+			return nil, fmt.Errorf("invalid schedule window %s: %v", windowStr, err)
+		}
+		if w.End, err = parseScheduleTime(bounds[1]); err != nil {
+			return nil, fmt.Errorf("invalid schedule window %s: %v", windowStr, err)
+		}
+		s.Windows = append(s.Windows, w)
+	}
+	if len(s.Windows) == 0 {
+		return nil, nil
+	}
+	return s, nil
+}
+
+// Open returns true if t falls in one of the Schedule's windows
+func (s *Schedule) Open(t time.Time) bool {
+	if s == nil {
+		return true
+	}
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+	yesterday := (t.Weekday() + 6) % 7
+	for _, w := range s.Windows {
+		if w.Start <= w.End {
+			if w.Days[t.Weekday()] && offset >= w.Start && offset < w.End {
+				return true
+			}
+			continue
+		}
+		// wraps past midnight
+		if w.Days[t.Weekday()] && offset >= w.Start {
+			return true
+		}
+		if w.Days[yesterday] && offset < w.End {
+			return true
+		}
+	}
+	return false
+}
+
+// NextTransition returns the next time after t at which the Schedule opens or closes,
+// or the zero time if it never does
+func (s *Schedule) NextTransition(t time.Time) time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+	open := s.Open(t)
+	next := t.Truncate(time.Minute)
+	for next.Sub(t) < maxScheduleLookahead {
+		next = next.Add(time.Minute)
+		if s.Open(next) != open {
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+// Closes returns when the window open at t closes, or the zero time if it never does
+func (s *Schedule) Closes(t time.Time) time.Time {
+	if !s.Open(t) {
+		return t
+	}
+	return s.NextTransition(t)
+}
+
+func (s *Schedule) equal(o *Schedule) bool {
+	if s == nil || o == nil {
+		return s == o
+	}
+	if len(s.Windows) != len(o.Windows) {
+		return false
+	}
+	for i := range s.Windows {
+		if s.Windows[i] != o.Windows[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// parseDays parses * or a comma-separated list of days & day ranges
+func parseDays(s string) ([7]bool, error) {
+	days := [7]bool{}
+	if s == "*" {
+		for i := range days {
+			days[i] = true
+		}
+		return days, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := parseWeekday(bounds[0])
+		if err != nil {
+			return days, err
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = parseWeekday(bounds[1]); err != nil {
+				return days, err
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+func parseWeekday(s string) (time.Weekday, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) >= 3 {
+		if d, ok := weekdays[s[:3]]; ok {
+			return d, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > 6 {
+		return 0, fmt.Errorf("invalid day %s", s)
+	}
+	return time.Weekday(n), nil
+}
+
+// parseScheduleTime parses HH:MM into an offset from midnight, allowing 24:00 for end of day
+func parseScheduleTime(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "24:00" {
+		return 24 * time.Hour, nil
+	}
+	return parseTimeOfDay(s)
+}
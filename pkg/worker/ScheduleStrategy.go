@@ -0,0 +1,92 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScheduleStrategy bids according to the local time of day, falling back to the
+// device's configured bid-rate outside of its windows
+type ScheduleStrategy struct {
+	Windows []RateWindow
+}
+
+// RateWindow is a daily window [Start, End) with its own bid rate. Start & End
+// are offsets from midnight; windows with End before Start wrap past midnight
+type RateWindow struct {
+	Start time.Duration
+	End   time.Duration
+	Rate  float64
+}
+
+// ParseScheduleStrategy parses windows of the form HH:MM-HH:MM=RATE separated by semicolons
+func ParseScheduleStrategy(args string) (*ScheduleStrategy, error) {
+	s := &ScheduleStrategy{}
+	for _, windowStr := range strings.Split(args, ";") {
+		windowStr = strings.TrimSpace(windowStr)
+		if windowStr == "" {
+			continue
+		}
+		split := strings.SplitN(windowStr, "=", 2)
+		if len(split) != 2 {
+			return nil, fmt.Errorf("invalid schedule window %s: must be HH:MM-HH:MM=RATE", windowStr)
+		}
+		bounds := strings.SplitN(split[0], "-", 2)
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("invalid schedule window %s: must be HH:MM-HH:MM=RATE", windowStr)
+		}
+		start, err := parseTimeOfDay(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule window %s: %v", windowStr, err)
+		}
+		end, err := parseTimeOfDay(bounds[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule window %s: %v", windowStr, err)
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(split[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule window %s: %v", windowStr, err)
+		}
+		s.Windows = append(s.Windows, RateWindow{
+			Start: start,
+			End:   end,
+			Rate:  rate,
+		})
+	}
+	if len(s.Windows) == 0 {
+		return nil, fmt.Errorf("schedule bid strategy requires at least one window")
+	}
+	return s, nil
+}
+
+// Rate returns the rate of the first window containing the current time
+func (s *ScheduleStrategy) Rate(ctx context.Context, req *BidRequest) (float64, bool, error) {
+	now := time.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	offset := now.Sub(midnight)
+	for _, window := range s.Windows {
+		if window.contains(offset) {
+			return window.Rate, true, nil
+		}
+	}
+	return req.BidRate, true, nil
+}
+
+func (w RateWindow) contains(offset time.Duration) bool {
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// parseTimeOfDay parses HH:MM into an offset from midnight
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
@@ -0,0 +1,140 @@
+package worker
+
+import (
+	"testing"
+	"time"
+)
+
+// days returns the ScheduleWindow days set for ds
+func days(ds ...time.Weekday) [7]bool {
+	d := [7]bool{}
+	for _, day := range ds {
+		d[day] = true
+	}
+	return d
+}
+
+var everyDay = days(time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday)
+
+// at returns hh:mm UTC on day of January 2024, which starts on a Monday
+func at(day int, hh, mm int) time.Time {
+	return time.Date(2024, time.January, day, hh, mm, 0, 0, time.UTC)
+}
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []ScheduleWindow
+		wantErr bool
+	}{
+		{spec: "", want: nil},
+		{spec: " ; ", want: nil},
+		{spec: "18:00-08:00", want: []ScheduleWindow{{everyDay, 18 * time.Hour, 8 * time.Hour}}},
+		{spec: "* 09:30-17:00", want: []ScheduleWindow{{everyDay, 9*time.Hour + 30*time.Minute, 17 * time.Hour}}},
+		{spec: "mon-fri 09:00-17:00", want: []ScheduleWindow{
+			{days(time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday), 9 * time.Hour, 17 * time.Hour},
+		}},
+		{spec: "fri-mon 22:00-02:00", want: []ScheduleWindow{
+			{days(time.Friday, time.Saturday, time.Sunday, time.Monday), 22 * time.Hour, 2 * time.Hour},
+		}},
+		{spec: "0,6 00:00-24:00", want: []ScheduleWindow{{days(time.Sunday, time.Saturday), 0, 24 * time.Hour}}},
+		{spec: "Monday,wed 08:00-09:00", want: []ScheduleWindow{{days(time.Monday, time.Wednesday), 8 * time.Hour, 9 * time.Hour}}},
+		{spec: "mon-fri 18:00-08:00; sat,sun 00:00-24:00", want: []ScheduleWindow{
+			{days(time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday), 18 * time.Hour, 8 * time.Hour},
+			{days(time.Sunday, time.Saturday), 0, 24 * time.Hour},
+		}},
+		{spec: "mon tue 09:00-17:00", wantErr: true},
+		{spec: "funday 09:00-17:00", wantErr: true},
+		{spec: "7 09:00-17:00", wantErr: true},
+		{spec: "mon 09:00", wantErr: true},
+		{spec: "mon 9am-5pm", wantErr: true},
+		{spec: "mon 09:00-25:00", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := ParseSchedule(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseSchedule(%q) = %+v, want error", tt.spec, s)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("ParseSchedule(%q): %v", tt.spec, err)
+			}
+			if tt.want == nil {
+				if s != nil {
+					t.Errorf("ParseSchedule(%q) = %+v, want nil", tt.spec, s)
+				}
+				return
+			}
+			if want := (&Schedule{Windows: tt.want}); !s.equal(want) {
+				t.Errorf("ParseSchedule(%q) = %+v, want %+v", tt.spec, s, want)
+			}
+		})
+	}
+}
+
+func TestScheduleOpen(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		t    time.Time
+		want bool
+	}{
+		{"nil schedule", "", at(1, 12, 0), true},
+		{"inside day window", "mon-fri 09:00-17:00", at(1, 9, 0), true},
+		{"window end excluded", "mon-fri 09:00-17:00", at(1, 17, 0), false},
+		{"wrong day", "mon-fri 09:00-17:00", at(6, 12, 0), false},
+		{"overnight before midnight", "mon 22:00-06:00", at(1, 23, 0), true},
+		{"overnight after midnight", "mon 22:00-06:00", at(2, 5, 59), true},
+		{"overnight closed after end", "mon 22:00-06:00", at(2, 6, 0), false},
+		{"overnight not started the day before", "mon 22:00-06:00", at(1, 5, 0), false},
+		{"overnight wraps the week", "sun 22:00-06:00", at(8, 1, 0), true},
+		{"overnight from saturday", "sat 22:00-02:00", at(7, 1, 0), true},
+		{"whole day", "sat,sun 00:00-24:00", at(7, 23, 59), true},
+		{"whole day ends at midnight", "sun 00:00-24:00", at(8, 0, 0), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseSchedule(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Open(tt.t); got != tt.want {
+				t.Errorf("Open(%s) = %v, want %v", tt.t.Format(time.RFC1123), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleNextTransition(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		t    time.Time
+		want time.Time
+	}{
+		{"nil schedule", "", at(1, 12, 0), time.Time{}},
+		{"always open", "00:00-24:00", at(1, 12, 0), time.Time{}},
+		{"opens later today", "mon-fri 09:00-17:00", at(1, 8, 30), at(1, 9, 0)},
+		{"closes today", "mon-fri 09:00-17:00", at(1, 12, 0), at(1, 17, 0)},
+		{"opens next week", "mon-fri 09:00-17:00", at(5, 17, 0), at(8, 9, 0)},
+		{"closes after midnight", "mon 22:00-06:00", at(1, 23, 0), at(2, 6, 0)},
+		{"opens before midnight", "mon 22:00-06:00", at(1, 21, 59), at(1, 22, 0)},
+		{"closes across the week", "sun 22:00-06:00", at(7, 23, 0), at(8, 6, 0)},
+		{"opens across the week", "sun 22:00-06:00", at(8, 6, 0), at(14, 22, 0)},
+		{"rounds up to the minute", "mon-fri 09:00-17:00", at(1, 8, 59).Add(30 * time.Second), at(1, 9, 0)},
+		{"adjacent windows merge", "mon 18:00-24:00; tue 00:00-08:00", at(1, 20, 0), at(2, 8, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseSchedule(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.NextTransition(tt.t); !got.Equal(tt.want) {
+				t.Errorf("NextTransition(%s) = %s, want %s", tt.t.Format(time.RFC1123), got.Format(time.RFC1123), tt.want.Format(time.RFC1123))
+			}
+		})
+	}
+}
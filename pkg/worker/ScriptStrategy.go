@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// scriptTimeout keeps script bids inside the 3 second auction
+const scriptTimeout = 2 * time.Second
+
+// ScriptStrategy execs a user command with the json-encoded BidRequest on stdin.
+// The command must print a json-encoded ScriptResponse to stdout
+type ScriptStrategy struct {
+	Command string
+}
+
+// ScriptResponse is the output expected from a ScriptStrategy's command
+type ScriptResponse struct {
+	Rate float64 `json:"rate"`
+	Skip bool    `json:"skip"`
+}
+
+// Rate runs the command & returns its rate
+func (s *ScriptStrategy) Rate(ctx context.Context, req *BidRequest) (float64, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, scriptTimeout)
+	defer cancel()
+
+	stdin := &bytes.Buffer{}
+	if err := json.NewEncoder(stdin).Encode(req); err != nil {
+		return 0, false, fmt.Errorf("encoding bid request: %v", err)
+	}
+
+	cmd := exec.Command("/bin/sh", "-c", s.Command)
+	cmd.Stdin = stdin
+	stdout := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = os.Stderr
+	// run the script in its own process group, so the timeout kills any children holding stdout too
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return 0, false, fmt.Errorf("running bid script: %v", err)
+	}
+	waitCh := make(chan error, 1)
+	go func() {
+		waitCh <- cmd.Wait()
+	}()
+	select {
+	case err := <-waitCh:
+		if err != nil {
+			return 0, false, fmt.Errorf("running bid script: %v", err)
+		}
+	case <-ctx.Done():
+		if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+			return 0, false, fmt.Errorf("killing bid script: %v", err)
+		}
+		<-waitCh
+		return 0, false, fmt.Errorf("running bid script: %v", ctx.Err())
+	}
+
+	resp := ScriptResponse{}
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return 0, false, fmt.Errorf("decoding bid script output: %v", err)
+	}
+	if resp.Skip {
+		return 0, false, nil
+	}
+	return resp.Rate, true, nil
+}
@@ -0,0 +1,56 @@
+package worker
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScriptStrategy(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		wantRate float64
+		wantBid  bool
+		wantErr  string
+	}{
+		{"rate", `echo '{"rate": 1.5}'`, 1.5, true, ""},
+		{"reads the bid request", `grep -q '"bid_rate":2' && echo '{"rate": 3}'`, 3, true, ""},
+		{"skip", `echo '{"skip": true, "rate": 1}'`, 0, false, ""},
+		{"exit status", `exit 1`, 0, false, "running bid script"},
+		{"invalid output", `echo 'rate: 1'`, 0, false, "decoding bid script output"},
+		{"no output", `true`, 0, false, "decoding bid script output"},
+		{"timeout", `sleep 10`, 0, false, "running bid script"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseBidStrategy("script: " + tt.command)
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := time.Now()
+			rate, bid, err := s.Rate(context.Background(), &BidRequest{BidRate: 2})
+			if elapsed := time.Since(start); elapsed > scriptTimeout+time.Second {
+				t.Errorf("script ran for %s, past its %s timeout", elapsed, scriptTimeout)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Rate() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("Rate(): %v", err)
+			}
+			if rate != tt.wantRate || bid != tt.wantBid {
+				t.Errorf("Rate() = %v, %v, want %v, %v", rate, bid, tt.wantRate, tt.wantBid)
+			}
+		})
+	}
+}
+
+func TestParseBidStrategyScriptRequiresCommand(t *testing.T) {
+	if _, err := ParseBidStrategy("script:"); err == nil {
+		t.Errorf("ParseBidStrategy(\"script:\") succeeded, want error")
+	}
+}
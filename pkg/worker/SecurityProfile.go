@@ -0,0 +1,124 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/dustin/go-humanize"
+	"io/ioutil"
+)
+
+// Seccomp modes; any other SecurityProfile.Seccomp value is the path to a json profile
+const (
+	SeccompBundled        = "bundled"
+	SeccompRuntimeDefault = "runtime-default"
+	SeccompUnconfined     = "unconfined"
+)
+
+// IPC modes a SecurityProfile may use
+const (
+	IpcPrivate   = "private"
+	IpcShareable = "shareable"
+	IpcNone      = "none"
+)
+
+// scratchDirs are mounted as tmpfs when a job's root filesystem is read-only
+var scratchDirs = []string{"/tmp", "/var/tmp", "/run"}
+
+// scratchEnv points common caches & runtime dirs (which default to the read-only home dir) at scratch space
+var scratchEnv = []string{
+	"TMPDIR=/tmp",
+	"XDG_CACHE_HOME=/tmp/.cache",
+	"JUPYTER_RUNTIME_DIR=/tmp/.jupyter/runtime",
+	"IPYTHONDIR=/tmp/.ipython",
+	"MPLCONFIGDIR=/tmp/.matplotlib",
+}
+
+// SecurityProfile restricts what a job container may do beyond dropping all capabilities
+// & setting no-new-privileges, which always apply
+type SecurityProfile struct {
+	// PidsLimit caps the number of processes & threads in the container; 0 is unlimited
+	PidsLimit int64
+	// ReadOnlyRootfs mounts the container's root filesystem read-only, with tmpfs scratch space
+	ReadOnlyRootfs bool
+	// TmpfsSize caps each tmpfs scratch mount; 0 uses the runtime's default
+	TmpfsSize uint64
+	// IpcMode is IpcPrivate, IpcShareable, or IpcNone
+	IpcMode string
+	// Seccomp is SeccompBundled, SeccompRuntimeDefault, SeccompUnconfined, or the path to a json profile
+	Seccomp string
+	// AppArmor is the name of an apparmor profile loaded on the host; blank uses the runtime's default
+	AppArmor string
+}
+
+// DefaultSecurityProfile returns the hardened baseline job containers run with
+func DefaultSecurityProfile() SecurityProfile {
+	return SecurityProfile{
+		PidsLimit:      4096,
+		ReadOnlyRootfs: true,
+		TmpfsSize:      1 * 1000 * 1000 * 1000, // 1 GB
+		IpcMode:        IpcPrivate,
+		Seccomp:        SeccompBundled,
+	}
+}
+
+// Validate checks the profile's ipc mode & seccomp profile
+func (p SecurityProfile) Validate() error {
+	if p.PidsLimit < 0 {
+		return fmt.Errorf("invalid pids limit %d: must be non-negative", p.PidsLimit)
+	}
+	switch p.IpcMode {
+	case IpcPrivate, IpcShareable, IpcNone:
+	default:
+		return fmt.Errorf("invalid ipc mode %s: must be %s, %s, or %s", p.IpcMode, IpcPrivate, IpcShareable, IpcNone)
+	}
+	if _, err := p.seccompProfile(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// seccompProfile returns the json seccomp profile to apply, SeccompUnconfined, or blank
+// to use the runtime's default
+func (p SecurityProfile) seccompProfile() (string, error) {
+	switch p.Seccomp {
+	case SeccompRuntimeDefault, "":
+		return "", nil
+	case SeccompUnconfined:
+		return SeccompUnconfined, nil
+	case SeccompBundled:
+		return bundledSeccompProfile()
+	}
+
+	b, err := ioutil.ReadFile(p.Seccomp)
+	if err != nil {
+		return "", fmt.Errorf("reading seccomp profile: %v", err)
+	}
+	if !json.Valid(b) {
+		return "", fmt.Errorf("seccomp profile %s is not valid json", p.Seccomp)
+	}
+	return string(b), nil
+}
+
+func (p SecurityProfile) String() string {
+	pidsLimit, tmpfsSize, appArmor := "unlimited", "default", p.AppArmor
+	if p.PidsLimit > 0 {
+		pidsLimit = fmt.Sprintf("%d", p.PidsLimit)
+	}
+	if p.TmpfsSize > 0 {
+		tmpfsSize = humanize.Bytes(p.TmpfsSize)
+	}
+	if appArmor == "" {
+		appArmor = "runtime-default"
+	}
+	return fmt.Sprintf("pids-limit: %s, read-only-rootfs: %t, tmpfs-size: %s, ipc: %s, seccomp: %s, apparmor: %s",
+		pidsLimit, p.ReadOnlyRootfs, tmpfsSize, p.IpcMode, p.Seccomp, appArmor)
+}
+
+// tmpfsOptions returns the mount options for a tmpfs scratch mount
+func (p SecurityProfile) tmpfsOptions() string {
+	opts := "rw,nosuid,nodev"
+	if p.TmpfsSize > 0 {
+		opts += fmt.Sprintf(",size=%d", p.TmpfsSize)
+	}
+	return opts
+}
@@ -0,0 +1,93 @@
+package worker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSecurityProfileValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "emrys-seccomp-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	valid := filepath.Join(dir, "valid.json")
+	if err := ioutil.WriteFile(valid, []byte(`{"defaultAction": "SCMP_ACT_ALLOW"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := ioutil.WriteFile(invalid, []byte(`{"defaultAction": `), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	withProfile := func(f func(p *SecurityProfile)) SecurityProfile {
+		p := DefaultSecurityProfile()
+		f(&p)
+		return p
+	}
+	tests := []struct {
+		name    string
+		profile SecurityProfile
+		wantErr bool
+	}{
+		{"default", DefaultSecurityProfile(), false},
+		{"unlimited pids", withProfile(func(p *SecurityProfile) { p.PidsLimit = 0 }), false},
+		{"negative pids limit", withProfile(func(p *SecurityProfile) { p.PidsLimit = -1 }), true},
+		{"shareable ipc", withProfile(func(p *SecurityProfile) { p.IpcMode = IpcShareable }), false},
+		{"host ipc", withProfile(func(p *SecurityProfile) { p.IpcMode = "host" }), true},
+		{"runtime default seccomp", withProfile(func(p *SecurityProfile) { p.Seccomp = SeccompRuntimeDefault }), false},
+		{"unconfined seccomp", withProfile(func(p *SecurityProfile) { p.Seccomp = SeccompUnconfined }), false},
+		{"seccomp file", withProfile(func(p *SecurityProfile) { p.Seccomp = valid }), false},
+		{"invalid seccomp file", withProfile(func(p *SecurityProfile) { p.Seccomp = invalid }), true},
+		{"missing seccomp file", withProfile(func(p *SecurityProfile) { p.Seccomp = filepath.Join(dir, "missing.json") }), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.profile.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBundledSeccompProfile(t *testing.T) {
+	s, err := bundledSeccompProfile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile := seccompProfile{}
+	if err := json.Unmarshal([]byte(s), &profile); err != nil {
+		t.Fatalf("decoding bundled profile: %v", err)
+	}
+	if profile.DefaultAction != "SCMP_ACT_ERRNO" {
+		t.Errorf("default action = %s, want SCMP_ACT_ERRNO", profile.DefaultAction)
+	}
+
+	// unconditionally allowed syscalls
+	allowed := map[string]bool{}
+	for _, rule := range profile.Syscalls {
+		if rule.Action != "SCMP_ACT_ALLOW" || len(rule.Args) > 0 {
+			continue
+		}
+		for _, name := range rule.Names {
+			if allowed[name] {
+				t.Errorf("%s allowed twice", name)
+			}
+			allowed[name] = true
+		}
+	}
+	for _, name := range []string{"read", "write", "openat", "mmap", "futex", "execve", "socket", "ioctl"} {
+		if !allowed[name] {
+			t.Errorf("%s not allowed", name)
+		}
+	}
+	for _, name := range []string{"mount", "umount2", "ptrace", "bpf", "unshare", "setns", "keyctl",
+		"init_module", "kexec_load", "reboot", "clock_settime", "perf_event_open", "clone", "clone3", "personality"} {
+		if allowed[name] {
+			t.Errorf("%s allowed unconditionally", name)
+		}
+	}
+}
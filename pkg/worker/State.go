@@ -0,0 +1,233 @@
+package worker
+
+import (
+	"fmt"
+	"github.com/wminshew/emrys/pkg/job"
+	"log"
+	"time"
+)
+
+// eventBuffer is the number of events a subscriber may fall behind before events are dropped
+const eventBuffer = 16
+
+// State is a Worker's position in the job lifecycle
+type State int
+
+// Worker states, in lifecycle order
+const (
+	StateIdle State = iota
+	StateBidding
+	StateWon
+	StatePreparing
+	StateRunning
+	StateUploading
+)
+
+var stateNames = map[State]string{
+	StateIdle:      "idle",
+	StateBidding:   "bidding",
+	StateWon:       "won",
+	StatePreparing: "preparing",
+	StateRunning:   "running",
+	StateUploading: "uploading",
+}
+
+func (s State) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("state(%d)", int(s))
+}
+
+// nextStates holds the forward transitions; any state may also return to idle when
+// a bid loses or a job ends early
+var nextStates = map[State]State{
+	StateIdle:      StateBidding,
+	StateBidding:   StateWon,
+	StateWon:       StatePreparing,
+	StatePreparing: StateRunning,
+	StateRunning:   StateUploading,
+}
+
+// Event is published to subscribers on every Worker state transition
+type Event struct {
+	Device uint
+	From   State
+	To     State
+	JobID  string
+	Time   time.Time
+}
+
+// State returns the Worker's current state
+func (w *Worker) State() State {
+	w.stateMu.Lock()
+	defer w.stateMu.Unlock()
+	return w.state
+}
+
+// Busy returns true if the Worker has won a job it hasn't finished
+func (w *Worker) Busy() bool {
+	s := w.State()
+	return s != StateIdle && s != StateBidding
+}
+
+// JobID returns the ID of the job the Worker is busy with, or blank if it isn't busy
+func (w *Worker) JobID() string {
+	w.stateMu.Lock()
+	defer w.stateMu.Unlock()
+	if w.state == StateIdle || w.state == StateBidding {
+		return ""
+	}
+	return w.jobID
+}
+
+// ContainerID returns the ID of the Worker's running job container, or blank if there isn't one
+func (w *Worker) ContainerID() string {
+	w.stateMu.Lock()
+	defer w.stateMu.Unlock()
+	return w.containerID
+}
+
+// flagDiskQuotaExceeded marks the Worker's current job as having exceeded its disk allocation
+func (w *Worker) flagDiskQuotaExceeded() {
+	w.stateMu.Lock()
+	defer w.stateMu.Unlock()
+	w.diskQuotaExceeded = true
+}
+
+// takeDiskQuotaExceeded returns & clears the disk quota flag
+func (w *Worker) takeDiskQuotaExceeded() bool {
+	w.stateMu.Lock()
+	defer w.stateMu.Unlock()
+	exceeded := w.diskQuotaExceeded
+	w.diskQuotaExceeded = false
+	return exceeded
+}
+
+// JobDirs returns the host directories of the data & output of the Worker's running job, or
+// blanks if it isn't running one
+func (w *Worker) JobDirs() (string, string) {
+	w.stateMu.Lock()
+	defer w.stateMu.Unlock()
+	return w.dataDir, w.outputDir
+}
+
+func (w *Worker) setJobDirs(dataDir, outputDir string) {
+	w.stateMu.Lock()
+	defer w.stateMu.Unlock()
+	w.dataDir = dataDir
+	w.outputDir = outputDir
+}
+
+// notebookKey returns the ssh key users reach the Worker's notebook job with, & false if its
+// job isn't a notebook
+func (w *Worker) notebookKey() ([]byte, bool) {
+	w.stateMu.Lock()
+	defer w.stateMu.Unlock()
+	return w.sshKey, w.notebook
+}
+
+func (w *Worker) setNotebookKey(sshKey []byte) {
+	w.stateMu.Lock()
+	defer w.stateMu.Unlock()
+	w.sshKey = sshKey
+	w.notebook = true
+}
+
+// Snapshot returns the static properties of the Worker's gpu, read when monitoring began
+func (w *Worker) Snapshot() job.DeviceSnapshot {
+	w.stateMu.Lock()
+	defer w.stateMu.Unlock()
+	if w.snapshot == nil {
+		return job.DeviceSnapshot{}
+	}
+	return *w.snapshot
+}
+
+func (w *Worker) setContainerID(cID string) {
+	w.stateMu.Lock()
+	defer w.stateMu.Unlock()
+	w.containerID = cID
+}
+
+// Subscribe returns a channel of the Worker's state transitions & a func to unsubscribe.
+// Events are dropped if the subscriber falls more than eventBuffer events behind
+func (w *Worker) Subscribe() (<-chan Event, func()) {
+	w.stateMu.Lock()
+	defer w.stateMu.Unlock()
+	if w.subscribers == nil {
+		w.subscribers = make(map[int]chan Event)
+	}
+	id := w.nextSubscriber
+	w.nextSubscriber++
+	ch := make(chan Event, eventBuffer)
+	w.subscribers[id] = ch
+	return ch, func() {
+		w.stateMu.Lock()
+		defer w.stateMu.Unlock()
+		if _, ok := w.subscribers[id]; ok {
+			delete(w.subscribers, id)
+			close(ch)
+		}
+	}
+}
+
+// transition moves the Worker to state to. Entering StateBidding sets the Worker's job
+// to jID; other transitions ignore jID
+func (w *Worker) transition(to State, jID string) error {
+	w.stateMu.Lock()
+	defer w.stateMu.Unlock()
+	from := w.state
+	if to != StateIdle {
+		if next, ok := nextStates[from]; !ok || next != to {
+			return fmt.Errorf("invalid worker state transition %s -> %s", from, to)
+		}
+	}
+
+	w.state = to
+	if to == StateBidding {
+		w.jobID = jID
+	}
+	w.publish(from, to)
+	if to == StateIdle {
+		w.jobID = ""
+		w.containerID = ""
+		w.diskQuotaExceeded = false
+		w.sshKey = nil
+		w.notebook = false
+		w.dataDir = ""
+		w.outputDir = ""
+	}
+	return nil
+}
+
+// resume moves an idle Worker straight to running job jID, recovered after the miner restarted
+func (w *Worker) resume(jID string) error {
+	w.stateMu.Lock()
+	defer w.stateMu.Unlock()
+	if w.state != StateIdle {
+		return fmt.Errorf("invalid worker state transition %s -> %s", w.state, StateRunning)
+	}
+	w.state = StateRunning
+	w.jobID = jID
+	w.publish(StateIdle, StateRunning)
+	return nil
+}
+
+// publish must be called with stateMu held
+func (w *Worker) publish(from, to State) {
+	e := Event{
+		Device: w.Device,
+		From:   from,
+		To:     to,
+		JobID:  w.jobID,
+		Time:   time.Now(),
+	}
+	for _, ch := range w.subscribers {
+		select {
+		case ch <- e:
+		default:
+			log.Printf("Device %d: dropping %s -> %s event for slow subscriber\n", w.Device, from, to)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultUtilizationWindow = 24 * time.Hour
+
+// UtilizationStrategy scales its bid between Min & Max with the share of the
+// trailing Window the device spent running jobs: an idle device bids low to win
+// work, a device in demand bids high
+type UtilizationStrategy struct {
+	Min    float64
+	Max    float64
+	Window time.Duration
+}
+
+// ParseUtilizationStrategy parses a rate range of the form MIN-MAX
+func ParseUtilizationStrategy(args string) (*UtilizationStrategy, error) {
+	split := strings.SplitN(args, "-", 2)
+	if len(split) != 2 {
+		return nil, fmt.Errorf("invalid utilization range %s: must be MIN-MAX", args)
+	}
+	min, err := strconv.ParseFloat(strings.TrimSpace(split[0]), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid utilization range %s: %v", args, err)
+	}
+	max, err := strconv.ParseFloat(strings.TrimSpace(split[1]), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid utilization range %s: %v", args, err)
+	}
+	if min > max {
+		return nil, fmt.Errorf("invalid utilization range %s: min > max", args)
+	}
+	return &UtilizationStrategy{
+		Min:    min,
+		Max:    max,
+		Window: defaultUtilizationWindow,
+	}, nil
+}
+
+// Rate returns Min + (Max - Min) * utilization
+func (s *UtilizationStrategy) Rate(ctx context.Context, req *BidRequest) (float64, bool, error) {
+	util := utilization(req.History.Jobs, time.Now(), s.Window)
+	return s.Min + (s.Max-s.Min)*util, true, nil
+}
+
+// utilization returns the share of [now - window, now) covered by jobs
+func utilization(jobs []JobRecord, now time.Time, window time.Duration) float64 {
+	if window <= 0 {
+		return 0
+	}
+	windowStart := now.Add(-window)
+	var busy time.Duration
+	for _, j := range jobs {
+		start, end := j.Start, j.End
+		if end.IsZero() || end.After(now) {
+			end = now
+		}
+		if start.Before(windowStart) {
+			start = windowStart
+		}
+		if end.After(start) {
+			busy += end.Sub(start)
+		}
+	}
+	if busy > window {
+		return 1
+	}
+	return float64(busy) / float64(window)
+}
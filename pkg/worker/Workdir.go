@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"syscall"
+)
+
+// jobIDPattern matches the job ids that name job dirs within a workdir
+var jobIDPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// DefaultWorkdir returns ~/.emrys of the user running the miner, or of the user who invoked sudo
+func DefaultWorkdir() (string, error) {
+	home, err := userHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".emrys"), nil
+}
+
+// configDir returns the directory the Worker keeps its job records & notebook ssh-keys in, which
+// defaults to ~/.config/emrys
+func (w *Worker) configDir() (string, error) {
+	if w.ConfigDir != "" {
+		return w.ConfigDir, nil
+	}
+	home, err := userHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "emrys"), nil
+}
+
+// userHomeDir returns the home directory of the user running the miner, or of the user who invoked sudo
+func userHomeDir() (string, error) {
+	currUser, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("getting current user: %v", err)
+	}
+	if os.Geteuid() == 0 && os.Getenv("SUDO_USER") != "" {
+		currUser, err = user.Lookup(os.Getenv("SUDO_USER"))
+		if err != nil {
+			return "", fmt.Errorf("getting current sudo user: %v", err)
+		}
+	}
+	return currUser.HomeDir, nil
+}
+
+// MountPoint returns the mount point of the filesystem containing path
+func MountPoint(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	stat := syscall.Stat_t{}
+	if err := syscall.Stat(path, &stat); err != nil {
+		return "", fmt.Errorf("stat %s: %v", path, err)
+	}
+	for path != "/" {
+		parent := filepath.Dir(path)
+		parentStat := syscall.Stat_t{}
+		if err := syscall.Stat(parent, &parentStat); err != nil {
+			return "", fmt.Errorf("stat %s: %v", parent, err)
+		}
+		if parentStat.Dev != stat.Dev {
+			break
+		}
+		path = parent
+	}
+	return path, nil
+}
@@ -1,10 +1,10 @@
 package worker
 
 import (
-	docker "github.com/docker/docker/client"
 	"github.com/wminshew/emrys/pkg/job"
-	"github.com/wminshew/gonvml"
 	"net/http"
+	"sync"
+	"time"
 )
 
 const (
@@ -13,26 +13,48 @@ const (
 
 // Worker represents a GPU Worker to bid on & execute jobs
 type Worker struct {
-	MinerID           string
-	Client            *http.Client
-	Docker            *docker.Client
-	AuthToken         *string
-	BidsOut           *int
-	JobsInProcess     *int
-	Device            uint
-	gonvmlDevice      gonvml.Device
-	Snapshot          *job.DeviceSnapshot
-	Busy              bool
-	sshKey            []byte
-	notebook          bool
-	Port              string
-	JobID             string
-	ContainerID       string
-	DataDir           string
-	OutputDir         string
-	BidRate           float64
-	RAM               uint64
-	Disk              uint64
-	DiskQuotaExceeded bool
-	Miner             *CryptoMiner
+	MinerID             string
+	Client              *http.Client
+	Runtime             ContainerRuntime
+	AuthToken           *string
+	Ledger              *Ledger
+	Images              *ImageCache
+	Device              uint
+	GPU                 GPU
+	Fans                FanController
+	stateMu             sync.Mutex
+	snapshot            *job.DeviceSnapshot
+	state               State
+	jobID               string
+	containerID         string
+	diskQuotaExceeded   bool
+	subscribers         map[int]chan Event
+	nextSubscriber      int
+	sshKey              []byte
+	notebook            bool
+	dataDir             string
+	outputDir           string
+	Port                string
+	settingsMu          sync.Mutex
+	pendingSettings     *Settings
+	BidRate             float64
+	RAM                 uint64
+	Disk                uint64
+	Workdir             string
+	ConfigDir           string
+	BidStrategy         BidStrategy
+	BidSchedule         *Schedule
+	ElectricityPrice    float64
+	MiningRevenue       float64
+	BreakEvenPolicy     string
+	Security            SecurityProfile
+	NetworkPolicy       NetworkPolicy
+	OutputSyncInterval  time.Duration
+	OutputSyncThreshold uint64
+	Firewall            Firewall
+	historyMu           sync.Mutex
+	bidHistory          []BidRecord
+	jobHistory          []JobRecord
+	lastAltPowerUsage   uint
+	Miner               *CryptoMiner
 }
@@ -0,0 +1,137 @@
+package worker_test
+
+import (
+	"context"
+	"github.com/satori/go.uuid"
+	"github.com/wminshew/emrys/pkg/job"
+	"github.com/wminshew/emrysclient/pkg/fakeserver"
+	"github.com/wminshew/emrysclient/pkg/sim"
+	"github.com/wminshew/emrysclient/pkg/worker"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestWorkerConcurrentAccess reads & reconfigures a Worker from other goroutines while it wins &
+// runs a job, as the miner's monitor, config watcher & connect loop do. Run it with -race
+func TestWorkerConcurrentAccess(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "emrys-worker-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(workdir)
+	configDir, err := ioutil.TempDir("", "emrys-worker-test-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(configDir)
+	fs, err := worker.MountPoint(workdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gpu := sim.NewGPU(0)
+	runtime := sim.NewRuntime([]*sim.GPU{gpu})
+	runtime.JobDuration = time.Second
+	runtime.LogPeriod = 50 * time.Millisecond
+	srv := fakeserver.New(nil)
+	defer srv.Close()
+	authToken := srv.Scenario.Token
+	ledger := worker.NewLedger()
+	ledger.SetCapacity(1<<40, map[string]uint64{fs: 1 << 40})
+	w := &worker.Worker{
+		MinerID:         "test-miner",
+		Client:          srv.Client(),
+		Runtime:         runtime,
+		AuthToken:       &authToken,
+		Ledger:          ledger,
+		Images:          worker.NewImageCache(runtime, 0, 0),
+		GPU:             gpu,
+		Fans:            &sim.Fans{GPU: gpu},
+		BidRate:         1,
+		RAM:             1000 * 1000,
+		Disk:            1000 * 1000,
+		Workdir:         workdir,
+		ConfigDir:       configDir,
+		BreakEvenPolicy: worker.BreakEvenRaise,
+		Miner:           &worker.CryptoMiner{},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w.Miner.Init(ctx)
+	defer w.Miner.Stop()
+	if err := w.InitGPUMonitoring(); err != nil {
+		t.Fatal(err)
+	}
+	settings := w.Settings()
+	settings.ElectricityPrice = 0.1
+
+	jID, err := srv.PostJob("test", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &job.Message{Job: &job.Job{ID: uuid.FromStringOrNil(jID)}}
+	events, unsubscribe := w.Subscribe()
+	defer unsubscribe()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, f := range []func(){
+		func() { _, _ = w.JobDirs() },
+		func() { _ = w.Snapshot() },
+		func() { _ = w.BreakEvenRate(settings) },
+		func() { w.Reconfigure(settings) },
+		func() { _, _ = w.Busy(), w.JobID() },
+	} {
+		wg.Add(1)
+		go func(f func()) {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				f()
+				time.Sleep(time.Millisecond)
+			}
+		}(f)
+	}
+
+	if err := w.Bid(ctx, srv.URL(), msg, worker.JobLimits{}); err != nil {
+		t.Fatal(err)
+	}
+	ran := false
+	timeout := time.After(30 * time.Second)
+	for finished := false; !finished; {
+		select {
+		case e := <-events:
+			if e.To == worker.StateRunning {
+				ran = true
+				if dataDir, outputDir := w.JobDirs(); dataDir == "" || outputDir == "" {
+					t.Errorf("job dirs (%q, %q) blank while running", dataDir, outputDir)
+				}
+			}
+			finished = e.To == worker.StateIdle && e.From != worker.StateBidding
+		case <-timeout:
+			t.Fatalf("timed out in state %s", w.State())
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	if !ran {
+		t.Errorf("job never ran")
+	}
+	if dataDir, outputDir := w.JobDirs(); dataDir != "" || outputDir != "" {
+		t.Errorf("job dirs (%q, %q) not cleared after the job", dataDir, outputDir)
+	}
+	if got := w.Settings().ElectricityPrice; got != settings.ElectricityPrice {
+		t.Errorf("electricity price = %v, want %v", got, settings.ElectricityPrice)
+	}
+	if s := w.Snapshot(); s.Name == "" {
+		t.Errorf("snapshot has no gpu name")
+	}
+}
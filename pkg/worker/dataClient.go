@@ -0,0 +1,76 @@
+package worker
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// blockedDataNets can't serve remote data sets: besides privateNets, loopback, unspecified &
+// their IPv6 equivalents, so a job's data URLs can't reach the miner's own network
+var blockedDataNets = parseNets(append([]string{
+	"127.0.0.0/8",
+	"0.0.0.0/8",
+	"::1/128",
+	"::/128",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+}, privateNets...))
+
+// dataClient fetches remote data sets from their sources. Environment proxies are ignored, so
+// every connection it dials is checked by publicAddrOnly
+var dataClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control:   publicAddrOnly,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: time.Minute,
+		IdleConnTimeout:       90 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if req.URL.Scheme != "https" {
+			return fmt.Errorf("redirected to non-https url %s", req.URL)
+		} else if len(via) >= 10 {
+			return fmt.Errorf("stopped after 10 redirects")
+		}
+		return nil
+	},
+}
+
+// publicAddrOnly is a net.Dialer Control refusing connections to blockedDataNets. It runs
+// after name resolution, so it catches hostnames resolving to private addresses too
+func publicAddrOnly(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("dialing %s: not an ip address", address)
+	}
+	for _, n := range blockedDataNets {
+		if n.Contains(ip) {
+			return fmt.Errorf("dialing %s: private, loopback & link-local addresses not allowed", address)
+		}
+	}
+	return nil
+}
+
+// parseNets parses cidrs, panicking on an invalid one
+func parseNets(cidrs []string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
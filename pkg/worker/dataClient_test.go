@@ -0,0 +1,33 @@
+package worker
+
+import (
+	"testing"
+)
+
+func TestPublicAddrOnly(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", true},
+		{"127.0.0.1:443", false},
+		{"10.1.2.3:443", false},
+		{"172.16.0.1:443", false},
+		{"192.168.1.1:443", false},
+		{"169.254.169.254:80", false},
+		{"0.0.0.0:443", false},
+		{"[::1]:443", false},
+		{"[fe80::1]:443", false},
+		{"[fd00::1]:443", false},
+		{"[::ffff:127.0.0.1]:443", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			err := publicAddrOnly("tcp", tt.address, nil)
+			if allowed := err == nil; allowed != tt.allowed {
+				t.Errorf("publicAddrOnly(%s) = %v, want allowed %v", tt.address, err, tt.allowed)
+			}
+		})
+	}
+}
@@ -4,20 +4,43 @@ import (
 	"context"
 	"fmt"
 	"github.com/cenkalti/backoff"
-	"github.com/mholt/archiver"
 	"github.com/wminshew/emrys/pkg/check"
+	"github.com/wminshew/emrysclient/pkg/extract"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
 	"path"
+	"path/filepath"
 	"sync"
 	"time"
 )
 
+// maxDataFiles bounds the number of files in a job's data set
+const maxDataFiles = 1000000
+
+// downloadData downloads the job's data set into jobDir, from the server or, if the user gave a
+// remote data set, from its source
 func (w *Worker) downloadData(ctx context.Context, wg *sync.WaitGroup, errCh chan<- error, u url.URL, jobDir string) {
 	defer wg.Done()
-	p := path.Join("miner", "job", w.JobID)
+	d, err := w.getRemoteData(ctx, u)
+	if err != nil {
+		log.Printf("Data: error: %v", err)
+		errCh <- err
+		return
+	}
+	if d != nil {
+		log.Printf("Data: fetching %d file(s) from source...\n", len(d.Files))
+		if err := w.fetchRemoteData(ctx, d, filepath.Join(jobDir, remoteDataDir)); err != nil {
+			log.Printf("Data: error: %v", err)
+			errCh <- err
+			return
+		}
+		log.Printf("Data: downloaded!\n")
+		return
+	}
+
+	p := path.Join("miner", "job", w.JobID())
 	u.Host = "data.emrys.io"
 	u.Path = p
 	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
@@ -45,7 +68,14 @@ func (w *Worker) downloadData(ctx context.Context, wg *sync.WaitGroup, errCh cha
 		}
 
 		if resp.ContentLength != 0 {
-			if err = archiver.TarGz.Read(resp.Body, jobDir); err != nil {
+			// the data set can't be larger than the job's disk allocation
+			if err = extract.TarGz(resp.Body, jobDir, extract.Limits{
+				MaxBytes: int64(w.Settings().Disk),
+				MaxFiles: maxDataFiles,
+			}); err != nil {
+				if extract.IsUnsafe(err) {
+					return backoff.Permanent(err)
+				}
 				return fmt.Errorf("unpacking response targz into temporary job directory %v: %v", jobDir, err)
 			}
 		}
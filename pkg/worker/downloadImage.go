@@ -36,9 +36,7 @@ func (w *Worker) downloadImage(ctx context.Context, wg *sync.WaitGroup, errCh ch
 	dockerAuthStr := base64.URLEncoding.EncodeToString(dockerAuthJSON)
 
 	operation := func() error {
-		pullResp, err := w.Docker.ImagePull(ctx, refStr, types.ImagePullOptions{
-			RegistryAuth: dockerAuthStr,
-		})
+		pullResp, err := w.Runtime.ImagePull(ctx, refStr, dockerAuthStr)
 		if err != nil {
 			return err
 		}
@@ -75,7 +73,7 @@ func (w *Worker) downloadImage(ctx context.Context, wg *sync.WaitGroup, errCh ch
 		return
 	}
 
-	p := path.Join("image", "downloaded", w.JobID)
+	p := path.Join("image", "downloaded", w.JobID())
 	u.Path = p
 	req, err := http.NewRequest(http.MethodPost, u.String(), nil)
 	if err != nil {
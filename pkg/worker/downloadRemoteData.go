@@ -0,0 +1,158 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/cenkalti/backoff"
+	"github.com/wminshew/emrys/pkg/check"
+	"github.com/wminshew/emrysclient/pkg/wire"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// remoteDataDir is the name of the data directory remote data sets are fetched into
+const remoteDataDir = "data"
+
+// getRemoteData returns the remote data set of the current job, or nil if its data comes from the server
+func (w *Worker) getRemoteData(ctx context.Context, u url.URL) (*wire.RemoteData, error) {
+	u.Host = "data.emrys.io"
+	u.Path = path.Join("miner", "job", w.JobID(), "remote")
+	var d *wire.RemoteData
+	operation := func() error {
+		req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", *w.AuthToken))
+		req = req.WithContext(ctx)
+
+		resp, err := w.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer check.Err(resp.Body.Close)
+
+		if resp.StatusCode == http.StatusBadGateway {
+			return fmt.Errorf("server: temporary error")
+		} else if resp.StatusCode >= 300 {
+			b, _ := ioutil.ReadAll(resp.Body)
+			return backoff.Permanent(fmt.Errorf("server: %v", string(b)))
+		} else if resp.StatusCode == http.StatusNoContent {
+			return nil
+		}
+
+		d = &wire.RemoteData{}
+		if err := json.NewDecoder(resp.Body).Decode(d); err != nil {
+			return backoff.Permanent(fmt.Errorf("decoding remote data set: %v", err))
+		}
+		return nil
+	}
+	if err := backoff.RetryNotify(operation,
+		backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxRetries), ctx),
+		func(err error, t time.Duration) {
+			log.Printf("Data: error: %v", err)
+			log.Printf("Data: retrying in %s seconds\n", t.Round(time.Second).String())
+		}); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// fetchRemoteData downloads every file of d into dataDir from its source, verifying each against
+// the size & checksum the user locked
+func (w *Worker) fetchRemoteData(ctx context.Context, d *wire.RemoteData, dataDir string) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	for _, f := range d.Files {
+		// s3:// & gs:// URLs are presigned by the user, so only https reaches the miner
+		if u, _ := url.Parse(f.URL); u.Scheme != "https" {
+			return fmt.Errorf("invalid url of data file %q: must be https", f.Path)
+		}
+	}
+	// the data set can't be larger than the job's disk allocation
+	if disk := w.Settings().Disk; uint64(d.Size()) > disk {
+		return fmt.Errorf("data set (%d bytes) larger than disk allocation (%d bytes)", d.Size(), disk)
+	}
+	if len(d.Files) > maxDataFiles {
+		return fmt.Errorf("data set has too many files (%d > %d)", len(d.Files), maxDataFiles)
+	}
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return fmt.Errorf("making data dir %s: %v", dataDir, err)
+	}
+
+	for _, f := range d.Files {
+		f := f
+		p := filepath.Join(dataDir, filepath.FromSlash(f.Path))
+		operation := func() error {
+			return w.fetchRemoteFile(ctx, f, p)
+		}
+		if err := backoff.RetryNotify(operation,
+			backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxRetries), ctx),
+			func(err error, t time.Duration) {
+				log.Printf("Data: error fetching %s: %v", f.Path, err)
+				log.Printf("Data: retrying in %s seconds\n", t.Round(time.Second).String())
+			}); err != nil {
+			return fmt.Errorf("fetching %s: %v", f.Path, err)
+		}
+		log.Printf("Data: fetched %s\n", f.Path)
+	}
+	return nil
+}
+
+// fetchRemoteFile downloads f to p, removing it unless its size & checksum match
+func (w *Worker) fetchRemoteFile(ctx context.Context, f wire.RemoteFile, p string) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return backoff.Permanent(err)
+	}
+	req, err := http.NewRequest(http.MethodGet, f.URL, nil)
+	if err != nil {
+		return backoff.Permanent(err)
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := dataClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer check.Err(resp.Body.Close)
+	if resp.StatusCode >= 300 {
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		err := fmt.Errorf("source: %d: %s", resp.StatusCode, string(b))
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return backoff.Permanent(err)
+		}
+		return err
+	}
+
+	file, err := os.OpenFile(p, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return backoff.Permanent(err)
+	}
+	h := sha256.New()
+	// read one byte past the locked size, so a longer file is caught without filling the disk
+	n, err := io.Copy(io.MultiWriter(file, h), io.LimitReader(resp.Body, f.Size+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		check.Err(func() error { return os.Remove(p) })
+		return err
+	}
+	if n != f.Size || hex.EncodeToString(h.Sum(nil)) != f.SHA256 {
+		check.Err(func() error { return os.Remove(p) })
+		return backoff.Permanent(fmt.Errorf("doesn't match its lock (size %d, sha256 %s): source changed since it was locked",
+			f.Size, f.SHA256))
+	}
+	return nil
+}
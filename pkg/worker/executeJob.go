@@ -2,27 +2,14 @@ package worker
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"github.com/cenkalti/backoff"
-	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/container"
-	// "github.com/docker/docker/api/types/filters"
-	"github.com/docker/go-connections/nat"
-	"github.com/mholt/archiver"
 	"github.com/wminshew/emrys/pkg/check"
-	"github.com/wminshew/emrysclient/pkg/poll"
-	"io"
 	"io/ioutil"
 	"log"
-	"net/http"
 	"net/url"
 	"os"
-	"os/user"
-	"path"
 	"path/filepath"
 	"strconv"
-	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -33,18 +20,17 @@ var (
 	shmSize    = int64(1 * 1000 * 1000 * 1000) // 1 GB
 )
 
-func (w *Worker) executeJob(ctx context.Context, u url.URL, jID string) {
-	w.JobID = jID
-	w.Busy = true
-	defer func() {
-		w.Busy = false
-		w.JobID = ""
-		w.sshKey = []byte{}
-		w.notebook = false
-	}()
-	*w.JobsInProcess++
-	defer func() { *w.JobsInProcess-- }()
+func (w *Worker) executeJob(ctx context.Context, u url.URL, jID string, res *Reservation) {
+	defer w.finishJob()
+	// release the reservation before going idle, so the Worker's next bid can use it
+	defer res.Release()
+	w.recordJobStart(jID)
+	defer w.recordJobEnd(jID)
 	dStr := strconv.Itoa(int(w.Device))
+	if err := w.transition(StatePreparing, ""); err != nil {
+		log.Printf("Device %s: %v", dStr, err)
+		return
+	}
 	if err := check.ContextCanceled(ctx); err != nil {
 		log.Printf("Device %s: miner canceled job execution: %v", dStr, err)
 		return
@@ -52,97 +38,12 @@ func (w *Worker) executeJob(ctx context.Context, u url.URL, jID string) {
 	w.Miner.Stop()
 	defer w.Miner.Start()
 
-	jobFinished := make(chan struct{})
-	defer func() {
-		close(jobFinished)
-	}()
-	jobCanceled := make(chan struct{})
-	go func(u url.URL) {
-		// poll to check if job is canceled
-		p := path.Join("job", w.JobID, "cancel")
-		u.Path = p
-		q := u.Query()
-		q.Set("timeout", fmt.Sprintf("%d", maxTimeout))
-		buffer := int64(10)
-		sinceTime := (time.Now().Unix() - buffer) * 1000
-		q.Set("since_time", fmt.Sprintf("%d", sinceTime))
-		u.RawQuery = q.Encode()
-		for {
-			if err := check.ContextCanceled(ctx); err != nil {
-				log.Printf("Device %s: miner canceled job execution: %v", dStr, err)
-				return
-			}
-			select {
-			case <-jobFinished:
-				return
-			default:
-			}
-			pr := poll.Response{}
-			operation := func() error {
-				req, err := http.NewRequest(http.MethodGet, u.String(), nil)
-				if err != nil {
-					return err
-				}
-				req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", *w.AuthToken))
-				req = req.WithContext(ctx)
-
-				resp, err := w.Client.Do(req)
-				if err != nil {
-					return err
-				}
-				defer check.Err(resp.Body.Close)
-
-				if resp.StatusCode == http.StatusBadGateway {
-					return fmt.Errorf("server: temporary error")
-				} else if resp.StatusCode >= 300 {
-					b, _ := ioutil.ReadAll(resp.Body)
-					return fmt.Errorf("server: %v", string(b))
-				}
-
-				if err := json.NewDecoder(resp.Body).Decode(&pr); err != nil {
-					return fmt.Errorf("decoding response: %v", err)
-				}
-
-				return nil
-			}
-			if err := backoff.RetryNotify(operation,
-				backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxRetries), ctx),
-				func(err error, t time.Duration) {
-					log.Printf("Device %s: error polling job canceled: %v", dStr, err)
-					log.Printf("Device %s: retrying in %s seconds\n", dStr, t.Round(time.Second).String())
-				}); err != nil {
-				log.Printf("Device %s: error polling job canceled: %v", dStr, err)
-			}
-
-			if len(pr.Events) > 0 {
-				close(jobCanceled)
-				return
-			}
-
-			if pr.Timestamp > sinceTime {
-				sinceTime = pr.Timestamp
-			}
-
-			q = u.Query()
-			q.Set("since_time", fmt.Sprintf("%d", sinceTime))
-			u.RawQuery = q.Encode()
-		}
-	}(u)
+	jobCanceled, stopPolling := w.pollJobCanceled(ctx, u, jID, time.Now().Add(-10*time.Second))
+	defer stopPolling()
 
-	currUser, err := user.Current()
-	if err != nil {
-		log.Printf("Device %s: error getting current user: %v", dStr, err)
-		return
-	}
-	if os.Geteuid() == 0 && os.Getenv("SUDO_USER") != "" {
-		currUser, err = user.Lookup(os.Getenv("SUDO_USER"))
-		if err != nil {
-			log.Printf("Device %s: error getting current sudo user: %v", dStr, err)
-			return
-		}
-	}
-	jobDir := filepath.Join(currUser.HomeDir, ".emrys", w.JobID)
-	if err = os.MkdirAll(jobDir, 0755); err != nil {
+	settings := w.Settings()
+	jobDir := filepath.Join(settings.Workdir, jID)
+	if err := os.MkdirAll(jobDir, 0755); err != nil {
 		log.Printf("Device %s: error making job dir %v: %v", dStr, jobDir, err)
 		return
 	}
@@ -166,22 +67,14 @@ func (w *Worker) executeJob(ctx context.Context, u url.URL, jID string) {
 
 	registry := "registry.emrys.io"
 	repo := "miner"
-	imgRefStr := fmt.Sprintf("%s/%s/%s:latest", registry, repo, w.JobID)
+	imgRefStr := fmt.Sprintf("%s/%s/%s:latest", registry, repo, jID)
+	w.Images.Acquire(imgRefStr)
 	go w.downloadImage(ctx, &wg, errCh, u, imgRefStr)
 	defer func() {
-		ctx := context.Background()
-		log.Printf("Device %s: removing image...\n", dStr)
-		if _, err := w.Docker.ImageRemove(ctx, imgRefStr, types.ImageRemoveOptions{
-			Force: true,
-		}); err != nil {
-			log.Printf("Device %s: error removing job image %v: %v", dStr, w.JobID, err)
+		w.Images.Release(imgRefStr)
+		if err := w.Images.Evict(context.Background()); err != nil {
+			log.Printf("Device %s: error evicting cached images: %v", dStr, err)
 		}
-		// TODO: may need to prune danglings; will have to monitor
-		// filter := filters.Args{}
-		// filter.Add("dangling", "true")
-		// if _, err := w.Docker.ImagesPrune(ctx, filter); err != nil {
-		// 	log.Printf("Device %s: error pruning build cache: %v", dStr, err)
-		// }
 	}()
 
 	go w.downloadData(ctx, &wg, errCh, u, jobDir)
@@ -219,18 +112,15 @@ func (w *Worker) executeJob(ctx context.Context, u url.URL, jID string) {
 			return
 		}
 	}
-	w.DataDir = hostDataDir
-	defer func() { w.DataDir = "" }()
 
-	// sizeDataDir, err := GetDirSize(w.DataDir)
-	// if err != nil {
-	// 	log.Printf("Device %s: error getting directory size: data folder: %v", dStr, err)
-	// 	return
-	// }
+	sizeDataDir, err := GetDirSize(hostDataDir)
+	if err != nil {
+		log.Printf("Device %s: error getting directory size: data folder: %v", dStr, err)
+		return
+	}
 
 	hostOutputDir := filepath.Join(jobDir, "output")
-	w.OutputDir = hostOutputDir
-	defer func() { w.OutputDir = "" }()
+	w.setJobDirs(hostDataDir, hostOutputDir)
 
 	oldUMask := syscall.Umask(000)
 	if err := filepath.Walk(hostDataDir, func(path string, info os.FileInfo, err error) error {
@@ -267,69 +157,59 @@ func (w *Worker) executeJob(ctx context.Context, u url.URL, jID string) {
 	// // chances of triggering this are very low though, fine for now
 	// defer check.Err(func() error { return os.Unsetenv("NVIDIA_VISIBLE_DEVICES") })
 
-	var exposedPorts nat.PortSet
-	var portBindings nat.PortMap
-	if w.notebook {
-		exposedPorts = nat.PortSet{
-			"8888/tcp": struct{}{},
-		}
-		portBindings = nat.PortMap{
-			"8888/tcp": []nat.PortBinding{
-				nat.PortBinding{
-					HostIP:   "0.0.0.0",
-					HostPort: w.Port,
-				},
-			},
-		}
+	jobDirQuota, rootfsQuota := splitDiskQuota(settings.Disk, sizeDataDir)
+	if clearQuota, err := setProjectQuota(jobDir, uint32(w.Device), jobDirQuota); err != nil {
+		log.Printf("Device %s: error setting job dir disk quota, relying on disk watchdog: %v", dStr, err)
+	} else if clearQuota != nil {
+		defer func() {
+			if err := clearQuota(); err != nil {
+				log.Printf("Device %s: error clearing job dir disk quota: %v", dStr, err)
+			}
+		}()
 	}
-	c, err := w.Docker.ContainerCreate(ctx, &container.Config{
-		ExposedPorts: exposedPorts,
-		Image:        imgRefStr,
-		Tty:          true,
-	}, &container.HostConfig{
-		Binds: []string{
-			fmt.Sprintf("%s:%s:rw", hostDataDir, dockerDataDir),
-			fmt.Sprintf("%s:%s:rw", hostOutputDir, dockerOutputDir),
-		},
-		CapDrop: []string{
-			"ALL",
-		},
-		// IpcMode:      "private", TODO?
-		PortBindings: portBindings,
-		// ReadonlyPaths: []string{}, TODO?
-		Resources: container.Resources{
-			// DiskQuota: int64(w.Disk) - sizeDataDir,
-			DeviceRequests: []container.DeviceRequest{
-				container.DeviceRequest{
-					DeviceIDs:    []string{dStr},
-					Capabilities: [][]string{[]string{"gpu"}},
-				},
-			},
-			Memory:     int64(w.RAM),
-			MemorySwap: int64(w.RAM),
-			// PidsLimit:  &pidsLimit, TODO
-		},
-		SecurityOpt: []string{
-			"no-new-privileges",
+	network, err := w.prepareNetwork(ctx, settings.NetworkPolicy)
+	if err != nil {
+		log.Printf("Device %s: error preparing job network: %v", dStr, err)
+		return
+	}
+
+	spec := &ContainerSpec{
+		Image:              imgRefStr,
+		Device:             dStr,
+		HostDataDir:        hostDataDir,
+		ContainerDataDir:   dockerDataDir,
+		HostOutputDir:      hostOutputDir,
+		ContainerOutputDir: dockerOutputDir,
+		Memory:             int64(settings.RAM),
+		ShmSize:            shmSize,
+		DiskQuota:          rootfsQuota,
+		Network:            network,
+		Security:           settings.Security,
+		Labels: map[string]string{
+			labelJob:    jID,
+			labelDevice: dStr,
+			labelMiner:  w.MinerID,
 		},
-		ShmSize: shmSize,
-		// StorageOpt: map[string]string{ TODO?
-		// 	"size", "120gb"
-		// },
-	}, nil, "")
+	}
+	_, notebook := w.notebookKey()
+	if notebook {
+		if network == NetworkNone {
+			log.Printf("Device %s: notebook can't be reached under network policy %s", dStr, NetworkNone)
+		}
+		spec.NotebookPort = w.Port
+	}
+	cID, err := w.Runtime.ContainerCreate(ctx, spec)
 	if err != nil {
 		log.Printf("Device %s: error creating container: %v", dStr, err)
 		return
 	}
-	w.ContainerID = c.ID
-	defer func() { w.ContainerID = "" }()
+	w.setContainerID(cID)
+	defer w.setContainerID("")
 	defer func() {
 		ctx := context.Background()
 		log.Printf("Device %s: removing container...\n", dStr)
-		if err := w.Docker.ContainerRemove(ctx, c.ID, types.ContainerRemoveOptions{
-			Force: true,
-		}); err != nil {
-			log.Printf("Device %s: error removing job container %v: %v", dStr, w.JobID, err)
+		if err := w.Runtime.ContainerRemove(ctx, cID); err != nil {
+			log.Printf("Device %s: error removing job container %v: %v", dStr, jID, err)
 		}
 	}()
 
@@ -339,248 +219,38 @@ func (w *Worker) executeJob(ctx context.Context, u url.URL, jID string) {
 	}
 
 	log.Printf("Device %s: running container...\n", dStr)
-	if err := w.Docker.ContainerStart(ctx, c.ID, types.ContainerStartOptions{}); err != nil {
+	if err := w.Runtime.ContainerStart(ctx, cID); err != nil {
 		log.Printf("Device %s: error starting container: %v", dStr, err)
 		return
 	}
-
-	out, err := w.Docker.ContainerLogs(ctx, c.ID, types.ContainerLogsOptions{
-		Follow:     true,
-		ShowStdout: true,
-		ShowStderr: true,
-	})
-	if err != nil {
-		log.Printf("Device %s: error logging container: %v", dStr, err)
+	if err := w.transition(StateRunning, ""); err != nil {
+		log.Printf("Device %s: %v", dStr, err)
 		return
 	}
-	defer check.Err(out.Close)
 
-	if w.notebook {
-		log.Printf("Device %s: forwarding port...\n", dStr)
-		sshCmd := w.sshRemoteForward(ctx, sshKeyFile)
-		if err = sshCmd.Start(); err != nil {
-			log.Printf("Device %s: error remote forwarding notebook requests: %v", dStr, err)
-			return
-		}
-		defer func() {
-			if err := sshCmd.Process.Kill(); err != nil {
-				log.Printf("Device %s: error killing remote forwarding process: %v", dStr, err)
-				return
-			}
-		}()
+	rec := &jobRecord{
+		JobID:       jID,
+		MinerID:     w.MinerID,
+		Device:      w.Device,
+		ContainerID: cID,
+		Image:       imgRefStr,
+		JobDir:      jobDir,
+		DataDir:     hostDataDir,
+		OutputDir:   hostOutputDir,
+		RAM:         settings.RAM,
+		Disk:        settings.Disk,
+		JobDirQuota: jobDirQuota,
+		Notebook:    notebook,
+		Started:     time.Now(),
 	}
-
-	log.Printf("Device %s: uploading log...\n", dStr)
-	logStrCh := make(chan string)
-	logErrCh := make(chan error)
-	go func() {
-		body := make([]byte, 4096)
-		for {
-			n, err := out.Read(body)
-			if err != nil {
-				logErrCh <- err
-				return
-			}
-			logStrCh <- string(body[:n])
-		}
-	}()
-
-	var operation func() error
-	jCanceled := false
-	p := path.Join("job", w.JobID, "log")
-	u.Path = p
-loop:
-	for {
-		select {
-		case <-jobCanceled:
-			log.Printf("Device %s: job canceled by user...\n", dStr)
-			jCanceled = true
-			operation := func() error {
-				var body *strings.Reader
-				if w.DiskQuotaExceeded {
-					defer func() { w.DiskQuotaExceeded = false }()
-					body = strings.NewReader("JOB CANCELED: USER EXCEEDED DISK QUOTA\n")
-				} else {
-					body = strings.NewReader("JOB CANCELED BY USER.\n")
-				}
-
-				req, err := http.NewRequest(http.MethodPost, u.String(), body)
-				if err != nil {
-					return err
-				}
-				req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", *w.AuthToken))
-				req = req.WithContext(ctx)
-
-				resp, err := w.Client.Do(req)
-				if err != nil {
-					return err
-				}
-				defer check.Err(resp.Body.Close)
-
-				if resp.StatusCode == http.StatusBadGateway {
-					return fmt.Errorf("server: temporary error")
-				} else if resp.StatusCode >= 300 {
-					b, _ := ioutil.ReadAll(resp.Body)
-					return fmt.Errorf("server: %v", string(b))
-				}
-
-				return nil
-			}
-			if err := backoff.RetryNotify(operation,
-				backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxRetries), ctx),
-				func(err error, t time.Duration) {
-					log.Printf("Device %s: error uploading output: %v", dStr, err)
-					log.Printf("Device %s: retrying in %s seconds\n", dStr, t.Round(time.Second).String())
-				}); err != nil {
-				log.Printf("Device %s: error uploading output: %v", dStr, err)
-				return
-			}
-
-			goto FinishLogAndUploadData
-		case err := <-logErrCh:
-			if err != io.EOF {
-				log.Printf("Device %s: error reading container logs: %v", dStr, err)
-				return
-			}
-			break loop
-		case logStr := <-logStrCh:
-			if err := check.ContextCanceled(ctx); err != nil {
-				log.Printf("Device %s: miner canceled job execution: %v", dStr, err)
-				return
-			}
-			operation := func() error {
-				req, err := http.NewRequest(http.MethodPost, u.String(), strings.NewReader(logStr))
-				if err != nil {
-					return err
-				}
-				req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", *w.AuthToken))
-				req = req.WithContext(ctx)
-
-				resp, err := w.Client.Do(req)
-				if err != nil {
-					return err
-				}
-				defer check.Err(resp.Body.Close)
-
-				if resp.StatusCode == http.StatusBadGateway {
-					return fmt.Errorf("server: temporary error")
-				} else if resp.StatusCode >= 300 {
-					b, _ := ioutil.ReadAll(resp.Body)
-					return fmt.Errorf("server: %v", string(b))
-				}
-
-				return nil
-			}
-			if err := backoff.RetryNotify(operation,
-				backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxRetries), ctx),
-				func(err error, t time.Duration) {
-					log.Printf("Device %s: error uploading output: %v", dStr, err)
-					log.Printf("Device %s: retrying in %s seconds\n", dStr, t.Round(time.Second).String())
-				}); err != nil {
-				log.Printf("Device %s: error uploading output: %v", dStr, err)
-				return
-			}
-		}
-	}
-
-FinishLogAndUploadData:
-	operation = func() error {
-		// POST with empty body signifies log upload complete
-		req, err := http.NewRequest(http.MethodPost, u.String(), nil)
-		if err != nil {
-			return err
-		}
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", *w.AuthToken))
-
-		resp, err := w.Client.Do(req)
-		if err != nil {
-			return err
-		}
-		defer check.Err(resp.Body.Close)
-
-		if resp.StatusCode == http.StatusBadGateway {
-			return fmt.Errorf("server: temporary error")
-		} else if resp.StatusCode >= 300 {
-			b, _ := ioutil.ReadAll(resp.Body)
-			return fmt.Errorf("server: %v", string(b))
-		}
-
-		return nil
-	}
-	if err := backoff.RetryNotify(operation,
-		backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxRetries), ctx),
-		func(err error, t time.Duration) {
-			log.Printf("Device %s: error uploading output: %v", dStr, err)
-			log.Printf("Device %s: retrying in %s seconds\n", dStr, t.Round(time.Second).String())
-		}); err != nil {
-		log.Printf("Device %s: error uploading output: %v", dStr, err)
-		return
-	}
-	log.Printf("Device %s: log uploaded!\n", dStr)
-
-	if err := check.ContextCanceled(ctx); err != nil {
-		log.Printf("Device %s: miner canceled job execution: %v", dStr, err)
-		return
+	if err := w.saveJobRecord(rec); err != nil {
+		log.Printf("Device %s: error saving job record; job can't be recovered if the miner restarts: %v", dStr, err)
 	}
-	log.Printf("Device %s: uploading data...\n", dStr)
-	p = path.Join("job", w.JobID, "data")
-	u.Path = p
-	if jCanceled {
-		q := u.Query()
-		q.Set("jobcanceled", "1")
-		u.RawQuery = q.Encode()
-	}
-	operation = func() error {
-		pr, pw := io.Pipe()
-		go func() {
-			defer check.Err(pw.Close)
-			files, err := ioutil.ReadDir(hostOutputDir)
-			outputFiles := make([]string, 0, len(files))
-			if err != nil {
-				log.Printf("Device %s: error uploading output: reading files in output directory %v: %v\n", dStr, hostOutputDir, err)
-				return
-			}
-			for _, file := range files {
-				outputFile := filepath.Join(hostOutputDir, file.Name())
-				outputFiles = append(outputFiles, outputFile)
-			}
-			if err = archiver.TarGz.Write(pw, outputFiles); err != nil {
-				log.Printf("Device %s: error uploading output: packing output directory %v: %v\n", dStr, hostOutputDir, err)
-				return
-			}
-		}()
-
-		req, err := http.NewRequest(http.MethodPost, u.String(), pr)
-		if err != nil {
-			return err
-		}
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", *w.AuthToken))
-		req = req.WithContext(ctx)
-
-		resp, err := w.Client.Do(req)
-		if err != nil {
-			return err
-		}
-		defer check.Err(resp.Body.Close)
-
-		if resp.StatusCode == http.StatusBadGateway {
-			return fmt.Errorf("server: temporary error")
-		} else if resp.StatusCode >= 300 {
-			b, _ := ioutil.ReadAll(resp.Body)
-			return fmt.Errorf("server: %v", string(b))
+	defer func() {
+		if err := w.removeJobRecord(); err != nil {
+			log.Printf("Device %s: %v", dStr, err)
 		}
+	}()
 
-		return nil
-	}
-	if err := backoff.RetryNotify(operation,
-		backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxRetries), ctx),
-		func(err error, t time.Duration) {
-			log.Printf("Device %s: error uploading output: %v", dStr, err)
-			log.Printf("Device %s: retrying in %s seconds\n", dStr, t.Round(time.Second).String())
-		}); err != nil {
-		log.Printf("Device %s: error uploading output: %v", dStr, err)
-		return
-	}
-
-	log.Printf("Device %s: job completed!\n", dStr)
+	w.runJob(ctx, u, rec, jobCanceled, sshKeyFile)
 }
@@ -0,0 +1,46 @@
+package worker
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// ShipLog ships chunks of job jID's log through a logShipper, continuing from batch logSeq, &
+// returns the job record's sequence & log offset once the shipper closes
+func (w *Worker) ShipLog(ctx context.Context, u url.URL, jID string, logSeq int64, chunks []string) (int64, int64, error) {
+	rec := &jobRecord{JobID: jID, LogSeq: logSeq}
+	s := w.newLogShipper(ctx, u, rec)
+	for _, c := range chunks {
+		if err := s.send(ctx, c, true); err != nil {
+			return rec.LogSeq, rec.LogOffset, err
+		}
+	}
+	err := s.close()
+	return rec.LogSeq, rec.LogOffset, err
+}
+
+// LogBatchSize is the size at which the logShipper ships a batch early
+const LogBatchSize = logBatchSize
+
+// SavedJob is the record the Worker keeps of its running job so the job can be recovered
+type SavedJob = jobRecord
+
+// SaveJob saves rec as the Worker's job record
+func (w *Worker) SaveJob(rec *SavedJob) error {
+	return w.saveJobRecord(rec)
+}
+
+// LoadJob returns the Worker's job record, or nil if it has none
+func (w *Worker) LoadJob() (*SavedJob, error) {
+	return w.loadJobRecord()
+}
+
+// JobLabels returns the labels of the container of job jID on device d of miner mID
+func JobLabels(mID, jID string, d uint) map[string]string {
+	return map[string]string{
+		labelJob:    jID,
+		labelDevice: strconv.Itoa(int(d)),
+		labelMiner:  mID,
+	}
+}
@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"time"
+)
+
+// maxHistory bounds the bids & jobs a Worker remembers
+const maxHistory = 100
+
+func (w *Worker) recordBid(r BidRecord) {
+	w.historyMu.Lock()
+	defer w.historyMu.Unlock()
+	w.bidHistory = append(w.bidHistory, r)
+	if len(w.bidHistory) > maxHistory {
+		w.bidHistory = w.bidHistory[len(w.bidHistory)-maxHistory:]
+	}
+}
+
+func (w *Worker) recordJobStart(jID string) {
+	w.historyMu.Lock()
+	defer w.historyMu.Unlock()
+	w.jobHistory = append(w.jobHistory, JobRecord{
+		JobID: jID,
+		Start: time.Now(),
+	})
+	if len(w.jobHistory) > maxHistory {
+		w.jobHistory = w.jobHistory[len(w.jobHistory)-maxHistory:]
+	}
+}
+
+func (w *Worker) recordJobEnd(jID string) {
+	w.historyMu.Lock()
+	defer w.historyMu.Unlock()
+	for i := len(w.jobHistory) - 1; i >= 0; i-- {
+		if w.jobHistory[i].JobID == jID {
+			w.jobHistory[i].End = time.Now()
+			return
+		}
+	}
+}
+
+// history returns a copy of the Worker's recent bids & jobs
+func (w *Worker) history() History {
+	w.historyMu.Lock()
+	defer w.historyMu.Unlock()
+	return History{
+		Bids: append([]BidRecord{}, w.bidHistory...),
+		Jobs: append([]JobRecord{}, w.jobHistory...),
+	}
+}
+
+func (w *Worker) recordAltPowerUsage(powerUsage uint) {
+	w.historyMu.Lock()
+	defer w.historyMu.Unlock()
+	w.lastAltPowerUsage = powerUsage
+}
+
+// altPowerUsage returns the average power (mW) last sampled while the Worker was between jobs
+func (w *Worker) altPowerUsage() uint {
+	w.historyMu.Lock()
+	defer w.historyMu.Unlock()
+	return w.lastAltPowerUsage
+}
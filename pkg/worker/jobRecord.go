@@ -0,0 +1,99 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// labels identifying the job, device & miner of a job container
+const (
+	labelJob    = "io.emrys.job"
+	labelDevice = "io.emrys.device"
+	labelMiner  = "io.emrys.miner"
+)
+
+// jobRecord is the local state of a running job, saved so the job can be recovered if the miner restarts
+type jobRecord struct {
+	JobID       string `json:"job_id"`
+	MinerID     string `json:"miner_id"`
+	Device      uint   `json:"device"`
+	ContainerID string `json:"container_id"`
+	Image       string `json:"image"`
+	JobDir      string `json:"job_dir"`
+	DataDir     string `json:"data_dir"`
+	OutputDir   string `json:"output_dir"`
+	RAM         uint64 `json:"ram"`
+	Disk        uint64 `json:"disk"`
+	// JobDirQuota is the part of Disk the job dir's project quota allows
+	JobDirQuota uint64    `json:"job_dir_quota"`
+	Notebook    bool      `json:"notebook"`
+	Started     time.Time `json:"started"`
+	// LogOffset is the number of bytes of the container's log already uploaded
+	LogOffset int64 `json:"log_offset"`
+	// LogSeq is the sequence number of the last log batch the server acknowledged
+	LogSeq int64 `json:"log_seq"`
+}
+
+// jobRecordFile returns the path of the Worker's job record
+func (w *Worker) jobRecordFile() (string, error) {
+	dir, err := w.configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "jobs", fmt.Sprintf("device-%d.json", w.Device)), nil
+}
+
+// saveJobRecord atomically replaces the Worker's job record with rec
+func (w *Worker) saveJobRecord(rec *jobRecord) error {
+	p, err := w.jobRecordFile()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return fmt.Errorf("making directory %s: %v", filepath.Dir(p), err)
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("encoding job record: %v", err)
+	}
+	tmp := p + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return fmt.Errorf("writing job record %s: %v", tmp, err)
+	}
+	return os.Rename(tmp, p)
+}
+
+// loadJobRecord returns the Worker's job record, or nil if it has none
+func (w *Worker) loadJobRecord() (*jobRecord, error) {
+	p, err := w.jobRecordFile()
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading job record %s: %v", p, err)
+	}
+	rec := &jobRecord{}
+	if err := json.Unmarshal(b, rec); err != nil {
+		return nil, fmt.Errorf("decoding job record %s: %v", p, err)
+	}
+	return rec, nil
+}
+
+// removeJobRecord removes the Worker's job record, if any
+func (w *Worker) removeJobRecord() error {
+	p, err := w.jobRecordFile()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing job record %s: %v", p, err)
+	}
+	return nil
+}
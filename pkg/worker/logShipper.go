@@ -0,0 +1,156 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+)
+
+const (
+	// logBatchSize is the number of bytes of log coalesced before a batch is shipped early
+	logBatchSize = 64 * 1024
+	// logFlushPeriod is the longest log output waits to be shipped
+	logFlushPeriod = 1 * time.Second
+	// logBufferChunks is the number of chunks buffered before writers block on the shipper
+	logBufferChunks = 256
+)
+
+// logChunk is a piece of a job's log
+type logChunk struct {
+	data string
+	// container is true if data was read from the job container's log, rather than written by the miner
+	container bool
+}
+
+// logShipper coalesces a job's log into batches by size & time & uploads them in order. Each
+// batch carries a sequence number so the server can drop the duplicates retries may deliver.
+// Writers block once logBufferChunks chunks are waiting to be shipped
+type logShipper struct {
+	w      *Worker
+	u      url.URL
+	rec    *jobRecord
+	chunks chan logChunk
+	closeC chan struct{}
+	doneC  chan struct{}
+	err    error
+}
+
+// newLogShipper starts shipping the log of job rec. Batches continue from rec.LogSeq, & rec's
+// sequence & log offset are saved as batches are acknowledged
+func (w *Worker) newLogShipper(ctx context.Context, u url.URL, rec *jobRecord) *logShipper {
+	s := &logShipper{
+		w:      w,
+		u:      u,
+		rec:    rec,
+		chunks: make(chan logChunk, logBufferChunks),
+		closeC: make(chan struct{}),
+		doneC:  make(chan struct{}),
+	}
+	go s.run(ctx)
+	return s
+}
+
+// send queues data to be shipped, blocking while the buffer is full
+func (s *logShipper) send(ctx context.Context, data string, container bool) error {
+	select {
+	case s.chunks <- logChunk{data: data, container: container}:
+		return nil
+	case <-s.doneC:
+		if s.err != nil {
+			return s.err
+		}
+		return fmt.Errorf("log shipper closed")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// done is closed once the shipper stops, either because it was closed or failed to ship a batch
+func (s *logShipper) done() <-chan struct{} {
+	return s.doneC
+}
+
+// close ships everything sent so far & stops the shipper, returning the first error shipping the log
+func (s *logShipper) close() error {
+	select {
+	case s.closeC <- struct{}{}:
+	case <-s.doneC:
+	}
+	<-s.doneC
+	return s.err
+}
+
+func (s *logShipper) run(ctx context.Context) {
+	defer close(s.doneC)
+	var batch bytes.Buffer
+	var containerBytes int64
+	timer := time.NewTimer(logFlushPeriod)
+	timer.Stop()
+	defer timer.Stop()
+
+	add := func(c logChunk) {
+		if batch.Len() == 0 {
+			timer.Reset(logFlushPeriod)
+		}
+		batch.WriteString(c.data)
+		if c.container {
+			containerBytes += int64(len(c.data))
+		}
+	}
+	flush := func() error {
+		timer.Stop()
+		if batch.Len() == 0 {
+			return nil
+		}
+		seq := s.rec.LogSeq + 1
+		if err := s.w.postLog(ctx, s.u, s.rec.JobID, batch.String(), seq); err != nil {
+			return err
+		}
+		s.rec.LogSeq = seq
+		s.rec.LogOffset += containerBytes
+		if err := s.w.saveJobRecord(s.rec); err != nil {
+			log.Printf("Device %d: error saving job record: %v", s.w.Device, err)
+		}
+		batch.Reset()
+		containerBytes = 0
+		return nil
+	}
+
+	for {
+		select {
+		case c := <-s.chunks:
+			add(c)
+			if batch.Len() < logBatchSize {
+				continue
+			}
+		case <-timer.C:
+		case <-ctx.Done():
+			s.err = ctx.Err()
+			return
+		case <-s.closeC:
+		drain:
+			for {
+				select {
+				case c := <-s.chunks:
+					add(c)
+					if batch.Len() < logBatchSize {
+						continue
+					}
+					if s.err = flush(); s.err != nil {
+						return
+					}
+				default:
+					break drain
+				}
+			}
+			s.err = flush()
+			return
+		}
+		if s.err = flush(); s.err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package worker_test
+
+import (
+	"context"
+	"errors"
+	"github.com/wminshew/emrysclient/pkg/fakeserver"
+	"github.com/wminshew/emrysclient/pkg/worker"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// lostAckTransport delivers the first n log batches, then fails them as if the ack was lost
+type lostAckTransport struct {
+	next http.RoundTripper
+	mu   sync.Mutex
+	n    int
+}
+
+func (t *lostAckTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || req.Method != http.MethodPost || !strings.HasSuffix(req.URL.Path, "/log") {
+		return resp, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.n <= 0 {
+		return resp, err
+	}
+	t.n--
+	_ = resp.Body.Close()
+	return nil, errors.New("connection reset by peer")
+}
+
+func TestLogShipper(t *testing.T) {
+	big := strings.Repeat("x", worker.LogBatchSize)
+	tests := []struct {
+		name     string
+		storm    int
+		lostAcks int
+		// shipments are shipped in turn, each continuing from the sequence the previous one returned
+		shipments [][]string
+		// resumeFrom, if positive, restarts the last shipment from this sequence instead, as if
+		// the miner restarted before saving its record
+		resumeFrom int64
+		wantLog    string
+		wantSeq    int64
+		wantPosts  int
+	}{
+		{
+			name:      "coalesces a batch",
+			shipments: [][]string{{"epoch 1\n", "epoch 2\n", "epoch 3\n"}},
+			wantLog:   "epoch 1\nepoch 2\nepoch 3\n",
+			wantSeq:   1,
+			wantPosts: 1,
+		},
+		{
+			name:      "ships full batches early",
+			shipments: [][]string{{big, "tail\n"}},
+			wantLog:   big + "tail\n",
+			wantSeq:   2,
+			wantPosts: 2,
+		},
+		{
+			name:      "continues the sequence",
+			shipments: [][]string{{"epoch 1\n"}, {"epoch 2\n"}},
+			wantLog:   "epoch 1\nepoch 2\n",
+			wantSeq:   2,
+			wantPosts: 2,
+		},
+		{
+			name:       "server drops replayed batches",
+			shipments:  [][]string{{"epoch 1\n"}, {"epoch 2\n"}, {"epoch 2\n"}},
+			resumeFrom: 1,
+			wantLog:    "epoch 1\nepoch 2\n",
+			wantSeq:    2,
+			wantPosts:  3,
+		},
+		{
+			name:      "retries through a bad gateway storm",
+			storm:     2,
+			shipments: [][]string{{"epoch 1\n"}},
+			wantLog:   "epoch 1\n",
+			wantSeq:   1,
+			wantPosts: 3,
+		},
+		{
+			name:      "retries a batch whose ack was lost",
+			lostAcks:  1,
+			shipments: [][]string{{"epoch 1\n"}, {"epoch 2\n"}},
+			wantLog:   "epoch 1\nepoch 2\n",
+			wantSeq:   2,
+			wantPosts: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := fakeserver.DefaultScenario()
+			s.BadGatewayStorm = tt.storm
+			srv := fakeserver.New(s)
+			defer srv.Close()
+			jID, err := srv.PostJob("test", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			workdir, err := ioutil.TempDir("", "emrys-log-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(workdir)
+
+			client := srv.Client()
+			client.Transport = &lostAckTransport{next: client.Transport, n: tt.lostAcks}
+			w := &worker.Worker{
+				Client:    client,
+				AuthToken: &s.Token,
+				Workdir:   workdir,
+				ConfigDir: workdir,
+			}
+			var seq, offset, wantOffset int64
+			for i, chunks := range tt.shipments {
+				if i == len(tt.shipments)-1 && tt.resumeFrom > 0 {
+					seq = tt.resumeFrom
+				}
+				if seq, offset, err = w.ShipLog(context.Background(), srv.URL(), jID, seq, chunks); err != nil {
+					t.Fatal(err)
+				}
+				wantOffset = int64(len(strings.Join(chunks, "")))
+				if offset != wantOffset {
+					t.Errorf("shipment %d: log offset = %d, want %d", i, offset, wantOffset)
+				}
+			}
+
+			if seq != tt.wantSeq {
+				t.Errorf("log sequence = %d, want %d", seq, tt.wantSeq)
+			}
+			js, err := srv.Job(jID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(js.Log) != tt.wantLog {
+				t.Errorf("log = %.80q, want %.80q", js.Log, tt.wantLog)
+			}
+			if posts := srv.Hits("POST api.emrys.io /job/" + jID + "/log"); posts != tt.wantPosts {
+				t.Errorf("log posts = %d, want %d", posts, tt.wantPosts)
+			}
+		})
+	}
+}
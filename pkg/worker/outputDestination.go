@@ -0,0 +1,100 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cenkalti/backoff"
+	"github.com/wminshew/emrys/pkg/check"
+	"github.com/wminshew/emrysclient/pkg/s3"
+	"github.com/wminshew/emrysclient/pkg/wire"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// getOutputDestination returns the upload policy for the object store job jID's user wants its
+// output sent to, or nil if the output goes to the server
+func (w *Worker) getOutputDestination(ctx context.Context, u url.URL, jID string) (*s3.PostPolicy, error) {
+	dStr := strconv.Itoa(int(w.Device))
+	u.Path = path.Join("job", jID, "destination")
+	var dest *s3.PostPolicy
+	operation := func() error {
+		req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", *w.AuthToken))
+		req = req.WithContext(ctx)
+
+		resp, err := w.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer check.Err(resp.Body.Close)
+
+		if resp.StatusCode == http.StatusBadGateway {
+			return fmt.Errorf("server: temporary error")
+		} else if resp.StatusCode >= 300 {
+			b, _ := ioutil.ReadAll(resp.Body)
+			return backoff.Permanent(fmt.Errorf("server: %v", string(b)))
+		} else if resp.StatusCode == http.StatusNoContent {
+			return nil
+		}
+
+		dest = &s3.PostPolicy{}
+		if err := json.NewDecoder(resp.Body).Decode(dest); err != nil {
+			return backoff.Permanent(fmt.Errorf("decoding output destination: %v", err))
+		}
+		return nil
+	}
+	if err := backoff.RetryNotify(operation,
+		backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxRetries), ctx),
+		func(err error, t time.Duration) {
+			log.Printf("Device %s: error getting output destination: %v", dStr, err)
+			log.Printf("Device %s: retrying in %s seconds\n", dStr, t.Round(time.Second).String())
+		}); err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
+
+// uploadToDestination uploads every file in m from outputDir to dest, recording each object's URL in m
+func (w *Worker) uploadToDestination(ctx context.Context, dest *s3.PostPolicy, outputDir string, m *wire.OutputManifest) error {
+	dStr := strconv.Itoa(int(w.Device))
+	log.Printf("Device %s: uploading %d output file(s) to %s...\n", dStr, len(m.Files), dest.URL)
+	for i := range m.Files {
+		f := &m.Files[i]
+		operation := func() error {
+			file, err := os.Open(filepath.Join(outputDir, filepath.FromSlash(f.Path)))
+			if err != nil {
+				return backoff.Permanent(err)
+			}
+			defer check.Err(file.Close)
+
+			objectURL, err := dest.Upload(ctx, w.Client, f.Path, file, f.Size)
+			if uploadErr, ok := err.(*s3.UploadError); ok && uploadErr.StatusCode < 500 {
+				return backoff.Permanent(err)
+			} else if err != nil {
+				return err
+			}
+			f.URL = objectURL
+			return nil
+		}
+		if err := backoff.RetryNotify(operation,
+			backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxRetries), ctx),
+			func(err error, t time.Duration) {
+				log.Printf("Device %s: error uploading output file %s: %v", dStr, f.Path, err)
+				log.Printf("Device %s: retrying in %s seconds\n", dStr, t.Round(time.Second).String())
+			}); err != nil {
+			return fmt.Errorf("uploading %s: %v", f.Path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cenkalti/backoff"
+	"github.com/wminshew/emrys/pkg/check"
+	"github.com/wminshew/emrysclient/pkg/poll"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+)
+
+// pollJobCanceled long-polls the server for the cancellation of job jID since since. The returned
+// channel is closed if the job is canceled; the returned func stops polling & must be called
+func (w *Worker) pollJobCanceled(ctx context.Context, u url.URL, jID string, since time.Time) (<-chan struct{}, func()) {
+	dStr := strconv.Itoa(int(w.Device))
+	jobFinished := make(chan struct{})
+	jobCanceled := make(chan struct{})
+	go func(u url.URL) {
+		// poll to check if job is canceled
+		p := path.Join("job", jID, "cancel")
+		u.Path = p
+		q := u.Query()
+		q.Set("timeout", fmt.Sprintf("%d", maxTimeout))
+		sinceTime := since.Unix() * 1000
+		q.Set("since_time", fmt.Sprintf("%d", sinceTime))
+		u.RawQuery = q.Encode()
+		for {
+			if err := check.ContextCanceled(ctx); err != nil {
+				log.Printf("Device %s: miner canceled job execution: %v", dStr, err)
+				return
+			}
+			select {
+			case <-jobFinished:
+				return
+			default:
+			}
+			pr := poll.Response{}
+			operation := func() error {
+				req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+				if err != nil {
+					return err
+				}
+				req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", *w.AuthToken))
+				req = req.WithContext(ctx)
+
+				resp, err := w.Client.Do(req)
+				if err != nil {
+					return err
+				}
+				defer check.Err(resp.Body.Close)
+
+				if resp.StatusCode == http.StatusBadGateway {
+					return fmt.Errorf("server: temporary error")
+				} else if resp.StatusCode >= 300 {
+					b, _ := ioutil.ReadAll(resp.Body)
+					return fmt.Errorf("server: %v", string(b))
+				}
+
+				if err := json.NewDecoder(resp.Body).Decode(&pr); err != nil {
+					return fmt.Errorf("decoding response: %v", err)
+				}
+
+				return nil
+			}
+			if err := backoff.RetryNotify(operation,
+				backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxRetries), ctx),
+				func(err error, t time.Duration) {
+					log.Printf("Device %s: error polling job canceled: %v", dStr, err)
+					log.Printf("Device %s: retrying in %s seconds\n", dStr, t.Round(time.Second).String())
+				}); err != nil {
+				log.Printf("Device %s: error polling job canceled: %v", dStr, err)
+			}
+
+			if len(pr.Events) > 0 {
+				close(jobCanceled)
+				return
+			}
+
+			if pr.Timestamp > sinceTime {
+				sinceTime = pr.Timestamp
+			}
+
+			q = u.Query()
+			q.Set("since_time", fmt.Sprintf("%d", sinceTime))
+			u.RawQuery = q.Encode()
+		}
+	}(u)
+	return jobCanceled, func() { close(jobFinished) }
+}
@@ -0,0 +1,26 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+)
+
+// prepareNetwork ensures the job network for policy exists & is firewalled, returning
+// the network to attach the job container to
+func (w *Worker) prepareNetwork(ctx context.Context, policy NetworkPolicy) (string, error) {
+	network := policy.network()
+	if network == NetworkNone {
+		return network, nil
+	}
+
+	subnet, err := w.Runtime.NetworkEnsure(ctx, network)
+	if err != nil {
+		return "", err
+	}
+	if w.Firewall != nil {
+		if err := w.Firewall.Apply(ctx, network, subnet, network, policy); err != nil {
+			return "", fmt.Errorf("applying network policy %s: %v", policy, err)
+		}
+	}
+	return network, nil
+}
@@ -0,0 +1,53 @@
+package worker
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+const (
+	xfsQuotaCmd   = "xfs_quota"
+	xfsSuperMagic = 0x58465342
+	// projectIDBase offsets the xfs project ids used for job dirs from any the operator assigns
+	projectIDBase = 0x454d0000
+)
+
+// setProjectQuota limits dir to limit bytes with an xfs project quota, returning a func
+// that clears it. It returns a nil func if dir isn't on xfs; the quota fails to apply
+// if the filesystem isn't mounted with prjquota
+func setProjectQuota(dir string, id uint32, limit uint64) (func() error, error) {
+	statfs := syscall.Statfs_t{}
+	if err := syscall.Statfs(dir, &statfs); err != nil {
+		return nil, fmt.Errorf("statfs %s: %v", dir, err)
+	}
+	if statfs.Type != xfsSuperMagic {
+		return nil, nil
+	}
+	mount, err := MountPoint(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	projectID := fmt.Sprintf("%d", projectIDBase+id)
+	if err := xfsQuota(mount, fmt.Sprintf("project -s -p %s %s", dir, projectID)); err != nil {
+		return nil, err
+	}
+	if err := xfsQuota(mount, fmt.Sprintf("limit -p bhard=%d %s", limit, projectID)); err != nil {
+		return nil, err
+	}
+	return func() error {
+		if err := xfsQuota(mount, fmt.Sprintf("limit -p bhard=0 %s", projectID)); err != nil {
+			return err
+		}
+		return xfsQuota(mount, fmt.Sprintf("project -C -p %s %s", dir, projectID))
+	}, nil
+}
+
+func xfsQuota(mount, command string) error {
+	if _, err := exec.Command(xfsQuotaCmd, "-x", "-c", command, mount).Output(); err != nil {
+		return fmt.Errorf("%s %s: %v", xfsQuotaCmd, strings.Fields(command)[0], cmdErr(err))
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package worker
+
+import (
+	"context"
+	"github.com/wminshew/emrys/pkg/check"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"strconv"
+)
+
+// runJob ships the log of rec's started container to the server, skipping the rec.LogOffset bytes
+// already uploaded, then uploads the job's output. The record's log offset & sequence are saved as
+// the log is shipped so the job can be resumed if the miner restarts
+func (w *Worker) runJob(ctx context.Context, u url.URL, rec *jobRecord, jobCanceled <-chan struct{}, sshKeyFile string) {
+	dStr := strconv.Itoa(int(w.Device))
+	jID, cID := rec.JobID, rec.ContainerID
+	out, err := w.Runtime.ContainerLogs(ctx, cID)
+	if err != nil {
+		log.Printf("Device %s: error logging container: %v", dStr, err)
+		return
+	}
+	defer check.Err(out.Close)
+
+	if rec.Notebook {
+		log.Printf("Device %s: forwarding port...\n", dStr)
+		sshCmd := w.sshRemoteForward(ctx, sshKeyFile)
+		if err = sshCmd.Start(); err != nil {
+			log.Printf("Device %s: error remote forwarding notebook requests: %v", dStr, err)
+			return
+		}
+		defer func() {
+			if err := sshCmd.Process.Kill(); err != nil {
+				log.Printf("Device %s: error killing remote forwarding process: %v", dStr, err)
+				return
+			}
+		}()
+	}
+
+	log.Printf("Device %s: uploading log...\n", dStr)
+	shipCtx, stopShipping := context.WithCancel(ctx)
+	defer stopShipping()
+	shipper := w.newLogShipper(shipCtx, u, rec)
+	logErrCh := make(chan error, 1)
+	go func() {
+		if rec.LogOffset > 0 {
+			if _, err := io.CopyN(ioutil.Discard, out, rec.LogOffset); err != nil {
+				logErrCh <- err
+				return
+			}
+		}
+		body := make([]byte, 4096)
+		for {
+			n, err := out.Read(body)
+			if n > 0 {
+				// blocks while the shipper is backed up; shipping errors are handled by the job loop
+				if shipper.send(shipCtx, string(body[:n]), true) != nil {
+					return
+				}
+			}
+			if err != nil {
+				logErrCh <- err
+				return
+			}
+		}
+	}()
+
+	watchCtx, stopWatching := context.WithCancel(ctx)
+	defer stopWatching()
+	noticeCh := make(chan string)
+	go w.watchDisk(watchCtx, cID, rec.JobDir, rec.Disk, noticeCh)
+	settings := w.Settings()
+	go w.syncOutput(watchCtx, u, rec, settings.OutputSyncInterval, settings.OutputSyncThreshold)
+
+	jCanceled := false
+	quotaExceeded := false
+loop:
+	for {
+		select {
+		case <-jobCanceled:
+			log.Printf("Device %s: job canceled by user...\n", dStr)
+			jCanceled = true
+			// stop the job so its output doesn't change while it's packed & uploaded
+			if err := w.Runtime.ContainerKill(ctx, cID); err != nil {
+				log.Printf("Device %s: error stopping container: %v", dStr, err)
+			}
+			quotaExceeded = w.takeDiskQuotaExceeded()
+			msg := "JOB CANCELED BY USER.\n"
+			if quotaExceeded {
+				msg = "JOB CANCELED: USER EXCEEDED DISK QUOTA\n"
+			}
+			if err := shipper.send(ctx, msg, false); err != nil {
+				log.Printf("Device %s: error uploading log: %v", dStr, err)
+				return
+			}
+			break loop
+		case err := <-logErrCh:
+			if err != io.EOF {
+				log.Printf("Device %s: error reading container logs: %v", dStr, err)
+				return
+			}
+			quotaExceeded = w.takeDiskQuotaExceeded()
+			break loop
+		case notice := <-noticeCh:
+			if err := shipper.send(ctx, notice, false); err != nil {
+				log.Printf("Device %s: error uploading log: %v", dStr, err)
+				return
+			}
+		case <-shipper.done():
+			if err := check.ContextCanceled(ctx); err != nil {
+				log.Printf("Device %s: miner canceled job execution: %v", dStr, err)
+				return
+			}
+			log.Printf("Device %s: error uploading log: %v", dStr, shipper.close())
+			return
+		}
+	}
+	if err := shipper.close(); err != nil {
+		log.Printf("Device %s: error uploading log: %v", dStr, err)
+		return
+	}
+
+	stopWatching()
+	if err := w.transition(StateUploading, ""); err != nil {
+		log.Printf("Device %s: %v", dStr, err)
+		return
+	}
+	// POST with empty body signifies log upload complete
+	if err := w.postLog(ctx, u, jID, "", 0); err != nil {
+		log.Printf("Device %s: error uploading log: %v", dStr, err)
+		return
+	}
+	log.Printf("Device %s: log uploaded!\n", dStr)
+
+	if err := check.ContextCanceled(ctx); err != nil {
+		log.Printf("Device %s: miner canceled job execution: %v", dStr, err)
+		return
+	}
+	log.Printf("Device %s: uploading data...\n", dStr)
+	q := url.Values{}
+	if jCanceled {
+		q.Set("jobcanceled", "1")
+	}
+	if quotaExceeded {
+		q.Set("diskquotaexceeded", "1")
+	}
+	if err := w.uploadOutput(ctx, u, jID, rec.OutputDir, q); err != nil {
+		log.Printf("Device %s: error uploading output: %v", dStr, err)
+		return
+	}
+
+	log.Printf("Device %s: job completed!\n", dStr)
+}
@@ -0,0 +1,137 @@
+package worker
+
+import (
+	"encoding/json"
+)
+
+// seccompAllowed is derived from docker's default profile, minus syscalls that need
+// capabilities job containers never have (mount, bpf, ptrace, keyctl, namespace
+// creation, kernel modules, clock setting, etc.)
+var seccompAllowed = []string{
+	"accept", "accept4", "access", "alarm", "arch_prctl", "bind", "brk", "capget", "capset",
+	"chdir", "chmod", "chown", "chown32", "clock_getres", "clock_getres_time64", "clock_gettime",
+	"clock_gettime64", "clock_nanosleep", "clock_nanosleep_time64", "close", "close_range", "connect",
+	"copy_file_range", "creat", "dup", "dup2", "dup3", "epoll_create", "epoll_create1", "epoll_ctl",
+	"epoll_ctl_old", "epoll_pwait", "epoll_pwait2", "epoll_wait", "epoll_wait_old", "eventfd", "eventfd2",
+	"execve", "execveat", "exit", "exit_group", "faccessat", "faccessat2", "fadvise64", "fadvise64_64",
+	"fallocate", "fchdir", "fchmod", "fchmodat", "fchown", "fchown32", "fchownat", "fcntl", "fcntl64",
+	"fdatasync", "fgetxattr", "flistxattr", "flock", "fork", "fremovexattr", "fsetxattr", "fstat",
+	"fstat64", "fstatat64", "fstatfs", "fstatfs64", "fsync", "ftruncate", "ftruncate64", "futex",
+	"futex_time64", "futex_waitv", "futimesat", "get_robust_list", "get_thread_area", "getcpu", "getcwd",
+	"getdents", "getdents64", "getegid", "getegid32", "geteuid", "geteuid32", "getgid", "getgid32",
+	"getgroups", "getgroups32", "getitimer", "getpeername", "getpgid", "getpgrp", "getpid", "getppid",
+	"getpriority", "getrandom", "getresgid", "getresgid32", "getresuid", "getresuid32", "getrlimit",
+	"getrusage", "getsid", "getsockname", "getsockopt", "gettid", "gettimeofday", "getuid", "getuid32",
+	"getxattr", "inotify_add_watch", "inotify_init", "inotify_init1", "inotify_rm_watch", "io_cancel",
+	"io_destroy", "io_getevents", "io_pgetevents", "io_pgetevents_time64", "io_setup", "io_submit",
+	"ioctl", "ioprio_get", "ioprio_set", "ipc", "kill", "lchown", "lchown32", "lgetxattr", "link",
+	"linkat", "listen", "listxattr", "llistxattr", "_llseek", "lremovexattr", "lseek", "lsetxattr",
+	"lstat", "lstat64", "madvise", "membarrier", "memfd_create", "mincore", "mkdir", "mkdirat",
+	"mlock", "mlock2", "mlockall", "mmap", "mmap2", "mprotect", "mq_getsetattr", "mq_notify",
+	"mq_open", "mq_timedreceive", "mq_timedreceive_time64", "mq_timedsend", "mq_timedsend_time64",
+	"mq_unlink", "mremap", "msgctl", "msgget", "msgrcv", "msgsnd", "msync", "munlock", "munlockall",
+	"munmap", "nanosleep", "newfstatat", "_newselect", "open", "openat", "openat2", "pause",
+	"pidfd_open", "pidfd_send_signal", "pipe", "pipe2", "pkey_alloc", "pkey_free", "pkey_mprotect",
+	"poll", "ppoll", "ppoll_time64", "prctl", "pread64", "preadv", "preadv2", "prlimit64", "pselect6",
+	"pselect6_time64", "pwrite64", "pwritev", "pwritev2", "read", "readahead", "readlink", "readlinkat",
+	"readv", "recv", "recvfrom", "recvmmsg", "recvmmsg_time64", "recvmsg", "remap_file_pages",
+	"removexattr", "rename", "renameat", "renameat2", "restart_syscall", "rmdir", "rseq",
+	"rt_sigaction", "rt_sigpending", "rt_sigprocmask", "rt_sigqueueinfo", "rt_sigreturn",
+	"rt_sigsuspend", "rt_sigtimedwait", "rt_sigtimedwait_time64", "rt_tgsigqueueinfo",
+	"sched_get_priority_max", "sched_get_priority_min", "sched_getaffinity", "sched_getattr",
+	"sched_getparam", "sched_getscheduler", "sched_rr_get_interval", "sched_rr_get_interval_time64",
+	"sched_setaffinity", "sched_setattr", "sched_setparam", "sched_setscheduler", "sched_yield",
+	"seccomp", "select", "semctl", "semget", "semop", "semtimedop", "semtimedop_time64", "send",
+	"sendfile", "sendfile64", "sendmmsg", "sendmsg", "sendto", "set_robust_list", "set_thread_area",
+	"set_tid_address", "setfsgid", "setfsgid32", "setfsuid", "setfsuid32", "setgid", "setgid32",
+	"setgroups", "setgroups32", "setitimer", "setpgid", "setpriority", "setregid", "setregid32",
+	"setresgid", "setresgid32", "setresuid", "setresuid32", "setreuid", "setreuid32", "setrlimit",
+	"setsid", "setsockopt", "setuid", "setuid32", "setxattr", "shmat", "shmctl", "shmdt", "shmget",
+	"shutdown", "sigaltstack", "signalfd", "signalfd4", "sigprocmask", "sigreturn", "socket",
+	"socketcall", "socketpair", "splice", "stat", "stat64", "statfs", "statfs64", "statx", "symlink",
+	"symlinkat", "sync", "sync_file_range", "syncfs", "sysinfo", "tee", "tgkill", "time",
+	"timer_create", "timer_delete", "timer_getoverrun", "timer_gettime", "timer_gettime64",
+	"timer_settime", "timer_settime64", "timerfd_create", "timerfd_gettime", "timerfd_gettime64",
+	"timerfd_settime", "timerfd_settime64", "times", "tkill", "truncate", "truncate64", "ugetrlimit",
+	"umask", "uname", "unlink", "unlinkat", "utime", "utimensat", "utimensat_time64", "utimes", "vfork",
+	"vmsplice", "wait4", "waitid", "waitpid", "write", "writev",
+}
+
+const (
+	// cloneNamespaceFlags are CLONE_NEWNS|CLONE_NEWUTS|CLONE_NEWIPC|CLONE_NEWUSER|CLONE_NEWPID|
+	// CLONE_NEWNET|CLONE_NEWCGROUP; clone is only allowed without them
+	cloneNamespaceFlags = 0x7E020000
+	enosys              = 38
+)
+
+type seccompProfile struct {
+	DefaultAction string               `json:"defaultAction"`
+	ArchMap       []seccompArch        `json:"archMap"`
+	Syscalls      []seccompSyscallRule `json:"syscalls"`
+}
+
+type seccompArch struct {
+	Architecture     string   `json:"architecture"`
+	SubArchitectures []string `json:"subArchitectures"`
+}
+
+type seccompSyscallRule struct {
+	Names    []string     `json:"names"`
+	Action   string       `json:"action"`
+	ErrnoRet uint         `json:"errnoRet,omitempty"`
+	Args     []seccompArg `json:"args,omitempty"`
+}
+
+type seccompArg struct {
+	Index    uint   `json:"index"`
+	Value    uint64 `json:"value"`
+	ValueTwo uint64 `json:"valueTwo"`
+	Op       string `json:"op"`
+}
+
+// bundledSeccompProfile returns the json seccomp profile used by SeccompBundled
+func bundledSeccompProfile() (string, error) {
+	rules := []seccompSyscallRule{
+		{
+			Names:  seccompAllowed,
+			Action: "SCMP_ACT_ALLOW",
+		},
+		{
+			Names:  []string{"clone"},
+			Action: "SCMP_ACT_ALLOW",
+			Args: []seccompArg{
+				{Index: 0, Value: cloneNamespaceFlags, ValueTwo: 0, Op: "SCMP_CMP_MASKED_EQ"},
+			},
+		},
+		{
+			// clone3's flags can't be filtered, so make libc fall back to clone
+			Names:    []string{"clone3"},
+			Action:   "SCMP_ACT_ERRNO",
+			ErrnoRet: enosys,
+		},
+	}
+	// personality is only allowed to query or set the default execution domains
+	for _, persona := range []uint64{0x0, 0x8, 0x20000, 0x20008, 0xffffffff} {
+		rules = append(rules, seccompSyscallRule{
+			Names:  []string{"personality"},
+			Action: "SCMP_ACT_ALLOW",
+			Args: []seccompArg{
+				{Index: 0, Value: persona, Op: "SCMP_CMP_EQ"},
+			},
+		})
+	}
+
+	b, err := json.Marshal(seccompProfile{
+		DefaultAction: "SCMP_ACT_ERRNO",
+		ArchMap: []seccompArch{
+			{Architecture: "SCMP_ARCH_X86_64", SubArchitectures: []string{"SCMP_ARCH_X86", "SCMP_ARCH_X32"}},
+			{Architecture: "SCMP_ARCH_AARCH64", SubArchitectures: []string{"SCMP_ARCH_ARM"}},
+			{Architecture: "SCMP_ARCH_PPC64LE", SubArchitectures: []string{"SCMP_ARCH_PPC64", "SCMP_ARCH_PPC"}},
+		},
+		Syscalls: rules,
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
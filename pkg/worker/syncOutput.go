@@ -0,0 +1,100 @@
+package worker
+
+import (
+	"context"
+	"github.com/dustin/go-humanize"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// outputSyncPoll is how often the output dir is scanned for new or changed files
+const outputSyncPoll = 10 * time.Second
+
+// outputFile identifies a version of a file in the output dir
+type outputFile struct {
+	size    int64
+	modTime int64
+}
+
+// syncOutput uploads new & changed files in job rec's output dir as checkpoints while the job runs,
+// so they survive if the job doesn't. Files are uploaded once they haven't changed for a poll, when
+// interval has passed since the last checkpoint or threshold bytes are waiting to be uploaded.
+// Syncing is disabled if interval is zero
+func (w *Worker) syncOutput(ctx context.Context, u url.URL, rec *jobRecord, interval time.Duration, threshold uint64) {
+	if interval <= 0 {
+		return
+	}
+	dStr := strconv.Itoa(int(w.Device))
+	uploaded := make(map[string]outputFile)
+	prev := make(map[string]outputFile)
+	lastSync := time.Now()
+	ticker := time.NewTicker(outputSyncPoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cur, err := scanOutput(rec.OutputDir)
+		if err != nil {
+			log.Printf("Device %s: error scanning output dir: %v", dStr, err)
+			continue
+		}
+		pending := []string{}
+		var pendingBytes uint64
+		for rel, f := range cur {
+			// files still being written are left for the next poll
+			if uploaded[rel] == f || prev[rel] != f {
+				continue
+			}
+			pending = append(pending, rel)
+			pendingBytes += uint64(f.size)
+		}
+		prev = cur
+		if len(pending) == 0 || (time.Since(lastSync) < interval && pendingBytes < threshold) {
+			continue
+		}
+
+		sort.Strings(pending)
+		log.Printf("Device %s: uploading checkpoint of %d output file(s) (%s)...\n", dStr, len(pending), humanize.Bytes(pendingBytes))
+		if err := w.uploadCheckpoint(ctx, u, rec.JobID, rec.OutputDir, pending); err != nil {
+			log.Printf("Device %s: error uploading checkpoint: %v", dStr, err)
+			continue
+		}
+		for _, rel := range pending {
+			uploaded[rel] = cur[rel]
+		}
+		lastSync = time.Now()
+	}
+}
+
+// scanOutput returns the regular files under outputDir, keyed by their path relative to it
+func scanOutput(outputDir string) (map[string]outputFile, error) {
+	files := make(map[string]outputFile)
+	err := filepath.Walk(outputDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			// files the job removes mid-walk are skipped
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(outputDir, p)
+		if err != nil {
+			return err
+		}
+		files[rel] = outputFile{size: info.Size(), modTime: info.ModTime().UnixNano()}
+		return nil
+	})
+	return files, err
+}
@@ -0,0 +1,58 @@
+package worker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestScanOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "emrys-output-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"model.pt":             "weights",
+		"checkpoints/1/opt.pt": "state",
+		"empty.log":            "",
+	}
+	for rel, body := range files {
+		p := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("model.pt", filepath.Join(dir, "latest.pt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	scanned, err := scanOutput(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes := map[string]int64{}
+	for rel, f := range scanned {
+		sizes[filepath.ToSlash(rel)] = f.size
+		if f.modTime == 0 {
+			t.Errorf("%s has no modification time", rel)
+		}
+	}
+	want := map[string]int64{"model.pt": 7, "checkpoints/1/opt.pt": 5, "empty.log": 0}
+	if !reflect.DeepEqual(sizes, want) {
+		t.Errorf("scanned sizes = %v, want %v", sizes, want)
+	}
+
+	// a missing output dir has no files
+	if scanned, err := scanOutput(filepath.Join(dir, "missing")); err != nil || len(scanned) != 0 {
+		t.Errorf("scanning a missing dir = %v, %v, want no files", scanned, err)
+	}
+}
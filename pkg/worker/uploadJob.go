@@ -0,0 +1,269 @@
+package worker
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cenkalti/backoff"
+	"github.com/mholt/archiver"
+	"github.com/wminshew/emrys/pkg/check"
+	"github.com/wminshew/emrysclient/pkg/wire"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// postLog appends logStr to job jID's log. An empty logStr signifies the log upload is complete.
+// A non-zero seq numbers the batch so the server can ignore it if it was already appended
+func (w *Worker) postLog(ctx context.Context, u url.URL, jID, logStr string, seq int64) error {
+	dStr := strconv.Itoa(int(w.Device))
+	u.Path = path.Join("job", jID, "log")
+	if seq > 0 {
+		q := url.Values{}
+		q.Set("seq", strconv.FormatInt(seq, 10))
+		u.RawQuery = q.Encode()
+	}
+	operation := func() error {
+		var body io.Reader
+		if logStr != "" {
+			body = strings.NewReader(logStr)
+		}
+		req, err := http.NewRequest(http.MethodPost, u.String(), body)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", *w.AuthToken))
+		req = req.WithContext(ctx)
+
+		resp, err := w.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer check.Err(resp.Body.Close)
+
+		if resp.StatusCode == http.StatusBadGateway {
+			return fmt.Errorf("server: temporary error")
+		} else if resp.StatusCode >= 300 {
+			b, _ := ioutil.ReadAll(resp.Body)
+			return fmt.Errorf("server: %v", string(b))
+		}
+
+		return nil
+	}
+	return backoff.RetryNotify(operation,
+		backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxRetries), ctx),
+		func(err error, t time.Duration) {
+			log.Printf("Device %s: error uploading log: %v", dStr, err)
+			log.Printf("Device %s: retrying in %s seconds\n", dStr, t.Round(time.Second).String())
+		})
+}
+
+// uploadOutput uploads the contents of outputDir as job jID's output, preceded by its manifest.
+// If the job's user set an output destination, the files are uploaded straight to it & only
+// the manifest, with the files' URLs, goes to the server. query flags how the job ended
+func (w *Worker) uploadOutput(ctx context.Context, u url.URL, jID, outputDir string, query url.Values) error {
+	dStr := strconv.Itoa(int(w.Device))
+	m, err := wire.BuildOutputManifest(outputDir)
+	if err != nil {
+		return fmt.Errorf("building output manifest: %v", err)
+	}
+	dest, err := w.getOutputDestination(ctx, u, jID)
+	if err != nil {
+		return fmt.Errorf("getting output destination: %v", err)
+	}
+	if dest != nil {
+		if err := w.uploadToDestination(ctx, dest, outputDir, m); err != nil {
+			return fmt.Errorf("uploading output to destination: %v", err)
+		}
+		query.Set("external", "1")
+	}
+	if err := w.uploadManifest(ctx, u, jID, m); err != nil {
+		return fmt.Errorf("uploading output manifest: %v", err)
+	}
+
+	u.Path = path.Join("job", jID, "data")
+	u.RawQuery = query.Encode()
+	operation := func() error {
+		var body io.Reader
+		if dest == nil {
+			pr, pw := io.Pipe()
+			body = pr
+			go w.packOutput(pw, outputDir)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, u.String(), body)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", *w.AuthToken))
+		req = req.WithContext(ctx)
+
+		resp, err := w.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer check.Err(resp.Body.Close)
+
+		if resp.StatusCode == http.StatusBadGateway {
+			return fmt.Errorf("server: temporary error")
+		} else if resp.StatusCode >= 300 {
+			b, _ := ioutil.ReadAll(resp.Body)
+			return fmt.Errorf("server: %v", string(b))
+		}
+
+		return nil
+	}
+	return backoff.RetryNotify(operation,
+		backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxRetries), ctx),
+		func(err error, t time.Duration) {
+			log.Printf("Device %s: error uploading output: %v", dStr, err)
+			log.Printf("Device %s: retrying in %s seconds\n", dStr, t.Round(time.Second).String())
+		})
+}
+
+// packOutput writes the contents of outputDir to pw as a .tar.gz
+func (w *Worker) packOutput(pw *io.PipeWriter, outputDir string) {
+	dStr := strconv.Itoa(int(w.Device))
+	defer check.Err(pw.Close)
+	files, err := ioutil.ReadDir(outputDir)
+	outputFiles := make([]string, 0, len(files))
+	if err != nil {
+		log.Printf("Device %s: error uploading output: reading files in output directory %v: %v\n", dStr, outputDir, err)
+		return
+	}
+	for _, file := range files {
+		outputFile := filepath.Join(outputDir, file.Name())
+		outputFiles = append(outputFiles, outputFile)
+	}
+	if err = archiver.TarGz.Write(pw, outputFiles); err != nil {
+		log.Printf("Device %s: error uploading output: packing output directory %v: %v\n", dStr, outputDir, err)
+		return
+	}
+}
+
+// uploadManifest uploads m as the manifest of job jID's output
+func (w *Worker) uploadManifest(ctx context.Context, u url.URL, jID string, m *wire.OutputManifest) error {
+	dStr := strconv.Itoa(int(w.Device))
+	u.Path = path.Join("job", jID, "manifest")
+	b, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("encoding manifest: %v", err)
+	}
+	operation := func() error {
+		req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(b))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", *w.AuthToken))
+		req.Header.Set("Content-Type", "application/json")
+		req = req.WithContext(ctx)
+
+		resp, err := w.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer check.Err(resp.Body.Close)
+
+		if resp.StatusCode == http.StatusBadGateway {
+			return fmt.Errorf("server: temporary error")
+		} else if resp.StatusCode >= 300 {
+			b, _ := ioutil.ReadAll(resp.Body)
+			return fmt.Errorf("server: %v", string(b))
+		}
+
+		return nil
+	}
+	return backoff.RetryNotify(operation,
+		backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxRetries), ctx),
+		func(err error, t time.Duration) {
+			log.Printf("Device %s: error uploading output manifest: %v", dStr, err)
+			log.Printf("Device %s: retrying in %s seconds\n", dStr, t.Round(time.Second).String())
+		})
+}
+
+// uploadCheckpoint uploads the files rels, relative to outputDir, as a checkpoint of job jID's output
+func (w *Worker) uploadCheckpoint(ctx context.Context, u url.URL, jID, outputDir string, rels []string) error {
+	dStr := strconv.Itoa(int(w.Device))
+	u.Path = path.Join("job", jID, "checkpoint")
+	operation := func() error {
+		pr, pw := io.Pipe()
+		go func() {
+			_ = pw.CloseWithError(writeTarGz(pw, outputDir, rels))
+		}()
+
+		req, err := http.NewRequest(http.MethodPost, u.String(), pr)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", *w.AuthToken))
+		req = req.WithContext(ctx)
+
+		resp, err := w.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer check.Err(resp.Body.Close)
+
+		if resp.StatusCode == http.StatusBadGateway {
+			return fmt.Errorf("server: temporary error")
+		} else if resp.StatusCode >= 300 {
+			b, _ := ioutil.ReadAll(resp.Body)
+			return fmt.Errorf("server: %v", string(b))
+		}
+
+		return nil
+	}
+	return backoff.RetryNotify(operation,
+		backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxRetries), ctx),
+		func(err error, t time.Duration) {
+			log.Printf("Device %s: error uploading checkpoint: %v", dStr, err)
+			log.Printf("Device %s: retrying in %s seconds\n", dStr, t.Round(time.Second).String())
+		})
+}
+
+// writeTarGz writes the files rels, relative to dir, to w as a .tar.gz keeping their relative paths
+func writeTarGz(w io.Writer, dir string, rels []string) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, rel := range rels {
+		if err := func() error {
+			f, err := os.Open(filepath.Join(dir, rel))
+			if err != nil {
+				return err
+			}
+			defer check.Err(f.Close)
+			fi, err := f.Stat()
+			if err != nil {
+				return err
+			}
+			hdr, err := tar.FileInfoHeader(fi, "")
+			if err != nil {
+				return err
+			}
+			hdr.Name = filepath.ToSlash(rel)
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			// the file may grow while it's copied; the header's size is all that's sent
+			_, err = io.CopyN(tw, f, hdr.Size)
+			return err
+		}(); err != nil {
+			return fmt.Errorf("packing %s: %v", rel, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
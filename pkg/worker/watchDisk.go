@@ -0,0 +1,88 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"github.com/dustin/go-humanize"
+	"log"
+	"time"
+)
+
+const (
+	diskWatchPeriod = 15 * time.Second
+	// diskWarnFraction of a job's disk allocation triggers a warning in the job log
+	diskWarnFraction = 0.9
+	// rootfsDiskShare of a job's disk allocation, after its data, is left for its container's writable
+	// layer; the rest is for its output. Root filesystems are read-only by default, so it's small
+	rootfsDiskShare = 0.25
+)
+
+// watchDisk periodically totals the disk used by container cID & the job's dir. Jobs are
+// warned through notices when they near limit & killed once they exceed it
+func (w *Worker) watchDisk(ctx context.Context, cID, jobDir string, limit uint64, notices chan<- string) {
+	warned := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(diskWatchPeriod):
+		}
+
+		used, err := w.jobDiskUsage(ctx, cID, jobDir)
+		if err != nil {
+			log.Printf("Device %d: disk watchdog: %v", w.Device, err)
+			continue
+		}
+
+		if used > limit {
+			log.Printf("Device %d: job exceeded its disk allocation (%s > %s); stopping container...\n",
+				w.Device, humanize.Bytes(used), humanize.Bytes(limit))
+			w.flagDiskQuotaExceeded()
+			select {
+			case <-ctx.Done():
+				return
+			case notices <- fmt.Sprintf("\nJOB STOPPED: DISK QUOTA EXCEEDED (%s used > %s allocated)\n", humanize.Bytes(used), humanize.Bytes(limit)):
+			}
+			if err := w.Runtime.ContainerKill(ctx, cID); err != nil {
+				log.Printf("Device %d: disk watchdog: error stopping container: %v", w.Device, err)
+			}
+			return
+		}
+
+		if !warned && float64(used) > diskWarnFraction*float64(limit) {
+			warned = true
+			log.Printf("Device %d: job is nearing its disk allocation (%s of %s)\n", w.Device, humanize.Bytes(used), humanize.Bytes(limit))
+			select {
+			case <-ctx.Done():
+				return
+			case notices <- fmt.Sprintf("\nWARNING: JOB IS USING %s OF ITS %s DISK QUOTA AND WILL BE STOPPED IF IT EXCEEDS IT\n", humanize.Bytes(used), humanize.Bytes(limit)):
+			}
+		}
+	}
+}
+
+// jobDiskUsage returns the disk written by container cID, plus the job's dir holding its data &
+// output. The image isn't counted: its layers are shared & were accounted for when it was pulled
+func (w *Worker) jobDiskUsage(ctx context.Context, cID, jobDir string) (uint64, error) {
+	containerDisk, err := w.Runtime.ContainerDiskUsage(ctx, cID)
+	if err != nil {
+		return 0, fmt.Errorf("getting container disk usage: %v", err)
+	}
+	sizeJobDir, err := GetDirSize(jobDir)
+	if err != nil {
+		return 0, fmt.Errorf("getting directory size: job folder: %v", err)
+	}
+	return uint64(containerDisk.SizeRw + sizeJobDir), nil
+}
+
+// splitDiskQuota divides a job's disk allocation between its job dir, which holds sizeDataDir
+// bytes of data plus its output, & its container's writable layer, so the two quotas together
+// never exceed the allocation. The writable layer gets rootfsDiskShare of what's left after the data
+func splitDiskQuota(disk uint64, sizeDataDir int64) (jobDirQuota uint64, rootfsQuota int64) {
+	free := int64(disk) - sizeDataDir
+	if free <= 0 {
+		return disk, 0
+	}
+	rootfsQuota = int64(float64(free) * rootfsDiskShare)
+	return disk - uint64(rootfsQuota), rootfsQuota
+}
@@ -0,0 +1,31 @@
+package worker
+
+import (
+	"testing"
+)
+
+func TestSplitDiskQuota(t *testing.T) {
+	tests := []struct {
+		name        string
+		disk        uint64
+		sizeDataDir int64
+		jobDir      uint64
+		rootfs      int64
+	}{
+		{"no data", 1000, 0, 750, 250},
+		{"some data", 1000, 200, 800, 200},
+		{"data fills allocation", 1000, 1000, 1000, 0},
+		{"data exceeds allocation", 1000, 1200, 1000, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobDir, rootfs := splitDiskQuota(tt.disk, tt.sizeDataDir)
+			if jobDir != tt.jobDir || rootfs != tt.rootfs {
+				t.Errorf("splitDiskQuota(%d, %d) = %d, %d, want %d, %d", tt.disk, tt.sizeDataDir, jobDir, rootfs, tt.jobDir, tt.rootfs)
+			}
+			if rootfs > 0 && jobDir+uint64(rootfs) != tt.disk {
+				t.Errorf("quotas total %d, want the allocation %d", jobDir+uint64(rootfs), tt.disk)
+			}
+		})
+	}
+}